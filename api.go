@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // LAUNCH_LINK_TIMEZONE is loaded in containers without a zoneinfo database
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// errorInvalidRequest is the API error code for a request body which can't be used
+const errorInvalidRequest = "invalid_request"
+
+// summaryClaims are the claims included in the claims_summary of a launch response
+var summaryClaims = []string{
+	"schema_name", "survey_url", "schema_url", "version", "tx_id", "jti", "roles", "ru_ref", "case_id",
+	"collection_exercise_sid", "response_id", "questionnaire_id", "language_code", "channel",
+}
+
+type tokenRequest struct {
+	SchemaName string                 `json:"schema_name"`
+	SchemaURL  string                 `json:"schema_url"`
+	Persona    string                 `json:"persona"`
+	Claims     map[string]interface{} `json:"claims"`
+	Options    tokenRequestOptions    `json:"options"`
+}
+
+type tokenRequestOptions struct {
+	// Encrypt defaults to true when not given.
+	Encrypt *bool `json:"encrypt"`
+
+	// Exp is how long the token is valid for, as a duration such as "1h".
+	Exp string `json:"exp"`
+
+	Version string `json:"version"`
+}
+
+type launchResponse struct {
+	Token         string                 `json:"token"`
+	Payload       string                 `json:"payload,omitempty"`
+	ExpiresAt     time.Time              `json:"expires_at"`
+	ClaimsSummary map[string]interface{} `json:"claims_summary"`
+	LaunchURL     string                 `json:"launch_url"`
+
+	// ExpiresAtLocal and ExpiresIn tell whoever a launch link is shared with when it stops working.
+	ExpiresAtLocal   string `json:"expires_at_local"`
+	ExpiresIn        string `json:"expires_in"`
+	ExpiresInSeconds int64  `json:"expires_in_seconds"`
+
+	// Claims is every claim in the token, and DebugToken a signed but unencrypted copy of it, only included for
+	// wantsDebugClaims.
+	Claims     map[string]interface{} `json:"claims,omitempty"`
+	DebugToken string                 `json:"debug_token,omitempty"`
+
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type apiError struct {
+	Code        string                         `json:"code"`
+	Message     string                         `json:"message"`
+	Fields      []authentication.MetadataError `json:"fields,omitempty"`
+	Suggestions []string                       `json:"suggestions,omitempty"`
+	Dependency  string                         `json:"dependency,omitempty"`
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// postTokenAPIHandler generates a token from a JSON or YAML request, through the same pipeline as the launch form
+func postTokenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	launch, _, ok := generateTokenRequestLaunch(w, r, wantsDebugClaims(r))
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newLaunchResponse(r, launch, launch.URL))
+}
+
+// tokenBundleResponse is a launch's token with everything tooling might need alongside it, in one response
+type tokenBundleResponse struct {
+	Token     string     `json:"token"`
+	Payload   string     `json:"payload,omitempty"`
+	LaunchURL string     `json:"launch_url"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	KIDs      launchKIDs `json:"kids"`
+
+	// Claims are the claims as they went into the token, only included when ENABLE_DEBUG_CLAIMS is set.
+	Claims map[string]interface{} `json:"claims,omitempty"`
+}
+
+type launchKIDs struct {
+	Signing    string `json:"signing"`
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// postTokenBundleAPIHandler generates a token as /api/token does, responding with the token, its launch URL, expiry
+// and the kids of the keys it was made with, plus its claims when ENABLE_DEBUG_CLAIMS allows
+func postTokenBundleAPIHandler(w http.ResponseWriter, r *http.Request) {
+	launch, _, ok := generateTokenRequestLaunch(w, r, false)
+	if !ok {
+		return
+	}
+
+	response := tokenBundleResponse{
+		Token:     launch.Token,
+		Payload:   launch.Payload,
+		LaunchURL: launch.URL,
+		ExpiresAt: launch.ExpiresAt.UTC(),
+		KIDs:      launchKIDs{Signing: launch.SigningKID, Encryption: launch.EncryptionKID},
+	}
+	if settings.GetBool("ENABLE_DEBUG_CLAIMS") {
+		response.Claims = launch.Claims
+	}
+	writeJSON(w, r, http.StatusOK, response)
+}
+
+// batchTokenRequest is a tokenRequest for a number of launches, each with its own response_id, case_id, user_id and
+// tx_id
+type batchTokenRequest struct {
+	tokenRequest
+	Count int `json:"count"`
+}
+
+// postBatchTokenAPIHandler generates count launches from a token request body, as /bulk does, responding with each
+// launch's token or why it failed as JSON, or as CSV when wantsBulkCSV
+func postBatchTokenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	var request batchTokenRequest
+
+	if err := decodeTokenRequest(r, &request); errors.Is(err, errRequestBodyTooLarge) {
+		writeAPIError(w, r, http.StatusRequestEntityTooLarge, errorInvalidRequest, requestTooLargeMessage())
+		return
+	} else if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return
+	}
+
+	if maxCount := settings.GetInt("MAX_BULK_LAUNCHES"); request.Count < 1 || request.Count > maxCount {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, fmt.Sprintf("count must be between 1 and %d", maxCount))
+		return
+	}
+	if (request.SchemaName == "") == (request.SchemaURL == "") {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, "exactly one of schema_name or schema_url is required")
+		return
+	}
+
+	options, err := request.tokenOptions()
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return
+	}
+	shared, err := request.launchValues()
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return
+	}
+	schemaName := request.schemaName(shared)
+
+	if shared.Get("collection_exercise_sid") == "" {
+		collectionExerciseSid, err := authentication.NewIdentifier()
+		if err != nil {
+			writeAPILaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: err.Error()}, schemaName)
+			return
+		}
+		shared.Set("collection_exercise_sid", collectionExerciseSid)
+	}
+
+	values := make([]url.Values, request.Count)
+	for i := range values {
+		if values[i], err = bulkLaunchValues(shared); err != nil {
+			writeAPILaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: err.Error()}, schemaName)
+			return
+		}
+	}
+
+	launches, launchErr := generateBulkLaunchResults(r, request.SchemaURL, schemaName, values, options)
+	if launchErr != nil {
+		writeAPILaunchFailure(w, r, launchErr, schemaName)
+		return
+	}
+	writeBulkLaunches(w, r, launches)
+}
+
+// generateTokenRequestLaunch generates a launch from a tokenRequest body, as for /api/token. When it fails, the error
+// response has been written and ok is false.
+func generateTokenRequestLaunch(w http.ResponseWriter, r *http.Request, signedCopy bool) (launch *authentication.Launch, schemaName string, ok bool) {
+	var request tokenRequest
+
+	if err := decodeTokenRequest(r, &request); errors.Is(err, errRequestBodyTooLarge) {
+		writeAPIError(w, r, http.StatusRequestEntityTooLarge, errorInvalidRequest, requestTooLargeMessage())
+		return nil, "", false
+	} else if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return nil, "", false
+	}
+
+	if (request.SchemaName == "") == (request.SchemaURL == "") {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, "exactly one of schema_name or schema_url is required")
+		return nil, "", false
+	}
+
+	options, err := request.tokenOptions()
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return nil, "", false
+	}
+	options.SignedCopy = signedCopy
+
+	values, err := request.launchValues()
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return nil, "", false
+	}
+
+	schemaName = request.schemaName(values)
+
+	timings := &authentication.Timings{}
+	launch, launchErr := authentication.GenerateLaunch(authentication.ContextWithTimings(r.Context(), timings), request.SchemaURL, values, options)
+	recordLaunch(r, schemaName, timings, launch, launchErr)
+	if launchErr != nil {
+		writeAPILaunchFailure(w, r, launchErr, schemaName)
+		return nil, "", false
+	}
+	auditLaunch(r, launch, schemaName)
+	setLaunchHeaders(w, launch)
+
+	return launch, schemaName, true
+}
+
+// tokenOptions returns the token options the request's options ask for
+func (request tokenRequest) tokenOptions() (authentication.TokenOptions, error) {
+	options := authentication.TokenOptions{}
+	if request.Options.Encrypt != nil {
+		options.Unencrypted = !*request.Options.Encrypt
+	}
+	if request.Options.Exp != "" {
+		lifetime, err := time.ParseDuration(request.Options.Exp)
+		if err != nil || lifetime <= 0 {
+			return options, fmt.Errorf("invalid exp %q, expected a positive duration such as 1h", request.Options.Exp)
+		}
+		options.Lifetime = lifetime
+	}
+	return options, nil
+}
+
+// schemaName names the schema the request launches, for logs and metrics
+func (request tokenRequest) schemaName(values url.Values) string {
+	if request.SchemaURL != "" {
+		return schemaNameFromURL(request.SchemaURL)
+	}
+	return authentication.TransformSchemaParamsToName(values)
+}
+
+// launchValues returns the request's claims, persona, schema_name and version as launch form values
+func (request tokenRequest) launchValues() (url.Values, error) {
+	values, err := claimValues(request.Claims)
+	if err != nil {
+		return nil, err
+	}
+	if request.Persona != "" {
+		values.Set("persona", request.Persona)
+	}
+	if values, err = applyPersona(values); err != nil {
+		return nil, err
+	}
+	if request.SchemaName != "" {
+		values.Set("schema_name", request.SchemaName)
+	}
+	if request.Options.Version != "" {
+		values.Set("version", request.Options.Version)
+	}
+	return values, nil
+}
+
+// claimValues converts JSON claim values to the url.Values used by the launch form. Lists become repeated values and
+// false booleans are left out, as an unticked checkbox would be.
+func claimValues(claims map[string]interface{}) (url.Values, error) {
+	values := url.Values{}
+
+	for name, claim := range claims {
+		switch v := claim.(type) {
+		case []interface{}:
+			for _, item := range v {
+				value, err := claimValue(name, item)
+				if err != nil {
+					return nil, err
+				}
+				values.Add(name, value)
+			}
+		case bool:
+			if v {
+				values.Set(name, "true")
+			}
+		default:
+			value, err := claimValue(name, v)
+			if err != nil {
+				return nil, err
+			}
+			values.Set(name, value)
+		}
+	}
+
+	return values, nil
+}
+
+func claimValue(name string, claim interface{}) (string, error) {
+	switch v := claim.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("claim %s must be a string, number, boolean or list of them", name)
+	}
+}
+
+// wantsJSON reports whether the request's Accept header asks for a JSON response rather than HTML
+func wantsJSON(r *http.Request) bool {
+	return accepts(r, "application/json")
+}
+
+// wantsJWT reports whether the request asks for the bare token, through its Accept header or a format=jwt parameter
+func wantsJWT(r *http.Request) bool {
+	return accepts(r, "application/jwt") || r.URL.Query().Get("format") == "jwt"
+}
+
+func accepts(r *http.Request, mediaType string) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.EqualFold(strings.TrimSpace(strings.SplitN(accept, ";", 2)[0]), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJWT(w http.ResponseWriter, r *http.Request, token string) {
+	w.Header().Set("Content-Type", "application/jwt")
+	if _, err := w.Write([]byte(token)); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write token response", "error", err)
+	}
+}
+
+// newLaunchResponse describes a launch, with every claim it carries when the request asks for debugClaims
+func newLaunchResponse(r *http.Request, launch *authentication.Launch, launchURL string) launchResponse {
+	summary := make(map[string]interface{})
+	for _, name := range summaryClaims {
+		if value, ok := launch.Claims[name]; ok {
+			summary[name] = value
+		}
+	}
+
+	response := launchResponse{
+		Token:         launch.Token,
+		Payload:       launch.Payload,
+		ExpiresAt:     launch.ExpiresAt.UTC(),
+		ClaimsSummary: summary,
+		LaunchURL:     launchURL,
+		Warnings:      launch.Warnings,
+	}
+	response.ExpiresAtLocal, response.ExpiresIn, response.ExpiresInSeconds = launchExpiry(r, launch.ExpiresAt)
+	if wantsDebugClaims(r) {
+		response.Claims = launch.Claims
+		response.DebugToken = launch.SignedToken
+	}
+	return response
+}
+
+// launchExpiry returns when a launch expires in LAUNCH_LINK_TIMEZONE, and how long is left until then
+func launchExpiry(r *http.Request, expiresAt time.Time) (local string, remaining string, remainingSeconds int64) {
+	location, err := time.LoadLocation(settings.Get("LAUNCH_LINK_TIMEZONE"))
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("invalid LAUNCH_LINK_TIMEZONE, using UTC", "error", err)
+		location = time.UTC
+	}
+
+	left := expiresAt.Sub(authentication.Clock()).Truncate(time.Second)
+	if left < 0 {
+		left = 0
+	}
+	return expiresAt.In(location).Format("Mon 2 Jan 2006 15:04:05 MST"), left.String(), int64(left / time.Second)
+}
+
+// wantsDebugClaims reports whether the response should include every claim, for testers to check a token without
+// decrypting it. It needs debug=true on the request and ENABLE_DEBUG_CLAIMS, as claims can hold personal data.
+func wantsDebugClaims(r *http.Request) bool {
+	return settings.GetBool("ENABLE_DEBUG_CLAIMS") && r.URL.Query().Get("debug") == "true"
+}
+
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code string, message string) {
+	writeJSON(w, r, status, apiErrorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write JSON response", "error", err)
+	}
+}
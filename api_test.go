@@ -0,0 +1,276 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+func TestPostTokenAPI(t *testing.T) {
+	runner := useRunner(t)
+
+	recorder := postAPI(t, "/api/token", `{
+		"schema_name": "test_launch",
+		"claims": {"ru_ref": "12346789012A", "period_id": "201605", "roles": ["dumper", "flusher"]},
+		"options": {"exp": "30m", "version": "v2"}
+	}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var response launchResponse
+	decodeResponse(t, recorder, &response)
+
+	claims, err := runner.Claims(response.Token)
+	if err != nil {
+		t.Fatalf("the runner couldn't read the token: %v", err)
+	}
+	if claims["ru_ref"] != "12346789012A" || claims["version"] != "v2" || len(claims["roles"].([]interface{})) != 2 {
+		t.Errorf("expected the request's claims in the token, got %v", claims)
+	}
+	if response.ClaimsSummary["schema_name"] != "test_launch" {
+		t.Errorf("expected schema_name in the claims summary, got %v", response.ClaimsSummary)
+	}
+	if lifetime := time.Until(response.ExpiresAt); lifetime <= 29*time.Minute || lifetime > 30*time.Minute {
+		t.Errorf("expected the token to expire in 30 minutes, got %s", lifetime)
+	}
+	if sessionClaims(t, runner, response.LaunchURL)["tx_id"] != claims["tx_id"] {
+		t.Errorf("expected the launch_url to carry the token, got %s", response.LaunchURL)
+	}
+}
+
+func TestPostTokenBundleAPI(t *testing.T) {
+	runner := useRunner(t)
+
+	tests := []struct {
+		name        string
+		debugClaims string
+		wantClaims  bool
+	}{
+		{"with claims", "true", true},
+		{"claims not enabled", "false", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ENABLE_DEBUG_CLAIMS", test.debugClaims)
+
+			recorder := postAPI(t, "/api/token/bundle", `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605"}}`)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+			}
+
+			var response tokenBundleResponse
+			decodeResponse(t, recorder, &response)
+			claims, err := runner.Claims(response.Token)
+			if err != nil {
+				t.Fatalf("the runner couldn't read the token: %v", err)
+			}
+			if response.KIDs.Signing == "" || response.KIDs.Encryption == "" {
+				t.Errorf("expected the signing and encryption kids, got %+v", response.KIDs)
+			}
+			if response.ExpiresAt.IsZero() {
+				t.Error("expected expires_at")
+			}
+			if sessionClaims(t, runner, response.LaunchURL)["tx_id"] != claims["tx_id"] {
+				t.Errorf("expected the launch_url to carry the token, got %s", response.LaunchURL)
+			}
+			if !test.wantClaims {
+				if response.Claims != nil {
+					t.Errorf("expected no claims without ENABLE_DEBUG_CLAIMS, got %v", response.Claims)
+				}
+				return
+			}
+			if response.Claims["tx_id"] != claims["tx_id"] || response.Claims["ru_ref"] != "12346789012A" {
+				t.Errorf("expected the token's claims, got %v", response.Claims)
+			}
+		})
+	}
+}
+
+func TestPostTokenAPIUnencrypted(t *testing.T) {
+	runner := useRunner(t)
+
+	recorder := postAPI(t, "/api/token", `{"schema_name": "test_launch", "claims": {"ru_ref": "1", "period_id": "201605"}, "options": {"encrypt": false}}`)
+
+	var response launchResponse
+	decodeResponse(t, recorder, &response)
+	if strings.Count(response.Token, ".") != 2 {
+		t.Errorf("expected a signed but unencrypted token, got %s", response.Token)
+	}
+	if _, err := runner.Claims(response.Token); err != nil {
+		t.Errorf("the runner couldn't read the token: %v", err)
+	}
+}
+
+func TestPostTokenAPIErrors(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid JSON", `{"schema_name":`, http.StatusBadRequest, "invalid_request"},
+		{"no schema", `{"claims": {}}`, http.StatusBadRequest, "invalid_request"},
+		{"both schema_name and schema_url", `{"schema_name": "test_launch", "schema_url": "http://localhost/test.json"}`, http.StatusBadRequest, "invalid_request"},
+		{"invalid exp", `{"schema_name": "test_launch", "options": {"exp": "soon"}}`, http.StatusBadRequest, "invalid_request"},
+		{"invalid claim", `{"schema_name": "test_launch", "claims": {"ru_ref": {"nested": true}}}`, http.StatusBadRequest, "invalid_request"},
+		{"schema not found", `{"schema_name": "test_missing", "claims": {"ru_ref": "1"}}`, http.StatusNotFound, "schema_not_found"},
+		{"invalid metadata", `{"schema_name": "test_launch", "claims": {"ru_ref": "1", "ref_p_start_date": "01/05/2016"}}`, http.StatusBadRequest, "metadata_error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := postAPI(t, "/api/token", test.body)
+
+			var response apiErrorResponse
+			decodeResponse(t, recorder, &response)
+			if recorder.Code != test.wantStatus || response.Error.Code != test.wantCode {
+				t.Errorf("expected %d %s, got %d %+v", test.wantStatus, test.wantCode, recorder.Code, response.Error)
+			}
+			if test.wantCode == "metadata_error" && (len(response.Error.Fields) != 1 || response.Error.Fields[0].Name != "ref_p_start_date") {
+				t.Errorf("expected the invalid ref_p_start_date in the fields, got %+v", response.Error.Fields)
+			}
+		})
+	}
+}
+
+func TestPostTokenAPIKeyError(t *testing.T) {
+	useRunner(t)
+	withSetting(t, "JWT_SIGNING_KEY_PATH", filepath.Join(t.TempDir(), "missing.pem"))
+
+	recorder := postAPI(t, "/api/token", `{"schema_name": "test_launch", "claims": {"ru_ref": "1", "period_id": "201605"}}`)
+
+	var response apiErrorResponse
+	decodeResponse(t, recorder, &response)
+	if recorder.Code != http.StatusInternalServerError || response.Error.Code != "key_error" {
+		t.Errorf("expected a 500 key_error, got %d %+v", recorder.Code, response.Error)
+	}
+	if strings.Contains(response.Error.Message, "missing.pem") {
+		t.Errorf("expected the key path not to be in the response, got %q", response.Error.Message)
+	}
+}
+
+func TestPostTokenAPILaunchURL(t *testing.T) {
+	useRunner(t)
+	runnerURL := settings.Get("SURVEY_RUNNER_URL")
+	request := `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605"}}`
+
+	tests := []struct {
+		name        string
+		runnerURL   string
+		sessionPath string
+		wantStatus  int
+		wantPrefix  string
+	}{
+		{"query style", runnerURL, "/session?token={token}", http.StatusOK, runnerURL + "/session?token="},
+		{"path segment style", runnerURL, "/session/{token}", http.StatusOK, runnerURL + "/session/"},
+		{"runner URL not set", "", "/session?token={token}", http.StatusInternalServerError, ""},
+		{"template without a token", runnerURL, "/session", http.StatusInternalServerError, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SURVEY_RUNNER_URL", test.runnerURL)
+			withSetting(t, "SURVEY_RUNNER_SESSION_PATH", test.sessionPath)
+
+			recorder := postAPI(t, "/api/token", request)
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+
+			if test.wantPrefix == "" {
+				var response apiErrorResponse
+				decodeResponse(t, recorder, &response)
+				if response.Error.Code != "configuration_error" {
+					t.Errorf("expected a configuration_error, got %+v", response.Error)
+				}
+				return
+			}
+
+			var response launchResponse
+			decodeResponse(t, recorder, &response)
+			if response.LaunchURL != test.wantPrefix+response.Token {
+				t.Errorf("expected %s followed by the token, got %s", test.wantPrefix, response.LaunchURL)
+			}
+		})
+	}
+}
+
+func TestDebugClaims(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name       string
+		enabled    string
+		query      string
+		wantClaims bool
+	}{
+		{"enabled and asked for", "true", "?debug=true", true},
+		{"enabled but not asked for", "true", "", false},
+		{"asked for but disabled", "false", "?debug=true", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ENABLE_DEBUG_CLAIMS", test.enabled)
+
+			recorder := postAPI(t, "/api/token"+test.query, `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605"}}`)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+			}
+
+			var response launchResponse
+			decodeResponse(t, recorder, &response)
+			if !test.wantClaims {
+				if response.Claims != nil {
+					t.Errorf("expected no claims, got %v", response.Claims)
+				}
+				return
+			}
+			if response.Claims["ru_ref"] != "12346789012A" || response.Claims["jti"] == nil {
+				t.Errorf("expected every claim, got %v", response.Claims)
+			}
+		})
+	}
+}
+
+func TestLaunchExpiry(t *testing.T) {
+	now := time.Date(2024, time.July, 1, 11, 0, 0, 0, time.UTC)
+	previousClock := authentication.Clock
+	authentication.Clock = func() time.Time { return now }
+	t.Cleanup(func() { authentication.Clock = previousClock })
+
+	tests := []struct {
+		name          string
+		timezone      string
+		expiresAt     time.Time
+		wantLocal     string
+		wantIn        string
+		wantInSeconds int64
+	}{
+		{"London in summer", "Europe/London", now.Add(90 * time.Minute), "Mon 1 Jul 2024 13:30:00 BST", "1h30m0s", 5400},
+		{"UTC", "UTC", now.Add(45*time.Second + 500*time.Millisecond), "Mon 1 Jul 2024 11:00:45 UTC", "45s", 45},
+		{"invalid timezone uses UTC", "Not/AZone", now.Add(time.Hour), "Mon 1 Jul 2024 12:00:00 UTC", "1h0m0s", 3600},
+		{"already expired", "UTC", now.Add(-time.Minute), "Mon 1 Jul 2024 10:59:00 UTC", "0s", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "LAUNCH_LINK_TIMEZONE", test.timezone)
+
+			local, in, inSeconds := launchExpiry(httptest.NewRequest(http.MethodPost, "/api/token", nil), test.expiresAt)
+			if local != test.wantLocal || in != test.wantIn || inSeconds != test.wantInSeconds {
+				t.Errorf("expected %s, %s and %d, got %s, %s and %d", test.wantLocal, test.wantIn, test.wantInSeconds, local, in, inSeconds)
+			}
+		})
+	}
+}
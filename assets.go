@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// embeddedAssets holds the templates and static files, so the binary can run without them alongside it
+//
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// staticMaxAge is how long, in seconds, browsers may use embedded static files before revalidating them by ETag
+const staticMaxAge = 3600
+
+var (
+	embeddedTemplatesOnce sync.Once
+	embeddedTemplates     map[string]*template.Template
+	embeddedTemplatesErr  error
+)
+
+// assetsFromDisk reports whether ASSETS_FROM_DISK is set, so templates and static files are read from the working
+// directory on every request and changes show up without rebuilding
+func assetsFromDisk() bool {
+	return settings.GetBool("ASSETS_FROM_DISK")
+}
+
+// pageTemplates returns each page template combined with the layout, keyed by file name. The embedded templates are
+// only parsed once.
+func pageTemplates() (map[string]*template.Template, error) {
+	if assetsFromDisk() {
+		return parseTemplates(os.DirFS("."))
+	}
+
+	embeddedTemplatesOnce.Do(func() {
+		embeddedTemplates, embeddedTemplatesErr = parseTemplates(embeddedAssets)
+	})
+	return embeddedTemplates, embeddedTemplatesErr
+}
+
+func parseTemplates(fsys fs.FS) (map[string]*template.Template, error) {
+	names, err := fs.Glob(fsys, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string]*template.Template)
+	for _, name := range names {
+		if path.Base(name) == "layout.html" {
+			continue
+		}
+
+		tmpl, err := template.New("").Funcs(templateFuncs).ParseFS(fsys, "templates/layout.html", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %v", name, err)
+		}
+		templates[path.Base(name)] = tmpl
+	}
+
+	return templates, nil
+}
+
+// staticHandler serves the static files. Embedded files are served with an ETag of their content hash, so browsers
+// only download them again when they change.
+func staticHandler() http.Handler {
+	if assetsFromDisk() {
+		return http.FileServer(http.Dir("static"))
+	}
+
+	static, err := fs.Sub(embeddedAssets, "static")
+	if err != nil {
+		logging.Fatal("failed to read embedded static files", "error", err)
+	}
+
+	etags, err := staticETags(static)
+	if err != nil {
+		logging.Fatal("failed to hash embedded static files", "error", err)
+	}
+
+	files := http.FileServer(http.FS(static))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag, ok := etags[strings.TrimPrefix(r.URL.Path, "/")]; ok {
+			// http.FileServer answers If-None-Match with a 304 using this header
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", staticMaxAge))
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// staticETags returns a quoted ETag of the SHA-256 of each file, keyed by path
+func staticETags(static fs.FS) (map[string]string, error) {
+	etags := make(map[string]string)
+
+	err := fs.WalkDir(static, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(static, name)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(content)
+		etags[name] = `"` + hex.EncodeToString(hash[:16]) + `"`
+		return nil
+	})
+
+	return etags, err
+}
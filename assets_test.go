@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// inDir runs the rest of the test from dir, as a binary deployed there would run
+func inDir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func TestServesEmbeddedAssets(t *testing.T) {
+	useRunner(t)
+	withSetting(t, "ASSETS_FROM_DISK", "false")
+	inDir(t, t.TempDir())
+
+	recorder := route(t, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "</footer>") {
+		t.Errorf("expected the launch page from the embedded templates, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = route(t, httptest.NewRequest(http.MethodGet, "/static/css/main.css", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.Len() == 0 {
+		t.Fatalf("expected the embedded stylesheet, got %d", recorder.Code)
+	}
+	etag := recorder.Header().Get("ETag")
+	if etag == "" || !strings.Contains(recorder.Header().Get("Cache-Control"), "max-age=") {
+		t.Errorf("expected an ETag and Cache-Control, got %v", recorder.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/static/css/main.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	if recorder := route(t, req); recorder.Code != http.StatusNotModified {
+		t.Errorf("expected a 304 for an unchanged stylesheet, got %d", recorder.Code)
+	}
+}
+
+func TestServesAssetsFromDisk(t *testing.T) {
+	useRunner(t)
+	withSetting(t, "ASSETS_FROM_DISK", "true")
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"templates/layout.html": `{{define "layout"}}<main>{{template "body" .}}</main>{{end}}`,
+		"templates/launch.html": `{{define "body"}}launch from disk{{end}}`,
+		"static/css/main.css":   `main { color: red; }`,
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inDir(t, dir)
+
+	if body := route(t, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String(); body != "<main>launch from disk</main>" {
+		t.Errorf("expected the template on disk, got %s", body)
+	}
+	if body := route(t, httptest.NewRequest(http.MethodGet, "/static/css/main.css", nil)).Body.String(); body != "main { color: red; }" {
+		t.Errorf("expected the stylesheet on disk, got %s", body)
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	layout := &fstest.MapFile{Data: []byte(`{{define "layout"}}{{template "body" .}}{{end}}`)}
+
+	tests := []struct {
+		name      string
+		fsys      fstest.MapFS
+		wantNames []string
+		wantError bool
+	}{
+		{"valid", fstest.MapFS{
+			"templates/layout.html": layout,
+			"templates/launch.html": {Data: []byte(`{{define "body"}}launch{{end}}`)},
+		}, []string{"launch.html"}, false},
+		{"syntax error", fstest.MapFS{
+			"templates/layout.html": layout,
+			"templates/launch.html": {Data: []byte(`{{define "body"}}{{if}}{{end}}`)},
+		}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			templates, err := parseTemplates(test.fsys)
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+			if len(templates) != len(test.wantNames) {
+				t.Errorf("expected templates %v, got %v", test.wantNames, templates)
+			}
+			for _, name := range test.wantNames {
+				if templates[name] == nil {
+					t.Errorf("expected template %s", name)
+				}
+			}
+		})
+	}
+
+	t.Run("embedded", func(t *testing.T) {
+		if _, err := parseTemplates(embeddedAssets); err != nil {
+			t.Errorf("expected the embedded templates to parse, got %v", err)
+		}
+	})
+}
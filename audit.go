@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/audit"
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/metrics"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// defaultAuditTail is how many entries /admin/audit returns when n isn't given
+const defaultAuditTail = 50
+
+var auditErrorsTotal = metrics.NewCounterVec(
+	"launcher_audit_log_errors_total", "Audit log entries which could not be written, by reason.", "reason")
+
+// auditLog records generated tokens when AUDIT_LOG_PATH is set, and is nil otherwise
+var auditLog *audit.Log
+
+// openAuditLog opens the audit log at AUDIT_LOG_PATH, if one is set
+func openAuditLog() {
+	var err error
+	auditLog, err = audit.Open(settings.Get("AUDIT_LOG_PATH"), func(err error) {
+		reason := "write"
+		if err == audit.ErrDropped {
+			reason = "dropped"
+		}
+		auditErrorsTotal.Inc(reason)
+		logging.Error("failed to write audit log entry", "error", err)
+	})
+	if err != nil {
+		logging.Fatal("failed to open audit log", "path", settings.Get("AUDIT_LOG_PATH"), "error", err)
+	}
+}
+
+// auditLaunch records a generated token in the audit log, along with who requested it
+func auditLaunch(r *http.Request, launch *authentication.Launch, schemaName string) {
+	if auditLog == nil || launch.Token == "" {
+		return
+	}
+
+	entry := audit.Entry{
+		Time:         time.Now().UTC(),
+		TxID:         claimString(launch.Claims, "tx_id"),
+		JTI:          claimString(launch.Claims, "jti"),
+		SchemaName:   schemaName,
+		RunnerURL:    settings.Get("SURVEY_RUNNER_URL"),
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		User:         requester(r),
+		ExpiresAt:    launch.ExpiresAt.UTC(),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		entry.RemoteIP = host
+	}
+	if name := claimString(launch.Claims, "schema_name"); name != "" {
+		entry.SchemaName = name
+	}
+
+	auditLog.Record(entry)
+}
+
+// requester names who made an authenticated request: the basic auth user, or "api-token" for the bearer token on the
+// JSON API. authMiddleware has already checked the credentials, so only those it checks are named.
+func requester(r *http.Request) string {
+	if username, _, ok := r.BasicAuth(); ok && settings.Get("LAUNCHER_BASIC_AUTH") != "" {
+		return username
+	}
+	if isAPIRequest(r) && settings.Get("LAUNCHER_API_TOKEN") != "" && strings.HasPrefix(strings.ToLower(r.Header.Get("Authorization")), "bearer ") {
+		return "api-token"
+	}
+	return ""
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// getAuditHandler returns the latest audit log entries, n of them when given
+func getAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if auditLog == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	n := defaultAuditTail
+	if requested := r.URL.Query().Get("n"); requested != "" {
+		var err error
+		if n, err = strconv.Atoi(requested); err != nil || n < 1 {
+			writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, "n must be a positive number")
+			return
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, auditLog.Recent(n))
+}
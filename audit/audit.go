@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// queueSize is how many entries can wait to be written before new entries are dropped, so a slow disk never holds
+// up a launch
+const queueSize = 1024
+
+// recentSize is how many of the latest entries are kept in memory for Recent
+const recentSize = 200
+
+// ErrDropped is reported when an entry is dropped because the queue of entries to write is full
+var ErrDropped = errors.New("audit queue full, entry dropped")
+
+// Entry records one generated token. It never holds the token or its claims.
+type Entry struct {
+	Logger       string    `json:"logger"`
+	Time         time.Time `json:"time"`
+	TxID         string    `json:"tx_id"`
+	JTI          string    `json:"jti"`
+	SchemaName   string    `json:"schema_name"`
+	RunnerURL    string    `json:"runner_url"`
+	RemoteIP     string    `json:"remote_ip,omitempty"`
+	ForwardedFor string    `json:"forwarded_for,omitempty"`
+	User         string    `json:"user,omitempty"`
+	ExpiresAt    time.Time `json:"exp"`
+}
+
+// Log writes entries as JSON lines in the background. A nil *Log discards entries, so callers don't need to check
+// whether auditing is enabled.
+type Log struct {
+	output  io.Writer
+	closer  io.Closer
+	onError func(error)
+	entries chan Entry
+	done    chan struct{}
+
+	mutex  sync.Mutex
+	recent []Entry
+}
+
+// Open returns a Log appending to the file at path, or writing to stdout when path is "stdout", or nil when path is
+// empty. onError is called for entries which can't be written.
+func Open(path string, onError func(error)) (*Log, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	l := &Log{output: os.Stdout, onError: onError, entries: make(chan Entry, queueSize), done: make(chan struct{})}
+	if path != "stdout" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return nil, err
+		}
+		l.output, l.closer = file, file
+	}
+
+	go l.run()
+	return l, nil
+}
+
+// Record queues an entry to be written without blocking
+func (l *Log) Record(entry Entry) {
+	if l == nil {
+		return
+	}
+	entry.Logger = "audit"
+
+	l.mutex.Lock()
+	l.recent = append(l.recent, entry)
+	if len(l.recent) > recentSize {
+		l.recent = l.recent[len(l.recent)-recentSize:]
+	}
+	l.mutex.Unlock()
+
+	select {
+	case l.entries <- entry:
+	default:
+		l.onError(ErrDropped)
+	}
+}
+
+// Recent returns up to n of the latest entries, oldest first
+func (l *Log) Recent(n int) []Entry {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if n <= 0 || n > len(l.recent) {
+		n = len(l.recent)
+	}
+	return append([]Entry(nil), l.recent[len(l.recent)-n:]...)
+}
+
+// Close writes any queued entries and closes the file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	close(l.entries)
+	<-l.done
+	if l.closer != nil {
+		return l.closer.Close()
+	}
+	return nil
+}
+
+func (l *Log) run() {
+	defer close(l.done)
+
+	encoder := json.NewEncoder(l.output)
+	for entry := range l.entries {
+		if err := encoder.Encode(entry); err != nil {
+			l.onError(err)
+		}
+	}
+}
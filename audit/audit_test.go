@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := ioutil.WriteFile(path, []byte(`{"logger":"audit","tx_id":"earlier"}`+"\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := Open(path, func(err error) { t.Errorf("unexpected error: %v", err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Date(2017, 5, 1, 9, 10, 0, 0, time.UTC)
+	log.Record(Entry{TxID: "tx-1", JTI: "jti-1", SchemaName: "test_launch", ExpiresAt: expiresAt})
+	log.Record(Entry{TxID: "tx-2", JTI: "jti-2", SchemaName: "test_launch", ExpiresAt: expiresAt})
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(written), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected the entries to be appended to the existing one, got %s", written)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal([]byte(lines[2]), &entry); err != nil {
+		t.Fatalf("expected a JSON line, got %q: %v", lines[2], err)
+	}
+	if entry.Logger != "audit" || entry.TxID != "tx-2" || !entry.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected the second entry, got %+v", entry)
+	}
+}
+
+func TestLogDisabled(t *testing.T) {
+	log, err := Open("", nil)
+	if log != nil || err != nil {
+		t.Fatalf("expected no log for an empty path, got %v, %v", log, err)
+	}
+
+	log.Record(Entry{TxID: "tx-1"})
+	if recent := log.Recent(10); recent != nil {
+		t.Errorf("expected no entries, got %v", recent)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestOpenUnwritablePath(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing", "audit.jsonl"), nil); !os.IsNotExist(err) {
+		t.Errorf("expected the missing directory to be reported, got %v", err)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	log, err := Open(filepath.Join(t.TempDir(), "audit.jsonl"), func(err error) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	for i := 0; i < recentSize+5; i++ {
+		log.Record(Entry{TxID: strconv.Itoa(i)})
+	}
+
+	if recent := log.Recent(0); len(recent) != recentSize || recent[0].TxID != "5" {
+		t.Errorf("expected the latest %d entries, got %d from %+v", recentSize, len(recent), recent[0])
+	}
+	recent := log.Recent(2)
+	if len(recent) != 2 || recent[0].TxID != strconv.Itoa(recentSize+3) || recent[1].TxID != strconv.Itoa(recentSize+4) {
+		t.Errorf("expected the latest 2 entries oldest first, got %+v", recent)
+	}
+}
+
+func TestRecordDropsWhenQueueFull(t *testing.T) {
+	var errs []error
+	// Without a writer running, the queue fills after its first entry
+	log := &Log{entries: make(chan Entry, 1), onError: func(err error) { errs = append(errs, err) }}
+
+	log.Record(Entry{TxID: "queued"})
+	log.Record(Entry{TxID: "dropped"})
+
+	if len(errs) != 1 || errs[0] != ErrDropped {
+		t.Errorf("expected the second entry to be dropped, got %v", errs)
+	}
+	if len(log.Recent(0)) != 2 {
+		t.Error("expected dropped entries to still be kept in memory")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/audit"
+)
+
+// useAuditLog records launches in a new audit log for the rest of the test, returning the log's path
+func useAuditLog(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log, err := audit.Open(path, func(err error) { t.Errorf("failed to write audit log entry: %v", err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := auditLog
+	auditLog = log
+	t.Cleanup(func() { auditLog = previous })
+	return path
+}
+
+func TestAuditLaunch(t *testing.T) {
+	runner := useRunner(t)
+	path := useAuditLog(t)
+
+	recorder := postAPI(t, "/api/token", `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605"}}`)
+	var response launchResponse
+	decodeResponse(t, recorder, &response)
+	claims, err := runner.Claims(response.Token)
+	if err != nil {
+		t.Fatalf("the runner couldn't read the token: %v", err)
+	}
+
+	entries := auditLog.Recent(0)
+	if len(entries) != 1 || entries[0].TxID != claims["tx_id"] || entries[0].JTI != claims["jti"] || entries[0].SchemaName != "test_launch" {
+		t.Fatalf("expected an entry for the launch, got %+v", entries)
+	}
+
+	if err := auditLog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(written), "\n") != 1 || strings.Contains(string(written), response.Token) || strings.Contains(string(written), "12346789012A") {
+		t.Errorf("expected one entry without the token or claims, got %s", written)
+	}
+}
+
+func TestRequester(t *testing.T) {
+	tests := []struct {
+		name       string
+		basicAuth  string
+		apiToken   string
+		path       string
+		authHeader func(r *http.Request)
+		want       string
+	}{
+		{"auth not enabled", "", "", "/api/token", func(r *http.Request) { r.SetBasicAuth("researcher", "secret") }, ""},
+		{"basic auth user", "researcher:hash", "", "/api/token", func(r *http.Request) { r.SetBasicAuth("researcher", "secret") }, "researcher"},
+		{"API token", "", "token", "/api/token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, "api-token"},
+		{"API token outside the API", "", "token", "/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, ""},
+		{"unchecked basic auth", "", "token", "/api/token", func(r *http.Request) { r.SetBasicAuth("researcher", "secret") }, ""},
+		{"no credentials", "researcher:hash", "token", "/api/token", func(r *http.Request) {}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "LAUNCHER_BASIC_AUTH", test.basicAuth)
+			withSetting(t, "LAUNCHER_API_TOKEN", test.apiToken)
+
+			req := httptest.NewRequest(http.MethodPost, test.path, nil)
+			test.authHeader(req)
+			if got := requester(req); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGetAuditHandler(t *testing.T) {
+	previous := auditLog
+	auditLog = nil
+	t.Cleanup(func() { auditLog = previous })
+	if recorder := route(t, httptest.NewRequest(http.MethodGet, "/admin/audit", nil)); recorder.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without an audit log, got %d", recorder.Code)
+	}
+
+	useAuditLog(t)
+	for _, txID := range []string{"tx-1", "tx-2", "tx-3"} {
+		auditLog.Record(audit.Entry{TxID: txID})
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTxIDs  []string
+	}{
+		{"default", "", http.StatusOK, []string{"tx-1", "tx-2", "tx-3"}},
+		{"latest n", "?n=2", http.StatusOK, []string{"tx-2", "tx-3"}},
+		{"invalid n", "?n=all", http.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/admin/audit"+test.query, nil))
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			if test.wantTxIDs == nil {
+				return
+			}
+
+			var entries []audit.Entry
+			decodeResponse(t, recorder, &entries)
+			var txIDs []string
+			for _, entry := range entries {
+				txIDs = append(txIDs, entry.TxID)
+			}
+			if !reflect.DeepEqual(txIDs, test.wantTxIDs) {
+				t.Errorf("expected %v, got %v", test.wantTxIDs, txIDs)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package authentication
+
+import (
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"gopkg.in/square/go-jose.v2"
+)
+
+const (
+	signingAlgorithm       = jose.RS256
+	keyEncryptionAlgorithm = jose.RSA_OAEP
+
+	// kidHash is the hash of the PEM encoded public key which gives each key's kid
+	kidHash = "SHA-1"
+)
+
+// TokenAlgorithms describes how the launcher is configured to sign and encrypt tokens
+type TokenAlgorithms struct {
+	SigningAlgorithm            string   `json:"signing_algorithm"`
+	KeyEncryptionAlgorithm      string   `json:"key_encryption_algorithm"`
+	ContentEncryptionAlgorithm  string   `json:"content_encryption_algorithm"`
+	SupportedContentEncryptions []string `json:"supported_content_encryptions"`
+	EncOverride                 bool     `json:"enc_override"`
+	KIDHash                     string   `json:"kid_hash"`
+	Serialization               string   `json:"serialization"`
+	Typ                         string   `json:"typ"`
+}
+
+// GetTokenAlgorithms returns the algorithms tokens are currently generated with, from the settings. Serialization is
+// "detached" when unencrypted tokens leave out their payload, otherwise "compact".
+func GetTokenAlgorithms() TokenAlgorithms {
+	serialization := "compact"
+	if settings.GetBool("JWT_DETACHED_PAYLOAD") {
+		serialization = "detached"
+	}
+
+	return TokenAlgorithms{
+		SigningAlgorithm:            string(signingAlgorithm),
+		KeyEncryptionAlgorithm:      string(keyEncryptionAlgorithm),
+		ContentEncryptionAlgorithm:  settings.Get("JWT_CONTENT_ENCRYPTION"),
+		SupportedContentEncryptions: ContentEncryptions,
+		EncOverride:                 settings.GetBool("ENABLE_ENC_OVERRIDE"),
+		KIDHash:                     kidHash,
+		Serialization:               serialization,
+		Typ:                         settings.Get("JWT_TYP"),
+	}
+}
@@ -1,26 +1,34 @@
 package authentication
 
 import (
+	"bytes"
+	"context"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
+	"sort"
 	"time"
 
 	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
 	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
 	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"github.com/ONSdigital/eq-questionnaire-launcher/version"
 	"github.com/gofrs/uuid"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/json"
 	"gopkg.in/square/go-jose.v2/jwt"
 
-	"bytes"
-	"log"
 	"path"
 	"strconv"
 	"strings"
@@ -56,14 +64,23 @@ type PrivateKeyResult struct {
 }
 
 func loadEncryptionKey() (*PublicKeyResult, *KeyLoadError) {
-	encryptionKeyPath := settings.Get("JWT_ENCRYPTION_KEY_PATH")
+	encryptionKeyPath, keyErr := encryptionKeyPath()
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	return loadEncryptionKeyFromPath(encryptionKeyPath)
+}
 
+func loadEncryptionKeyFromPath(encryptionKeyPath string) (*PublicKeyResult, *KeyLoadError) {
 	keyData, err := ioutil.ReadFile(encryptionKeyPath)
 	if err != nil {
 		return nil, &KeyLoadError{Op: "read", Err: "Failed to read encryption key from file: " + encryptionKeyPath}
 	}
 
 	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, &KeyLoadError{Op: "parse", Err: "Encryption key file is not valid PEM: " + encryptionKeyPath}
+	}
 	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		return nil, &KeyLoadError{Op: "parse", Err: "Failed to parse encryption key PEM"}
@@ -80,14 +97,37 @@ func loadEncryptionKey() (*PublicKeyResult, *KeyLoadError) {
 }
 
 func loadSigningKey() (*PrivateKeyResult, *KeyLoadError) {
-	signingKeyPath := settings.Get("JWT_SIGNING_KEY_PATH")
+	signingKeyPath, keyErr := signingKeyPath()
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	return loadSigningKeyFromPath(signingKeyPath)
+}
+
+func loadSigningKeyFromPath(signingKeyPath string) (*PrivateKeyResult, *KeyLoadError) {
 	keyData, err := ioutil.ReadFile(signingKeyPath)
 	if err != nil {
 		return nil, &KeyLoadError{Op: "read", Err: "Failed to read signing key from file: " + signingKeyPath}
 	}
 
 	block, _ := pem.Decode(keyData)
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if block == nil {
+		return nil, &KeyLoadError{Op: "parse", Err: "Signing key file is not valid PEM: " + signingKeyPath}
+	}
+	keyBytes := block.Bytes
+	if x509.IsEncryptedPEMBlock(block) {
+		passphrase := settings.Get("JWT_SIGNING_KEY_PASSPHRASE")
+		if passphrase == "" {
+			return nil, &KeyLoadError{Op: "decrypt", Err: "Signing key is encrypted but JWT_SIGNING_KEY_PASSPHRASE is not set"}
+		}
+
+		keyBytes, err = x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			return nil, &KeyLoadError{Op: "decrypt", Err: "Failed to decrypt signing key, check JWT_SIGNING_KEY_PASSPHRASE"}
+		}
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(keyBytes)
 	if err != nil {
 		return nil, &KeyLoadError{Op: "parse", Err: "Failed to parse signing key from PEM"}
 	}
@@ -106,46 +146,181 @@ func loadSigningKey() (*PrivateKeyResult, *KeyLoadError) {
 	return &PrivateKeyResult{privateKey, kid}, nil
 }
 
+// SigningPublicKey returns the public key of the signing key, which verifies the tokens the launcher generates
+func SigningPublicKey() (*rsa.PublicKey, error) {
+	privateKeyResult, keyErr := loadSigningKey()
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	return &privateKeyResult.key.PublicKey, nil
+}
+
+// CheckKeys returns an error if either the signing or the encryption key can't be loaded
+func CheckKeys() error {
+	if _, keyErr := loadSigningKey(); keyErr != nil {
+		return keyErr
+	}
+	keyPaths, keyErr := signingKeyPaths()
+	if keyErr != nil {
+		return keyErr
+	}
+	for id := range keyPaths {
+		if _, keyErr := loadSigningKeyByID(id); keyErr != nil {
+			return keyErr
+		}
+	}
+	if _, keyErr := loadEncryptionKey(); keyErr != nil {
+		return keyErr
+	}
+	return nil
+}
+
+// requiredSettings are the settings which launches can't be generated without
+var requiredSettings = []string{
+	"JWT_SIGNING_KEY_PATH",
+	"JWT_ENCRYPTION_KEY_PATH",
+	"SURVEY_RUNNER_URL",
+	"SURVEY_RUNNER_SCHEMA_URL",
+}
+
+// MissingSettings returns the required settings which are empty, so misconfiguration can be reported at startup
+// rather than by the first failed launch
+func MissingSettings() []string {
+	missing := []string{}
+	for _, name := range requiredSettings {
+		if strings.TrimSpace(settings.Get(name)) == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// KeyAges returns how long ago the signing and encryption key files were last modified
+func KeyAges() map[string]time.Duration {
+	ages := make(map[string]time.Duration)
+	for name, path := range map[string]func() (string, *KeyLoadError){"signing": signingKeyPath, "encryption": encryptionKeyPath} {
+		keyPath, keyErr := path()
+		if keyErr != nil {
+			continue
+		}
+		if info, err := os.Stat(keyPath); err == nil {
+			ages[name] = time.Since(info.ModTime())
+		}
+	}
+	return ages
+}
+
 // QuestionnaireSchema is a minimal representation of a questionnaire schema used for extracting the metadata and questionnaire identifiers
 type QuestionnaireSchema struct {
-	Metadata   []Metadata `json:"metadata"`
-	SchemaName string     `json:"schema_name"`
+	Metadata   []Metadata  `json:"metadata"`
+	SchemaName string      `json:"schema_name"`
+	Version    interface{} `json:"version"`
+	Theme      string      `json:"theme"`
+
+	// hash is the hex SHA-256 of the schema body as it was fetched.
+	hash string
+}
+
+// version returns the schema's version as a string, or an empty string if it doesn't declare one
+func (schema QuestionnaireSchema) version() string {
+	if schema.Version == nil {
+		return ""
+	}
+	return fmt.Sprint(schema.Version)
 }
 
 // Metadata is a representation of the metadata within the schema with an additional `Default` value
 type Metadata struct {
 	Name      string `json:"name"`
 	Validator string `json:"type"`
+	Optional  bool   `json:"optional"`
 	Default   string `json:"default"`
+
+	// Format is a hint such as "email" or "uri" which values must also match.
+	Format string `json:"format,omitempty"`
+
+	// RequiredIf makes the metadata required only when another metadata value meets the condition, and optional
+	// otherwise, whatever Optional is set to.
+	RequiredIf *MetadataCondition `json:"required_if,omitempty"`
+
+	// Ref is the URL of metadata defined elsewhere, which is resolved when RESOLVE_SCHEMA_REFS is set.
+	Ref string `json:"$ref,omitempty"`
 }
 
-func generateClaims(claimValues map[string][]string, launcherSchema surveys.LauncherSchema) (claims map[string]interface{}) {
+func generateClaims(ctx context.Context, claimValues map[string][]string, launcherSchema surveys.LauncherSchema, questionnaireSchema QuestionnaireSchema) (claims map[string]interface{}, err error) {
 
+	// The claims are built from copies, so later changes to them never reach the caller's values
 	var roles []string
 	if rolesValues, ok := claimValues["roles"]; ok {
-		roles = rolesValues
+		roles = append([]string(nil), rolesValues...)
 	} else {
 		roles = []string{"dumper"}
 	}
 
+	schemaName := launcherSchema.Name
+	if len(claimValues["schema_name"]) > 0 && claimValues["schema_name"][0] != "" {
+		schemaName = claimValues["schema_name"][0]
+	}
+	var survey string
+	if len(claimValues["survey"]) > 0 {
+		survey = claimValues["survey"][0]
+	}
+	roles = withoutForbiddenRoles(ctx, addRequiredRoles(ctx, roles, schemaName, survey))
+	if rolesErr := checkMaxRoles(roles); rolesErr != nil {
+		return nil, rolesErr
+	}
+	if rolesErr := checkRoleCombination(roles); rolesErr != nil {
+		return nil, rolesErr
+	}
+
+	txID, err := defaultTxID(ctx)
+	if settings.GetBool("DETERMINISTIC_TX_ID") {
+		txID, err = deterministicTxID(claimValues)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	claims = make(map[string]interface{})
 
 	claims["roles"] = roles
-	TxID, _ := uuid.NewV4()
-	claims["tx_id"] = TxID.String()
+	claims["tx_id"] = txID
 
+	strict := settings.GetBool("STRICT_CLAIMS")
+	trimmed := trimmedClaims()
+	var dropped []string
 	for key, value := range claimValues {
-		if key != "roles" {
-			if value[0] != "" {
-				claims[key] = value[0]
-			}
-		} else {
-			claims[key] = value
+		// Launcher parameters, such as strict and enc, control the launch rather than being sent to the runner
+		if key == "roles" || len(value) == 0 || isLauncherParameter(key) {
+			continue
+		}
+		if strict && !declaredClaim(key, questionnaireSchema) {
+			dropped = append(dropped, key)
+			continue
+		}
+		claimValue := value[0]
+		if trimmed(key) {
+			claimValue = strings.TrimSpace(claimValue)
+		}
+		if claimValue == EmptyClaimValue {
+			claims[key] = ""
+		} else if claimValue != "" {
+			claims[key] = claimValue
+		}
+	}
+	if len(dropped) > 0 {
+		sort.Strings(dropped)
+		logging.FromContext(ctx).Info("dropping form fields which aren't known claims", "fields", dropped)
+	}
+	emptyRequiredMetadata(questionnaireSchema.Metadata, claims, claimValues)
+	for _, name := range []string{"account_service_url", "account_service_log_out_url"} {
+		if accountServiceURL, ok := claims[name].(string); ok {
+			claims[name] = normaliseTrailingSlash(accountServiceURL)
 		}
 	}
     var isCensusTestSchema = len(claimValues["schema_name"]) > 0 && claimValues["schema_name"][0] == "test_individual_response"
 	if !isCensusTestSchema && (len(claimValues["survey"]) > 0 || len(claimValues["form_type"]) > 0 || len(claimValues["region_code"]) > 0) {
-		log.Println("Deleting schema name from claims")
+		logging.FromContext(ctx).Debug("deleting schema name from claims")
 		delete(claims, "schema_name")
 	} else {
 		// When quicklaunching, schema_name will not be set, but launcherSchema will have the schema_name.
@@ -154,115 +329,430 @@ func generateClaims(claimValues map[string][]string, launcherSchema surveys.Laun
 		}
 	}
 
-	log.Printf("Using claims: %s", claims)
+	logging.FromContext(ctx).Debug("using claims", "tx_id", claims["tx_id"], "schema_name", claims["schema_name"], "claims", claims)
+
+	return claims, nil
+}
+
+// trimmedClaims returns whether a claim's value should have leading and trailing whitespace removed, which is all of
+// them when TRIM_CLAIM_VALUES is set apart from the TRIM_CLAIM_VALUES_EXCLUDED, such as pasted values with a trailing
+// space the runner would reject
+func trimmedClaims() func(name string) bool {
+	if !settings.GetBool("TRIM_CLAIM_VALUES") {
+		return func(string) bool { return false }
+	}
+
+	excluded := make(map[string]bool)
+	for _, name := range settings.GetList("TRIM_CLAIM_VALUES_EXCLUDED") {
+		excluded[name] = true
+	}
+	return func(name string) bool { return !excluded[name] }
+}
+
+// normaliseRegionCode returns a region code such as gb_eng in the form GB-ENG the runner expects
+func normaliseRegionCode(regionCode string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(regionCode), "_", "-", -1))
+}
+
+// normaliseRegionCodes normalises the region_code values before any claims are assembled from them, so the claim is
+// the same whether it is given or filled in as metadata. EmptyClaimValue is left as it is.
+func normaliseRegionCodes(values url.Values) {
+	for i, regionCode := range values["region_code"] {
+		if regionCode != EmptyClaimValue {
+			values["region_code"][i] = normaliseRegionCode(regionCode)
+		}
+	}
+}
+
+// normaliseTrailingSlash removes the trailing slash from an account service URL when ACCOUNT_SERVICE_URL_TRAILING_SLASH
+// is "strip", or adds one when it is "ensure", for runners which only accept one form
+func normaliseTrailingSlash(accountServiceURL string) string {
+	switch settings.Get("ACCOUNT_SERVICE_URL_TRAILING_SLASH") {
+	case "strip":
+		return strings.TrimRight(accountServiceURL, "/")
+	case "ensure":
+		if accountServiceURL != "" && !strings.HasSuffix(accountServiceURL, "/") {
+			return accountServiceURL + "/"
+		}
+	}
+	return accountServiceURL
+}
+
+// defaultTxID returns the request ID when it is a UUID, so the same identifier flows from the launcher's logs into
+// the runner's, otherwise a new UUID
+func defaultTxID(ctx context.Context) (string, error) {
+	if id, err := uuid.FromString(requestid.FromContext(ctx)); err == nil {
+		return id.String(), nil
+	}
+
+	return NewIdentifier()
+}
+
+// txIDNamespace is the UUIDv5 namespace of the tx_ids derived by deterministicTxID
+var txIDNamespace = uuid.Must(uuid.FromString("96bbd076-f8e2-4f33-b821-015554005f72"))
+
+// deterministicTxID returns a UUIDv5 derived from the hash of the launch values, so the same values always give the
+// same tx_id, for golden file and idempotency tests run with DETERMINISTIC_TX_ID
+func deterministicTxID(claimValues map[string][]string) (string, error) {
+	values := make(map[string]interface{}, len(claimValues))
+	for key, value := range claimValues {
+		values[key] = value
+	}
+
+	hash, err := ClaimsHash(values)
+	if err != nil {
+		return "", err
+	}
+	return uuid.NewV5(txIDNamespace, hash).String(), nil
+}
+
+// newUUID is the source of the UUIDs generated for tx_id, jti and collection_exercise_sid. Tests can replace it to
+// force the failure path.
+var newUUID = uuid.NewV4
+
+// NewIdentifier returns a new UUID for the identifiers in a token, including those launch handlers generate
+// themselves, trying once more if generating it fails. A token with an empty identifier would only be rejected by the
+// runner with a misleading message, so a second failure is returned as an error.
+func NewIdentifier() (string, error) {
+	id, err := newUUID()
+	if err != nil {
+		id, err = newUUID()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to generate UUID: %w", err)
+	}
+	return id.String(), nil
+}
+
+// defaultTokenLifetime is how long a token is valid for, unless TokenOptions overrides it
+const defaultTokenLifetime = 10 * time.Minute
+
+// limitLifetime checks the requested lifetime against JWT_MAX_LIFETIME. Longer lifetimes are rejected, or cut down to
+// the maximum when JWT_MAX_LIFETIME_MODE is clamp.
+func limitLifetime(ctx context.Context, options TokenOptions) (TokenOptions, *LaunchError) {
+	maxLifetime := settings.GetDuration("JWT_MAX_LIFETIME")
+	if maxLifetime <= 0 || options.Lifetime <= maxLifetime {
+		return options, nil
+	}
+
+	if settings.Get("JWT_MAX_LIFETIME_MODE") == "clamp" {
+		logging.FromContext(ctx).Warn("clamping token lifetime to JWT_MAX_LIFETIME", "requested", options.Lifetime, "max_lifetime", maxLifetime)
+		options.Lifetime = maxLifetime
+		return options, nil
+	}
+
+	return options, metadataLaunchError([]MetadataError{{Name: "exp", Reason: fmt.Sprintf("must not be more than %s", maxLifetime)}})
+}
+
+// Clock returns the time the iat and exp claims are based on, and which launches count down to their expiry from.
+// Tests can replace it to pin the claims to a fixed time.
+var Clock = time.Now
+
+// setExpiry sets the exp claim to lifetime from now, or the default lifetime when it is zero, returning the expiry
+func setExpiry(claims map[string]interface{}, lifetime time.Duration) time.Time {
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+
+	// The exp claim only has a resolution of seconds
+	expiresAt := Clock().Add(lifetime).Truncate(time.Second)
+	claims["exp"] = numericDate(expiresAt)
+
+	return expiresAt
+}
 
-	return claims
+// numericDate returns t as epoch seconds for the iat, exp and nbf claims. They are kept as int64 rather than
+// jwt.NumericDate, so they encode as JSON numbers in the token, dry runs and debug claims alike.
+func numericDate(t time.Time) int64 {
+	return t.Unix()
 }
 
-// GenerateJwtClaims creates a jwtClaim needed to generate a token
-func GenerateJwtClaims() (jwtClaims map[string]interface{}) {
-	issued := time.Now()
-	expires := issued.Add(time.Minute * 10) // TODO: Support custom exp: r.PostForm.Get("exp")
+// GenerateJwtClaims creates a jwtClaim needed to generate a token. When JWT_CLOCK_SKEW is set, iat is back-dated by
+// the skew and nbf is set to match, so runners whose clocks are slightly behind still accept the token.
+func GenerateJwtClaims() (jwtClaims map[string]interface{}, err error) {
+	now := Clock()
+	expires := now.Add(defaultTokenLifetime)
 
 	jwtClaims = make(map[string]interface{})
 
-	jwtClaims["iat"] = jwt.NewNumericDate(issued)
-	jwtClaims["exp"] = jwt.NewNumericDate(expires)
-	jti, _ := uuid.NewV4()
-	jwtClaims["jti"] = jti.String()
+	if skew := settings.GetDuration("JWT_CLOCK_SKEW"); skew > 0 {
+		issued := now.Add(-skew)
+		jwtClaims["iat"] = numericDate(issued)
+		jwtClaims["nbf"] = numericDate(issued)
+	} else {
+		jwtClaims["iat"] = numericDate(now)
+	}
+	jwtClaims["exp"] = numericDate(expires)
+	jti, err := NewIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	jwtClaims["jti"] = jti
 
-	return jwtClaims
+	return jwtClaims, nil
 }
 
-func launcherSchemaFromURL(url string) (launcherSchema surveys.LauncherSchema, error string) {
-	resp, err := clients.GetHTTPClient().Get(url)
+// checkSchemaHost returns an error if SCHEMA_HOST_ALLOWLIST is set and doesn't include the schema URL's host
+func checkSchemaHost(schemaURL string) string {
+	allowedHosts := settings.GetList("SCHEMA_HOST_ALLOWLIST")
+	if len(allowedHosts) == 0 {
+		return ""
+	}
+
+	parsedURL, err := url.Parse(schemaURL)
 	if err != nil {
-		panic(err)
+		return fmt.Sprintf("Invalid schema URL %s", schemaURL)
 	}
 
-	if resp.StatusCode != 200 {
-		return launcherSchema, fmt.Sprintf("Failed to load Schema from %s", url)
+	for _, host := range allowedHosts {
+		if strings.EqualFold(host, parsedURL.Host) || strings.EqualFold(host, parsedURL.Hostname()) {
+			return ""
+		}
 	}
 
-	responseBody, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	return fmt.Sprintf("Schema host %s is not in the allowed list of schema hosts", parsedURL.Host)
+}
+
+// launcherSchemaFromURL fetches and validates the quicklaunch schema at url, returning an error describing which step
+// failed. Failures to fetch the schema wrap the client's error.
+func launcherSchemaFromURL(ctx context.Context, url string) (launcherSchema surveys.LauncherSchema, err error) {
+	if hostError := checkSchemaHost(url); hostError != "" {
+		logging.FromContext(ctx).Warn("rejected quicklaunch schema URL", "survey_url", url)
+		return launcherSchema, errors.New(hostError)
+	}
+
+	timings := timingsFromContext(ctx)
+
+	var schemaJSON json.RawMessage
+	fetchStart := time.Now()
+	err = clients.GetJSONLimit(ctx, withSchemaQueryParams(ctx, url), maxSchemaBytes(), &schemaJSON)
+	if fallbackURL := runnerFallbackURL(url, err); fallbackURL != "" {
+		logging.FromContext(ctx).Warn("quicklaunch schema not found, trying survey runner", "survey_url", url, "fallback_url", fallbackURL)
+		if fallbackErr := clients.GetJSONLimit(ctx, withSchemaQueryParams(ctx, fallbackURL), maxSchemaBytes(), &schemaJSON); fallbackErr == nil {
+			url, err = fallbackURL, nil
+		} else {
+			err = fmt.Errorf("%w (fallback to %s failed: %v)", err, fallbackURL, fallbackErr)
+		}
+	}
+	timings.SchemaFetch += time.Since(fetchStart)
 	if err != nil {
-		panic(err)
+		logging.FromContext(ctx).Error("failed to load schema", "survey_url", url, "error", err)
+		return launcherSchema, fmt.Errorf("Failed to load Schema from %s: %w", url, err)
 	}
 
-	validationError := validateSchema(responseBody)
-	if validationError != "" {
+	validationStart := time.Now()
+	validationError := validateSchema(ctx, schemaJSON)
+	timings.Validation += time.Since(validationStart)
+	if validationError != nil {
 		return launcherSchema, validationError
 	}
 
 	var schema QuestionnaireSchema
-	if err := json.Unmarshal(responseBody, &schema); err != nil {
-		panic(err)
+	if err := json.Unmarshal(schemaJSON, &schema); err != nil {
+		return launcherSchema, fmt.Errorf("Failed to unmarshal Schema from %s: %v", url, err)
 	}
 
 	cacheBust := ""
 	if !strings.Contains(url, "?") {
-		cacheBust = "?bust=" + time.Now().Format("20060102150405")
+		cacheBust = "?bust=" + Clock().Format("20060102150405")
 	}
 
-	schemaName := ""
-
-	if schema.SchemaName == "" {
-		lastSlash := strings.LastIndex(url, "/")
-		if lastSlash != -1 {
-			lastDot := strings.LastIndex(url, ".")
-			if lastDot == -1 {
-				lastDot = len(url)
-			}
-			schemaName = url[lastSlash+1 : lastDot]
+	schemaName := schema.SchemaName
+	if schemaName == "" {
+		schemaName = schemaNameFromPath(url)
+	}
+	if schemaName == "" {
+		fallbackName := settings.Get("QUICKLAUNCH_FALLBACK_SCHEMA_NAME")
+		if fallbackName == "" {
+			return launcherSchema, fmt.Errorf("Unable to derive a schema name from %s, add schema_name to the schema or set QUICKLAUNCH_FALLBACK_SCHEMA_NAME", url)
 		}
-	} else {
-		schemaName = schema.SchemaName
+		logging.FromContext(ctx).Warn("unable to derive quicklaunch schema_name, using fallback", "survey_url", url, "schema_name", fallbackName)
+		schemaName = fallbackName
 	}
 
-	log.Println("Quicklaunch schema_name set to: ", schemaName)
+	schemaName = applySchemaNameCase(schemaName)
+	logging.FromContext(ctx).Info("quicklaunch schema_name set", "schema_name", schemaName)
 
 	launcherSchema = surveys.LauncherSchema{
-		URL:  url + cacheBust,
-		Name: schemaName,
+		URL:       url + cacheBust,
+		Name:      schemaName,
+		CacheBust: cacheBust,
+	}
+	if registered, ok := surveys.FindRegisteredSurveyByURL(ctx, url); ok {
+		launcherSchema.AccountServiceURL = registered.AccountServiceURL
+		launcherSchema.AccountServiceLogOutURL = registered.AccountServiceLogOutURL
 	}
 
-	return launcherSchema, ""
+	return launcherSchema, nil
 }
 
-func validateSchema(payload []byte) (error string) {
-	if settings.Get("SCHEMA_VALIDATOR_URL") == "" {
+// defaultMaxSchemaBytes is used when MAX_SCHEMA_BYTES isn't a positive number
+const defaultMaxSchemaBytes = 5 << 20
+
+// maxSchemaBytes is the largest schema which will be read, so a very large response can't exhaust the launcher's
+// memory
+func maxSchemaBytes() int64 {
+	if maxBytes := settings.GetInt("MAX_SCHEMA_BYTES"); maxBytes > 0 {
+		return int64(maxBytes)
+	}
+	return defaultMaxSchemaBytes
+}
+
+// withSchemaQueryParams adds the SCHEMA_QUERY_PARAMS to a schema URL when fetching it. Parameters already in the URL,
+// such as the cache bust, are kept as they are rather than replaced.
+func withSchemaQueryParams(ctx context.Context, schemaURL string) string {
+	params, err := url.ParseQuery(settings.Get("SCHEMA_QUERY_PARAMS"))
+	if err != nil {
+		logging.FromContext(ctx).Warn("ignoring invalid SCHEMA_QUERY_PARAMS", "error", err)
+		return schemaURL
+	}
+	if len(params) == 0 {
+		return schemaURL
+	}
+
+	parsedURL, err := url.Parse(schemaURL)
+	if err != nil {
+		return schemaURL
+	}
+
+	existing := parsedURL.Query()
+	extra := url.Values{}
+	for name, value := range params {
+		if _, ok := existing[name]; !ok {
+			extra[name] = value
+		}
+	}
+	if len(extra) == 0 {
+		return schemaURL
+	}
+
+	if parsedURL.RawQuery != "" {
+		parsedURL.RawQuery += "&"
+	}
+	parsedURL.RawQuery += extra.Encode()
+	return parsedURL.String()
+}
+
+// runnerFallbackURL returns the survey runner URL to retry a quicklaunch schema against when fetching it returned
+// a 404 and QUICKLAUNCH_RUNNER_FALLBACK is enabled, or an empty string if no fallback should be attempted
+func runnerFallbackURL(schemaURL string, err error) string {
+	var httpErr *clients.HTTPError
+	if !settings.GetBool("QUICKLAUNCH_RUNNER_FALLBACK") || !errors.As(err, &httpErr) || httpErr.StatusCode != 404 {
 		return ""
 	}
 
-	validateURL, _ := url.Parse(settings.Get("SCHEMA_VALIDATOR_URL"))
-	validateURL.Path = path.Join(validateURL.Path, "validate")
+	schemaName := schemaNameFromPath(schemaURL)
+	if schemaName == "" {
+		return ""
+	}
 
-	log.Println("Validating schema: ", validateURL.String())
+	fallbackURL, err := clients.JoinURL(settings.Get("SURVEY_RUNNER_SCHEMA_URL"), "schemas", schemaName)
+	if err != nil {
+		return ""
+	}
+	return fallbackURL
+}
 
-	resp, err := http.Post(validateURL.String(), "application/json", bytes.NewBuffer(payload))
+// schemaNameFromPath returns the last element of a schema URL's path without its extension, such as test_checkbox
+// for https://example.com/schemas/test_checkbox.json, or an empty string when the URL has no path
+func schemaNameFromPath(schemaURL string) string {
+	parsedURL, err := url.Parse(schemaURL)
 	if err != nil {
-		return err.Error()
+		return ""
+	}
+
+	schemaName := strings.TrimSuffix(path.Base(parsedURL.Path), path.Ext(parsedURL.Path))
+	if schemaName == "." || schemaName == "/" {
+		return ""
+	}
+	return schemaName
+}
+
+// ValidatorError is the schema validator's response when it doesn't accept a schema. A 4xx status means the schema
+// is invalid, and a 5xx status that the validator itself failed.
+type ValidatorError struct {
+	URL        string
+	StatusCode int
+
+	// Body is the start of the validator's response, describing what's wrong with the schema.
+	Body string
+}
+
+func (e *ValidatorError) Error() string {
+	return fmt.Sprintf("schema validator returned %d: %s", e.StatusCode, e.Body)
+}
+
+// validateSchema posts the schema to the validator when SCHEMA_VALIDATOR_URL is set, giving up after
+// SCHEMA_VALIDATOR_TIMEOUT so a hung validator can't hold up the launch. Responses other than 2xx are returned as a
+// *ValidatorError.
+func validateSchema(ctx context.Context, payload json.RawMessage) error {
+	if settings.Get("SCHEMA_VALIDATOR_URL") == "" {
+		return nil
 	}
 
-	responseBody, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	validateURL, err := clients.JoinURL(settings.Get("SCHEMA_VALIDATOR_URL"), "validate")
 	if err != nil {
-		return err.Error()
+		return fmt.Errorf("invalid SCHEMA_VALIDATOR_URL: %w", err)
 	}
 
-	if resp.StatusCode != 200 {
-		return string(responseBody)
+	if timeout := settings.GetDuration("SCHEMA_VALIDATOR_TIMEOUT"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	return ""
+	logging.FromContext(ctx).Info("validating schema", "validator_url", validateURL)
+
+	retries := settings.GetInt("VALIDATOR_RETRIES")
+	for attempt := 0; ; attempt++ {
+		// The schema is posted as it was loaded, since encoding it again would hold a second copy of a large schema in memory
+		err = clients.PostJSONReader(ctx, validateURL, bytes.NewReader(payload), nil)
+
+		var httpErr *clients.HTTPError
+		if errors.As(err, &httpErr) {
+			err = &ValidatorError{URL: httpErr.URL, StatusCode: httpErr.StatusCode, Body: httpErr.Body}
+		}
+		if attempt >= retries || !retryableValidatorError(ctx, err) {
+			return err
+		}
+
+		logging.FromContext(ctx).Warn("retrying schema validation", "attempt", attempt+1, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt+1) * 100 * time.Millisecond):
+		}
+	}
+}
+
+// retryableValidatorError reports whether validating again might succeed, which is only the case for connection errors
+// and 5xx responses. A schema the validator rejected fails the same way every time.
+func retryableValidatorError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil || errors.Is(err, clients.ErrCircuitOpen) {
+		return false
+	}
+
+	var validatorErr *ValidatorError
+	if errors.As(err, &validatorErr) {
+		return validatorErr.StatusCode >= 500
+	}
+	return true
 }
 
+// getSchemaClaims returns the claim with the URL of a schema launched from one, which is survey_url unless
+// SCHEMA_URL_CLAIM names another claim, such as schema_url for runners which expect that
 func getSchemaClaims(LauncherSchema surveys.LauncherSchema) map[string]interface{} {
 
 	schemaClaims := make(map[string]interface{})
 	if LauncherSchema.URL != "" {
-		schemaClaims["survey_url"] = LauncherSchema.URL
+		claimName := settings.Get("SCHEMA_URL_CLAIM")
+		schemaClaims[claimName] = LauncherSchema.URL
+
+		// The cache bust is only for fetching the schema, so runners which log or reject unknown parameters can be
+		// given the URL without it
+		if settings.GetBool("STRIP_SURVEY_URL_CACHE_BUST") && LauncherSchema.CacheBust != "" {
+			schemaClaims[claimName] = strings.TrimSuffix(LauncherSchema.URL, LauncherSchema.CacheBust)
+		}
 	}
 
 	return schemaClaims
@@ -288,45 +778,340 @@ func (e *TokenError) Error() string {
 	return err
 }
 
-// generateTokenFromClaims creates a token though encryption using the private and public keys
-func generateTokenFromClaims(cl map[string]interface{}) (string, *TokenError) {
-	privateKeyResult, keyErr := loadSigningKey()
-	if keyErr != nil {
-		return "", &TokenError{Desc: "Error loading signing key", From: keyErr}
+// Categories of LaunchError, by the stage of the launch which failed
+const (
+	LaunchErrorSchemaNotFound = "schema_not_found"
+	LaunchErrorSchema         = "schema_error"
+	LaunchErrorMetadata       = "metadata_error"
+	LaunchErrorUpstream       = "upstream_unavailable"
+	LaunchErrorKey            = "key_error"
+	LaunchErrorConfiguration  = "configuration_error"
+	LaunchErrorIdentifier     = "identifier_error"
+)
+
+// schemaLoadError categorises a failure to load the questionnaire schema for a launch
+func schemaLoadError(err error) *LaunchError {
+	launchErr := &LaunchError{Kind: LaunchErrorMetadata, Desc: fmt.Sprintf("GetRequiredMetadata failed err: %v", err), Err: err}
+
+	var httpErr *clients.HTTPError
+	var urlErr *url.Error
+	var validatorErr *ValidatorError
+	switch {
+	case errors.Is(err, clients.ErrResponseTooLarge):
+		launchErr.Kind = LaunchErrorSchema
+		launchErr.Desc = fmt.Sprintf("The schema is larger than MAX_SCHEMA_BYTES (%d bytes)", maxSchemaBytes())
+	case errors.As(err, &validatorErr) && validatorErr.StatusCode >= 500:
+		launchErr.Kind = LaunchErrorUpstream
+		launchErr.Dependency = "schema validator"
+	case errors.As(err, &validatorErr):
+		launchErr.Kind = LaunchErrorSchema
+	case errors.Is(err, clients.ErrRedirectNotFollowed):
+		launchErr.Kind = LaunchErrorSchema
+	case errors.Is(err, ErrReservedMetadata):
+		launchErr.Kind = LaunchErrorSchema
+		launchErr.Desc = err.Error()
+	case errors.As(err, &httpErr) && httpErr.StatusCode == 404:
+		launchErr.Kind = LaunchErrorSchemaNotFound
+	case errors.As(err, &httpErr) && httpErr.StatusCode >= 500:
+		launchErr.Kind = LaunchErrorUpstream
+		launchErr.Dependency = dependencyName(httpErr.URL)
+	case errors.As(err, &urlErr):
+		// The request failed without a response, such as a refused connection, a timeout or an open circuit
+		launchErr.Kind = LaunchErrorUpstream
+		launchErr.Dependency = dependencyName(urlErr.URL)
+	}
+
+	return launchErr
+}
+
+// quicklaunchSchemaError categorises a failure from launcherSchemaFromURL. Failures to fetch the schema are
+// categorised as for schemaLoadError, and anything else means the schema itself can't be used.
+func quicklaunchSchemaError(err error) *LaunchError {
+	launchErr := schemaLoadError(err)
+	if launchErr.Kind == LaunchErrorMetadata {
+		launchErr.Kind = LaunchErrorSchema
 	}
+	launchErr.Desc = err.Error()
+	return launchErr
+}
+
+// identifierLaunchError returns a LaunchError for a failure to generate the launch's identifiers
+func identifierLaunchError(err error) *LaunchError {
+	return &LaunchError{Kind: LaunchErrorIdentifier, Desc: err.Error(), Err: err}
+}
+
+// metadataLaunchError returns a LaunchError listing the metadata values which aren't valid
+func metadataLaunchError(metadataErrors []MetadataError) *LaunchError {
+	descriptions := make([]string, len(metadataErrors))
+	for i, metadataError := range metadataErrors {
+		descriptions[i] = metadataError.Error()
+	}
+
+	return &LaunchError{Kind: LaunchErrorMetadata, Desc: strings.Join(descriptions, ", "), Fields: metadataErrors}
+}
+
+// dependencyName names the service a URL belongs to, for errors which are shown to users
+func dependencyName(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "schema host"
+	}
+
+	services := []struct{ name, setting string }{
+		{"survey runner", "SURVEY_RUNNER_SCHEMA_URL"},
+		{"survey runner", "SURVEY_RUNNER_URL"},
+		{"survey register", "SURVEY_REGISTER_URL"},
+		{"schema validator", "SCHEMA_VALIDATOR_URL"},
+	}
+	for _, service := range services {
+		if serviceURL, err := url.Parse(settings.Get(service.setting)); err == nil && serviceURL.Host != "" && strings.EqualFold(serviceURL.Host, parsedURL.Host) {
+			return service.name
+		}
+	}
+
+	return "schema host " + parsedURL.Host
+}
+
+// TokenOptions adjust how GenerateLaunch builds a token. The zero value gives the same token as GenerateTokenFromPost.
+type TokenOptions struct {
+	// Unencrypted returns a token which is signed but not encrypted.
+	Unencrypted bool
+
+	// Lifetime overrides how long the token is valid for when non-zero.
+	Lifetime time.Duration
+
+	// DryRun skips generating the token, returning only the claims it would carry.
+	DryRun bool
 
-	publicKeyResult, keyErr := loadEncryptionKey()
+	// ContentEncryption overrides JWT_CONTENT_ENCRYPTION for this token when it is a valid algorithm.
+	ContentEncryption string
+
+	// SignedCopy also returns the claims as a signed but unencrypted token, for testers who can only verify signatures.
+	SignedCopy bool
+
+	// metadataDefaults fills the schema's metadata which wasn't given with its defaults, for quick launches.
+	metadataDefaults bool
+}
+
+// Launch is a generated token along with the claims it carries
+type Launch struct {
+	Token     string
+	Claims    map[string]interface{}
+	ExpiresAt time.Time
+
+	// Payload is the base64url JWS payload when JWT_DETACHED_PAYLOAD leaves it out of an unencrypted Token.
+	Payload string
+
+	// SignedToken is a signed but unencrypted copy of an encrypted Token, for TokenOptions.SignedCopy.
+	SignedToken string
+
+	// URL is the runner URL which starts a session with the token.
+	URL string
+
+	// Warnings describe problems which didn't stop the token being generated, but which the runner may reject it
+	// for, such as required metadata the launcher had no value for.
+	Warnings []string
+
+	// SigningKID and EncryptionKID are the kids of the keys the token was made with. EncryptionKID is empty for an
+	// unencrypted token.
+	SigningKID    string
+	EncryptionKID string
+}
+
+func newLaunch(generated *generatedToken, claims map[string]interface{}, expiresAt time.Time) *Launch {
+	return &Launch{
+		Token:         generated.Token,
+		Payload:       generated.Payload,
+		Claims:        claims,
+		ExpiresAt:     expiresAt,
+		URL:           SessionURL(generated.Token),
+		SigningKID:    generated.SigningKID,
+		EncryptionKID: generated.EncryptionKID,
+	}
+}
+
+// LaunchError describes an error that can occur while generating a launch token
+type LaunchError struct {
+	// Kind is the category of the error, such as LaunchErrorSchema.
+	Kind string
+
+	// Desc is a description of the error that occurred.
+	Desc string
+
+	// Fields lists the metadata values which aren't valid, for LaunchErrorMetadata.
+	Fields []MetadataError
+
+	// Dependency names the service which couldn't be reached, for LaunchErrorUpstream.
+	Dependency string
+
+	// Err is the error the launch failed with, if any, for errors.Is and errors.As.
+	Err error
+}
+
+func (e *LaunchError) Error() string {
+	if e == nil {
+		return "<nil>"
+	}
+	return e.Desc
+}
+
+// Unwrap returns the error the launch failed with
+func (e *LaunchError) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// generatedToken is a token from generateTokenFromClaims, with the kids of the keys it was made with
+type generatedToken struct {
+	Token         string
+	Payload       string
+	SigningKID    string
+	EncryptionKID string
+}
+
+// generateTokenFromClaims creates a token though encryption using the private and public keys
+func generateTokenFromClaims(ctx context.Context, cl map[string]interface{}, signingKeyID string, options TokenOptions) (*generatedToken, *TokenError) {
+	generationStart := time.Now()
+	defer func() {
+		timingsFromContext(ctx).TokenGeneration += time.Since(generationStart)
+	}()
+
+	privateKeyResult, keyErr := signingKeyForContext(ctx, signingKeyID)
 	if keyErr != nil {
-		return "", &TokenError{Desc: "Error loading encryption key", From: keyErr}
+		return nil, &TokenError{Desc: "Error loading signing key", From: keyErr}
 	}
 
+	typ := jose.ContentType(settings.Get("JWT_TYP"))
+
 	opts := jose.SignerOptions{}
-	opts.WithType("JWT")
+	opts.WithType(typ)
 	opts.WithHeader("kid", privateKeyResult.kid)
 
-	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: privateKeyResult.key}, &opts)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: signingAlgorithm, Key: privateKeyResult.key}, &opts)
 	if err != nil {
-		return "", &TokenError{Desc: "Error creating JWT signer", From: err}
+		return nil, &TokenError{Desc: "Error creating JWT signer", From: err}
+	}
+
+	var publicKeyResult *PublicKeyResult
+	if !options.Unencrypted {
+		publicKeyResult, keyErr = encryptionKeyForContext(ctx)
+		if keyErr != nil && !signedOnlyFallback(keyErr) {
+			return nil, &TokenError{Desc: "Error loading encryption key", From: keyErr}
+		}
+		if keyErr != nil {
+			logging.FromContext(ctx).Warn("encryption key missing, generating an UNENCRYPTED signed-only token because SIGNED_ONLY_FALLBACK is set", "tx_id", cl["tx_id"], "error", keyErr)
+			options.Unencrypted = true
+		}
+	}
+
+	if options.Unencrypted {
+		token, err := jwt.Signed(signer).Claims(cl).CompactSerialize()
+		if err != nil {
+			return nil, &TokenError{Desc: "Error signing JWT", From: err}
+		}
+
+		if settings.GetBool("JWT_DETACHED_PAYLOAD") {
+			token, payload := detachPayload(token)
+			logging.FromContext(ctx).Info("created signed JWT with detached payload", "tx_id", cl["tx_id"], "duration", time.Since(generationStart))
+			return &generatedToken{Token: token, Payload: payload, SigningKID: privateKeyResult.kid}, nil
+		}
+
+		logging.FromContext(ctx).Info("created signed JWT", "tx_id", cl["tx_id"], "duration", time.Since(generationStart))
+
+		return &generatedToken{Token: token, SigningKID: privateKeyResult.kid}, nil
+	}
+
+	logging.FromContext(ctx).Debug("using keys", "signing_kid", privateKeyResult.kid, "encryption_kid", publicKeyResult.kid)
+	// The same kid for both means one key pair was configured for signing and encryption, which the runner rejects.
+	// The kids are hashes of the PEM files, so the keys themselves are compared too.
+	if publicKeyResult.kid == privateKeyResult.kid || publicKeyResult.key.Equal(&privateKeyResult.key.PublicKey) {
+		logging.FromContext(ctx).Warn("signing and encryption keys have the same kid, so are probably the same key pair", "kid", privateKeyResult.kid)
+	}
+
+	enc, encErr := contentEncryption(ctx, options.ContentEncryption)
+	if encErr != nil {
+		return nil, encErr
 	}
 
 	encryptor, err := jose.NewEncrypter(
-		jose.A256GCM,
-		jose.Recipient{Algorithm: jose.RSA_OAEP, Key: publicKeyResult.key, KeyID: publicKeyResult.kid},
-		(&jose.EncrypterOptions{}).WithType("JWT").WithContentType("JWT"))
+		enc,
+		jose.Recipient{Algorithm: keyEncryptionAlgorithm, Key: publicKeyResult.key, KeyID: publicKeyResult.kid},
+		(&jose.EncrypterOptions{}).WithType(typ).WithContentType("JWT"))
 
 	if err != nil {
-		return "", &TokenError{Desc: "Error creating JWT signer", From: err}
+		return nil, &TokenError{Desc: "Error creating JWT signer", From: err}
 	}
 
 	token, err := jwt.SignedAndEncrypted(signer, encryptor).Claims(cl).CompactSerialize()
 
 	if err != nil {
-		return "", &TokenError{Desc: "Error signing and encrypting JWT", From: err}
+		return nil, &TokenError{Desc: "Error signing and encrypting JWT", From: err}
+	}
+
+	logging.FromContext(ctx).Info("created signed/encrypted JWT", "tx_id", cl["tx_id"], "enc", enc, "duration", time.Since(generationStart))
+
+	return &generatedToken{Token: token, SigningKID: privateKeyResult.kid, EncryptionKID: publicKeyResult.kid}, nil
+}
+
+// signedOnlyFallback reports whether a launch can go ahead with a signed-only token when the encryption key is missing,
+// which SIGNED_ONLY_FALLBACK allows for local development without one. A key which exists but can't be used still
+// fails.
+func signedOnlyFallback(keyErr *KeyLoadError) bool {
+	return settings.GetBool("SIGNED_ONLY_FALLBACK") && keyErr.Op == "read"
+}
+
+// detachPayload splits a compact JWS into the detached form header..signature and its base64url payload, as in
+// RFC 7515 Appendix F. The signature still covers the payload, so it verifies once the payload is put back between
+// the dots.
+func detachPayload(token string) (detached string, payload string) {
+	parts := strings.SplitN(token, ".", 3)
+	if len(parts) != 3 {
+		return token, ""
+	}
+	return parts[0] + ".." + parts[2], parts[1]
+}
+
+// signedCopy returns the claims as a compact JWS signed with the same key as the launch's token but not encrypted,
+// so they can be checked with only the public signing key. The payload is always attached.
+func signedCopy(ctx context.Context, claims map[string]interface{}, signingKeyID string) (string, *TokenError) {
+	generated, tokenErr := generateTokenFromClaims(ctx, claims, signingKeyID, TokenOptions{Unencrypted: true})
+	if tokenErr != nil {
+		return "", tokenErr
+	}
+	if generated.Payload == "" {
+		return generated.Token, nil
+	}
+
+	parts := strings.SplitN(generated.Token, ".", 3)
+	return parts[0] + "." + generated.Payload + "." + parts[2], nil
+}
+
+// addVersionClaim defaults the version claim to the schema's version when one wasn't supplied
+func addVersionClaim(claims map[string]interface{}, schema QuestionnaireSchema) {
+	if _, ok := claims["version"]; ok {
+		return
+	}
+	if version := schema.version(); version != "" {
+		claims["version"] = version
 	}
+}
 
-	log.Println("Created signed/encrypted JWT:", token)
+// addSchemaHashClaim adds the schema_hash claim when SCHEMA_HASH_CLAIM is set, so a launch can be traced to the exact
+// schema body it was generated from
+func addSchemaHashClaim(claims map[string]interface{}, schema QuestionnaireSchema) {
+	if settings.GetBool("SCHEMA_HASH_CLAIM") && schema.hash != "" {
+		claims["schema_hash"] = schema.hash
+	}
+}
 
-	return token, nil
+// addLauncherVersionClaim adds the launcher_version claim when LAUNCHER_VERSION_CLAIM is set, so a token can be traced
+// to the launcher release which generated it
+func addLauncherVersionClaim(claims map[string]interface{}) {
+	if settings.GetBool("LAUNCHER_VERSION_CLAIM") {
+		claims["launcher_version"] = version.Get().Version
+	}
 }
 
 func getBooleanOrDefault(key string, values map[string][]string, defaultValue bool) bool {
@@ -340,162 +1125,493 @@ func getBooleanOrDefault(key string, values map[string][]string, defaultValue bo
 
 func getStringOrDefault(key string, values map[string][]string, defaultValue string) string {
 	if keyValues, ok := values[key]; ok {
+		if keyValues[0] == EmptyClaimValue {
+			return ""
+		}
 		return keyValues[0]
 	}
 
 	return defaultValue
 }
 
-// GenerateTokenFromDefaults coverts a set of DEFAULT values into a JWT
-func GenerateTokenFromDefaults(surveyURL string, accountServiceURL string, accountServiceLogOutURL string, urlValues url.Values) (token string, error string) {
-	launcherSchema, validationError := launcherSchemaFromURL(surveyURL)
-	if validationError != "" {
-		return "", validationError
+// defaultTradAsToRuName sets trad_as to the launch's ru_name, whether given or defaulted, when TRAD_AS_FROM_RU_NAME is
+// set and the schema's trad_as wasn't given, so the two names don't contradict each other
+func defaultTradAsToRuName(metadata []Metadata, claims map[string]interface{}, values map[string][]string) {
+	if !settings.GetBool("TRAD_AS_FROM_RU_NAME") || len(values["trad_as"]) > 0 && values["trad_as"][0] != "" {
+		return
+	}
+
+	ruName, ok := claims["ru_name"].(string)
+	if !ok || ruName == "" {
+		return
+	}
+	for _, item := range metadata {
+		if item.Name == "trad_as" {
+			claims["trad_as"] = ruName
+			return
+		}
 	}
+}
+
+// accountServiceURLs are the account service URLs configured for a launch channel
+type accountServiceURLs struct {
+	AccountServiceURL       string `json:"account_service_url"`
+	AccountServiceLogOutURL string `json:"account_service_log_out_url"`
+}
 
-	claims := make(map[string]interface{})
-	urlValues["account_service_url"] = []string{accountServiceURL}
-	urlValues["account_service_log_out_url"] = []string{accountServiceLogOutURL}
-	claims = generateClaims(urlValues, launcherSchema)
+// channelAccountServiceURLs returns the account service URLs mapped to the channel in CHANNEL_ACCOUNT_SERVICE_URLS, if any
+func channelAccountServiceURLs(channel string) accountServiceURLs {
+	var channelURLs map[string]accountServiceURLs
 
-	requiredMetadata, error := GetRequiredMetadata(launcherSchema)
-	if error != "" {
-		return "", fmt.Sprintf("GetRequiredMetadata failed err: %v", error)
+	if channel == "" || settings.Get("CHANNEL_ACCOUNT_SERVICE_URLS") == "" {
+		return accountServiceURLs{}
 	}
 
-	for _, metadata := range requiredMetadata {
-		if metadata.Validator == "boolean" {
-			claims[metadata.Name] = getBooleanOrDefault(metadata.Name, urlValues, false)
-			continue
+	if err := json.Unmarshal([]byte(settings.Get("CHANNEL_ACCOUNT_SERVICE_URLS")), &channelURLs); err != nil {
+		logging.Error("failed to parse CHANNEL_ACCOUNT_SERVICE_URLS", "error", err)
+		return accountServiceURLs{}
+	}
+
+	return channelURLs[channel]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
 		}
-		claims[metadata.Name] = getStringOrDefault(metadata.Name, urlValues, metadata.Default)
 	}
+	return ""
+}
 
-	jwtClaims := GenerateJwtClaims()
-	for key, v := range jwtClaims {
-		claims[key] = v
+// GenerateTokenFromDefaults coverts a set of DEFAULT values into a JWT
+func GenerateTokenFromDefaults(ctx context.Context, surveyURL string, accountServiceURL string, accountServiceLogOutURL string, urlValues url.Values) (token string, error *LaunchError) {
+	launch, err := GenerateLaunchFromDefaults(ctx, surveyURL, accountServiceURL, accountServiceLogOutURL, urlValues, TokenOptions{})
+	if err != nil {
+		return "", err
 	}
 
-	schemaClaims := getSchemaClaims(launcherSchema)
-	for key, v := range schemaClaims {
-		claims[key] = v
+	return launch.Token, nil
+}
+
+// GenerateLaunchFromDefaults converts a set of DEFAULT values into a token in the same way as
+// GenerateTokenFromDefaults, returning the claims it carries too. It is a launch of the schema at surveyURL as
+// GenerateLaunch makes, with the schema's defaults for the metadata which wasn't given. urlValues isn't modified.
+func GenerateLaunchFromDefaults(ctx context.Context, surveyURL string, accountServiceURL string, accountServiceLogOutURL string, urlValues url.Values, options TokenOptions) (*Launch, *LaunchError) {
+	options, launchErr := limitLifetime(ctx, options)
+	if launchErr != nil {
+		return nil, launchErr
 	}
+	options.metadataDefaults = true
 
-	token, tokenError := generateTokenFromClaims(claims)
-	if tokenError != nil {
-		return token, fmt.Sprintf("GenerateTokenFromDefaults failed err: %v", tokenError)
+	ctx = ContextWithSchemaScheme(ctx, urlValues.Get("schema_scheme"))
+
+	launcherSchema, err := launcherSchemaFromURL(ctx, surveyURL)
+	if err != nil {
+		return nil, quicklaunchSchemaError(err)
+	}
+
+	questionnaireSchema, schemaError := loadQuestionnaireSchema(ctx, launcherSchema)
+	if schemaError != nil {
+		return nil, schemaLoadError(schemaError)
 	}
 
-	return token, ""
+	values := copyValues(urlValues)
+	channelURLs := channelAccountServiceURLs(values.Get("channel"))
+	values["account_service_url"] = []string{firstNonEmpty(values.Get("account_service_url"), channelURLs.AccountServiceURL, launcherSchema.AccountServiceURL, accountServiceURL)}
+	values["account_service_log_out_url"] = []string{firstNonEmpty(values.Get("account_service_log_out_url"), channelURLs.AccountServiceLogOutURL, launcherSchema.AccountServiceLogOutURL, accountServiceLogOutURL)}
+
+	return launchFromSchema(ctx, launcherSchema, questionnaireSchema, values, options)
 }
 
 // TransformSchemaParamsToName Returns a schema name from census schema parameters
 // This function can be removed after census claims are removed.
 func TransformSchemaParamsToName(postValues url.Values) string {
 	if postValues.Get("schema_name") != "" {
-		return postValues["schema_name"][0]
+		return applySchemaNameCase(postValues["schema_name"][0])
 	}
 
-	formTypeMap := map[string]string{
-		"H": "household",
-		"I": "individual",
-		"C": "communal_establishment",
+	// A launch which doesn't say which schema, such as a bare /launch, gets the DEFAULT_SCHEMA_NAME demo survey
+	if postValues.Get("survey") == "" && postValues.Get("form_type") == "" && postValues.Get("region_code") == "" {
+		if defaultName := settings.Get("DEFAULT_SCHEMA_NAME"); defaultName != "" {
+			return applySchemaNameCase(defaultName)
+		}
 	}
 
 	regionCode := strings.Replace(postValues.Get("region_code"), "-", "_", -1)
 	regionCode = strings.ToLower(regionCode)
 
 	survey := postValues.Get("survey")
-	formType := formTypeMap[postValues.Get("form_type")]
+	formType := formTypeName(survey, postValues.Get("form_type"))
 	schemaName := fmt.Sprintf("%s_%s_%s", survey, formType, regionCode)
 
+	return applySchemaNameCase(schemaName)
+}
+
+// applySchemaNameCase lowercases a schema name when SCHEMA_NAME_CASE is lower, so launches by name and by URL give
+// the same schema_name claim. Names are used as they are when it is preserve.
+func applySchemaNameCase(schemaName string) string {
+	if settings.Get("SCHEMA_NAME_CASE") == "lower" {
+		return strings.ToLower(schemaName)
+	}
 	return schemaName
 }
 
 // GenerateTokenFromPost converts a set of POST values into a JWT
-func GenerateTokenFromPost(postValues url.Values) (string, string) {
-	log.Println("POST received: ", postValues)
+func GenerateTokenFromPost(ctx context.Context, postValues url.Values) (string, *LaunchError) {
+	launch, err := GenerateLaunch(ctx, "", postValues, TokenOptions{})
+	if err != nil {
+		return "", err
+	}
 
-	schema := TransformSchemaParamsToName(postValues)
+	return launch.Token, nil
+}
 
-	launcherSchema := surveys.FindSurveyByName(schema)
+// GenerateLaunch converts a set of launch values into a token in the same way as GenerateTokenFromPost, returning the
+// claims it carries too. The schema is loaded from schemaURL when one is given, otherwise it is found by name from
+// the values.
+func GenerateLaunch(ctx context.Context, schemaURL string, values url.Values, options TokenOptions) (*Launch, *LaunchError) {
+	logging.FromContext(ctx).Debug("launch values received", "form", values)
 
-	claims := generateClaims(postValues, launcherSchema)
+	options, launchErr := limitLifetime(ctx, options)
+	if launchErr != nil {
+		return nil, launchErr
+	}
 
-	jwtClaims := GenerateJwtClaims()
+	launcherSchema, questionnaireSchema, launchErr := resolveSchema(ctx, schemaURL, values)
+	if launchErr != nil {
+		return nil, launchErr
+	}
+
+	return launchFromSchema(ctx, launcherSchema, questionnaireSchema, values, options)
+}
+
+// copyValues returns a deep copy of values, so they can be added to without changing the caller's values
+func copyValues(values url.Values) url.Values {
+	copied := make(url.Values, len(values))
+	for name, value := range values {
+		copied[name] = append([]string(nil), value...)
+	}
+	return copied
+}
+
+// GenerateFlushLaunch generates a token for the runner's /flush endpoint from the metadata identifying a response. The
+// token always carries just the flusher role, whatever roles are in values.
+func GenerateFlushLaunch(ctx context.Context, values url.Values) (*Launch, *LaunchError) {
+	flushValues := copyValues(values)
+	flushValues["roles"] = []string{"flusher"}
+
+	return GenerateLaunch(ctx, "", flushValues, TokenOptions{})
+}
+
+// resolveSchema finds the schema for a launch, from schemaURL when one is given, otherwise by name from the values,
+// and loads it
+func resolveSchema(ctx context.Context, schemaURL string, values url.Values) (surveys.LauncherSchema, QuestionnaireSchema, *LaunchError) {
+	ctx = ContextWithSchemaScheme(ctx, values.Get("schema_scheme"))
+
+	var launcherSchema surveys.LauncherSchema
+	if schemaURL != "" {
+		var err error
+		launcherSchema, err = launcherSchemaFromURL(ctx, schemaURL)
+		if err != nil {
+			return launcherSchema, QuestionnaireSchema{}, quicklaunchSchemaError(err)
+		}
+	} else {
+		var err error
+		launcherSchema, err = surveys.FindSurveyByName(ctx, TransformSchemaParamsToName(values))
+		if err != nil {
+			return launcherSchema, QuestionnaireSchema{}, &LaunchError{Kind: LaunchErrorSchemaNotFound, Desc: err.Error(), Err: err}
+		}
+	}
+
+	questionnaireSchema, schemaError := loadQuestionnaireSchema(ctx, launcherSchema)
+	if schemaError != nil {
+		return launcherSchema, questionnaireSchema, schemaLoadError(schemaError)
+	}
+
+	return launcherSchema, questionnaireSchema, nil
+}
+
+// launchFromSchema generates the claims and token for a launch of a schema which has already been loaded
+func launchFromSchema(ctx context.Context, launcherSchema surveys.LauncherSchema, questionnaireSchema QuestionnaireSchema, values url.Values, options TokenOptions) (*Launch, *LaunchError) {
+	if paramsErr := checkUnknownParameters(ctx, values, questionnaireSchema); paramsErr != nil {
+		return nil, paramsErr
+	}
+
+	// decodeClaimValues returns a copy, so values can be modified from here on. Roles are checked once decoded, so an
+	// encoded forbidden role is rejected too.
+	values, decodeErr := decodeClaimValues(values)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	if rolesErr := checkForbiddenRoles(values); rolesErr != nil {
+		return nil, rolesErr
+	}
+	normaliseRegionCodes(values)
+
+	if enc := contentEncryptionOverride(values); enc != "" {
+		options.ContentEncryption = enc
+	}
+	values.Del("enc")
+
+	claims, err := generateClaims(ctx, values, launcherSchema, questionnaireSchema)
+	if err != nil {
+		var launchErr *LaunchError
+		if errors.As(err, &launchErr) {
+			return nil, launchErr
+		}
+		return nil, identifierLaunchError(err)
+	}
+	claims["preview"] = previewClaim(values)
+
+	jwtClaims, err := GenerateJwtClaims()
+	if err != nil {
+		return nil, identifierLaunchError(err)
+	}
 	for key, v := range jwtClaims {
 		claims[key] = v
 	}
 
+	expiresAt := setExpiry(claims, options.Lifetime)
+
 	schemaClaims := getSchemaClaims(launcherSchema)
 	for key, v := range schemaClaims {
 		claims[key] = v
 	}
 
-	requiredMetadata, error := GetRequiredMetadata(launcherSchema)
-	if error != "" {
-		return "", fmt.Sprintf("GetRequiredMetadata failed err: %v", error)
+	addVersionClaim(claims, questionnaireSchema)
+	addSchemaHashClaim(claims, questionnaireSchema)
+	addLauncherVersionClaim(claims)
+
+	requiredMetadata, err := questionnaireSchema.requiredMetadata(values.Get("language_code"))
+	if err != nil {
+		return nil, identifierLaunchError(err)
+	}
+
+	// A schema can pass validation and still require metadata which a quick launch has no value for, which would only
+	// be found when the runner rejects the token
+	var warnings []string
+	if options.metadataDefaults {
+		if unfillable := unfillableMetadata(requiredMetadata, values); len(unfillable) > 0 {
+			logging.FromContext(ctx).Warn("schema requires metadata with no default or launch value", "survey_url", launcherSchema.URL, "metadata", unfillable)
+			warnings = append(warnings, fmt.Sprintf("The schema requires metadata which has no default and wasn't given: %s", strings.Join(unfillable, ", ")))
+		}
 	}
 
 	for _, metadata := range requiredMetadata {
-		if metadata.Validator == "boolean" {
+		switch {
+		case options.metadataDefaults && metadata.Validator == "boolean":
+			claims[metadata.Name] = getBooleanOrDefault(metadata.Name, values, false)
+		case options.metadataDefaults:
+			claims[metadata.Name] = getStringOrDefault(metadata.Name, values, metadata.Default)
+		case metadata.Validator == "boolean":
 			_, isset := claims[metadata.Name]
 			claims[metadata.Name] = isset
 		}
 	}
+	defaultTradAsToRuName(requiredMetadata, claims, values)
+
+	if dateErrors := validateDateClaims(requiredMetadata, claims); len(dateErrors) > 0 {
+		return nil, metadataLaunchError(dateErrors)
+	}
+
+	if formatErrors := validateFormatClaims(requiredMetadata, claims); len(formatErrors) > 0 {
+		return nil, metadataLaunchError(formatErrors)
+	}
 
 	if launcherSchema.Name != "" && claims["schema_name"] == "" {
 		claims["schema_name"] = launcherSchema.Name
 	}
 
-	token, tokenError := generateTokenFromClaims(claims)
+	if countryErrors := validateCountryClaim(claims); len(countryErrors) > 0 {
+		return nil, metadataLaunchError(countryErrors)
+	}
+
+	addLaunchLanguageClaim(claims)
+	if languageErrors := validateLaunchLanguageClaim(claims); len(languageErrors) > 0 {
+		return nil, metadataLaunchError(languageErrors)
+	}
+
+	if userIDErrors := validateUserIDClaim(claims); len(userIDErrors) > 0 {
+		return nil, metadataLaunchError(userIDErrors)
+	}
+
+	if ruRefErrors := validateRuRefClaim(claims); len(ruRefErrors) > 0 {
+		return nil, metadataLaunchError(ruRefErrors)
+	}
+
+	if periodIDErrors := validatePeriodIDClaim(claims); len(periodIDErrors) > 0 {
+		return nil, metadataLaunchError(periodIDErrors)
+	}
+	if periodErr := validateCollectionExercisePeriod(claims); periodErr != nil {
+		return nil, periodErr
+	}
+
+	nullOptionalMetadata(requiredMetadata, claims, values)
+
+	if schemaName, ok := claims["schema_name"].(string); ok {
+		claims["schema_name"] = applySchemaNameCase(schemaName)
+	}
+
+	prefixMetadataClaims(claims, questionnaireSchema.Metadata)
+	claims, err = applyClaimsShape(claims)
+	if err != nil {
+		return nil, identifierLaunchError(err)
+	}
+	claims = excludeClaims(ctx, claims)
+	if renameErr := renameClaims(claims); renameErr != nil {
+		return nil, renameErr
+	}
+	if claimsErr := checkMaxClaims(claims); claimsErr != nil {
+		return nil, claimsErr
+	}
+
+	if options.DryRun {
+		return &Launch{Claims: claims, ExpiresAt: expiresAt, Warnings: warnings}, nil
+	}
+
+	if configErr := checkSessionURL(); configErr != nil {
+		return nil, configErr
+	}
+
+	generated, tokenError := generateTokenFromClaims(ctx, claims, signingKeyID(claims, launcherSchema), options)
 	if tokenError != nil {
-		return token, fmt.Sprintf("GenerateTokenFromPost failed err: %v", tokenError)
+		return nil, &LaunchError{Kind: LaunchErrorKey, Desc: fmt.Sprintf("GenerateTokenFromPost failed err: %v", tokenError)}
+	}
+
+	launch := newLaunch(generated, claims, expiresAt)
+	launch.Warnings = warnings
+	if options.SignedCopy && !options.Unencrypted {
+		if launch.SignedToken, tokenError = signedCopy(ctx, claims, signingKeyID(claims, launcherSchema)); tokenError != nil {
+			return nil, &LaunchError{Kind: LaunchErrorKey, Desc: fmt.Sprintf("GenerateTokenFromPost failed err: %v", tokenError)}
+		}
 	}
 
-	return token, ""
+	return launch, nil
 }
 
-// GetRequiredMetadata Gets the required metadata from a schema
-func GetRequiredMetadata(launcherSchema surveys.LauncherSchema) ([]Metadata, string) {
+// GetRequiredMetadata Gets the required metadata from a schema, with defaults in languageCode
+func GetRequiredMetadata(ctx context.Context, launcherSchema surveys.LauncherSchema, languageCode string) ([]Metadata, *LaunchError) {
+	schema, err := loadQuestionnaireSchema(ctx, launcherSchema)
+	if err != nil {
+		return nil, schemaLoadError(err)
+	}
+
+	metadata, err := schema.requiredMetadata(languageCode)
+	if err != nil {
+		return nil, schemaLoadError(err)
+	}
+	return metadata, nil
+}
+
+// loadQuestionnaireSchema fetches the schema from its URL, or by name from the runner
+func loadQuestionnaireSchema(ctx context.Context, launcherSchema surveys.LauncherSchema) (QuestionnaireSchema, error) {
 	var url string
+	postName := false
 
 	if launcherSchema.URL != "" {
 		url = launcherSchema.URL
 	} else {
-		hostURL := settings.Get("SURVEY_RUNNER_SCHEMA_URL")
+		logging.FromContext(ctx).Debug("loading schema by name", "schema_name", launcherSchema.Name)
 
-		log.Println("Name: ", launcherSchema.Name)
-		url = fmt.Sprintf("%s/schemas/%s", hostURL, launcherSchema.Name)
+		method := strings.ToUpper(settings.Get("SCHEMA_FETCH_METHOD"))
+		if method != http.MethodGet && method != http.MethodPost {
+			return QuestionnaireSchema{}, fmt.Errorf("SCHEMA_FETCH_METHOD %q is not GET or POST", settings.Get("SCHEMA_FETCH_METHOD"))
+		}
+		postName = method == http.MethodPost
+
+		var err error
+		if postName {
+			url, err = clients.JoinURL(settings.Get("SURVEY_RUNNER_SCHEMA_URL"), "schemas")
+		} else {
+			url, err = clients.JoinURL(settings.Get("SURVEY_RUNNER_SCHEMA_URL"), "schemas", launcherSchema.Name)
+		}
+		if err != nil {
+			return QuestionnaireSchema{}, fmt.Errorf("invalid SURVEY_RUNNER_SCHEMA_URL: %w", err)
+		}
 	}
+	url = withSchemaScheme(ctx, url)
 
-	log.Println("Loading metadata from schema:", url)
+	logging.FromContext(ctx).Info("loading metadata from schema", "schema_url", url, "schema_name", launcherSchema.Name)
 
-	resp, err := clients.GetHTTPClient().Get(url)
+	var schema QuestionnaireSchema
+	var body []byte
+	var err error
+	fetchStart := time.Now()
+	if postName {
+		// Runners which don't serve schemas by path are sent the name in the body instead
+		body, err = clients.PostJSONBody(ctx, withSchemaQueryParams(ctx, url), map[string]string{"schema_name": launcherSchema.Name}, maxSchemaBytes(), &schema)
+	} else {
+		body, err = clients.GetJSONBody(ctx, withSchemaQueryParams(ctx, url), maxSchemaBytes(), &schema)
+	}
+	timingsFromContext(ctx).SchemaFetch += time.Since(fetchStart)
 	if err != nil {
-		log.Println("Failed to load schema from:", url)
-		return nil, fmt.Sprintf("Failed to load Schema from %s", url)
+		logging.FromContext(ctx).Error("failed to load schema", "schema_url", url, "error", err, "duration", time.Since(fetchStart))
+		return schema, fmt.Errorf("Failed to load Schema from %s: %w", url, err)
+	}
+	sum := sha256.Sum256(body)
+	schema.hash = hex.EncodeToString(sum[:])
+
+	if settings.GetBool("RESOLVE_SCHEMA_REFS") {
+		fetchStart = time.Now()
+		err = resolveMetadataRefs(ctx, &schema, url)
+		timingsFromContext(ctx).SchemaFetch += time.Since(fetchStart)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to resolve schema metadata", "schema_url", url, "error", err)
+			return schema, fmt.Errorf("Failed to load Schema from %s: %w", url, err)
+		}
 	}
 
-	if resp.StatusCode != 200 {
-		log.Print("Invalid response code for schema from: ", url)
-		return nil, fmt.Sprintf("Failed to load Schema from %s", url)
+	return schema, schema.checkMetadata(ctx, url)
+}
+
+// checkMetadata removes duplicated metadata and metadata named after reserved claims from the schema at url, failing
+// instead when STRICT_SCHEMA_METADATA or ALLOW_RESERVED_METADATA say to
+func (schema *QuestionnaireSchema) checkMetadata(ctx context.Context, url string) error {
+	if duplicates := schema.dedupeMetadata(); len(duplicates) > 0 {
+		if settings.GetBool("STRICT_SCHEMA_METADATA") {
+			return fmt.Errorf("Schema %s declares metadata more than once: %s", url, strings.Join(duplicates, ", "))
+		}
+		logging.FromContext(ctx).Warn("schema declares metadata more than once, using the first of each", "schema_url", url, "metadata", duplicates)
 	}
 
-	responseBody, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		log.Print(err)
-		return nil, fmt.Sprintf("Failed to load Schema from %s", url)
+	if reserved := schema.removeReservedMetadata(); len(reserved) > 0 {
+		if !settings.GetBool("ALLOW_RESERVED_METADATA") {
+			return fmt.Errorf("%w: %s declares %s", ErrReservedMetadata, url, strings.Join(reserved, ", "))
+		}
+		logging.FromContext(ctx).Warn("schema declares metadata with reserved claim names, ignoring it", "schema_url", url, "metadata", reserved)
 	}
 
-	var schema QuestionnaireSchema
-	if err := json.Unmarshal(responseBody, &schema); err != nil {
-		log.Print(err)
-		return nil, fmt.Sprintf("Failed to unmarshal Schema from %s", url)
+	return nil
+}
+
+// dedupeMetadata removes all but the first metadata item of each name, returning the names which were duplicated
+func (schema *QuestionnaireSchema) dedupeMetadata() []string {
+	seen := make(map[string]bool)
+	duplicates := []string{}
+	metadata := schema.Metadata[:0]
+
+	for _, item := range schema.Metadata {
+		if seen[item.Name] {
+			duplicates = append(duplicates, item.Name)
+			continue
+		}
+		seen[item.Name] = true
+		metadata = append(metadata, item)
 	}
 
-	defaults := GetDefaultValues()
+	schema.Metadata = metadata
+	return duplicates
+}
+
+// requiredMetadata returns the schema's metadata with the default value for each filled in, in languageCode where
+// LANGUAGE_DEFAULTS_PATH has defaults for it
+func (schema QuestionnaireSchema) requiredMetadata(languageCode string) ([]Metadata, error) {
+	defaults, err := defaultValuesForLanguage(schema.defaultsTheme(), languageCode)
+	if err != nil {
+		return nil, err
+	}
 
 	for i, value := range schema.Metadata {
 		schema.Metadata[i].Default = defaults[value.Name]
@@ -503,39 +1619,60 @@ func GetRequiredMetadata(launcherSchema surveys.LauncherSchema) ([]Metadata, str
 		if value.Validator == "boolean" {
 			schema.Metadata[i].Default = "false"
 		}
+
+		// Runners which reject the static user_id default can be given a unique one for each launch instead
+		if value.Name == "user_id" && !value.Optional && settings.GetBool("GENERATE_USER_ID") {
+			userID, err := NewIdentifier()
+			if err != nil {
+				return nil, err
+			}
+			schema.Metadata[i].Default = userID
+		}
 	}
 
-	return schema.Metadata, ""
+	return schema.Metadata, nil
+}
+
+// staticDefaultValues are the default values which are the same for every launch. GetDefaultValues copies them rather
+// than building them again, as it's called for every launch and by every metadata lookup.
+var staticDefaultValues = map[string]string{
+	"period_id":        "201605",
+	"period_str":       "May 2017",
+	"ru_ref":           "12346789012A",
+	"ru_name":          "ESSENTIAL ENTERPRISE LTD.",
+	"ref_p_start_date": "2016-05-01",
+	"ref_p_end_date":   "2016-05-31",
+	"return_by":        "2016-06-12",
+	"trad_as":          "ESSENTIAL ENTERPRISE LTD.",
+	"employment_date":  "2016-06-10",
+	"region_code":      "GB-ENG",
+	"language_code":    "en",
+	"address_line1":    "68 Abingdon Road",
+	"address_line2":    "",
+	"locality":         "",
+	"town_name":        "Goathill",
+	"postcode":         "PE12 4GH",
+	"display_address":  "68 Abingdon Road, Goathill",
 }
 
-// GetDefaultValues Returns a map of default values for metadata keys
-func GetDefaultValues() map[string]string {
+// GetDefaultValues Returns a map of default values for metadata keys. Each call has a new collection_exercise_sid,
+// and the map is the caller's own to change.
+func GetDefaultValues() (map[string]string, error) {
 
-	defaults := make(map[string]string)
+	defaults := make(map[string]string, len(staticDefaultValues)+4)
+	for key, value := range staticDefaultValues {
+		defaults[key] = value
+	}
 
-	collectionExerciseSid, _ := uuid.NewV4()
+	collectionExerciseSid, err := NewIdentifier()
+	if err != nil {
+		return nil, err
+	}
 
-	defaults["user_id"] = "UNKNOWN"
-	defaults["period_id"] = "201605"
-	defaults["period_str"] = "May 2017"
-	defaults["collection_exercise_sid"] = collectionExerciseSid.String()
-	defaults["ru_ref"] = "12346789012A"
-	defaults["ru_name"] = "ESSENTIAL ENTERPRISE LTD."
-	defaults["ref_p_start_date"] = "2016-05-01"
-	defaults["ref_p_end_date"] = "2016-05-31"
-	defaults["return_by"] = "2016-06-12"
-	defaults["trad_as"] = "ESSENTIAL ENTERPRISE LTD."
-	defaults["employment_date"] = "2016-06-10"
-	defaults["region_code"] = "GB-ENG"
-	defaults["language_code"] = "en"
-	defaults["case_ref"] = "1000000000000001"
-	defaults["address_line1"] = "68 Abingdon Road"
-	defaults["address_line2"] = ""
-	defaults["locality"] = ""
-	defaults["town_name"] = "Goathill"
-	defaults["postcode"] = "PE12 4GH"
-	defaults["display_address"] = "68 Abingdon Road, Goathill"
-	defaults["country"] = "E"
+	defaults["user_id"] = settings.Get("DEFAULT_USER_ID")
+	defaults["collection_exercise_sid"] = collectionExerciseSid
+	defaults["country"] = settings.Get("DEFAULT_COUNTRY")
+	defaults["case_ref"] = defaultCaseRef()
 
-	return defaults
+	return defaults, nil
 }
@@ -0,0 +1,446 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"github.com/gofrs/uuid"
+)
+
+// withClock pins the time claims are based on to now for the rest of the test
+func withClock(t *testing.T, now time.Time) {
+	t.Helper()
+	previous := Clock
+	t.Cleanup(func() { Clock = previous })
+	Clock = func() time.Time { return now }
+}
+
+func TestGetRequiredMetadataReportsStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   []string
+	}{
+		{"not found", http.StatusNotFound, `{"message": "schema not found"}`, []string{"404 Not Found", "schema not found"}},
+		{"server error", http.StatusInternalServerError, `{"message": "database unavailable"}`, []string{"500 Internal Server Error", "database unavailable"}},
+	}
+
+	messages := map[string]bool{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := schemaServer(t, test.status, test.body)
+
+			_, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test", URL: server.URL + "/schema.json"}, "en")
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected %q in error %q", want, err)
+				}
+			}
+			messages[strings.ReplaceAll(err.Error(), server.URL, "")] = true
+		})
+	}
+
+	if len(messages) != len(tests) {
+		t.Errorf("expected each status to give a different message, got %v", messages)
+	}
+}
+
+func TestGetRequiredMetadataConnectionError(t *testing.T) {
+	server := schemaServer(t, http.StatusOK, `{}`)
+	server.Close()
+
+	_, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test", URL: server.URL + "/schema.json"}, "en")
+	if err == nil || strings.Contains(err.Error(), " returned ") {
+		t.Errorf("expected a connection error without a status, got %q", err)
+	}
+	if err != nil && err.Kind != LaunchErrorUpstream {
+		t.Errorf("expected an upstream error, got %s", err.Kind)
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("expected the error to unwrap to the *url.Error, got %#v", err.Err)
+	}
+}
+
+func TestLaunchErrorUnwrap(t *testing.T) {
+	cause := fmt.Errorf("Failed to load Schema from http://schemas: %w", &url.Error{Op: "Get", URL: "http://schemas", Err: clients.ErrCircuitOpen})
+
+	launchErr := schemaLoadError(cause)
+	if !errors.Is(launchErr, clients.ErrCircuitOpen) {
+		t.Errorf("expected the launch error to unwrap to ErrCircuitOpen, got %#v", launchErr.Err)
+	}
+
+	if errors.Is(&LaunchError{Kind: LaunchErrorUpstream, Desc: clients.ErrCircuitOpen.Error()}, clients.ErrCircuitOpen) {
+		t.Error("expected a launch error without Err not to match ErrCircuitOpen by its description")
+	}
+	if (*LaunchError)(nil).Unwrap() != nil {
+		t.Error("expected a nil launch error to unwrap to nil")
+	}
+}
+
+// BenchmarkGetRequiredMetadata loads a schema with hundreds of metadata items, mixing names with launcher defaults,
+// booleans and names without a default
+func BenchmarkGetRequiredMetadata(b *testing.B) {
+	metadata := []Metadata{}
+	for name := range staticDefaultValues {
+		metadata = append(metadata, Metadata{Name: name, Validator: "string"})
+	}
+	for i := 0; len(metadata) < 500; i++ {
+		metadata = append(metadata, Metadata{Name: fmt.Sprintf("flag_%d", i), Validator: "boolean"})
+		metadata = append(metadata, Metadata{Name: fmt.Sprintf("value_%d", i), Validator: "string", Optional: i%2 == 0})
+	}
+	body, err := json.Marshal(QuestionnaireSchema{SchemaName: "test_large_metadata", Metadata: metadata})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	server := schemaServer(b, http.StatusOK, string(body))
+	launcherSchema := surveys.LauncherSchema{Name: "test_large_metadata", URL: server.URL + "/schema.json"}
+
+	logging.SetOutput(ioutil.Discard)
+	b.Cleanup(func() { logging.SetOutput(os.Stderr) })
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := GetRequiredMetadata(context.Background(), launcherSchema, "en"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGetRequiredMetadataInvalidUTF8(t *testing.T) {
+	server := schemaServer(t, http.StatusOK, "{\"schema_name\": \"test\xff\"}")
+
+	_, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test", URL: server.URL + "/schema.json"}, "en")
+	if err == nil || !strings.Contains(err.Error(), "invalid UTF-8 byte 0xff at offset 21") {
+		t.Errorf("expected an error naming the invalid byte, got %q", err)
+	}
+}
+
+func TestNewIdentifier(t *testing.T) {
+	failure := errors.New("entropy exhausted")
+
+	tests := []struct {
+		name      string
+		failures  int
+		wantError bool
+	}{
+		{"first attempt", 0, false},
+		{"retried once", 1, false},
+		{"failed twice", 2, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := newUUID
+			t.Cleanup(func() { newUUID = previous })
+
+			calls := 0
+			newUUID = func() (uuid.UUID, error) {
+				calls++
+				if calls <= test.failures {
+					return uuid.Nil, failure
+				}
+				return uuid.NewV4()
+			}
+
+			id, err := NewIdentifier()
+			if test.wantError {
+				if !errors.Is(err, failure) || id != "" {
+					t.Errorf("expected the failure and no UUID, got %q, %v", id, err)
+				}
+				return
+			}
+			if _, parseErr := uuid.FromString(id); err != nil || parseErr != nil {
+				t.Errorf("expected a UUID, got %q, %v", id, err)
+			}
+		})
+	}
+}
+
+func TestGenerateJwtClaimsClockSkew(t *testing.T) {
+	now := time.Date(2017, 5, 1, 9, 0, 0, 0, time.UTC)
+	withClock(t, now)
+
+	tests := []struct {
+		name    string
+		skew    string
+		wantIat int64
+		wantNbf bool
+	}{
+		{"no skew", "0s", now.Unix(), false},
+		{"skew", "30s", now.Add(-30 * time.Second).Unix(), true},
+		{"invalid skew", "soon", now.Unix(), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "JWT_CLOCK_SKEW", test.skew)
+
+			claims, err := GenerateJwtClaims()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims["iat"] != test.wantIat {
+				t.Errorf("expected iat %d, got %v", test.wantIat, claims["iat"])
+			}
+			nbf, ok := claims["nbf"]
+			if ok != test.wantNbf {
+				t.Errorf("expected nbf set %v, got %v", test.wantNbf, nbf)
+			}
+			if ok && nbf != test.wantIat {
+				t.Errorf("expected nbf %d, got %v", test.wantIat, nbf)
+			}
+			if claims["exp"] != now.Add(defaultTokenLifetime).Unix() {
+				t.Errorf("expected exp to be unaffected by the skew, got %v", claims["exp"])
+			}
+		})
+	}
+}
+
+func TestLaunchWithFixedClock(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	now := time.Date(2017, 5, 1, 9, 0, 0, 500000000, time.UTC)
+	withClock(t, now)
+
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		wantExp  time.Time
+	}{
+		{"default lifetime", 0, time.Date(2017, 5, 1, 9, 0, 0, 0, time.UTC).Add(defaultTokenLifetime)},
+		{"requested lifetime", 10 * time.Minute, time.Date(2017, 5, 1, 9, 10, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+			launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true, Lifetime: test.lifetime})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+
+			if iat := launch.Claims["iat"]; iat != now.Unix() {
+				t.Errorf("expected iat %d, got %v", now.Unix(), iat)
+			}
+			if exp := launch.Claims["exp"]; exp != test.wantExp.Unix() {
+				t.Errorf("expected exp %d, got %v", test.wantExp.Unix(), exp)
+			}
+			if !launch.ExpiresAt.Equal(test.wantExp) {
+				t.Errorf("expected the launch to expire at %s, got %s", test.wantExp, launch.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestLimitLifetime(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxLifetime  string
+		mode         string
+		lifetime     time.Duration
+		wantLifetime time.Duration
+		wantError    bool
+		wantLog      bool
+	}{
+		{"within the maximum", "24h", "reject", 2 * time.Hour, 2 * time.Hour, false, false},
+		{"at the maximum", "24h", "reject", 24 * time.Hour, 24 * time.Hour, false, false},
+		{"default lifetime", "24h", "reject", 0, 0, false, false},
+		{"over the maximum", "24h", "reject", 48 * time.Hour, 0, true, false},
+		{"clamped", "24h", "clamp", 48 * time.Hour, 24 * time.Hour, false, true},
+		{"no maximum", "0s", "reject", 48 * time.Hour, 48 * time.Hour, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "JWT_MAX_LIFETIME", test.maxLifetime)
+			withSetting(t, "JWT_MAX_LIFETIME_MODE", test.mode)
+
+			var logs bytes.Buffer
+			logging.SetOutput(&logs)
+			t.Cleanup(func() { logging.SetOutput(os.Stderr) })
+
+			options, launchErr := limitLifetime(context.Background(), TokenOptions{Lifetime: test.lifetime})
+			if test.wantError {
+				if launchErr == nil || launchErr.Kind != LaunchErrorMetadata || len(launchErr.Fields) != 1 || launchErr.Fields[0].Name != "exp" {
+					t.Errorf("expected an exp metadata error, got %+v", launchErr)
+				}
+				return
+			}
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if options.Lifetime != test.wantLifetime {
+				t.Errorf("expected a lifetime of %s, got %s", test.wantLifetime, options.Lifetime)
+			}
+			if logged := strings.Contains(logs.String(), "clamping token lifetime"); logged != test.wantLog {
+				t.Errorf("expected clamping logged %v, got %q", test.wantLog, logs.String())
+			}
+		})
+	}
+}
+
+func TestLaunchLifetimeClamped(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	now := time.Date(2017, 5, 1, 9, 0, 0, 0, time.UTC)
+	withClock(t, now)
+	withSetting(t, "JWT_MAX_LIFETIME", "24h")
+	withSetting(t, "JWT_MAX_LIFETIME_MODE", "clamp")
+
+	values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+	launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true, Lifetime: 7 * 24 * time.Hour})
+	if launchErr != nil {
+		t.Fatalf("unexpected error: %v", launchErr)
+	}
+	if want := now.Add(24 * time.Hour).Unix(); launch.Claims["exp"] != want {
+		t.Errorf("expected exp %d, got %v", want, launch.Claims["exp"])
+	}
+}
+
+func TestSchemaNameCase(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"Test_Case": `{"schema_name": "Test_Case"}`, "test_case": `{"schema_name": "test_case"}`})
+	server := schemaServer(t, 200, `{"schema_name": "Test_Case"}`)
+
+	byName := func() (*Launch, *LaunchError) {
+		return GenerateLaunch(context.Background(), "", url.Values{"schema_name": {"Test_Case"}}, TokenOptions{DryRun: true})
+	}
+	byURL := func() (*Launch, *LaunchError) {
+		return GenerateLaunchFromDefaults(context.Background(), server.URL+"/schema.json", "", "", url.Values{}, TokenOptions{DryRun: true})
+	}
+
+	tests := []struct {
+		name   string
+		mode   string
+		launch func() (*Launch, *LaunchError)
+		want   string
+	}{
+		{"preserve by name", "preserve", byName, "Test_Case"},
+		{"preserve by URL", "preserve", byURL, "Test_Case"},
+		{"lower by name", "lower", byName, "test_case"},
+		{"lower by URL", "lower", byURL, "test_case"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SCHEMA_NAME_CASE", test.mode)
+			launch, launchErr := test.launch()
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if got := launch.Claims["schema_name"]; got != test.want {
+				t.Errorf("expected %s, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMissingSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		unset []string
+		want  []string
+	}{
+		{"complete", nil, []string{}},
+		{"no signing key path", []string{"JWT_SIGNING_KEY_PATH"}, []string{"JWT_SIGNING_KEY_PATH"}},
+		{"blank runner URLs", []string{"SURVEY_RUNNER_URL", "SURVEY_RUNNER_SCHEMA_URL"}, []string{"SURVEY_RUNNER_URL", "SURVEY_RUNNER_SCHEMA_URL"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range requiredSettings {
+				withSetting(t, name, "set")
+			}
+			for _, name := range test.unset {
+				withSetting(t, name, " ")
+			}
+
+			if got := MissingSettings(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTimeClaimsAreNumbers(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	withSetting(t, "JWT_CLOCK_SKEW", "30s")
+	values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+
+	tests := []struct {
+		name    string
+		options TokenOptions
+		payload func(t *testing.T, launch *Launch) []byte
+	}{
+		{"token", TokenOptions{Unencrypted: true}, func(t *testing.T, launch *Launch) []byte {
+			payload, err := base64.RawURLEncoding.DecodeString(strings.Split(launch.Token, ".")[1])
+			if err != nil {
+				t.Fatalf("failed to decode the token's payload: %v", err)
+			}
+			return payload
+		}},
+		{"dry run", TokenOptions{DryRun: true}, func(t *testing.T, launch *Launch) []byte {
+			payload, err := json.Marshal(launch.Claims)
+			if err != nil {
+				t.Fatalf("failed to encode the claims: %v", err)
+			}
+			return payload
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			launch, launchErr := GenerateLaunch(context.Background(), "", values, test.options)
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+
+			payload := test.payload(t, launch)
+			for _, name := range []string{"iat", "exp", "nbf"} {
+				if !regexp.MustCompile(`"` + name + `":[0-9]+[,}]`).Match(payload) {
+					t.Errorf("expected %s as a whole number, got %s", name, payload)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultTxID(t *testing.T) {
+	requestID := "6f0d8b8a-4a7e-4b8e-9c1e-2a5c1b0d7e3f"
+	if got, err := defaultTxID(requestid.NewContext(context.Background(), requestID)); err != nil || got != requestID {
+		t.Errorf("expected the request ID %s, got %s (%v)", requestID, got, err)
+	}
+
+	for _, ctx := range []context.Context{context.Background(), requestid.NewContext(context.Background(), "not-a-uuid")} {
+		got, err := defaultTxID(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := uuid.FromString(got); err != nil || got == requestID {
+			t.Errorf("expected a new UUID, got %q", got)
+		}
+	}
+}
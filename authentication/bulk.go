@@ -0,0 +1,136 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+)
+
+type keyCacheKey struct{}
+
+// keyCache holds the keys loaded while generating a batch of launches, so each is only read and parsed once
+type keyCache struct {
+	mutex       sync.Mutex
+	signingKeys map[string]*PrivateKeyResult
+	encryption  *PublicKeyResult
+}
+
+// contextWithKeyCache returns a context in which tokens are generated with keys loaded once and then reused
+func contextWithKeyCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keyCacheKey{}, &keyCache{signingKeys: make(map[string]*PrivateKeyResult)})
+}
+
+// signingKeyForContext loads the signing key with the given ID, reusing it if the context has a key cache
+func signingKeyForContext(ctx context.Context, id string) (*PrivateKeyResult, *KeyLoadError) {
+	cache, ok := ctx.Value(keyCacheKey{}).(*keyCache)
+	if !ok {
+		return loadSigningKeyByID(id)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if key, ok := cache.signingKeys[id]; ok {
+		return key, nil
+	}
+	key, keyErr := loadSigningKeyByID(id)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	cache.signingKeys[id] = key
+	return key, nil
+}
+
+// encryptionKeyForContext loads the encryption key, reusing it if the context has a key cache
+func encryptionKeyForContext(ctx context.Context) (*PublicKeyResult, *KeyLoadError) {
+	cache, ok := ctx.Value(keyCacheKey{}).(*keyCache)
+	if !ok {
+		return loadEncryptionKey()
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.encryption != nil {
+		return cache.encryption, nil
+	}
+	key, keyErr := loadEncryptionKey()
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	cache.encryption = key
+	return key, nil
+}
+
+// GenerateLaunches generates a launch for each set of values, which must all be for the same schema, in the same way
+// as GenerateLaunch. The schema is found and loaded from the first set of values, or schemaURL when one is given, and
+// the keys are loaded once for the whole batch. Generation stops at the first launch which fails.
+func GenerateLaunches(ctx context.Context, schemaURL string, values []url.Values, options TokenOptions) ([]*Launch, *LaunchError) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	options, launchErr := limitLifetime(ctx, options)
+	if launchErr != nil {
+		return nil, launchErr
+	}
+
+	launcherSchema, questionnaireSchema, launchErr := resolveSchema(ctx, schemaURL, values[0])
+	if launchErr != nil {
+		return nil, launchErr
+	}
+
+	ctx = contextWithKeyCache(ctx)
+	launches := make([]*Launch, 0, len(values))
+	for _, launchValues := range values {
+		launch, launchErr := launchFromSchema(ctx, launcherSchema, questionnaireSchema, launchValues, options)
+		if launchErr != nil {
+			return nil, launchErr
+		}
+		launches = append(launches, launch)
+	}
+
+	logging.FromContext(ctx).Info("generated launches", "schema_name", launcherSchema.Name, "count", len(launches))
+	return launches, nil
+}
+
+// LaunchResult is the outcome of one launch generated by GenerateLaunchResults, with either Launch or Err set
+type LaunchResult struct {
+	Launch *Launch
+	Err    *LaunchError
+}
+
+// GenerateLaunchResults generates a launch for each set of values in the same way as GenerateLaunches, but carries on
+// past launches which fail, so each set of values has its own result. The whole batch only fails when the schema
+// can't be found or loaded.
+func GenerateLaunchResults(ctx context.Context, schemaURL string, values []url.Values, options TokenOptions) ([]LaunchResult, *LaunchError) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	options, launchErr := limitLifetime(ctx, options)
+	if launchErr != nil {
+		return nil, launchErr
+	}
+
+	launcherSchema, questionnaireSchema, launchErr := resolveSchema(ctx, schemaURL, values[0])
+	if launchErr != nil {
+		return nil, launchErr
+	}
+
+	ctx = contextWithKeyCache(ctx)
+	results := make([]LaunchResult, 0, len(values))
+	failed := 0
+	for _, launchValues := range values {
+		launch, launchErr := launchFromSchema(ctx, launcherSchema, questionnaireSchema, launchValues, options)
+		if launchErr != nil {
+			failed++
+		}
+		results = append(results, LaunchResult{Launch: launch, Err: launchErr})
+	}
+
+	logging.FromContext(ctx).Info("generated launches", "schema_name", launcherSchema.Name, "count", len(results)-failed, "failed", failed)
+	return results, nil
+}
@@ -0,0 +1,92 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestGenerateLaunchesSharedValues launches concurrently from the same values, which is only safe while generating
+// a launch leaves its values alone, so is worth running with -race
+func TestGenerateLaunchesSharedValues(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	shared := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+	want := copyValues(shared)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, launchErr := GenerateLaunches(context.Background(), "", []url.Values{shared, shared}, TokenOptions{DryRun: true}); launchErr != nil {
+				t.Errorf("unexpected error: %v", launchErr)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, launchErr := GenerateLaunchResults(context.Background(), "", []url.Values{shared, shared}, TokenOptions{DryRun: true}); launchErr != nil {
+				t.Errorf("unexpected error: %v", launchErr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(shared, want) {
+		t.Errorf("expected the values to be unchanged, got %v", shared)
+	}
+}
+
+func TestGenerateLaunches(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	values := []url.Values{
+		{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}},
+		{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012B"}, "period_id": {"201605"}},
+	}
+	launches, launchErr := GenerateLaunches(context.Background(), "", values, TokenOptions{})
+	if launchErr != nil {
+		t.Fatalf("unexpected error: %v", launchErr)
+	}
+	if len(launches) != len(values) {
+		t.Fatalf("expected %d launches, got %d", len(values), len(launches))
+	}
+	for i, launch := range launches {
+		if launch.Token == "" || launch.Claims["ru_ref"] != values[i].Get("ru_ref") {
+			t.Errorf("expected launch %d to be of its own values, got %v", i, launch.Claims)
+		}
+	}
+
+	if launches, launchErr := GenerateLaunches(context.Background(), "", nil, TokenOptions{}); launches != nil || launchErr != nil {
+		t.Errorf("expected nothing for no values, got %v, %v", launches, launchErr)
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	useTestKeys(t)
+	ctx := contextWithKeyCache(context.Background())
+
+	signingKey, keyErr := signingKeyForContext(ctx, "")
+	if keyErr != nil {
+		t.Fatalf("unexpected error: %v", keyErr)
+	}
+	if cached, _ := signingKeyForContext(ctx, ""); cached != signingKey {
+		t.Error("expected the signing key to be loaded once for the context")
+	}
+
+	encryptionKey, keyErr := encryptionKeyForContext(ctx)
+	if keyErr != nil {
+		t.Fatalf("unexpected error: %v", keyErr)
+	}
+	if cached, _ := encryptionKeyForContext(ctx); cached != encryptionKey {
+		t.Error("expected the encryption key to be loaded once for the context")
+	}
+
+	if uncached, _ := signingKeyForContext(context.Background(), ""); uncached == signingKey {
+		t.Error("expected the signing key to be loaded again without a key cache")
+	}
+}
@@ -0,0 +1,43 @@
+package authentication
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+const (
+	defaultCaseRefLength = 16
+
+	caseRefDigits       = "0123456789"
+	caseRefAlphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// defaultCaseRef returns the case_ref default of CASE_REF_LENGTH characters in the CASE_REF_FORMAT, numeric or
+// alphanumeric. It's a fixed value, 1000000000000001 for the default 16 digits, unless GENERATE_CASE_REF asks for a
+// random one for each launch.
+func defaultCaseRef() string {
+	length := settings.GetInt("CASE_REF_LENGTH")
+	if length < 1 {
+		length = defaultCaseRefLength
+	}
+
+	alphabet, first := caseRefDigits, "1"
+	if strings.EqualFold(settings.Get("CASE_REF_FORMAT"), "alphanumeric") {
+		alphabet, first = caseRefAlphanumeric, "A"
+	}
+
+	if settings.GetBool("GENERATE_CASE_REF") {
+		caseRef := make([]byte, length)
+		for i := range caseRef {
+			caseRef[i] = alphabet[rand.Intn(len(alphabet))]
+		}
+		return string(caseRef)
+	}
+
+	if length == 1 {
+		return first
+	}
+	return first + strings.Repeat("0", length-2) + "1"
+}
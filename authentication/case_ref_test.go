@@ -0,0 +1,53 @@
+package authentication
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestDefaultCaseRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		length   string
+		generate string
+		want     string
+		pattern  string
+	}{
+		{"default", "numeric", "16", "false", "1000000000000001", ""},
+		{"invalid length", "numeric", "0", "false", "1000000000000001", ""},
+		{"10 digits", "numeric", "10", "false", "1000000001", ""},
+		{"single digit", "numeric", "1", "false", "1", ""},
+		{"alphanumeric", "alphanumeric", "8", "false", "A0000001", ""},
+		{"generated numeric", "numeric", "10", "true", "", `^[0-9]{10}$`},
+		{"generated alphanumeric", "ALPHANUMERIC", "12", "true", "", `^[A-Z0-9]{12}$`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "CASE_REF_FORMAT", test.format)
+			withSetting(t, "CASE_REF_LENGTH", test.length)
+			withSetting(t, "GENERATE_CASE_REF", test.generate)
+
+			got := defaultCaseRef()
+			if test.want != "" && got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+			if test.pattern != "" && !regexp.MustCompile(test.pattern).MatchString(got) {
+				t.Errorf("expected a case_ref matching %s, got %s", test.pattern, got)
+			}
+		})
+	}
+}
+
+func TestGetDefaultValuesCaseRef(t *testing.T) {
+	withSetting(t, "CASE_REF_LENGTH", "10")
+
+	defaults, err := GetDefaultValues()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if defaults["case_ref"] != "1000000001" {
+		t.Errorf("expected the configured case_ref default, got %s", defaults["case_ref"])
+	}
+}
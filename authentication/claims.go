@@ -0,0 +1,364 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// frameworkClaims are the claims which describe the launch itself, rather than the survey metadata from the schema
+var frameworkClaims = map[string]bool{
+	"roles":                       true,
+	"tx_id":                       true,
+	"jti":                         true,
+	"iat":                         true,
+	"exp":                         true,
+	"nbf":                         true,
+	"survey_url":                  true,
+	"schema_url":                  true,
+	"schema_name":                 true,
+	"version":                     true,
+	"account_service_url":         true,
+	"account_service_log_out_url": true,
+	"language_code":               true,
+	"launch_language":             true,
+	"case_id":                     true,
+	"collection_exercise_sid":     true,
+	"response_id":                 true,
+	"questionnaire_id":            true,
+	"channel":                     true,
+	"region_code":                 true,
+	"survey":                      true,
+	"form_type":                   true,
+	"preview":                     true,
+	"schema_hash":                 true,
+	"launcher_version":            true,
+}
+
+// reservedClaims are set by the launcher itself, so schema metadata with these names would overwrite them or be
+// overwritten, corrupting the token
+var reservedClaims = map[string]bool{
+	"roles":                       true,
+	"tx_id":                       true,
+	"jti":                         true,
+	"iat":                         true,
+	"exp":                         true,
+	"nbf":                         true,
+	"schema_name":                 true,
+	"survey_url":                  true,
+	"schema_url":                  true,
+	"account_service_url":         true,
+	"account_service_log_out_url": true,
+	"schema_hash":                 true,
+	"launcher_version":            true,
+	"survey_metadata":             true,
+	"receipting":                  true,
+}
+
+// ErrReservedMetadata is returned for a schema which declares metadata named after one of the reservedClaims
+var ErrReservedMetadata = errors.New("schema declares metadata with a reserved claim name")
+
+// removeReservedMetadata removes the metadata named after reservedClaims, returning their names
+func (schema *QuestionnaireSchema) removeReservedMetadata() []string {
+	reserved := []string{}
+	metadata := schema.Metadata[:0]
+
+	for _, item := range schema.Metadata {
+		if reservedClaims[item.Name] {
+			reserved = append(reserved, item.Name)
+			continue
+		}
+		metadata = append(metadata, item)
+	}
+
+	schema.Metadata = metadata
+	return reserved
+}
+
+// declaredClaim reports whether name is a framework claim or metadata declared by the schema, the only form fields
+// which become claims when STRICT_CLAIMS is set
+func declaredClaim(name string, schema QuestionnaireSchema) bool {
+	if frameworkClaims[name] {
+		return true
+	}
+	for _, metadata := range schema.Metadata {
+		if metadata.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requiredClaims can't be excluded with EXCLUDED_CLAIMS, as no runner accepts a token without them
+var requiredClaims = map[string]bool{
+	"iat": true,
+	"exp": true,
+}
+
+// excludeClaims removes the framework claims listed in EXCLUDED_CLAIMS, for minimal runners which reject claims they
+// don't recognise. Survey metadata and the claims in requiredClaims are never removed.
+func excludeClaims(ctx context.Context, claims map[string]interface{}) map[string]interface{} {
+	for _, name := range settings.GetList("EXCLUDED_CLAIMS") {
+		if requiredClaims[name] || !frameworkClaims[name] {
+			logging.FromContext(ctx).Warn("ignoring claim in EXCLUDED_CLAIMS which can't be excluded", "claim", name)
+			continue
+		}
+		delete(claims, name)
+	}
+	return claims
+}
+
+// renameClaims renames the claims listed in CLAIM_RENAME_MAP as old:new pairs, such as ru_ref:reporting_unit_ref, for
+// runners which expect a claim under a different name. Survey metadata nested under survey_metadata.data is renamed
+// too. Renaming a claim to one the launch already has is an error, rather than losing either value.
+func renameClaims(claims map[string]interface{}) *LaunchError {
+	renames := settings.GetList("CLAIM_RENAME_MAP")
+	if len(renames) == 0 {
+		return nil
+	}
+
+	targets := []map[string]interface{}{claims}
+	if surveyMetadata, ok := claims["survey_metadata"].(map[string]interface{}); ok {
+		if data, ok := surveyMetadata["data"].(map[string]interface{}); ok {
+			targets = append(targets, data)
+		}
+	}
+
+	for _, rename := range renames {
+		separator := strings.Index(rename, ":")
+		if separator < 1 || separator == len(rename)-1 {
+			return &LaunchError{Kind: LaunchErrorConfiguration, Desc: fmt.Sprintf("CLAIM_RENAME_MAP entry %q should be old:new", rename)}
+		}
+		oldName := strings.TrimSpace(rename[:separator])
+		newName := strings.TrimSpace(rename[separator+1:])
+
+		for _, target := range targets {
+			value, ok := target[oldName]
+			if !ok {
+				continue
+			}
+			if _, exists := target[newName]; exists {
+				return &LaunchError{Kind: LaunchErrorConfiguration, Desc: fmt.Sprintf("CLAIM_RENAME_MAP renames %s to %s, which the launch already has", oldName, newName)}
+			}
+			delete(target, oldName)
+			target[newName] = value
+		}
+	}
+	return nil
+}
+
+// countClaims returns the number of claims, including those nested in objects such as survey_metadata.data
+func countClaims(claims map[string]interface{}) int {
+	count := len(claims)
+	for _, value := range claims {
+		if nested, ok := value.(map[string]interface{}); ok {
+			count += countClaims(nested)
+		}
+	}
+	return count
+}
+
+// checkMaxClaims rejects launches with more than MAX_CLAIMS claims, such as from a schema which declares an enormous
+// number of metadata items
+func checkMaxClaims(claims map[string]interface{}) *LaunchError {
+	maxClaims := settings.GetInt("MAX_CLAIMS")
+	if maxClaims <= 0 {
+		return nil
+	}
+	if count := countClaims(claims); count > maxClaims {
+		return &LaunchError{Kind: LaunchErrorSchema, Desc: fmt.Sprintf("The launch has %d claims, more than MAX_CLAIMS (%d)", count, maxClaims)}
+	}
+	return nil
+}
+
+// EmptyClaimValue forces a claim to be sent as an empty string, where an empty value would otherwise be left out or
+// replaced by the metadata's default
+const EmptyClaimValue = "__EMPTY__"
+
+// emptyRequiredMetadata sends the schema's required metadata which was given for the launch with an empty value, such as
+// the empty address_line2 default, as an empty string rather than leaving it out, when EMPTY_REQUIRED_METADATA is set
+// for runners which only need the claim to exist. Empty values which the schema doesn't require are still left out.
+func emptyRequiredMetadata(requiredMetadata []Metadata, claims map[string]interface{}, values map[string][]string) {
+	if !settings.GetBool("EMPTY_REQUIRED_METADATA") {
+		return
+	}
+
+	for _, metadata := range requiredMetadata {
+		if _, present := claims[metadata.Name]; present || len(values[metadata.Name]) == 0 || !metadata.required(claims) {
+			continue
+		}
+		claims[metadata.Name] = ""
+	}
+}
+
+// nullOptionalMetadata sets the schema's optional metadata which wasn't given for the launch to null, when
+// NULL_OPTIONAL_METADATA is set for runners which treat a null claim differently from an absent one. It runs after
+// validation, which expects claims to be strings or booleans.
+func nullOptionalMetadata(requiredMetadata []Metadata, claims map[string]interface{}, values url.Values) {
+	if !settings.GetBool("NULL_OPTIONAL_METADATA") {
+		return
+	}
+
+	for _, metadata := range requiredMetadata {
+		if metadata.required(claims) || values.Get(metadata.Name) != "" {
+			continue
+		}
+		if value, present := claims[metadata.Name]; !present || value == "" {
+			claims[metadata.Name] = nil
+		}
+	}
+}
+
+// Base64ClaimPrefix marks a value as base64url encoded, so that opaque values which the form encoding would mangle
+// can be passed through. The claim is the decoded value.
+const Base64ClaimPrefix = "b64:"
+
+// decodeClaimValues returns a copy of values with the values starting with Base64ClaimPrefix decoded
+func decodeClaimValues(values url.Values) (url.Values, *LaunchError) {
+	decoded := copyValues(values)
+	var metadataErrors []MetadataError
+
+	for name, value := range decoded {
+		for i, v := range value {
+			if !strings.HasPrefix(v, Base64ClaimPrefix) {
+				continue
+			}
+
+			raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimPrefix(v, Base64ClaimPrefix), "="))
+			if err != nil {
+				metadataErrors = append(metadataErrors, MetadataError{Name: name, Reason: "is not valid base64url after " + Base64ClaimPrefix})
+				continue
+			}
+			if !utf8.Valid(raw) {
+				metadataErrors = append(metadataErrors, MetadataError{Name: name, Reason: "must decode to UTF-8 text, as claims are JSON strings"})
+				continue
+			}
+			value[i] = string(raw)
+		}
+	}
+
+	if len(metadataErrors) > 0 {
+		sort.Slice(metadataErrors, func(i, j int) bool { return metadataErrors[i].Name < metadataErrors[j].Name })
+		return nil, metadataLaunchError(metadataErrors)
+	}
+	return decoded, nil
+}
+
+// prefixMetadataClaims adds METADATA_CLAIM_PREFIX to the name of each claim which is metadata declared by the schema,
+// for runners which expect survey metadata namespaced, as in md_ru_ref. Framework claims and other claims the launch
+// was given, such as account_service_url, keep their names.
+func prefixMetadataClaims(claims map[string]interface{}, metadata []Metadata) {
+	prefix := settings.Get("METADATA_CLAIM_PREFIX")
+	if prefix == "" {
+		return
+	}
+
+	for _, item := range metadata {
+		value, ok := claims[item.Name]
+		if !ok || frameworkClaims[item.Name] {
+			continue
+		}
+		delete(claims, item.Name)
+		claims[prefix+item.Name] = value
+	}
+}
+
+// receiptingClaims are the identifiers the eq-v3 profile nests under the receipting claim
+var receiptingClaims = []string{"case_id", "collection_exercise_sid", "schema_name"}
+
+// applyClaimsShape arranges the survey metadata claims for the runner version selected by CLAIMS_VERSION: flat at the
+// top level for "v1", nested under survey_metadata.data for "v2", or both for "both" while migrating between them.
+// "eq-v3" nests them as "v2" does, and also moves the receiptingClaims under receipting.
+func applyClaimsShape(claims map[string]interface{}) (map[string]interface{}, error) {
+	version := settings.Get("CLAIMS_VERSION")
+	if version != "v2" && version != "both" && version != "eq-v3" {
+		return claims, nil
+	}
+
+	data := make(map[string]interface{})
+	for key, value := range claims {
+		if !frameworkClaims[key] {
+			data[key] = value
+		}
+	}
+
+	if version != "both" {
+		for key := range data {
+			delete(claims, key)
+		}
+	}
+
+	claims["survey_metadata"] = map[string]interface{}{"data": data}
+
+	if version == "eq-v3" {
+		receipting, err := receiptingClaim(claims)
+		if err != nil {
+			return nil, err
+		}
+		claims["receipting"] = receipting
+	}
+
+	return claims, nil
+}
+
+// receiptingClaim moves the receiptingClaims into the receipting claim of the eq-v3 profile, marked as version v2.
+// Identifiers the launch didn't give are filled from GetDefaultValues.
+func receiptingClaim(claims map[string]interface{}) (map[string]interface{}, error) {
+	defaults, err := GetDefaultValues()
+	if err != nil {
+		return nil, err
+	}
+
+	receipting := map[string]interface{}{"version": "v2"}
+	for _, name := range receiptingClaims {
+		if value, ok := claims[name]; ok {
+			receipting[name] = value
+			delete(claims, name)
+		} else if value, ok := defaults[name]; ok {
+			receipting[name] = value
+		}
+	}
+	return receipting, nil
+}
+
+// previewClaim returns the preview claim, which launches the runner in its read-only preview mode, as a boolean. A
+// ticked checkbox without a value is sent as "on".
+func previewClaim(values map[string][]string) bool {
+	if len(values["preview"]) == 0 {
+		return false
+	}
+
+	value := strings.TrimSpace(values["preview"][0])
+	if strings.EqualFold(value, "on") {
+		return true
+	}
+	preview, _ := strconv.ParseBool(value)
+	return preview
+}
+
+// ClaimsHash returns a hex SHA-256 of the claims as canonical JSON, for use as a cache or dedup key. Map keys at every
+// level are sorted by encoding/json, so the same claims give the same hash whatever order they were set in.
+func ClaimsHash(claims map[string]interface{}) (string, error) {
+	var canonical bytes.Buffer
+	encoder := json.NewEncoder(&canonical)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(claims); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(bytes.TrimSuffix(canonical.Bytes(), []byte("\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,800 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"github.com/ONSdigital/eq-questionnaire-launcher/version"
+	"github.com/gofrs/uuid"
+)
+
+func TestPrefixMetadataClaims(t *testing.T) {
+	metadata := []Metadata{{Name: "ru_ref"}, {Name: "period_id"}, {Name: "trad_as", Optional: true}}
+
+	tests := []struct {
+		name   string
+		prefix string
+		claims map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "no prefix",
+			prefix: "",
+			claims: map[string]interface{}{"ru_ref": "1", "tx_id": "t"},
+			want:   map[string]interface{}{"ru_ref": "1", "tx_id": "t"},
+		},
+		{
+			name:   "declared metadata",
+			prefix: "md_",
+			claims: map[string]interface{}{"ru_ref": "1", "period_id": "201605"},
+			want:   map[string]interface{}{"md_ru_ref": "1", "md_period_id": "201605"},
+		},
+		{
+			name:   "framework claims",
+			prefix: "md_",
+			claims: map[string]interface{}{"ru_ref": "1", "tx_id": "t", "roles": []string{"dumper"}, "survey_url": "u"},
+			want:   map[string]interface{}{"md_ru_ref": "1", "tx_id": "t", "roles": []string{"dumper"}, "survey_url": "u"},
+		},
+		{
+			name:   "undeclared claims",
+			prefix: "md_",
+			claims: map[string]interface{}{"ru_ref": "1", "account_service_url": "a", "language_code": "en", "response_expires_at": "r"},
+			want:   map[string]interface{}{"md_ru_ref": "1", "account_service_url": "a", "language_code": "en", "response_expires_at": "r"},
+		},
+		{
+			name:   "declared metadata not given",
+			prefix: "md_",
+			claims: map[string]interface{}{"ru_ref": "1"},
+			want:   map[string]interface{}{"md_ru_ref": "1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "METADATA_CLAIM_PREFIX", test.prefix)
+			prefixMetadataClaims(test.claims, metadata)
+			if !reflect.DeepEqual(test.claims, test.want) {
+				t.Errorf("expected %v, got %v", test.want, test.claims)
+			}
+		})
+	}
+}
+
+func TestApplyClaimsShape(t *testing.T) {
+	data := map[string]interface{}{"ru_ref": "12346789012A", "period_id": "201605"}
+
+	tests := []struct {
+		version string
+		want    map[string]interface{}
+	}{
+		{"v1", map[string]interface{}{"tx_id": "t", "ru_ref": "12346789012A", "period_id": "201605"}},
+		{"v2", map[string]interface{}{"tx_id": "t", "survey_metadata": map[string]interface{}{"data": data}}},
+		{"both", map[string]interface{}{"tx_id": "t", "ru_ref": "12346789012A", "period_id": "201605", "survey_metadata": map[string]interface{}{"data": data}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version, func(t *testing.T) {
+			withSetting(t, "CLAIMS_VERSION", test.version)
+
+			claims, err := applyClaimsShape(map[string]interface{}{"tx_id": "t", "ru_ref": "12346789012A", "period_id": "201605"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(claims, test.want) {
+				t.Errorf("expected %v, got %v", test.want, claims)
+			}
+		})
+	}
+}
+
+func TestApplyClaimsShapeEqV3(t *testing.T) {
+	withSetting(t, "CLAIMS_VERSION", "eq-v3")
+	sid := uuid.Must(uuid.FromString("6f0d8b8a-4a7e-4b8e-9c1e-2a5c1b0d7e3f"))
+	previous := newUUID
+	t.Cleanup(func() { newUUID = previous })
+	newUUID = func() (uuid.UUID, error) { return sid, nil }
+
+	data := map[string]interface{}{"ru_ref": "12346789012A", "period_id": "201605"}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			"identifiers given",
+			map[string]interface{}{"tx_id": "t", "ru_ref": "12346789012A", "period_id": "201605", "case_id": "c", "collection_exercise_sid": "s", "schema_name": "test_roundtrip"},
+			map[string]interface{}{
+				"tx_id":           "t",
+				"survey_metadata": map[string]interface{}{"data": data},
+				"receipting":      map[string]interface{}{"version": "v2", "case_id": "c", "collection_exercise_sid": "s", "schema_name": "test_roundtrip"},
+			},
+		},
+		{
+			"identifiers defaulted",
+			map[string]interface{}{"tx_id": "t", "ru_ref": "12346789012A", "period_id": "201605", "case_id": "c", "schema_name": "test_roundtrip"},
+			map[string]interface{}{
+				"tx_id":           "t",
+				"survey_metadata": map[string]interface{}{"data": data},
+				"receipting":      map[string]interface{}{"version": "v2", "case_id": "c", "collection_exercise_sid": sid.String(), "schema_name": "test_roundtrip"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims, err := applyClaimsShape(test.claims)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(claims, test.want) {
+				t.Errorf("expected %v, got %v", test.want, claims)
+			}
+		})
+	}
+}
+
+func TestClaimsShapeBothInLaunch(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	withSetting(t, "CLAIMS_VERSION", "both")
+
+	claims := dryRunLaunch(t, url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}).Claims
+
+	nested, _ := claims["survey_metadata"].(map[string]interface{})
+	nestedData, _ := nested["data"].(map[string]interface{})
+	for _, name := range []string{"ru_ref", "period_id"} {
+		if claims[name] == nil || nestedData[name] != claims[name] {
+			t.Errorf("expected %s both flat and nested, got %v and %v", name, claims[name], nestedData[name])
+		}
+	}
+	if _, ok := nestedData["tx_id"]; ok {
+		t.Error("expected framework claims not to be nested")
+	}
+}
+
+func TestPreviewClaim(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string][]string
+		want   bool
+	}{
+		{"absent", map[string][]string{}, false},
+		{"ticked checkbox", map[string][]string{"preview": {"on"}}, true},
+		{"true", map[string][]string{"preview": {"true"}}, true},
+		{"false", map[string][]string{"preview": {"false"}}, false},
+		{"invalid", map[string][]string{"preview": {"maybe"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := previewClaim(test.values); got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPreviewClaimInToken(t *testing.T) {
+	runner := useMockRunner(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name    string
+		preview []string
+		want    bool
+	}{
+		{"preview", []string{"true"}, true},
+		{"not preview", []string{"false"}, false},
+		{"default", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+			if test.preview != nil {
+				values["preview"] = test.preview
+			}
+
+			token, launchErr := GenerateTokenFromPost(context.Background(), values)
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			claims, err := runner.Claims(token)
+			if err != nil {
+				t.Fatalf("runner rejected the token: %v", err)
+			}
+
+			if preview, ok := claims["preview"].(bool); !ok || preview != test.want {
+				t.Errorf("expected preview to be the JSON boolean %v, got %#v", test.want, claims["preview"])
+			}
+		})
+	}
+}
+
+func TestEmptyClaimValue(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	server := schemaServer(t, 200, defaultsSchema)
+
+	tests := []struct {
+		name        string
+		value       []string
+		want        interface{}
+		wantDefault interface{}
+	}{
+		{"forced empty", []string{EmptyClaimValue}, "", ""},
+		{"absent", nil, nil, "May 2017"},
+		{"given", []string{"ESSENTIAL"}, "ESSENTIAL", "ESSENTIAL"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+			if test.value != nil {
+				values["trad_as"] = test.value
+			}
+			launch := dryRunLaunch(t, values)
+			if got, ok := launch.Claims["trad_as"]; got != test.want || ok != (test.want != nil) {
+				t.Errorf("expected trad_as %#v, got %#v", test.want, got)
+			}
+
+			values = url.Values{"ru_ref": {"12346789012A"}}
+			if test.value != nil {
+				values["period_str"] = test.value
+			}
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_defaults.json", "", "", values, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if got := launch.Claims["period_str"]; got != test.wantDefault {
+				t.Errorf("expected period_str %#v, got %#v", test.wantDefault, got)
+			}
+		})
+	}
+}
+
+func TestExcludedClaims(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name     string
+		excluded string
+		absent   []string
+		present  []string
+	}{
+		{"none", "", nil, []string{"roles", "iat", "exp", "ru_ref"}},
+		{"roles", "roles", []string{"roles"}, []string{"iat", "exp", "ru_ref"}},
+		{"required claims", "iat,exp", nil, []string{"roles", "iat", "exp"}},
+		{"survey metadata", "ru_ref", nil, []string{"ru_ref"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "EXCLUDED_CLAIMS", test.excluded)
+			launch := dryRunLaunch(t, url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "roles": {"dumper"}})
+			for _, name := range test.absent {
+				if _, ok := launch.Claims[name]; ok {
+					t.Errorf("expected no %s claim, got %v", name, launch.Claims)
+				}
+			}
+			for _, name := range test.present {
+				if _, ok := launch.Claims[name]; !ok {
+					t.Errorf("expected a %s claim, got %v", name, launch.Claims)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeClaimValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		want       string
+		wantFields []string
+	}{
+		{"plain", "a+b/c", "a+b/c", nil},
+		{"decoded", Base64ClaimPrefix + "YSZiPWMgZA", "a&b=c d", nil},
+		{"padded", Base64ClaimPrefix + "YSZiPWMgZA==", "a&b=c d", nil},
+		{"invalid base64", Base64ClaimPrefix + "not base64!", "", []string{"case_ref"}},
+		{"not UTF-8", Base64ClaimPrefix + "_w", "", []string{"case_ref"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"case_ref": {test.value}}
+			decoded, launchErr := decodeClaimValues(values)
+			if test.wantFields != nil {
+				if launchErr == nil {
+					t.Fatalf("expected an error, got %v", decoded)
+				}
+				if got := metadataErrorNames(launchErr.Fields); !reflect.DeepEqual(got, test.wantFields) {
+					t.Errorf("expected errors for %v, got %v", test.wantFields, got)
+				}
+				return
+			}
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if got := decoded.Get("case_ref"); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+			if values.Get("case_ref") != test.value {
+				t.Errorf("expected the values to be unchanged, got %v", values)
+			}
+		})
+	}
+}
+
+func TestNullOptionalMetadata(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name        string
+		enabled     string
+		tradAs      []string
+		wantPresent bool
+		want        interface{}
+	}{
+		{"omitted", "false", nil, false, nil},
+		{"null", "true", nil, true, nil},
+		{"given", "true", []string{"ESSENTIAL"}, true, "ESSENTIAL"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "NULL_OPTIONAL_METADATA", test.enabled)
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+			if test.tradAs != nil {
+				values["trad_as"] = test.tradAs
+			}
+
+			launch := dryRunLaunch(t, values)
+			if got, present := launch.Claims["trad_as"]; present != test.wantPresent || got != test.want {
+				t.Errorf("expected trad_as %v (present %v), got %v (present %v)", test.want, test.wantPresent, got, present)
+			}
+			if launch.Claims["ru_ref"] != "12346789012A" {
+				t.Errorf("expected the required ru_ref unchanged, got %v", launch.Claims["ru_ref"])
+			}
+		})
+	}
+}
+
+func TestClaimsHash(t *testing.T) {
+	first := map[string]interface{}{}
+	first["ru_ref"] = "12346789012A"
+	first["roles"] = []interface{}{"dumper"}
+	first["survey_metadata"] = map[string]interface{}{"data": map[string]interface{}{"a": "1", "b": "2"}}
+
+	second := map[string]interface{}{}
+	second["survey_metadata"] = map[string]interface{}{"data": map[string]interface{}{"b": "2", "a": "1"}}
+	second["roles"] = []interface{}{"dumper"}
+	second["ru_ref"] = "12346789012A"
+
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		wantSame bool
+	}{
+		{"same claims in another order", second, true},
+		{"different value", map[string]interface{}{"ru_ref": "12346789012B", "roles": []interface{}{"dumper"}, "survey_metadata": second["survey_metadata"]}, false},
+		{"different nested value", map[string]interface{}{"ru_ref": "12346789012A", "roles": []interface{}{"dumper"}, "survey_metadata": map[string]interface{}{"data": map[string]interface{}{"a": "1"}}}, false},
+		{"different list order", map[string]interface{}{"ru_ref": "12346789012A", "roles": []interface{}{"flusher", "dumper"}, "survey_metadata": second["survey_metadata"]}, false},
+	}
+
+	want, err := ClaimsHash(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ClaimsHash(test.claims)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (got == want) != test.wantSame {
+				t.Errorf("expected the same hash %v, got %s and %s", test.wantSame, want, got)
+			}
+		})
+	}
+}
+
+func TestSchemaHashClaim(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	server := schemaServer(t, 200, defaultsSchema)
+
+	roundTripSum := sha256.Sum256([]byte(roundTripSchema))
+	defaultsSum := sha256.Sum256([]byte(defaultsSchema))
+
+	byName := func() (*Launch, *LaunchError) {
+		return GenerateLaunch(context.Background(), "", url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}, TokenOptions{DryRun: true})
+	}
+	byURL := func() (*Launch, *LaunchError) {
+		return GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_defaults.json", "", "", url.Values{}, TokenOptions{DryRun: true})
+	}
+
+	tests := []struct {
+		name    string
+		enabled string
+		launch  func() (*Launch, *LaunchError)
+		want    string
+	}{
+		{"by name", "true", byName, hex.EncodeToString(roundTripSum[:])},
+		{"by URL", "true", byURL, hex.EncodeToString(defaultsSum[:])},
+		{"disabled", "false", byName, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SCHEMA_HASH_CLAIM", test.enabled)
+
+			launch, launchErr := test.launch()
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			got, present := launch.Claims["schema_hash"]
+			if test.want == "" {
+				if present {
+					t.Errorf("expected no schema_hash, got %v", got)
+				}
+				return
+			}
+			if got != test.want {
+				t.Errorf("expected %s, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestStrictClaims(t *testing.T) {
+	useTestKeys(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "survey": {"MBS"}, "unknown_field": {"x"}}
+
+	tests := []struct {
+		name        string
+		strict      string
+		wantUnknown bool
+	}{
+		{"strict drops unknown fields", "true", false},
+		{"permissive keeps them", "false", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "STRICT_CLAIMS", test.strict)
+
+			launch := dryRunLaunch(t, values)
+			if _, ok := launch.Claims["unknown_field"]; ok != test.wantUnknown {
+				t.Errorf("expected unknown_field %v, got %v", test.wantUnknown, launch.Claims)
+			}
+			if launch.Claims["ru_ref"] != "12346789012A" || launch.Claims["survey"] != "MBS" {
+				t.Errorf("expected declared metadata and framework claims to be kept, got %v", launch.Claims)
+			}
+		})
+	}
+}
+
+func TestRenameClaims(t *testing.T) {
+	tests := []struct {
+		name      string
+		renames   string
+		claims    map[string]interface{}
+		want      map[string]interface{}
+		wantError bool
+	}{
+		{
+			"simple rename", "ru_ref:reporting_unit_ref",
+			map[string]interface{}{"ru_ref": "12346789012A", "tx_id": "1"},
+			map[string]interface{}{"reporting_unit_ref": "12346789012A", "tx_id": "1"}, false,
+		},
+		{
+			"nested survey metadata", "ru_ref:reporting_unit_ref",
+			map[string]interface{}{"survey_metadata": map[string]interface{}{"data": map[string]interface{}{"ru_ref": "12346789012A"}}},
+			map[string]interface{}{"survey_metadata": map[string]interface{}{"data": map[string]interface{}{"reporting_unit_ref": "12346789012A"}}}, false,
+		},
+		{
+			"claim not in the launch", "trad_as:trading_as",
+			map[string]interface{}{"ru_ref": "12346789012A"},
+			map[string]interface{}{"ru_ref": "12346789012A"}, false,
+		},
+		{
+			"colliding rename", "ru_ref:user_id",
+			map[string]interface{}{"ru_ref": "12346789012A", "user_id": "UNKNOWN"}, nil, true,
+		},
+		{
+			"malformed entry", "ru_ref",
+			map[string]interface{}{"ru_ref": "12346789012A"}, nil, true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "CLAIM_RENAME_MAP", test.renames)
+
+			launchErr := renameClaims(test.claims)
+			if test.wantError {
+				if launchErr == nil || launchErr.Kind != LaunchErrorConfiguration {
+					t.Errorf("expected a configuration error, got %v", launchErr)
+				}
+				return
+			}
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if !reflect.DeepEqual(test.claims, test.want) {
+				t.Errorf("expected %v, got %v", test.want, test.claims)
+			}
+		})
+	}
+}
+
+func TestRegionCodeClaim(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name       string
+		regionCode string
+		want       string
+	}{
+		{"underscored", "gb_eng", "GB-ENG"},
+		{"lowercase", "gb-eng", "GB-ENG"},
+		{"canonical", "GB-ENG", "GB-ENG"},
+		{"padded", " gb_wls ", "GB-WLS"},
+		{"forced empty", EmptyClaimValue, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "region_code": {test.regionCode}}
+			launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if launch.Claims["region_code"] != test.want {
+				t.Errorf("expected region_code %s, got %v", test.want, launch.Claims["region_code"])
+			}
+			if values.Get("region_code") != test.regionCode {
+				t.Errorf("expected the values not to be modified, got %v", values)
+			}
+		})
+	}
+}
+
+func TestLauncherVersionClaim(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	previous := version.Version
+	t.Cleanup(func() { version.Version = previous })
+	version.Version = "v1.2.3"
+
+	tests := []struct {
+		name    string
+		enabled string
+		want    interface{}
+	}{
+		{"enabled", "true", "v1.2.3"},
+		{"disabled", "false", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "LAUNCHER_VERSION_CLAIM", test.enabled)
+
+			launch := dryRunLaunch(t, url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}})
+			if got, present := launch.Claims["launcher_version"]; got != test.want || present != (test.want != nil) {
+				t.Errorf("expected launcher_version %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestTrimClaimValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  string
+		excluded string
+		want     map[string]interface{}
+	}{
+		{"trimmed", "true", "", map[string]interface{}{"ru_ref": "12346789012A", "display_address": "68 Abingdon Road"}},
+		{"excluded", "true", "display_address", map[string]interface{}{"ru_ref": "12346789012A", "display_address": "  68 Abingdon Road "}},
+		{"disabled", "false", "", map[string]interface{}{"ru_ref": " 12346789012A ", "display_address": "  68 Abingdon Road "}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "TRIM_CLAIM_VALUES", test.enabled)
+			withSetting(t, "TRIM_CLAIM_VALUES_EXCLUDED", test.excluded)
+
+			values := map[string][]string{"ru_ref": {" 12346789012A "}, "display_address": {"  68 Abingdon Road "}}
+			claims, err := generateClaims(context.Background(), values, surveys.LauncherSchema{Name: "test"}, QuestionnaireSchema{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for name, want := range test.want {
+				if claims[name] != want {
+					t.Errorf("expected %s %q, got %q", name, want, claims[name])
+				}
+			}
+		})
+	}
+}
+
+func TestTrimClaimValuesBlank(t *testing.T) {
+	withSetting(t, "TRIM_CLAIM_VALUES", "true")
+
+	claims, err := generateClaims(context.Background(), map[string][]string{"trad_as": {"   "}}, surveys.LauncherSchema{Name: "test"}, QuestionnaireSchema{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := claims["trad_as"]; ok {
+		t.Errorf("expected a value of only whitespace to be left out, got %q", claims["trad_as"])
+	}
+}
+
+func TestDeterministicTxID(t *testing.T) {
+	txID := func(t *testing.T, values map[string][]string) string {
+		t.Helper()
+		claims, err := generateClaims(context.Background(), values, surveys.LauncherSchema{Name: "test"}, QuestionnaireSchema{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return claims["tx_id"].(string)
+	}
+	values := map[string][]string{"ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+
+	tests := []struct {
+		name     string
+		enabled  string
+		other    map[string][]string
+		wantSame bool
+	}{
+		{"identical values", "true", map[string][]string{"period_id": {"201605"}, "ru_ref": {"12346789012A"}}, true},
+		{"different values", "true", map[string][]string{"ru_ref": {"12346789012A"}, "period_id": {"201606"}}, false},
+		{"random by default", "false", values, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "DETERMINISTIC_TX_ID", test.enabled)
+
+			first, second := txID(t, values), txID(t, test.other)
+			if _, err := uuid.FromString(first); err != nil {
+				t.Errorf("expected tx_id to be a UUID, got %s", first)
+			}
+			if (first == second) != test.wantSame {
+				t.Errorf("expected the same tx_id %v, got %s and %s", test.wantSame, first, second)
+			}
+		})
+	}
+}
+
+func TestAccountServiceURLTrailingSlash(t *testing.T) {
+	useTestKeys(t)
+	server := schemaServer(t, 200, defaultsSchema)
+
+	tests := []struct {
+		name string
+		mode string
+		url  string
+		want string
+	}{
+		{"strip with slash", "strip", "https://surveys.example.com/", "https://surveys.example.com"},
+		{"strip without slash", "strip", "https://surveys.example.com", "https://surveys.example.com"},
+		{"ensure with slash", "ensure", "https://surveys.example.com/", "https://surveys.example.com/"},
+		{"ensure without slash", "ensure", "https://surveys.example.com", "https://surveys.example.com/"},
+		{"unchanged with slash", "", "https://surveys.example.com/", "https://surveys.example.com/"},
+		{"unchanged without slash", "", "https://surveys.example.com", "https://surveys.example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ACCOUNT_SERVICE_URL_TRAILING_SLASH", test.mode)
+
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_defaults.json", test.url, test.url, url.Values{}, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			for _, name := range []string{"account_service_url", "account_service_log_out_url"} {
+				if got := launch.Claims[name]; got != test.want {
+					t.Errorf("expected %s %s, got %v", name, test.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCountClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   int
+	}{
+		{"flat", map[string]interface{}{"tx_id": "t", "ru_ref": "1"}, 2},
+		{"nested", map[string]interface{}{"tx_id": "t", "survey_metadata": map[string]interface{}{"data": map[string]interface{}{"ru_ref": "1", "period_id": "2"}}}, 5},
+		{"lists aren't counted", map[string]interface{}{"roles": []string{"dumper", "flusher"}}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := countClaims(test.claims); got != test.want {
+				t.Errorf("expected %d, got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMaxClaims(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+
+	withSetting(t, "MAX_CLAIMS", "0")
+	count := countClaims(dryRunLaunch(t, values).Claims)
+
+	tests := []struct {
+		name      string
+		maxClaims int
+		wantError bool
+	}{
+		{"at the limit", count, false},
+		{"over the limit", count - 1, true},
+		{"unlimited", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "MAX_CLAIMS", fmt.Sprint(test.maxClaims))
+
+			_, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if !test.wantError {
+				if launchErr != nil {
+					t.Errorf("unexpected error: %v", launchErr)
+				}
+				return
+			}
+			if launchErr == nil || !strings.Contains(launchErr.Desc, "MAX_CLAIMS") {
+				t.Errorf("expected a MAX_CLAIMS error, got %v", launchErr)
+			}
+		})
+	}
+}
+
+func TestEmptyRequiredMetadata(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_address": `{"schema_name": "test_address", "metadata": [
+		{"name": "ru_ref", "type": "string"},
+		{"name": "address_line2", "type": "string"}
+	]}`})
+
+	tests := []struct {
+		name        string
+		enabled     string
+		wantAddress bool
+	}{
+		{"enabled", "true", true},
+		{"disabled", "false", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "EMPTY_REQUIRED_METADATA", test.enabled)
+
+			claims := dryRunLaunch(t, url.Values{"schema_name": {"test_address"}, "ru_ref": {"12346789012A"}, "address_line2": {""}, "locality": {""}}).Claims
+			if address, present := claims["address_line2"]; present != test.wantAddress || (present && address != "") {
+				t.Errorf("expected address_line2 present as an empty string %v, got %q (present %v)", test.wantAddress, address, present)
+			}
+			if locality, present := claims["locality"]; present {
+				t.Errorf("expected the undeclared empty locality to be left out, got %q", locality)
+			}
+		})
+	}
+}
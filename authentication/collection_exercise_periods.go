@@ -0,0 +1,60 @@
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+var (
+	collectionExercisePeriods        map[string]string
+	collectionExercisePeriodsErr     error
+	loadCollectionExercisePeriodsMap sync.Once
+)
+
+// readCollectionExercisePeriods loads the period_id of each collection_exercise_sid from the
+// COLLECTION_EXERCISE_PERIODS_PATH file, e.g. {"789473423": "201605"}
+func readCollectionExercisePeriods(periodsPath string) (map[string]string, error) {
+	periodsData, err := ioutil.ReadFile(periodsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read COLLECTION_EXERCISE_PERIODS_PATH: %w", err)
+	}
+
+	periods := make(map[string]string)
+	if err := json.Unmarshal(periodsData, &periods); err != nil {
+		return nil, fmt.Errorf("failed to parse COLLECTION_EXERCISE_PERIODS_PATH: %w", err)
+	}
+	return periods, nil
+}
+
+// validateCollectionExercisePeriod checks that the period_id given for the launch is the one
+// COLLECTION_EXERCISE_PERIODS_PATH maps its collection_exercise_sid to, for scenarios which need the two to agree with
+// the upstream services. Collection exercises which aren't in the file aren't checked.
+func validateCollectionExercisePeriod(claims map[string]interface{}) *LaunchError {
+	periodsPath := settings.Get("COLLECTION_EXERCISE_PERIODS_PATH")
+	if periodsPath == "" {
+		return nil
+	}
+
+	collectionExerciseSid, _ := claims["collection_exercise_sid"].(string)
+	periodID, _ := claims["period_id"].(string)
+	if collectionExerciseSid == "" || periodID == "" {
+		return nil
+	}
+
+	loadCollectionExercisePeriodsMap.Do(func() {
+		collectionExercisePeriods, collectionExercisePeriodsErr = readCollectionExercisePeriods(periodsPath)
+	})
+	if collectionExercisePeriodsErr != nil {
+		return &LaunchError{Kind: LaunchErrorConfiguration, Desc: collectionExercisePeriodsErr.Error()}
+	}
+
+	expected, ok := collectionExercisePeriods[collectionExerciseSid]
+	if !ok || expected == periodID {
+		return nil
+	}
+	return metadataLaunchError([]MetadataError{{Name: "period_id", Reason: fmt.Sprintf("collection exercise %s is for period %s, got %s", collectionExerciseSid, expected, periodID)}})
+}
@@ -0,0 +1,69 @@
+package authentication
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// withCollectionExercisePeriods points COLLECTION_EXERCISE_PERIODS_PATH at a file holding periodsJSON and reloads it,
+// as it is otherwise only read once
+func withCollectionExercisePeriods(t *testing.T, periodsJSON string) {
+	t.Helper()
+	periodsPath := filepath.Join(t.TempDir(), "periods.json")
+	if err := ioutil.WriteFile(periodsPath, []byte(periodsJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	withSetting(t, "COLLECTION_EXERCISE_PERIODS_PATH", periodsPath)
+
+	loadCollectionExercisePeriodsMap = sync.Once{}
+	t.Cleanup(func() { loadCollectionExercisePeriodsMap = sync.Once{} })
+}
+
+func TestValidateCollectionExercisePeriod(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name       string
+		periods    string
+		sid        string
+		periodID   string
+		wantKind   string
+		wantFields []string
+	}{
+		{"matching pair", `{"789473423": "201605"}`, "789473423", "201605", "", nil},
+		{"mismatching pair", `{"789473423": "201605"}`, "789473423", "201606", LaunchErrorMetadata, []string{"period_id"}},
+		{"unmapped collection exercise", `{"789473423": "201605"}`, "123", "201606", "", nil},
+		{"invalid file", `not json`, "789473423", "201605", LaunchErrorConfiguration, nil},
+		{"disabled", "", "789473423", "201606", "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.periods != "" {
+				withCollectionExercisePeriods(t, test.periods)
+			} else {
+				withSetting(t, "COLLECTION_EXERCISE_PERIODS_PATH", "")
+			}
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {test.periodID}, "collection_exercise_sid": {test.sid}}
+
+			_, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if test.wantKind == "" {
+				if launchErr != nil {
+					t.Errorf("unexpected error: %v", launchErr)
+				}
+				return
+			}
+			if launchErr == nil || launchErr.Kind != test.wantKind {
+				t.Fatalf("expected a %s error, got %v", test.wantKind, launchErr)
+			}
+			if test.wantFields != nil && !reflect.DeepEqual(metadataErrorNames(launchErr.Fields), test.wantFields) {
+				t.Errorf("expected errors for %v, got %+v", test.wantFields, launchErr.Fields)
+			}
+		})
+	}
+}
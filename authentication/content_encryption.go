@@ -0,0 +1,56 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// ContentEncryptions are the JWE content encryption algorithms a token can be encrypted with
+var ContentEncryptions = []string{
+	string(jose.A128GCM),
+	string(jose.A192GCM),
+	string(jose.A256GCM),
+	string(jose.A128CBC_HS256),
+	string(jose.A192CBC_HS384),
+	string(jose.A256CBC_HS512),
+}
+
+func validContentEncryption(enc string) bool {
+	for _, valid := range ContentEncryptions {
+		if enc == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// contentEncryptionOverride returns the enc launch value when ENABLE_ENC_OVERRIDE allows a single launch to be
+// encrypted differently, for debugging runners which disagree about the algorithm
+func contentEncryptionOverride(values url.Values) string {
+	if !settings.GetBool("ENABLE_ENC_OVERRIDE") {
+		return ""
+	}
+	return values.Get("enc")
+}
+
+// contentEncryption returns the algorithm to encrypt a token with, which is JWT_CONTENT_ENCRYPTION unless override is
+// a valid algorithm
+func contentEncryption(ctx context.Context, override string) (jose.ContentEncryption, *TokenError) {
+	if override != "" {
+		if validContentEncryption(override) {
+			return jose.ContentEncryption(override), nil
+		}
+		logging.FromContext(ctx).Warn("ignoring invalid enc override", "enc", override)
+	}
+
+	configured := settings.Get("JWT_CONTENT_ENCRYPTION")
+	if !validContentEncryption(configured) {
+		return "", &TokenError{Desc: fmt.Sprintf("JWT_CONTENT_ENCRYPTION %q is not a supported content encryption", configured)}
+	}
+	return jose.ContentEncryption(configured), nil
+}
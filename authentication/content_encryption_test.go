@@ -0,0 +1,109 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestContentEncryption(t *testing.T) {
+	withSetting(t, "JWT_CONTENT_ENCRYPTION", "A256GCM")
+
+	tests := []struct {
+		name     string
+		override string
+		want     jose.ContentEncryption
+	}{
+		{"absent", "", jose.A256GCM},
+		{"valid", "A128CBC-HS256", jose.A128CBC_HS256},
+		{"invalid", "ROT13", jose.A256GCM},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			enc, err := contentEncryption(context.Background(), test.override)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if enc != test.want {
+				t.Errorf("expected %s, got %s", test.want, enc)
+			}
+		})
+	}
+}
+
+func TestContentEncryptionInvalidSetting(t *testing.T) {
+	withSetting(t, "JWT_CONTENT_ENCRYPTION", "ROT13")
+
+	if _, err := contentEncryption(context.Background(), ""); err == nil {
+		t.Error("expected an unsupported JWT_CONTENT_ENCRYPTION to be an error")
+	}
+}
+
+func TestContentEncryptionOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled string
+		values  url.Values
+		want    string
+	}{
+		{"disabled", "false", url.Values{"enc": {"A128GCM"}}, ""},
+		{"enabled", "true", url.Values{"enc": {"A128GCM"}}, "A128GCM"},
+		{"absent", "true", url.Values{}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ENABLE_ENC_OVERRIDE", test.enabled)
+			if enc := contentEncryptionOverride(test.values); enc != test.want {
+				t.Errorf("expected %q, got %q", test.want, enc)
+			}
+		})
+	}
+}
+
+func TestEncOverrideIsNotAClaim(t *testing.T) {
+	runner := useMockRunner(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	withSetting(t, "ENABLE_ENC_OVERRIDE", "true")
+
+	tests := []struct {
+		name string
+		enc  string
+		want string
+	}{
+		{"valid", "A128GCM", "A128GCM"},
+		{"invalid", "ROT13", "A256GCM"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "enc": {test.enc}}
+			launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if _, ok := launch.Claims["enc"]; ok {
+				t.Error("expected enc not to be a claim")
+			}
+
+			encrypted, err := jose.ParseEncrypted(launch.Token)
+			if err != nil {
+				t.Fatalf("failed to parse token: %v", err)
+			}
+			if enc := encrypted.Header.ExtraHeaders["enc"]; enc != test.want {
+				t.Errorf("expected the token to be encrypted with %s, got %v", test.want, enc)
+			}
+
+			claims, err := runner.Claims(launch.Token)
+			if err != nil {
+				t.Fatalf("runner rejected the token: %v", err)
+			}
+			if _, ok := claims["enc"]; ok {
+				t.Error("expected the runner not to receive an enc claim")
+			}
+		})
+	}
+}
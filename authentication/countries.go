@@ -0,0 +1,57 @@
+package authentication
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// censusCountryCodes are the single letter codes used by census surveys for England, Wales, Scotland and Northern Ireland
+const censusCountryCodes = "E W S N"
+
+// isoCountryCodes are the ISO 3166-1 alpha-2 country codes
+const isoCountryCodes = `AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW
+BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR GA
+GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH
+KI KM KN KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY
+MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH
+SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI
+VN VU WF WS YE YT ZA ZM ZW`
+
+// countryCodes returns the country codes accepted for the country claim, from COUNTRY_CODES if it is set or otherwise
+// the census codes and the ISO 3166-1 alpha-2 codes
+func countryCodes() map[string]bool {
+	configured := settings.GetList("COUNTRY_CODES")
+	if len(configured) == 0 {
+		configured = strings.Fields(censusCountryCodes + " " + isoCountryCodes)
+	}
+
+	codes := make(map[string]bool, len(configured))
+	for _, code := range configured {
+		codes[strings.ToUpper(code)] = true
+	}
+	return codes
+}
+
+// checkCountry returns why value isn't an accepted country code, or an empty string if it is
+func checkCountry(value interface{}) string {
+	code, ok := value.(string)
+	if !ok || !countryCodes()[strings.ToUpper(code)] {
+		return fmt.Sprintf("unknown country code %v", value)
+	}
+	return ""
+}
+
+// validateCountryClaim checks the country claim, when one is given, is an accepted country code
+func validateCountryClaim(claims map[string]interface{}) []MetadataError {
+	value, present := claims["country"]
+	if !present || value == "" {
+		return nil
+	}
+
+	if reason := checkCountry(value); reason != "" {
+		return []MetadataError{{Name: "country", Reason: reason}}
+	}
+	return nil
+}
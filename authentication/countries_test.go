@@ -0,0 +1,61 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestDefaultCountry(t *testing.T) {
+	defaults, err := GetDefaultValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaults["country"] != "E" {
+		t.Errorf("expected the census default E, got %s", defaults["country"])
+	}
+
+	withSetting(t, "DEFAULT_COUNTRY", "GB")
+	if defaults, _ := GetDefaultValues(); defaults["country"] != "GB" {
+		t.Errorf("expected DEFAULT_COUNTRY GB, got %s", defaults["country"])
+	}
+}
+
+func TestValidateCountryClaim(t *testing.T) {
+	tests := []struct {
+		name      string
+		codes     string
+		country   interface{}
+		wantError bool
+	}{
+		{"census code", "", "W", false},
+		{"ISO code", "", "FR", false},
+		{"lower case ISO code", "", "fr", false},
+		{"invalid code", "", "XX", true},
+		{"not a string", "", 44, true},
+		{"empty", "", "", false},
+		{"configured code", "GB, IE", "IE", false},
+		{"code not configured", "GB, IE", "FR", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "COUNTRY_CODES", test.codes)
+
+			metadataErrors := validateCountryClaim(map[string]interface{}{"country": test.country})
+			if (len(metadataErrors) > 0) != test.wantError {
+				t.Errorf("expected error %v, got %+v", test.wantError, metadataErrors)
+			}
+		})
+	}
+}
+
+func TestLaunchWithInvalidCountry(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "country": {"XX"}}
+	_, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+	if launchErr == nil || launchErr.Kind != LaunchErrorMetadata || launchErr.Fields[0].Name != "country" {
+		t.Errorf("expected a metadata error for country, got %v", launchErr)
+	}
+}
@@ -0,0 +1,218 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGenerateLaunchFromDefaults(t *testing.T) {
+	useMockRunner(t)
+	server := schemaServer(t, 200, defaultsSchema)
+	surveyURL := server.URL + "/test_defaults.json"
+
+	values := url.Values{"ru_ref": {"12346789012A"}, "flag_on": {"true"}, "flag_off": {"false"}, "region_code": {"gb-wls"}}
+	launch, launchErr := GenerateLaunchFromDefaults(context.Background(), surveyURL, "", "", values, TokenOptions{SignedCopy: true})
+	if launchErr != nil {
+		t.Fatalf("unexpected error: %v", launchErr)
+	}
+
+	want := map[string]interface{}{
+		"ru_ref":      "12346789012A",
+		"period_str":  "May 2017",
+		"flag_on":     true,
+		"flag_off":    false,
+		"no_default":  "",
+		"region_code": "GB-WLS",
+	}
+	for name, value := range want {
+		if launch.Claims[name] != value {
+			t.Errorf("expected %s %v, got %v", name, value, launch.Claims[name])
+		}
+	}
+
+	if launch.SignedToken == "" {
+		t.Error("expected a signed copy of the token")
+	}
+	if len(launch.Warnings) != 1 {
+		t.Errorf("expected a warning for no_default, got %v", launch.Warnings)
+	}
+	if len(values) != 4 {
+		t.Errorf("expected the values not to be modified, got %v", values)
+	}
+}
+
+func TestGenerateLaunchFromDefaultsLeavesValues(t *testing.T) {
+	useTestKeys(t)
+	server := schemaServer(t, 200, defaultsSchema)
+
+	values := url.Values{"ru_ref": {"12346789012A"}, "channel": {"rh"}}
+	want := url.Values{"ru_ref": {"12346789012A"}, "channel": {"rh"}}
+	_, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_defaults.json", "https://default.example", "https://default.example/sign-out", values, TokenOptions{DryRun: true})
+	if launchErr != nil {
+		t.Fatalf("unexpected error: %v", launchErr)
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
+
+func TestGenerateLaunchFromDefaultsLifetime(t *testing.T) {
+	useMockRunner(t)
+	server := schemaServer(t, 200, defaultsSchema)
+	withSetting(t, "JWT_MAX_LIFETIME", "1h")
+
+	tests := []struct {
+		name      string
+		mode      string
+		lifetime  time.Duration
+		wantError bool
+	}{
+		{"within the maximum", "reject", 30 * time.Minute, false},
+		{"rejected", "reject", 2 * time.Hour, true},
+		{"clamped", "clamp", 2 * time.Hour, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "JWT_MAX_LIFETIME_MODE", test.mode)
+
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_defaults.json", "", "", url.Values{"ru_ref": {"1"}}, TokenOptions{Lifetime: test.lifetime, DryRun: true})
+			if (launchErr != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, launchErr)
+			}
+			if launchErr != nil {
+				return
+			}
+			if lifetime := time.Until(launch.ExpiresAt); lifetime > time.Hour+time.Minute {
+				t.Errorf("expected the lifetime to be at most an hour, got %s", lifetime)
+			}
+		})
+	}
+}
+
+func TestGenerateLaunchFromDefaultsChannelAccountServiceURLs(t *testing.T) {
+	server := schemaServer(t, 200, roundTripSchema)
+	withSetting(t, "CHANNEL_ACCOUNT_SERVICE_URLS", `{
+		"RH": {"account_service_url": "https://rh.example", "account_service_log_out_url": "https://rh.example/sign-out"},
+		"EQ": {"account_service_url": "https://eq.example", "account_service_log_out_url": "https://eq.example/sign-out"}
+	}`)
+
+	tests := []struct {
+		name       string
+		values     url.Values
+		wantURL    string
+		wantLogOut string
+	}{
+		{"RH channel", url.Values{"channel": {"RH"}}, "https://rh.example", "https://rh.example/sign-out"},
+		{"EQ channel", url.Values{"channel": {"EQ"}}, "https://eq.example", "https://eq.example/sign-out"},
+		{"unmapped channel falls back", url.Values{"channel": {"PAPER"}}, "https://default.example", "https://default.example/sign-out"},
+		{"no channel falls back", url.Values{}, "https://default.example", "https://default.example/sign-out"},
+		{"explicit URL wins", url.Values{"channel": {"RH"}, "account_service_url": {"https://given.example"}}, "https://given.example", "https://rh.example/sign-out"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.values.Set("ru_ref", "12346789012A")
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_roundtrip.json", "https://default.example", "https://default.example/sign-out", test.values, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+
+			if got := launch.Claims["account_service_url"]; got != test.wantURL {
+				t.Errorf("expected account_service_url %s, got %v", test.wantURL, got)
+			}
+			if got := launch.Claims["account_service_log_out_url"]; got != test.wantLogOut {
+				t.Errorf("expected account_service_log_out_url %s, got %v", test.wantLogOut, got)
+			}
+		})
+	}
+}
+
+func TestUserIDDefault(t *testing.T) {
+	useTestKeys(t)
+	server := schemaServer(t, 200, `{"schema_name": "test_user_id", "metadata": [{"name": "user_id", "type": "string"}]}`)
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+	tests := []struct {
+		name      string
+		generate  string
+		values    url.Values
+		want      string
+		wantUUID  bool
+		wantError bool
+	}{
+		{"static default", "false", url.Values{}, "TESTER", false, false},
+		{"generated", "true", url.Values{}, "", true, false},
+		{"given", "true", url.Values{"user_id": {"abc"}}, "abc", false, false},
+		{"given empty", "false", url.Values{"user_id": {""}}, "", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "DEFAULT_USER_ID", "TESTER")
+			withSetting(t, "GENERATE_USER_ID", test.generate)
+
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_user_id.json", "", "", test.values, TokenOptions{DryRun: true})
+			if test.wantError {
+				if launchErr == nil || launchErr.Kind != LaunchErrorMetadata {
+					t.Fatalf("expected a metadata error, got %v", launchErr)
+				}
+				return
+			}
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+
+			userID, _ := launch.Claims["user_id"].(string)
+			if test.wantUUID {
+				if !uuidPattern.MatchString(userID) {
+					t.Errorf("expected a UUID, got %q", userID)
+				}
+			} else if userID != test.want {
+				t.Errorf("expected %q, got %q", test.want, userID)
+			}
+		})
+	}
+}
+
+func TestTradAsFromRuName(t *testing.T) {
+	useTestKeys(t)
+	server := schemaServer(t, 200, `{"schema_name": "test_trad_as", "metadata": [
+		{"name": "ru_name", "type": "string"},
+		{"name": "trad_as", "type": "string", "optional": true}
+	]}`)
+	base, err := GetDefaultValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		enabled string
+		values  url.Values
+		want    string
+	}{
+		{"supplied ru_name", "true", url.Values{"ru_name": {"BOLTS LTD."}}, "BOLTS LTD."},
+		{"default ru_name", "true", url.Values{}, base["ru_name"]},
+		{"explicit trad_as", "true", url.Values{"ru_name": {"BOLTS LTD."}, "trad_as": {"NUTS"}}, "NUTS"},
+		{"disabled", "false", url.Values{"ru_name": {"BOLTS LTD."}}, base["trad_as"]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "TRAD_AS_FROM_RU_NAME", test.enabled)
+
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_trad_as.json", "", "", test.values, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if got := launch.Claims["trad_as"]; got != test.want {
+				t.Errorf("expected trad_as %q, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package authentication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+var defaultFormTypeMap = map[string]string{
+	"H": "household",
+	"I": "individual",
+	"C": "communal_establishment",
+}
+
+var (
+	formTypeOverrides     map[string]map[string]string
+	loadFormTypeOverrides sync.Once
+)
+
+// readFormTypeOverrides loads the per-survey form_type mappings from the FORM_TYPE_MAP file, e.g.
+// {"MBS": {"0106": "manufacturing"}}
+func readFormTypeOverrides() map[string]map[string]string {
+	overrides := make(map[string]map[string]string)
+
+	mapPath := settings.Get("FORM_TYPE_MAP")
+	if mapPath == "" {
+		return overrides
+	}
+
+	mapData, err := ioutil.ReadFile(mapPath)
+	if err != nil {
+		logging.Error("failed to read form type map", "path", mapPath, "error", err)
+		return overrides
+	}
+
+	var fileOverrides map[string]map[string]string
+	if err := json.Unmarshal(mapData, &fileOverrides); err != nil {
+		logging.Error("failed to parse form type map", "path", mapPath, "error", err)
+		return overrides
+	}
+
+	for survey, formTypes := range fileOverrides {
+		overrides[strings.ToUpper(survey)] = formTypes
+	}
+
+	return overrides
+}
+
+// formTypeName returns the schema name fragment for a form_type, preferring any override configured for the survey.
+// An unmapped form_type has no fragment, as before the map could be configured.
+func formTypeName(survey string, formType string) string {
+	loadFormTypeOverrides.Do(func() {
+		formTypeOverrides = readFormTypeOverrides()
+	})
+
+	if name, ok := formTypeOverrides[strings.ToUpper(survey)][formType]; ok {
+		return name
+	}
+
+	if name, ok := defaultFormTypeMap[formType]; ok {
+		return name
+	}
+
+	return ""
+}
@@ -0,0 +1,89 @@
+package authentication
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// withFormTypeMap points FORM_TYPE_MAP at a file holding mapJSON and reloads the overrides, which are otherwise only
+// read once
+func withFormTypeMap(t *testing.T, mapJSON string) {
+	t.Helper()
+	mapPath := filepath.Join(t.TempDir(), "form_types.json")
+	if err := ioutil.WriteFile(mapPath, []byte(mapJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	withSetting(t, "FORM_TYPE_MAP", mapPath)
+
+	loadFormTypeOverrides = sync.Once{}
+	t.Cleanup(func() { loadFormTypeOverrides = sync.Once{} })
+}
+
+func TestTransformSchemaParamsToName(t *testing.T) {
+	withFormTypeMap(t, `{"mbs": {"0106": "manufacturing", "H": "business_household"}}`)
+
+	tests := []struct {
+		name   string
+		values url.Values
+		want   string
+	}{
+		{"default map", url.Values{"survey": {"census"}, "form_type": {"H"}, "region_code": {"GB-WLS"}}, "census_household_gb_wls"},
+		{"override", url.Values{"survey": {"MBS"}, "form_type": {"0106"}, "region_code": {"GB-ENG"}}, "MBS_manufacturing_gb_eng"},
+		{"override replaces the default", url.Values{"survey": {"MBS"}, "form_type": {"H"}, "region_code": {"GB-ENG"}}, "MBS_business_household_gb_eng"},
+		{"other surveys keep the default", url.Values{"survey": {"census"}, "form_type": {"I"}, "region_code": {"GB-ENG"}}, "census_individual_gb_eng"},
+		{"unmapped form_type", url.Values{"survey": {"census"}, "form_type": {"X"}, "region_code": {"GB-ENG"}}, "census__gb_eng"},
+		{"schema_name wins", url.Values{"schema_name": {"test_checkbox"}, "survey": {"census"}, "form_type": {"H"}}, "test_checkbox"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := TransformSchemaParamsToName(test.values); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFormTypeNameInvalidMap(t *testing.T) {
+	withFormTypeMap(t, `not json`)
+
+	if got := formTypeName("MBS", "C"); got != "communal_establishment" {
+		t.Errorf("expected the default map when FORM_TYPE_MAP is invalid, got %s", got)
+	}
+}
+
+func TestDefaultSchemaName(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultName string
+		values      url.Values
+		want        string
+	}{
+		{"no schema", "test_checkbox", url.Values{}, "test_checkbox"},
+		{"explicit schema_name", "test_checkbox", url.Values{"schema_name": {"test_textfield"}}, "test_textfield"},
+		{"survey parameters", "test_checkbox", url.Values{"survey": {"census"}, "form_type": {"H"}, "region_code": {"GB-ENG"}}, "census_household_gb_eng"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "DEFAULT_SCHEMA_NAME", test.defaultName)
+
+			if got := TransformSchemaParamsToName(test.values); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDefaultSchemaNameLaunch(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	withSetting(t, "DEFAULT_SCHEMA_NAME", "test_roundtrip")
+
+	launch := dryRunLaunch(t, url.Values{"ru_ref": {"12346789012A"}, "period_id": {"201605"}})
+	if launch.Claims["schema_name"] != "test_roundtrip" {
+		t.Errorf("expected the DEFAULT_SCHEMA_NAME schema to be launched, got %v", launch.Claims["schema_name"])
+	}
+}
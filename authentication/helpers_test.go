@@ -0,0 +1,155 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/mockrunner"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// withSetting sets a setting for the rest of the test, restoring it afterwards
+func withSetting(t *testing.T, name string, value string) {
+	t.Helper()
+	previous := settings.Get(name)
+	settings.Set(name, value)
+	t.Cleanup(func() { settings.Set(name, previous) })
+}
+
+// schemaServer serves body at /schema.json with the status
+func schemaServer(t testing.TB, status int, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dryRunLaunch generates a launch of values without a token, failing the test if it can't be generated
+func dryRunLaunch(t *testing.T, values url.Values) *Launch {
+	t.Helper()
+	launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+	if launchErr != nil {
+		t.Fatalf("unexpected error: %v", launchErr)
+	}
+	return launch
+}
+
+// runnerSchemas serves schemas by name as the runner does, at /schemas and /schemas/{name}, and points
+// SURVEY_RUNNER_SCHEMA_URL at them
+func runnerSchemas(t *testing.T, schemas map[string]string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/schemas" {
+			var names []string
+			for name := range schemas {
+				names = append(names, `"`+name+`"`)
+			}
+			w.Write([]byte("[" + strings.Join(names, ",") + "]"))
+			return
+		}
+		schema, ok := schemas[strings.TrimPrefix(r.URL.Path, "/schemas/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(schema))
+	}))
+	t.Cleanup(server.Close)
+	withSetting(t, "SURVEY_RUNNER_SCHEMA_URL", server.URL)
+}
+
+const defaultsSchema = `{
+	"schema_name": "test_defaults",
+	"metadata": [
+		{"name": "ru_ref", "type": "string"},
+		{"name": "period_str", "type": "string"},
+		{"name": "flag_on", "type": "boolean"},
+		{"name": "flag_off", "type": "boolean"},
+		{"name": "no_default", "type": "string"}
+	]
+}`
+
+// writeKeyFile writes block to a file in a new temporary directory, returning its path
+func writeKeyFile(t *testing.T, block *pem.Block) string {
+	t.Helper()
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath
+}
+
+// newTestKey returns a small RSA key, which is quick to generate
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func metadataNames(metadata []Metadata) []string {
+	names := []string{}
+	for _, item := range metadata {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+const roundTripSchema = `{
+	"schema_name": "test_roundtrip",
+	"metadata": [
+		{"name": "ru_ref", "type": "string"},
+		{"name": "period_id", "type": "string"},
+		{"name": "trad_as", "type": "string", "optional": true}
+	]
+}`
+
+// useTestKeys points the launcher at new test keys, returning the runner's half of them
+func useTestKeys(t *testing.T) *mockrunner.Keys {
+	t.Helper()
+	for _, name := range []string{"JWT_SIGNING_KEY_PATH", "JWT_ENCRYPTION_KEY_PATH"} {
+		withSetting(t, name, settings.Get(name))
+	}
+
+	keys, err := mockrunner.UseTestKeys(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to generate test keys: %v", err)
+	}
+	return keys
+}
+
+// useMockRunner points the launcher at new test keys and a mock runner which holds the other half of them
+func useMockRunner(t *testing.T) *mockrunner.Runner {
+	t.Helper()
+	keys := useTestKeys(t)
+
+	server, runner := mockrunner.NewServer(keys.DecryptionKey, keys.VerificationKey)
+	t.Cleanup(server.Close)
+	withSetting(t, "SURVEY_RUNNER_URL", server.URL)
+	return runner
+}
+
+// metadataErrorNames returns the names in metadataErrors, in order
+func metadataErrorNames(metadataErrors []MetadataError) []string {
+	names := []string{}
+	for _, metadataError := range metadataErrors {
+		names = append(names, metadataError.Name)
+	}
+	return names
+}
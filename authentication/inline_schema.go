@@ -0,0 +1,59 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"gopkg.in/square/go-jose.v2/json"
+)
+
+// inlineSchemaSource names a schema given in a request, rather than fetched, in errors and logs
+const inlineSchemaSource = "(inline schema)"
+
+// GenerateLaunchFromSchema launches a schema given as JSON, such as one a schema author has pasted without hosting it.
+// The schema is validated as a quick launch schema is, but as it has no URL the token has no survey_url claim and
+// metadata $refs aren't resolved. The schema name is the schema's schema_name unless values give one.
+func GenerateLaunchFromSchema(ctx context.Context, schemaJSON []byte, values url.Values, options TokenOptions) (*Launch, *LaunchError) {
+	options, launchErr := limitLifetime(ctx, options)
+	if launchErr != nil {
+		return nil, launchErr
+	}
+
+	if int64(len(schemaJSON)) > maxSchemaBytes() {
+		return nil, &LaunchError{Kind: LaunchErrorSchema, Desc: fmt.Sprintf("The schema is larger than MAX_SCHEMA_BYTES (%d bytes)", maxSchemaBytes())}
+	}
+
+	validationStart := time.Now()
+	validationError := validateSchema(ctx, json.RawMessage(schemaJSON))
+	timingsFromContext(ctx).Validation += time.Since(validationStart)
+	if validationError != nil {
+		return nil, quicklaunchSchemaError(validationError)
+	}
+
+	var questionnaireSchema QuestionnaireSchema
+	if err := json.Unmarshal(schemaJSON, &questionnaireSchema); err != nil {
+		return nil, &LaunchError{Kind: LaunchErrorSchema, Desc: fmt.Sprintf("The schema is not valid JSON: %v", err)}
+	}
+	sum := sha256.Sum256(schemaJSON)
+	questionnaireSchema.hash = hex.EncodeToString(sum[:])
+
+	if err := questionnaireSchema.checkMetadata(ctx, inlineSchemaSource); err != nil {
+		return nil, quicklaunchSchemaError(err)
+	}
+
+	schemaName := values.Get("schema_name")
+	if schemaName == "" {
+		schemaName = questionnaireSchema.SchemaName
+	}
+	if schemaName == "" {
+		return nil, &LaunchError{Kind: LaunchErrorSchema, Desc: "The schema has no schema_name, so give one with the launch"}
+	}
+
+	launcherSchema := surveys.LauncherSchema{Name: applySchemaNameCase(schemaName)}
+	return launchFromSchema(ctx, launcherSchema, questionnaireSchema, values, options)
+}
@@ -0,0 +1,131 @@
+package authentication
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// versionedKeyPattern matches the key files in a key directory, which are versioned by the number before .pem, as in
+// signing-v3.pem
+var versionedKeyPattern = regexp.MustCompile(`v([0-9]+)\.pem$`)
+
+// versionedKeyPaths returns the versioned key files in dir, newest first
+func versionedKeyPaths(dir string) ([]string, *KeyLoadError) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, &KeyLoadError{Op: "read", Err: "Failed to read key directory: " + dir}
+	}
+
+	type versionedKey struct {
+		path    string
+		version int
+	}
+	var keys []versionedKey
+	for _, file := range files {
+		match := versionedKeyPattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		keys = append(keys, versionedKey{path: filepath.Join(dir, file.Name()), version: version})
+	}
+	if len(keys) == 0 {
+		return nil, &KeyLoadError{Op: "read", Err: "No versioned keys, such as signing-v1.pem, in key directory: " + dir}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].version > keys[j].version })
+	paths := make([]string, len(keys))
+	for i, key := range keys {
+		paths[i] = key.path
+	}
+	return paths, nil
+}
+
+// keyPath returns the newest versioned key in the directory dirSetting names, or else the key pathSetting names
+func keyPath(pathSetting string, dirSetting string) (string, *KeyLoadError) {
+	dir := settings.Get(dirSetting)
+	if dir == "" {
+		return settings.Get(pathSetting), nil
+	}
+
+	paths, keyErr := versionedKeyPaths(dir)
+	if keyErr != nil {
+		return "", keyErr
+	}
+	return paths[0], nil
+}
+
+// signingKeyPath returns the path of the key tokens are signed with, which is the newest key in JWT_SIGNING_KEY_DIR
+// when it is set
+func signingKeyPath() (string, *KeyLoadError) {
+	return keyPath("JWT_SIGNING_KEY_PATH", "JWT_SIGNING_KEY_DIR")
+}
+
+// encryptionKeyPath returns the path of the key tokens are encrypted with, which is the newest key in
+// JWT_ENCRYPTION_KEY_DIR when it is set
+func encryptionKeyPath() (string, *KeyLoadError) {
+	return keyPath("JWT_ENCRYPTION_KEY_PATH", "JWT_ENCRYPTION_KEY_DIR")
+}
+
+// SigningJWKS returns the public keys of every signing key, so tokens signed with an older versioned key in
+// JWT_SIGNING_KEY_DIR, or with a key from JWT_SIGNING_KEYS, can still be verified by their kid
+func SigningJWKS() (*jose.JSONWebKeySet, error) {
+	var results []*PrivateKeyResult
+
+	if dir := settings.Get("JWT_SIGNING_KEY_DIR"); dir != "" {
+		paths, keyErr := versionedKeyPaths(dir)
+		if keyErr != nil {
+			return nil, keyErr
+		}
+		for _, path := range paths {
+			privateKeyResult, keyErr := loadSigningKeyFromPath(path)
+			if keyErr != nil {
+				return nil, keyErr
+			}
+			results = append(results, privateKeyResult)
+		}
+	} else {
+		privateKeyResult, keyErr := loadSigningKey()
+		if keyErr != nil {
+			return nil, keyErr
+		}
+		results = append(results, privateKeyResult)
+	}
+
+	keyPaths, keyErr := signingKeyPaths()
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	ids := make([]string, 0, len(keyPaths))
+	for id := range keyPaths {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		privateKeyResult, keyErr := loadSigningKeyByID(id)
+		if keyErr != nil {
+			return nil, keyErr
+		}
+		results = append(results, privateKeyResult)
+	}
+
+	keySet := &jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, len(results))}
+	for i, result := range results {
+		keySet.Keys[i] = jose.JSONWebKey{
+			Key:       &result.key.PublicKey,
+			KeyID:     result.kid,
+			Algorithm: string(signingAlgorithm),
+			Use:       "sig",
+		}
+	}
+	return keySet, nil
+}
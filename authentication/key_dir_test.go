@@ -0,0 +1,142 @@
+package authentication
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeVersionedKeys writes a signing key for each name into a new key directory, returning the keys by name
+func writeVersionedKeys(t *testing.T, names ...string) (string, map[string]*rsa.PrivateKey) {
+	t.Helper()
+	dir := t.TempDir()
+	keys := make(map[string]*rsa.PrivateKey, len(names))
+	for _, name := range names {
+		key := newTestKey(t)
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+	}
+	return dir, keys
+}
+
+func TestVersionedKeyPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		want    []string
+		wantErr bool
+	}{
+		{"newest first", []string{"signing-v1.pem", "signing-v3.pem", "signing-v2.pem"}, []string{"signing-v3.pem", "signing-v2.pem", "signing-v1.pem"}, false},
+		{"numeric order", []string{"signing-v2.pem", "signing-v10.pem"}, []string{"signing-v10.pem", "signing-v2.pem"}, false},
+		{"unversioned files ignored", []string{"signing-v1.pem", "README.md", "signing.pem"}, []string{"signing-v1.pem"}, false},
+		{"no versioned keys", []string{"signing.pem"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, file), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			paths, keyErr := versionedKeyPaths(dir)
+			if test.wantErr {
+				if keyErr == nil {
+					t.Errorf("expected an error, got %v", paths)
+				}
+				return
+			}
+			if keyErr != nil {
+				t.Fatalf("unexpected error: %v", keyErr)
+			}
+			var got []string
+			for _, path := range paths {
+				got = append(got, filepath.Base(path))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestVersionedKeyPathsMissingDir(t *testing.T) {
+	if _, keyErr := versionedKeyPaths(filepath.Join(t.TempDir(), "missing")); keyErr == nil {
+		t.Error("expected an error for a missing key directory")
+	}
+}
+
+func TestSigningKeyDir(t *testing.T) {
+	dir, keys := writeVersionedKeys(t, "signing-v1.pem", "signing-v2.pem", "signing-v3.pem")
+	withSetting(t, "JWT_SIGNING_KEY_DIR", dir)
+	withSetting(t, "JWT_SIGNING_KEYS", "")
+
+	signingKey, keyErr := loadSigningKey()
+	if keyErr != nil {
+		t.Fatalf("unexpected error: %v", keyErr)
+	}
+	if !signingKey.key.PublicKey.Equal(&keys["signing-v3.pem"].PublicKey) {
+		t.Error("expected the newest key to be used for signing")
+	}
+
+	keySet, err := SigningJWKS()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keySet.Keys) != len(keys) {
+		t.Fatalf("expected all %d keys in the JWKS, got %d", len(keys), len(keySet.Keys))
+	}
+	if keySet.Keys[0].KeyID != signingKey.kid {
+		t.Errorf("expected the signing key's kid %s first in the JWKS, got %s", signingKey.kid, keySet.Keys[0].KeyID)
+	}
+	for name, key := range keys {
+		found := false
+		for _, jwk := range keySet.Keys {
+			found = found || key.PublicKey.Equal(jwk.Key)
+		}
+		if !found {
+			t.Errorf("expected %s in the JWKS", name)
+		}
+	}
+}
+
+func TestEncryptionKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	var newest *rsa.PrivateKey
+	for _, name := range []string{"encryption-v1.pem", "encryption-v2.pem"} {
+		newest = newTestKey(t)
+		publicKey, err := x509.MarshalPKIXPublicKey(&newest.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withSetting(t, "JWT_ENCRYPTION_KEY_DIR", dir)
+
+	encryptionKey, keyErr := loadEncryptionKey()
+	if keyErr != nil {
+		t.Fatalf("unexpected error: %v", keyErr)
+	}
+	if !encryptionKey.key.Equal(&newest.PublicKey) {
+		t.Error("expected the newest key to be used for encryption")
+	}
+
+	if err := os.Remove(filepath.Join(dir, "encryption-v2.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if encryptionKey, _ = loadEncryptionKey(); encryptionKey == nil || encryptionKey.key.Equal(&newest.PublicKey) {
+		t.Error("expected the remaining key to be used once the newest is removed")
+	}
+}
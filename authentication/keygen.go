@@ -0,0 +1,86 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// KeyPairPaths are where GenerateKeyPairs writes the keys. The launcher reads SigningKey and EncryptionKey, which
+// are JWT_SIGNING_KEY_PATH and JWT_ENCRYPTION_KEY_PATH, while the runner needs SigningPublicKey and
+// EncryptionPrivateKey.
+type KeyPairPaths struct {
+	SigningKey           string
+	SigningPublicKey     string
+	EncryptionKey        string
+	EncryptionPrivateKey string
+}
+
+// GeneratedKeys are the kids of the keys written by GenerateKeyPairs
+type GeneratedKeys struct {
+	SigningKID    string
+	EncryptionKID string
+}
+
+// GenerateKeyPairs generates RSA signing and encryption key pairs of the given size for local development, writing
+// private keys as PKCS1 and public keys as PKIX PEM. Existing files are only replaced when overwrite is set. The keys
+// are read back through the launcher's loaders, so the kids returned are those tokens will be stamped with.
+func GenerateKeyPairs(paths KeyPairPaths, bits int, overwrite bool) (*GeneratedKeys, error) {
+	if !overwrite {
+		for _, path := range []string{paths.SigningKey, paths.SigningPublicKey, paths.EncryptionKey, paths.EncryptionPrivateKey} {
+			if _, err := os.Stat(path); err == nil {
+				return nil, fmt.Errorf("%s already exists", path)
+			}
+		}
+	}
+
+	if err := writeKeyPair(paths.SigningKey, paths.SigningPublicKey, bits); err != nil {
+		return nil, fmt.Errorf("failed to write signing keys: %w", err)
+	}
+	if err := writeKeyPair(paths.EncryptionPrivateKey, paths.EncryptionKey, bits); err != nil {
+		return nil, fmt.Errorf("failed to write encryption keys: %w", err)
+	}
+
+	signingKey, keyErr := loadSigningKeyFromPath(paths.SigningKey)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	encryptionKey, keyErr := loadEncryptionKeyFromPath(paths.EncryptionKey)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	return &GeneratedKeys{SigningKID: signingKey.kid, EncryptionKID: encryptionKey.kid}, nil
+}
+
+// writeKeyPair generates an RSA key, writing the private key readable only by its owner
+func writeKeyPair(privatePath string, publicPath string, bits int) error {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(privatePath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key), 0600); err != nil {
+		return err
+	}
+	return writePEM(publicPath, "PUBLIC KEY", publicKey, 0644)
+}
+
+func writePEM(path string, blockType string, der []byte, perm os.FileMode) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
@@ -0,0 +1,102 @@
+package authentication
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// keyPairPaths returns paths for each key in dir
+func keyPairPaths(dir string) KeyPairPaths {
+	return KeyPairPaths{
+		SigningKey:           filepath.Join(dir, "signing.pem"),
+		SigningPublicKey:     filepath.Join(dir, "signing-public.pem"),
+		EncryptionKey:        filepath.Join(dir, "encryption.pem"),
+		EncryptionPrivateKey: filepath.Join(dir, "encryption-private.pem"),
+	}
+}
+
+// readPEM returns the DER bytes of the PEM file at path
+func readPEM(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("expected %s to be PEM", path)
+	}
+	return block.Bytes
+}
+
+func TestGenerateKeyPairs(t *testing.T) {
+	paths := keyPairPaths(t.TempDir())
+	withSetting(t, "JWT_SIGNING_KEY_PATH", paths.SigningKey)
+	withSetting(t, "JWT_ENCRYPTION_KEY_PATH", paths.EncryptionKey)
+
+	generated, err := GenerateKeyPairs(paths, 1024, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	signingKey, keyErr := loadSigningKey()
+	if keyErr != nil {
+		t.Fatalf("failed to load the signing key: %v", keyErr)
+	}
+	encryptionKey, keyErr := loadEncryptionKey()
+	if keyErr != nil {
+		t.Fatalf("failed to load the encryption key: %v", keyErr)
+	}
+	if signingKey.kid != generated.SigningKID || encryptionKey.kid != generated.EncryptionKID {
+		t.Errorf("expected kids %s and %s, got %s and %s", generated.SigningKID, generated.EncryptionKID, signingKey.kid, encryptionKey.kid)
+	}
+
+	verificationKey, err := x509.ParsePKIXPublicKey(readPEM(t, paths.SigningPublicKey))
+	if err != nil {
+		t.Fatalf("expected a PKIX signing public key: %v", err)
+	}
+	if !signingKey.key.PublicKey.Equal(verificationKey) {
+		t.Error("expected the signing public key to match the signing key")
+	}
+
+	decryptionKey, err := x509.ParsePKCS1PrivateKey(readPEM(t, paths.EncryptionPrivateKey))
+	if err != nil {
+		t.Fatalf("expected a PKCS1 encryption private key: %v", err)
+	}
+	if !decryptionKey.PublicKey.Equal(encryptionKey.key) {
+		t.Error("expected the encryption private key to match the encryption key")
+	}
+}
+
+func TestGenerateKeyPairsOverwrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite bool
+		wantError bool
+	}{
+		{"existing keys kept", false, true},
+		{"existing keys replaced", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths := keyPairPaths(t.TempDir())
+			if err := ioutil.WriteFile(paths.SigningKey, []byte("existing"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := GenerateKeyPairs(paths, 1024, test.overwrite)
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+
+			contents, _ := ioutil.ReadFile(paths.SigningKey)
+			if kept := string(contents) == "existing"; kept != test.wantError {
+				t.Errorf("expected the existing key kept %v, got %q", test.wantError, contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+func TestLoadSigningKeyPassphrase(t *testing.T) {
+	key := newTestKey(t)
+	plainBlock := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	encryptedBlock, err := x509.EncryptPEMBlock(rand.Reader, plainBlock.Type, plainBlock.Bytes, []byte("correct horse"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		block      *pem.Block
+		passphrase string
+		wantOp     string
+	}{
+		{"unencrypted", plainBlock, "", ""},
+		{"unencrypted ignores the passphrase", plainBlock, "correct horse", ""},
+		{"encrypted", encryptedBlock, "correct horse", ""},
+		{"encrypted with the wrong passphrase", encryptedBlock, "battery staple", "decrypt"},
+		{"encrypted without a passphrase", encryptedBlock, "", "decrypt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "JWT_SIGNING_KEY_PASSPHRASE", test.passphrase)
+
+			result, keyErr := loadSigningKeyFromPath(writeKeyFile(t, test.block))
+			if test.wantOp != "" {
+				if keyErr == nil || keyErr.Op != test.wantOp {
+					t.Fatalf("expected a %s error, got %v", test.wantOp, keyErr)
+				}
+				return
+			}
+			if keyErr != nil {
+				t.Fatalf("unexpected error: %v", keyErr)
+			}
+			if result.key.N.Cmp(key.N) != 0 {
+				t.Error("expected the key which was written")
+			}
+		})
+	}
+}
+
+func TestLoadKeyNotPEM(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"empty", ""},
+		{"not PEM", "this is not a key"},
+		{"DER", "\x30\x82\x01\x0a\x02\x82\x01\x01"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyPath := filepath.Join(t.TempDir(), "key.pem")
+			if err := ioutil.WriteFile(keyPath, []byte(test.contents), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, keyErr := loadSigningKeyFromPath(keyPath); keyErr == nil || keyErr.Op != "parse" {
+				t.Errorf("expected a parse error loading the signing key, got %v", keyErr)
+			}
+			if _, keyErr := loadEncryptionKeyFromPath(keyPath); keyErr == nil || keyErr.Op != "parse" {
+				t.Errorf("expected a parse error loading the encryption key, got %v", keyErr)
+			}
+		})
+	}
+}
+
+func TestSameSigningAndEncryptionKeyWarning(t *testing.T) {
+	useTestKeys(t)
+	key := newTestKey(t)
+	signingKeyPath := writeKeyFile(t, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samePublicKeyPath := writeKeyFile(t, &pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
+
+	tests := []struct {
+		name          string
+		encryptionKey string
+		wantWarning   bool
+	}{
+		{"different keys", settings.Get("JWT_ENCRYPTION_KEY_PATH"), false},
+		{"same key pair", samePublicKeyPath, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "JWT_SIGNING_KEY_PATH", signingKeyPath)
+			withSetting(t, "JWT_ENCRYPTION_KEY_PATH", test.encryptionKey)
+
+			var logs bytes.Buffer
+			logging.SetOutput(&logs)
+			t.Cleanup(func() { logging.SetOutput(os.Stderr) })
+
+			if _, tokenErr := generateTokenFromClaims(context.Background(), map[string]interface{}{"tx_id": "1"}, "", TokenOptions{}); tokenErr != nil {
+				t.Fatalf("unexpected error: %v", tokenErr)
+			}
+			if warned := strings.Contains(logs.String(), "probably the same key pair"); warned != test.wantWarning {
+				t.Errorf("expected the warning %v, got %q", test.wantWarning, logs.String())
+			}
+		})
+	}
+}
+
+func TestSignedOnlyFallback(t *testing.T) {
+	useTestKeys(t)
+	missingKeyPath := filepath.Join(t.TempDir(), "missing.pem")
+	invalidKeyPath := filepath.Join(t.TempDir(), "invalid.pem")
+	if err := ioutil.WriteFile(invalidKeyPath, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		fallback      string
+		encryptionKey string
+		wantSigned    bool
+	}{
+		{"fallback on", "true", missingKeyPath, true},
+		{"fallback off", "false", missingKeyPath, false},
+		{"invalid key", "true", invalidKeyPath, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SIGNED_ONLY_FALLBACK", test.fallback)
+			withSetting(t, "JWT_ENCRYPTION_KEY_PATH", test.encryptionKey)
+
+			var logs bytes.Buffer
+			logging.SetOutput(&logs)
+			t.Cleanup(func() { logging.SetOutput(os.Stderr) })
+
+			token, tokenErr := generateTokenFromClaims(context.Background(), map[string]interface{}{"tx_id": "1"}, "", TokenOptions{})
+			if !test.wantSigned {
+				if tokenErr == nil {
+					t.Errorf("expected an encryption key error, got %s", token.Token)
+				}
+				return
+			}
+			if tokenErr != nil {
+				t.Fatalf("unexpected error: %v", tokenErr)
+			}
+			if strings.Count(token.Token, ".") != 2 {
+				t.Errorf("expected a signed-only token, got %s", token.Token)
+			}
+			if !strings.Contains(logs.String(), "UNENCRYPTED") {
+				t.Errorf("expected a warning about the unencrypted token, got %q", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package authentication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+var (
+	languageDefaultOverrides     map[string]map[string]string
+	loadLanguageDefaultOverrides sync.Once
+)
+
+// readLanguageDefaults loads the per-language metadata defaults from the LANGUAGE_DEFAULTS_PATH file, keyed by
+// language_code, e.g. {"cy": {"ru_name": "MENTER HANFODOL CYF."}}
+func readLanguageDefaults() map[string]map[string]string {
+	overrides := make(map[string]map[string]string)
+
+	defaultsPath := settings.Get("LANGUAGE_DEFAULTS_PATH")
+	if defaultsPath == "" {
+		return overrides
+	}
+
+	defaultsData, err := ioutil.ReadFile(defaultsPath)
+	if err != nil {
+		logging.Error("failed to read language defaults", "path", defaultsPath, "error", err)
+		return overrides
+	}
+
+	if err := json.Unmarshal(defaultsData, &overrides); err != nil {
+		logging.Error("failed to parse language defaults", "path", defaultsPath, "error", err)
+		return make(map[string]map[string]string)
+	}
+
+	return overrides
+}
+
+// defaultValuesForLanguage returns the default metadata values for theme, with any overrides configured for
+// languageCode replacing them
+func defaultValuesForLanguage(theme string, languageCode string) (map[string]string, error) {
+	defaults, err := GetDefaultValues()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range themeDefaults[theme] {
+		defaults[name] = value
+	}
+
+	loadLanguageDefaultOverrides.Do(func() {
+		languageDefaultOverrides = readLanguageDefaults()
+	})
+
+	for name, value := range languageDefaultOverrides[languageCode] {
+		defaults[name] = value
+	}
+	return defaults, nil
+}
@@ -0,0 +1,66 @@
+package authentication
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// withLanguageDefaults points LANGUAGE_DEFAULTS_PATH at a file of contents, reloaded for the rest of the test
+func withLanguageDefaults(t *testing.T, contents string) {
+	t.Helper()
+	defaultsPath := filepath.Join(t.TempDir(), "language_defaults.json")
+	if err := ioutil.WriteFile(defaultsPath, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	withSetting(t, "LANGUAGE_DEFAULTS_PATH", defaultsPath)
+
+	reset := func() {
+		loadLanguageDefaultOverrides = sync.Once{}
+		languageDefaultOverrides = nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestLanguageDefaults(t *testing.T) {
+	withLanguageDefaults(t, `{"cy": {"ru_name": "MENTER HANFODOL CYF."}}`)
+	base, err := GetDefaultValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useTestKeys(t)
+	server := schemaServer(t, 200, `{"schema_name": "test_language", "metadata": [{"name": "ru_name", "type": "string"}, {"name": "period_str", "type": "string"}]}`)
+
+	tests := []struct {
+		languageCode string
+		wantRuName   string
+	}{
+		{"en", base["ru_name"]},
+		{"", base["ru_name"]},
+		{"cy", "MENTER HANFODOL CYF."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.languageCode, func(t *testing.T) {
+			values := url.Values{}
+			if test.languageCode != "" {
+				values.Set("language_code", test.languageCode)
+			}
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_language.json", "", "", values, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if got := launch.Claims["ru_name"]; got != test.wantRuName {
+				t.Errorf("expected ru_name %q, got %v", test.wantRuName, got)
+			}
+			if got := launch.Claims["period_str"]; got != base["period_str"] {
+				t.Errorf("expected the base period_str %q, got %v", base["period_str"], got)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package authentication
+
+import (
+	"fmt"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// LanguageCodes are the languages offered on the launch form, which launch_language must be one of
+var LanguageCodes = []string{"en", "cy", "ga", "eo"}
+
+func validLanguageCode(code string) bool {
+	for _, valid := range LanguageCodes {
+		if code == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// addLaunchLanguageClaim defaults launch_language, the language the launch starts in, to the language_code of the
+// response when LAUNCH_LANGUAGE_CLAIM is set and it wasn't given
+func addLaunchLanguageClaim(claims map[string]interface{}) {
+	if !settings.GetBool("LAUNCH_LANGUAGE_CLAIM") {
+		return
+	}
+	if launchLanguage, _ := claims["launch_language"].(string); launchLanguage != "" {
+		return
+	}
+	if languageCode, _ := claims["language_code"].(string); languageCode != "" {
+		claims["launch_language"] = languageCode
+	}
+}
+
+// validateLaunchLanguageClaim checks the launch_language claim, when one is given, is one of the LanguageCodes
+func validateLaunchLanguageClaim(claims map[string]interface{}) []MetadataError {
+	value, present := claims["launch_language"]
+	if !present || value == "" {
+		return nil
+	}
+
+	if code, ok := value.(string); !ok || !validLanguageCode(code) {
+		return []MetadataError{{Name: "launch_language", Reason: fmt.Sprintf("unknown language code %v", value)}}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestLaunchLanguageClaim(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name       string
+		enabled    string
+		values     url.Values
+		want       interface{}
+		wantErrors []string
+	}{
+		{"supplied", "true", url.Values{"language_code": {"en"}, "launch_language": {"cy"}}, "cy", nil},
+		{"defaults to language_code", "true", url.Values{"language_code": {"cy"}}, "cy", nil},
+		{"invalid", "true", url.Values{"language_code": {"en"}, "launch_language": {"fr"}}, nil, []string{"launch_language"}},
+		{"disabled", "false", url.Values{"language_code": {"cy"}}, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "LAUNCH_LANGUAGE_CLAIM", test.enabled)
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+			for name, value := range test.values {
+				values[name] = value
+			}
+
+			launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if test.wantErrors != nil {
+				if launchErr == nil || !reflect.DeepEqual(metadataErrorNames(launchErr.Fields), test.wantErrors) {
+					t.Errorf("expected errors for %v, got %v", test.wantErrors, launchErr)
+				}
+				return
+			}
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if got := launch.Claims["launch_language"]; got != test.want {
+				t.Errorf("expected launch_language %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+const duplicatedMetadataSchema = `{
+	"schema_name": "test_duplicated",
+	"metadata": [
+		{"name": "ru_ref", "type": "string"},
+		{"name": "flag", "type": "boolean"},
+		{"name": "ru_ref", "type": "uuid", "optional": true},
+		{"name": "flag", "type": "string"},
+		{"name": "trad_as", "type": "string", "optional": true}
+	]
+}`
+
+func TestDedupeMetadata(t *testing.T) {
+	schema := QuestionnaireSchema{Metadata: []Metadata{{Name: "ru_ref"}, {Name: "flag"}, {Name: "ru_ref", Optional: true}, {Name: "flag"}, {Name: "flag"}}}
+
+	duplicates := schema.dedupeMetadata()
+
+	if !reflect.DeepEqual(duplicates, []string{"ru_ref", "flag", "flag"}) {
+		t.Errorf("expected ru_ref and flag to be reported, got %v", duplicates)
+	}
+	if !reflect.DeepEqual(schema.Metadata, []Metadata{{Name: "ru_ref"}, {Name: "flag"}}) {
+		t.Errorf("expected the first of each name, got %+v", schema.Metadata)
+	}
+}
+
+func TestGetRequiredMetadataDuplicatedNames(t *testing.T) {
+	server := schemaServer(t, 200, duplicatedMetadataSchema)
+	launcherSchema := surveys.LauncherSchema{Name: "test_duplicated", URL: server.URL + "/test_duplicated.json"}
+
+	t.Run("deduplicated", func(t *testing.T) {
+		withSetting(t, "STRICT_SCHEMA_METADATA", "false")
+
+		metadata, err := GetRequiredMetadata(context.Background(), launcherSchema, "en")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := []Metadata{{Name: "ru_ref", Validator: "string"}, {Name: "flag", Validator: "boolean"}, {Name: "trad_as", Validator: "string", Optional: true}}
+		if len(metadata) != len(want) {
+			t.Fatalf("expected %d metadata, got %+v", len(want), metadata)
+		}
+		for i, item := range want {
+			if metadata[i].Name != item.Name || metadata[i].Validator != item.Validator || metadata[i].Optional != item.Optional {
+				t.Errorf("expected %+v, got %+v", item, metadata[i])
+			}
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		withSetting(t, "STRICT_SCHEMA_METADATA", "true")
+
+		_, err := GetRequiredMetadata(context.Background(), launcherSchema, "en")
+		if err == nil || !strings.Contains(err.Error(), "declares metadata more than once: ru_ref, flag") {
+			t.Errorf("expected an error naming the duplicates, got %q", err)
+		}
+	})
+}
+
+func TestReservedMetadata(t *testing.T) {
+	useTestKeys(t)
+	server := schemaServer(t, 200, `{
+		"schema_name": "test_reserved",
+		"metadata": [
+			{"name": "ru_ref", "type": "string"},
+			{"name": "roles", "type": "string"},
+			{"name": "exp", "type": "string"}
+		]
+	}`)
+	launcherSchema := surveys.LauncherSchema{Name: "test_reserved", URL: server.URL + "/test_reserved.json"}
+
+	tests := []struct {
+		name      string
+		allow     string
+		wantNames []string
+	}{
+		{"rejected", "false", nil},
+		{"ignored", "true", []string{"ru_ref"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ALLOW_RESERVED_METADATA", test.allow)
+
+			metadata, err := GetRequiredMetadata(context.Background(), launcherSchema, "en")
+			_, launchErr := GenerateLaunchFromDefaults(context.Background(), launcherSchema.URL, "", "", url.Values{"roles": {"flusher"}}, TokenOptions{DryRun: true})
+
+			if test.wantNames == nil {
+				if err == nil || !strings.Contains(err.Error(), "roles, exp") {
+					t.Errorf("expected an error naming roles and exp, got %q", err)
+				}
+				if launchErr == nil || launchErr.Kind != LaunchErrorSchema {
+					t.Errorf("expected a schema error, got %v", launchErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if names := metadataNames(metadata); !reflect.DeepEqual(names, test.wantNames) {
+				t.Errorf("expected %v, got %v", test.wantNames, names)
+			}
+			if launchErr != nil {
+				t.Errorf("unexpected error: %v", launchErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// LauncherParameter describes how the launcher uses one of its own parameters
+type LauncherParameter struct {
+	// ResponseOnly parameters only choose how a launch is responded to, so they are removed by
+	// StripResponseParameters before the launch is generated.
+	ResponseOnly bool
+}
+
+// LauncherParameters are the parameters read by the launcher itself, from the launch form, launch links and quick
+// launches, rather than sent on as survey metadata. Controls added to the launch form must be listed here, or strict
+// launches from the form will be rejected.
+var LauncherParameters = map[string]LauncherParameter{
+	"action_launch": {},
+	"action_flush":  {},
+	"action_reset":  {},
+	"format":        {ResponseOnly: true},
+	"redirect":      {ResponseOnly: true},
+	"debug":         {ResponseOnly: true},
+	"strict":        {},
+	"persona":       {},
+	"exp":           {},
+	"enc":           {},
+	"schema_scheme": {},
+	"url":           {},
+}
+
+// isLauncherParameter reports whether name is one of LauncherParameters
+func isLauncherParameter(name string) bool {
+	_, ok := LauncherParameters[name]
+	return ok
+}
+
+// StripResponseParameters removes the LauncherParameters which only choose how a launch is responded to from values
+func StripResponseParameters(values url.Values) {
+	for name, parameter := range LauncherParameters {
+		if parameter.ResponseOnly {
+			values.Del(name)
+		}
+	}
+}
+
+// knownParameter reports whether name is a launcher parameter, a known claim or metadata required by the schema
+func knownParameter(name string, schema QuestionnaireSchema, defaults map[string]string) bool {
+	if isLauncherParameter(name) || frameworkClaims[name] {
+		return true
+	}
+	if _, ok := defaults[name]; ok {
+		return true
+	}
+	for _, metadata := range schema.Metadata {
+		if metadata.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnknownParameters finds the supplied parameters which the launcher and schema don't recognise, which are
+// usually typos. Strict launches, with strict=true or LAUNCHER_STRICT set, are rejected listing them with the nearest
+// known names. Otherwise they are only logged.
+func checkUnknownParameters(ctx context.Context, values url.Values, schema QuestionnaireSchema) *LaunchError {
+	defaults, err := GetDefaultValues()
+	if err != nil {
+		return identifierLaunchError(err)
+	}
+
+	var unknown []string
+	for name := range values {
+		if !knownParameter(name, schema, defaults) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+
+	strict, _ := strconv.ParseBool(values.Get("strict"))
+	if !strict && !settings.GetBool("LAUNCHER_STRICT") {
+		logging.FromContext(ctx).Info("unrecognised launch parameters", "parameters", unknown)
+		return nil
+	}
+
+	known := knownParameterNames(schema, defaults)
+	metadataErrors := make([]MetadataError, len(unknown))
+	for i, name := range unknown {
+		metadataErrors[i] = MetadataError{Name: name, Reason: "is not a recognised parameter"}
+		if suggestion := nearestName(name, known); suggestion != "" {
+			metadataErrors[i].Reason = fmt.Sprintf("is not a recognised parameter, did you mean %q?", suggestion)
+		}
+	}
+	return metadataLaunchError(metadataErrors)
+}
+
+// knownParameterNames lists every name accepted by knownParameter
+func knownParameterNames(schema QuestionnaireSchema, defaults map[string]string) []string {
+	var names []string
+	for name := range LauncherParameters {
+		names = append(names, name)
+	}
+	for name := range frameworkClaims {
+		names = append(names, name)
+	}
+	for name := range defaults {
+		names = append(names, name)
+	}
+	for _, metadata := range schema.Metadata {
+		names = append(names, metadata.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nearestName returns the name closest to name, or an empty string when none is close enough to be a likely typo or
+// starts with name, such as language for language_code
+func nearestName(name string, names []string) string {
+	maxDistance := len(name)/3 + 1
+	nearest := ""
+	nearestDistance := 0
+	for _, candidate := range names {
+		distance := EditDistance(name, candidate)
+		if distance > maxDistance && !strings.HasPrefix(candidate, name) {
+			continue
+		}
+		if nearest == "" || distance < nearestDistance {
+			nearest = candidate
+			nearestDistance = distance
+		}
+	}
+	return nearest
+}
+
+// EditDistance returns the Levenshtein distance between a and b
+func EditDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
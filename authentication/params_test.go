@@ -0,0 +1,42 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+func TestGenerateClaimsSkipsLauncherParameters(t *testing.T) {
+	values := map[string][]string{"ru_ref": {"12346789012A"}}
+	for name := range LauncherParameters {
+		values[name] = []string{"true"}
+	}
+
+	claims, err := generateClaims(context.Background(), values, surveys.LauncherSchema{Name: "test"}, QuestionnaireSchema{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name := range LauncherParameters {
+		if _, ok := claims[name]; ok {
+			t.Errorf("expected launcher parameter %s not to be a claim", name)
+		}
+	}
+	if claims["ru_ref"] != "12346789012A" {
+		t.Errorf("expected ru_ref to be a claim, got %v", claims["ru_ref"])
+	}
+}
+
+func TestStripResponseParameters(t *testing.T) {
+	values := url.Values{"ru_ref": {"12346789012A"}, "format": {"json"}, "redirect": {"true"}, "debug": {"true"}, "strict": {"true"}}
+
+	StripResponseParameters(values)
+
+	want := url.Values{"ru_ref": {"12346789012A"}, "strict": {"true"}}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
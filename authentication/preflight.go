@@ -0,0 +1,100 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// PreflightReport says whether a launch would succeed, and if not which step would fail
+type PreflightReport struct {
+	Ready           bool            `json:"ready"`
+	SchemaReachable bool            `json:"schema_reachable"`
+	SchemaValid     bool            `json:"schema_valid"`
+	KeysOK          bool            `json:"keys_ok"`
+	MissingMetadata []string        `json:"missing_metadata"`
+	InvalidMetadata []MetadataError `json:"invalid_metadata"`
+	Errors          []string        `json:"errors,omitempty"`
+}
+
+// Preflight checks a launch of values, or of the schema at schemaURL when one is given, without generating a token.
+// The schema is fetched and validated, the keys loaded and the claims checked against the schema's metadata in the
+// same way as GenerateLaunch, except that required metadata which wasn't given is reported too.
+func Preflight(ctx context.Context, schemaURL string, values url.Values) PreflightReport {
+	report := PreflightReport{MissingMetadata: []string{}, InvalidMetadata: []MetadataError{}}
+
+	if err := CheckKeys(); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		report.KeysOK = true
+	}
+
+	launcherSchema, questionnaireSchema, launchErr := resolveSchema(ctx, schemaURL, values)
+	if launchErr != nil {
+		report.SchemaReachable = launchErr.Kind == LaunchErrorSchema
+		report.Errors = append(report.Errors, launchErr.Desc)
+		return report
+	}
+	report.SchemaReachable = true
+	report.SchemaValid = true
+
+	launch, launchErr := launchFromSchema(ctx, launcherSchema, questionnaireSchema, values, TokenOptions{DryRun: true})
+	if launchErr != nil {
+		if launchErr.Kind == LaunchErrorMetadata {
+			report.InvalidMetadata = append(report.InvalidMetadata, launchErr.Fields...)
+		} else {
+			report.Errors = append(report.Errors, launchErr.Desc)
+		}
+		return report
+	}
+
+	requiredMetadata, err := questionnaireSchema.requiredMetadata(values.Get("language_code"))
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report
+	}
+	for _, metadataErr := range validateMetadataClaims(requiredMetadata, flattenClaims(launch.Claims)) {
+		if metadataErr.Reason == ReasonMissingMetadata {
+			report.MissingMetadata = append(report.MissingMetadata, metadataErr.Name)
+		} else {
+			report.InvalidMetadata = append(report.InvalidMetadata, metadataErr)
+		}
+	}
+
+	report.Ready = report.KeysOK && len(report.MissingMetadata) == 0 && len(report.InvalidMetadata) == 0
+	return report
+}
+
+// flattenClaims returns the claims with any survey metadata nested under survey_metadata.data, or identifiers nested
+// under receipting, by CLAIMS_VERSION moved back to the top level, where the schema's metadata names are looked up
+func flattenClaims(claims map[string]interface{}) map[string]interface{} {
+	flattened := make(map[string]interface{}, len(claims))
+	for key, value := range claims {
+		flattened[key] = value
+	}
+
+	if surveyMetadata, ok := claims["survey_metadata"].(map[string]interface{}); ok {
+		if data, ok := surveyMetadata["data"].(map[string]interface{}); ok {
+			for key, value := range data {
+				flattened[key] = value
+			}
+		}
+	}
+	if prefix := settings.Get("METADATA_CLAIM_PREFIX"); prefix != "" {
+		for key, value := range flattened {
+			if strings.HasPrefix(key, prefix) {
+				flattened[strings.TrimPrefix(key, prefix)] = value
+			}
+		}
+	}
+	if receipting, ok := claims["receipting"].(map[string]interface{}); ok {
+		for _, name := range receiptingClaims {
+			if value, ok := receipting[name]; ok {
+				flattened[name] = value
+			}
+		}
+	}
+	return flattened
+}
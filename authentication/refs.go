@@ -0,0 +1,120 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+)
+
+// resolveMetadataRefs replaces each {"$ref": "..."} in the schema's metadata with the metadata it refers to. The ref
+// is resolved against the schema URL, and its fragment, such as #/definitions/metadata, is a JSON pointer to either a
+// list of metadata or an object with a metadata list. Refs within the referenced metadata aren't followed.
+func resolveMetadataRefs(ctx context.Context, schema *QuestionnaireSchema, schemaURL string) error {
+	var resolved []Metadata
+
+	for _, item := range schema.Metadata {
+		if item.Ref == "" {
+			resolved = append(resolved, item)
+			continue
+		}
+
+		refURL, err := resolveRefURL(schemaURL, item.Ref)
+		if err != nil {
+			return err
+		}
+
+		logging.FromContext(ctx).Debug("resolving metadata $ref", "schema_url", schemaURL, "ref", refURL.String())
+		referenced, err := fetchMetadataRef(ctx, refURL)
+		if err != nil {
+			return fmt.Errorf("Failed to resolve metadata $ref %s: %w", item.Ref, err)
+		}
+		resolved = append(resolved, referenced...)
+	}
+
+	schema.Metadata = resolved
+	return nil
+}
+
+func resolveRefURL(schemaURL string, ref string) (*url.URL, error) {
+	base, err := url.Parse(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema URL %s", schemaURL)
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid metadata $ref %s", ref)
+	}
+	return base.ResolveReference(refURL), nil
+}
+
+func fetchMetadataRef(ctx context.Context, refURL *url.URL) ([]Metadata, error) {
+	pointer := refURL.Fragment
+	documentURL := *refURL
+	documentURL.Fragment = ""
+
+	var document interface{}
+	if err := clients.GetJSONLimit(ctx, withSchemaQueryParams(ctx, documentURL.String()), maxSchemaBytes(), &document); err != nil {
+		return nil, err
+	}
+
+	target, err := jsonPointer(document, pointer)
+	if err != nil {
+		return nil, err
+	}
+	if object, ok := target.(map[string]interface{}); ok {
+		target = object["metadata"]
+	}
+
+	encoded, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	var metadata []Metadata
+	if err := json.Unmarshal(encoded, &metadata); err != nil {
+		return nil, fmt.Errorf("%s is not a list of metadata", refURL)
+	}
+	for _, item := range metadata {
+		if item.Ref != "" || item.Name == "" {
+			return nil, fmt.Errorf("%s contains metadata without a name, or a nested $ref", refURL)
+		}
+	}
+
+	return metadata, nil
+}
+
+// jsonPointer returns the value at an RFC 6901 JSON pointer within document, such as /definitions/metadata
+func jsonPointer(document interface{}, pointer string) (interface{}, error) {
+	if pointer == "" || pointer == "/" {
+		return document, nil
+	}
+
+	current := document
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		switch value := current.(type) {
+		case map[string]interface{}:
+			next, ok := value[token]
+			if !ok {
+				return nil, fmt.Errorf("no %q in referenced document", token)
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, fmt.Errorf("no index %q in referenced document", token)
+			}
+			current = value[index]
+		default:
+			return nil, fmt.Errorf("no %q in referenced document", token)
+		}
+	}
+
+	return current, nil
+}
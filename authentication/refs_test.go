@@ -0,0 +1,136 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+// refServer serves each document by path, and 404s for any other
+func refServer(t *testing.T, documents map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		document, ok := documents[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(document))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetRequiredMetadataRefs(t *testing.T) {
+	shared := refServer(t, map[string]string{
+		"/shared.json": `{"definitions": {
+			"business": {"metadata": [{"name": "ru_ref", "type": "string"}, {"name": "trad_as", "type": "string", "optional": true}]},
+			"period": [{"name": "period_id", "type": "string"}],
+			"nested": [{"$ref": "#/definitions/period"}]
+		}}`,
+	})
+
+	tests := []struct {
+		name      string
+		enabled   string
+		metadata  string
+		want      []string
+		wantError bool
+	}{
+		{"absolute refs", "true", `[
+			{"name": "user_id", "type": "string"},
+			{"$ref": "` + shared.URL + `/shared.json#/definitions/business"},
+			{"$ref": "` + shared.URL + `/shared.json#/definitions/period"}
+		]`, []string{"user_id", "ru_ref", "trad_as", "period_id"}, false},
+		{"ref relative to the schema", "true", `[{"$ref": "local.json"}]`, []string{"ref_p_start_date"}, false},
+		{"without refs", "true", `[{"name": "ru_ref", "type": "string"}]`, []string{"ru_ref"}, false},
+		{"missing pointer", "true", `[{"$ref": "` + shared.URL + `/shared.json#/definitions/missing"}]`, nil, true},
+		{"missing document", "true", `[{"$ref": "` + shared.URL + `/missing.json"}]`, nil, true},
+		{"nested ref", "true", `[{"$ref": "` + shared.URL + `/shared.json#/definitions/nested"}]`, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "RESOLVE_SCHEMA_REFS", test.enabled)
+			server := refServer(t, map[string]string{
+				"/schema.json": `{"schema_name": "test_refs", "metadata": ` + test.metadata + `}`,
+				"/local.json":  `[{"name": "ref_p_start_date", "type": "date"}]`,
+			})
+
+			metadata, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test_refs", URL: server.URL + "/schema.json"}, "")
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %q", test.wantError, err)
+			}
+			if test.wantError {
+				return
+			}
+			if got := metadataNames(metadata); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGetRequiredMetadataRefsDisabled(t *testing.T) {
+	withSetting(t, "RESOLVE_SCHEMA_REFS", "false")
+	fetched := false
+	shared := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		w.Write([]byte(`[{"name": "period_id", "type": "string"}]`))
+	}))
+	t.Cleanup(shared.Close)
+	server := refServer(t, map[string]string{
+		"/schema.json": `{"schema_name": "test_refs", "metadata": [{"name": "user_id", "type": "string"}, {"$ref": "` + shared.URL + `"}]}`,
+	})
+
+	metadata, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test_refs", URL: server.URL + "/schema.json"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched {
+		t.Error("expected the $ref not to be fetched")
+	}
+	for _, name := range metadataNames(metadata) {
+		if name == "period_id" {
+			t.Errorf("expected no period_id, got %v", metadataNames(metadata))
+		}
+	}
+}
+
+func TestJSONPointer(t *testing.T) {
+	var document interface{}
+	if err := json.Unmarshal([]byte(`{"a/b": {"m~n": [10, 20]}, "list": [{"name": "x"}]}`), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pointer   string
+		want      interface{}
+		wantError bool
+	}{
+		{"", document, false},
+		{"/a~1b/m~0n/1", float64(20), false},
+		{"/list/0/name", "x", false},
+		{"/list/1", nil, true},
+		{"/list/name", nil, true},
+		{"/missing", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pointer, func(t *testing.T) {
+			got, err := jsonPointer(document, test.pointer)
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+			if !test.wantError && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
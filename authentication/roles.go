@@ -0,0 +1,131 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// requiredRoles returns the roles SURVEY_REQUIRED_ROLES requires for launches of the schema name, or else of the
+// survey, e.g. {"admin": ["flusher"]}
+func requiredRoles(schemaName string, survey string) []string {
+	if settings.Get("SURVEY_REQUIRED_ROLES") == "" {
+		return nil
+	}
+
+	var surveyRoles map[string][]string
+	if err := json.Unmarshal([]byte(settings.Get("SURVEY_REQUIRED_ROLES")), &surveyRoles); err != nil {
+		logging.Error("failed to parse SURVEY_REQUIRED_ROLES", "error", err)
+		return nil
+	}
+
+	for _, name := range surveyLookupNames(schemaName, survey) {
+		if roles, ok := surveyRoles[name]; ok {
+			return roles
+		}
+	}
+	return nil
+}
+
+// addRequiredRoles returns roles with any of the survey's required roles which weren't requested added
+func addRequiredRoles(ctx context.Context, roles []string, schemaName string, survey string) []string {
+	requested := make(map[string]bool)
+	for _, role := range roles {
+		requested[role] = true
+	}
+
+	for _, role := range requiredRoles(schemaName, survey) {
+		if !requested[role] {
+			logging.FromContext(ctx).Info("adding role required by survey", "role", role, "schema_name", schemaName)
+			roles = append(roles, role)
+			requested[role] = true
+		}
+	}
+	return roles
+}
+
+// forbiddenRoles returns the roles in FORBIDDEN_ROLES, such as dumper in production-like environments
+func forbiddenRoles() map[string]bool {
+	forbidden := make(map[string]bool)
+	for _, role := range settings.GetList("FORBIDDEN_ROLES") {
+		forbidden[role] = true
+	}
+	return forbidden
+}
+
+// checkForbiddenRoles rejects a launch which asks for any of the FORBIDDEN_ROLES
+func checkForbiddenRoles(values url.Values) *LaunchError {
+	forbidden := forbiddenRoles()
+
+	var metadataErrors []MetadataError
+	for _, role := range values["roles"] {
+		if forbidden[role] {
+			metadataErrors = append(metadataErrors, MetadataError{Name: "roles", Reason: fmt.Sprintf("%s is not allowed by FORBIDDEN_ROLES", role)})
+		}
+	}
+
+	if len(metadataErrors) > 0 {
+		return metadataLaunchError(metadataErrors)
+	}
+	return nil
+}
+
+// withoutForbiddenRoles removes the FORBIDDEN_ROLES from roles which weren't asked for, such as the default dumper
+// role or a survey's required roles
+func withoutForbiddenRoles(ctx context.Context, roles []string) []string {
+	forbidden := forbiddenRoles()
+
+	allowed := []string{}
+	for _, role := range roles {
+		if forbidden[role] {
+			logging.FromContext(ctx).Info("leaving out role forbidden by FORBIDDEN_ROLES", "role", role)
+			continue
+		}
+		allowed = append(allowed, role)
+	}
+	return allowed
+}
+
+// roleCombination returns roles as a sorted, comma-separated list, so combinations compare equal whatever order their
+// roles were given in
+func roleCombination(roles []string) string {
+	sorted := append([]string(nil), roles...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+// checkRoleCombination rejects roles which aren't exactly one of the combinations in ALLOWED_ROLE_COMBINATIONS, e.g.
+// [["dumper"], ["flusher"]], for environments which don't allow a launch to be both
+func checkRoleCombination(roles []string) *LaunchError {
+	if settings.Get("ALLOWED_ROLE_COMBINATIONS") == "" {
+		return nil
+	}
+
+	var combinations [][]string
+	if err := json.Unmarshal([]byte(settings.Get("ALLOWED_ROLE_COMBINATIONS")), &combinations); err != nil {
+		return &LaunchError{Kind: LaunchErrorConfiguration, Desc: fmt.Sprintf("ALLOWED_ROLE_COMBINATIONS is not a JSON list of role lists: %v", err)}
+	}
+
+	requested := roleCombination(roles)
+	for _, combination := range combinations {
+		if roleCombination(combination) == requested {
+			return nil
+		}
+	}
+	return metadataLaunchError([]MetadataError{{Name: "roles", Reason: fmt.Sprintf("[%s] is not one of the ALLOWED_ROLE_COMBINATIONS", requested)}})
+}
+
+// checkMaxRoles rejects more than MAX_ROLES roles, such as from a malformed multi-select, which would bloat the token
+func checkMaxRoles(roles []string) *LaunchError {
+	maxRoles := settings.GetInt("MAX_ROLES")
+	if maxRoles <= 0 || len(roles) <= maxRoles {
+		return nil
+	}
+	return metadataLaunchError([]MetadataError{{Name: "roles", Reason: fmt.Sprintf("%d roles given, more than MAX_ROLES (%d)", len(roles), maxRoles)}})
+}
@@ -0,0 +1,194 @@
+package authentication
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestForbiddenRoles(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	withSetting(t, "FORBIDDEN_ROLES", "dumper")
+
+	encoded := Base64ClaimPrefix + base64.RawURLEncoding.EncodeToString([]byte("dumper"))
+
+	tests := []struct {
+		name      string
+		roles     []string
+		wantError bool
+	}{
+		{"allowed role", []string{"flusher"}, false},
+		{"forbidden role", []string{"dumper"}, true},
+		{"encoded forbidden role", []string{encoded}, true},
+		{"forbidden among allowed roles", []string{"flusher", "dumper"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "roles": test.roles}
+			launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if test.wantError {
+				if launchErr == nil || launchErr.Kind != LaunchErrorMetadata {
+					t.Fatalf("expected a metadata error, got %v", launchErr)
+				}
+				if len(launchErr.Fields) == 0 || launchErr.Fields[0].Name != "roles" {
+					t.Errorf("expected the error to name roles, got %+v", launchErr.Fields)
+				}
+				return
+			}
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			for _, role := range launch.Claims["roles"].([]string) {
+				if role == "dumper" {
+					t.Error("expected the forbidden role not to be in the claims")
+				}
+			}
+		})
+	}
+}
+
+func TestWithoutForbiddenRoles(t *testing.T) {
+	withSetting(t, "FORBIDDEN_ROLES", "dumper")
+
+	roles := withoutForbiddenRoles(context.Background(), []string{"dumper", "flusher"})
+	if len(roles) != 1 || roles[0] != "flusher" {
+		t.Errorf("expected only flusher, got %v", roles)
+	}
+}
+
+func TestCheckMaxRoles(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxRoles  string
+		roles     []string
+		wantError bool
+	}{
+		{"under the limit", "2", []string{"dumper"}, false},
+		{"at the limit", "2", []string{"dumper", "flusher"}, false},
+		{"over the limit", "1", []string{"dumper", "flusher"}, true},
+		{"unlimited", "0", []string{"a", "b", "c"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "MAX_ROLES", test.maxRoles)
+			if err := checkMaxRoles(test.roles); (err != nil) != test.wantError {
+				t.Errorf("expected error %v, got %v", test.wantError, err)
+			}
+		})
+	}
+}
+
+func TestMaxRolesLaunch(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	withSetting(t, "MAX_ROLES", "10")
+
+	roles := func(n int) []string {
+		var roles []string
+		for i := 0; i < n; i++ {
+			roles = append(roles, fmt.Sprintf("role_%d", i))
+		}
+		return roles
+	}
+
+	tests := []struct {
+		name      string
+		roles     []string
+		wantError bool
+	}{
+		{"default role", nil, false},
+		{"at the limit", roles(10), false},
+		{"over the limit", roles(11), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+			if test.roles != nil {
+				values["roles"] = test.roles
+			}
+
+			launch, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if test.wantError {
+				if launchErr == nil || len(launchErr.Fields) == 0 || launchErr.Fields[0].Name != "roles" {
+					t.Errorf("expected a roles error, got %v", launchErr)
+				}
+				return
+			}
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if test.roles == nil && !reflect.DeepEqual(launch.Claims["roles"], []string{"dumper"}) {
+				t.Errorf("expected the default roles, got %v", launch.Claims["roles"])
+			}
+		})
+	}
+}
+
+func TestAddRequiredRoles(t *testing.T) {
+	withSetting(t, "SURVEY_REQUIRED_ROLES", `{"admin": ["flusher"], "test_admin_only": ["flusher", "dumper"]}`)
+
+	tests := []struct {
+		name       string
+		roles      []string
+		schemaName string
+		survey     string
+		want       []string
+	}{
+		{"required role present", []string{"dumper", "flusher"}, "admin_0001", "", []string{"dumper", "flusher"}},
+		{"required role added", []string{"dumper"}, "admin_0001", "", []string{"dumper", "flusher"}},
+		{"required by survey", []string{"dumper"}, "test_other", "admin", []string{"dumper", "flusher"}},
+		{"schema name before survey", nil, "test_admin_only", "admin", []string{"flusher", "dumper"}},
+		{"no requirement", []string{"dumper"}, "test_launch", "", []string{"dumper"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := addRequiredRoles(context.Background(), test.roles, test.schemaName, test.survey); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestAllowedRoleCombinations(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name         string
+		combinations string
+		roles        []string
+		wantKind     string
+	}{
+		{"allowed combination", `[["dumper"], ["flusher"]]`, []string{"flusher"}, ""},
+		{"allowed in any order", `[["dumper", "flusher"]]`, []string{"flusher", "dumper"}, ""},
+		{"disallowed combination", `[["dumper"], ["flusher"]]`, []string{"dumper", "flusher"}, LaunchErrorMetadata},
+		{"unrestricted", "", []string{"dumper", "flusher"}, ""},
+		{"invalid setting", `["dumper"]`, []string{"dumper"}, LaunchErrorConfiguration},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ALLOWED_ROLE_COMBINATIONS", test.combinations)
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "roles": test.roles}
+
+			_, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if test.wantKind == "" {
+				if launchErr != nil {
+					t.Errorf("unexpected error: %v", launchErr)
+				}
+				return
+			}
+			if launchErr == nil || launchErr.Kind != test.wantKind {
+				t.Fatalf("expected a %s error, got %v", test.wantKind, launchErr)
+			}
+			if test.wantKind == LaunchErrorMetadata && (len(launchErr.Fields) == 0 || launchErr.Fields[0].Name != "roles") {
+				t.Errorf("expected the error to name roles, got %+v", launchErr.Fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestGenerateTokenFromPostRoundTrip(t *testing.T) {
+	runner := useMockRunner(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name   string
+		values url.Values
+		want   map[string]interface{}
+	}{
+		{
+			name:   "required metadata",
+			values: url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}},
+			want:   map[string]interface{}{"schema_name": "test_roundtrip", "ru_ref": "12346789012A", "period_id": "201605"},
+		},
+		{
+			name:   "optional metadata",
+			values: url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "trad_as": {"ESSENTIAL"}},
+			want:   map[string]interface{}{"ru_ref": "12346789012A", "trad_as": "ESSENTIAL"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, launchErr := GenerateTokenFromPost(context.Background(), test.values)
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+
+			response, err := http.Get(SessionURL(token))
+			if err != nil {
+				t.Fatalf("failed to start session: %v", err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("runner rejected the token with %d", response.StatusCode)
+			}
+
+			var claims map[string]interface{}
+			if err := json.NewDecoder(response.Body).Decode(&claims); err != nil {
+				t.Fatalf("failed to decode runner response: %v", err)
+			}
+			for name, want := range test.want {
+				if claims[name] != want {
+					t.Errorf("expected %s %v, got %v", name, want, claims[name])
+				}
+			}
+			for _, name := range []string{"tx_id", "jti", "iat", "exp", "roles"} {
+				if _, ok := claims[name]; !ok {
+					t.Errorf("expected the runner to receive %s", name)
+				}
+			}
+		})
+	}
+
+	if received := runner.Received(); len(received) != len(tests) {
+		t.Errorf("expected the runner to accept %d tokens, got %d", len(tests), len(received))
+	}
+}
+
+func TestGenerateTokenFromPostRoundTripWrongKey(t *testing.T) {
+	useMockRunner(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	token, launchErr := GenerateTokenFromPost(context.Background(), url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}})
+	if launchErr != nil {
+		t.Fatalf("unexpected error: %v", launchErr)
+	}
+
+	// A runner holding different keys must reject the token
+	other := useMockRunner(t)
+	if _, err := other.Claims(token); err == nil {
+		t.Error("expected a runner with other keys to reject the token")
+	}
+}
+
+func TestGenerateTokenFromPostUnknownSurvey(t *testing.T) {
+	useMockRunner(t)
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name       string
+		schemaName string
+		wantError  string
+	}{
+		{"known survey", "test_roundtrip", ""},
+		{"unknown survey", "test_missing", "unknown survey: test_missing"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, launchErr := GenerateTokenFromPost(context.Background(), url.Values{"schema_name": {test.schemaName}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}})
+			if test.wantError == "" {
+				if launchErr != nil || token == "" {
+					t.Errorf("expected a token, got %v", launchErr)
+				}
+				return
+			}
+			if launchErr == nil || launchErr.Kind != LaunchErrorSchemaNotFound || launchErr.Desc != test.wantError {
+				t.Errorf("expected a %s error %q, got %+v", LaunchErrorSchemaNotFound, test.wantError, launchErr)
+			}
+			if token != "" {
+				t.Error("expected no token for an unknown survey")
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+type schemaSchemeKey struct{}
+
+// ContextWithSchemaScheme returns a context whose schema fetches use scheme, http or https, whatever scheme the
+// schema URL was configured with. It only has an effect when ENABLE_SCHEMA_SCHEME_OVERRIDE is set, for forcing https
+// on a host configured with http for a single launch.
+func ContextWithSchemaScheme(ctx context.Context, scheme string) context.Context {
+	if scheme == "" || !settings.GetBool("ENABLE_SCHEMA_SCHEME_OVERRIDE") {
+		return ctx
+	}
+	if scheme != "http" && scheme != "https" {
+		logging.FromContext(ctx).Warn("ignoring invalid schema_scheme", "schema_scheme", scheme)
+		return ctx
+	}
+	return context.WithValue(ctx, schemaSchemeKey{}, scheme)
+}
+
+// withSchemaScheme rewrites the scheme of a schema URL to the one from ContextWithSchemaScheme, if any
+func withSchemaScheme(ctx context.Context, schemaURL string) string {
+	scheme, ok := ctx.Value(schemaSchemeKey{}).(string)
+	if !ok {
+		return schemaURL
+	}
+
+	parsedURL, err := url.Parse(schemaURL)
+	if err != nil || parsedURL.Scheme == scheme {
+		return schemaURL
+	}
+	parsedURL.Scheme = scheme
+	return parsedURL.String()
+}
@@ -0,0 +1,55 @@
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+func TestWithSchemaScheme(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   string
+		scheme    string
+		schemaURL string
+		want      string
+	}{
+		{"forces https", "true", "https", "http://runner/schemas/test.json", "https://runner/schemas/test.json"},
+		{"forces http", "true", "http", "https://runner/schemas/test.json", "http://runner/schemas/test.json"},
+		{"same scheme", "true", "https", "https://runner/schemas/test.json", "https://runner/schemas/test.json"},
+		{"keeps the query", "true", "https", "http://runner/schemas/test.json?language_code=cy", "https://runner/schemas/test.json?language_code=cy"},
+		{"unchanged by default", "true", "", "http://runner/schemas/test.json", "http://runner/schemas/test.json"},
+		{"disabled", "false", "https", "http://runner/schemas/test.json", "http://runner/schemas/test.json"},
+		{"invalid scheme", "true", "ftp", "http://runner/schemas/test.json", "http://runner/schemas/test.json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ENABLE_SCHEMA_SCHEME_OVERRIDE", test.enabled)
+
+			ctx := ContextWithSchemaScheme(context.Background(), test.scheme)
+			if got := withSchemaScheme(ctx, test.schemaURL); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGetRequiredMetadataSchemaScheme(t *testing.T) {
+	withSetting(t, "ENABLE_SCHEMA_SCHEME_OVERRIDE", "true")
+	server := schemaServer(t, http.StatusOK, `{"metadata": [{"name": "ru_ref", "type": "string"}]}`)
+	// The server only speaks http, so the schema can only be fetched when the scheme is overridden
+	schemaURL := strings.Replace(server.URL, "http://", "https://", 1) + "/schema.json"
+
+	if _, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test", URL: schemaURL}, "en"); err == nil {
+		t.Fatal("expected fetching an http server over https to fail")
+	}
+
+	ctx := ContextWithSchemaScheme(context.Background(), "http")
+	if _, err := GetRequiredMetadata(ctx, surveys.LauncherSchema{Name: "test", URL: schemaURL}, "en"); err != nil {
+		t.Errorf("expected the overridden scheme to be fetched, got %s", err)
+	}
+}
@@ -0,0 +1,416 @@
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+func TestCheckSchemaHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist string
+		url       string
+		wantError bool
+	}{
+		{"empty list allows any host", "", "https://anywhere.example.com/schema.json", false},
+		{"allowed host", "schemas.example.com, localhost", "https://schemas.example.com/test.json", false},
+		{"allowed host with a port", "localhost", "http://localhost:5000/test.json", false},
+		{"allowed host and port", "localhost:5000", "http://localhost:5000/test.json", false},
+		{"host is case insensitive", "Schemas.Example.com", "https://schemas.example.com/test.json", false},
+		{"disallowed host", "schemas.example.com", "https://evil.example.com/test.json", true},
+		{"other port not allowed", "localhost:5000", "http://localhost:6000/test.json", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SCHEMA_HOST_ALLOWLIST", test.allowlist)
+
+			if got := checkSchemaHost(test.url); (got != "") != test.wantError {
+				t.Errorf("expected error %v, got %q", test.wantError, got)
+			}
+		})
+	}
+}
+
+func TestLauncherSchemaFromURLDisallowedHost(t *testing.T) {
+	server := schemaServer(t, 200, roundTripSchema)
+	withSetting(t, "SCHEMA_HOST_ALLOWLIST", "schemas.example.com")
+
+	if _, err := launcherSchemaFromURL(context.Background(), server.URL+"/test_roundtrip.json"); err == nil {
+		t.Error("expected a disallowed host to be rejected before the schema is fetched")
+	}
+}
+
+func TestLauncherSchemaFromURLRunnerFallback(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+	notFound := schemaServer(t, 404, `{}`)
+	serverError := schemaServer(t, 500, `{}`)
+
+	tests := []struct {
+		name      string
+		fallback  string
+		url       string
+		wantError bool
+	}{
+		{"404 with a working fallback", "true", notFound.URL + "/schemas/test_roundtrip.json", false},
+		{"404 without the schema on the runner", "true", notFound.URL + "/schemas/test_missing.json", true},
+		{"404 with the fallback disabled", "false", notFound.URL + "/schemas/test_roundtrip.json", true},
+		{"500 isn't retried", "true", serverError.URL + "/schemas/test_roundtrip.json", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "QUICKLAUNCH_RUNNER_FALLBACK", test.fallback)
+
+			launcherSchema, err := launcherSchemaFromURL(context.Background(), test.url)
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(launcherSchema.URL, settings.Get("SURVEY_RUNNER_SCHEMA_URL")+"/schemas/test_roundtrip") {
+				t.Errorf("expected the runner's schema URL, got %s", launcherSchema.URL)
+			}
+		})
+	}
+}
+
+func TestLauncherSchemaFromURLFallbackName(t *testing.T) {
+	unnamed := schemaServer(t, 200, `{"metadata": []}`)
+	named := schemaServer(t, 200, roundTripSchema)
+
+	tests := []struct {
+		name      string
+		fallback  string
+		url       string
+		want      string
+		wantError bool
+	}{
+		{"name in the schema", "test_fallback", named.URL + "/", "test_roundtrip", false},
+		{"name from the URL", "test_fallback", unnamed.URL + "/schemas/test_from_path.json", "test_from_path", false},
+		{"fallback used", "test_fallback", unnamed.URL + "/", "test_fallback", false},
+		{"no fallback configured", "", unnamed.URL + "/", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "QUICKLAUNCH_FALLBACK_SCHEMA_NAME", test.fallback)
+
+			launcherSchema, err := launcherSchemaFromURL(context.Background(), test.url)
+			if test.wantError {
+				if err == nil || !strings.Contains(err.Error(), "QUICKLAUNCH_FALLBACK_SCHEMA_NAME") {
+					t.Errorf("expected an error suggesting QUICKLAUNCH_FALLBACK_SCHEMA_NAME, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if launcherSchema.Name != test.want {
+				t.Errorf("expected %s, got %s", test.want, launcherSchema.Name)
+			}
+		})
+	}
+}
+
+func TestWithSchemaQueryParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		url    string
+		want   string
+	}{
+		{"no params", "", "http://schemas/test.json", "http://schemas/test.json"},
+		{"without a query", "tenant=ons", "http://schemas/test.json", "http://schemas/test.json?tenant=ons"},
+		{"with a query", "tenant=ons", "http://schemas/test.json?bust=20170501", "http://schemas/test.json?bust=20170501&tenant=ons"},
+		{"cache bust isn't clobbered", "tenant=ons&bust=0", "http://schemas/test.json?bust=20170501", "http://schemas/test.json?bust=20170501&tenant=ons"},
+		{"escaped", "tenant=o%26s", "http://schemas/test.json", "http://schemas/test.json?tenant=o%26s"},
+		{"invalid params", "tenant=%zz", "http://schemas/test.json", "http://schemas/test.json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SCHEMA_QUERY_PARAMS", test.params)
+
+			if got := withSchemaQueryParams(context.Background(), test.url); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestSchemaQueryParamsOnFetch(t *testing.T) {
+	withSetting(t, "SCHEMA_QUERY_PARAMS", "tenant=ons")
+
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(roundTripSchema))
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name  string
+		fetch func(schemaURL string) error
+		url   string
+	}{
+		{"GetRequiredMetadata", func(schemaURL string) error {
+			if _, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test_roundtrip", URL: schemaURL}, ""); err != nil {
+				return err
+			}
+			return nil
+		}, server.URL + "/test_roundtrip.json?bust=20170501"},
+		{"launcherSchemaFromURL", func(schemaURL string) error {
+			_, err := launcherSchemaFromURL(context.Background(), schemaURL)
+			return err
+		}, server.URL + "/test_roundtrip.json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queries = nil
+			if err := test.fetch(test.url); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(queries) == 0 {
+				t.Fatal("expected the schema to be fetched")
+			}
+			for _, query := range queries {
+				if query.Get("tenant") != "ons" {
+					t.Errorf("expected tenant=ons on the fetch, got %v", query)
+				}
+			}
+		})
+	}
+}
+
+func TestLauncherSchemaFromURLErrors(t *testing.T) {
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refused.Close()
+
+	truncated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte(`{"schema_name": "test_`))
+	}))
+	t.Cleanup(truncated.Close)
+
+	invalidJSON := schemaServer(t, 200, `<html>not a schema</html>`)
+
+	tests := []struct {
+		name     string
+		url      string
+		wantKind string
+	}{
+		{"connection refused", refused.URL + "/test_roundtrip.json", LaunchErrorUpstream},
+		{"body read error", truncated.URL + "/test_roundtrip.json", LaunchErrorUpstream},
+		{"invalid JSON", invalidJSON.URL + "/test_roundtrip.json", LaunchErrorSchema},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := launcherSchemaFromURL(context.Background(), test.url)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), test.url) {
+				t.Errorf("expected the error to name %s, got %v", test.url, err)
+			}
+
+			_, launchErr := GenerateLaunchFromDefaults(context.Background(), test.url, "", "", url.Values{}, TokenOptions{DryRun: true})
+			if launchErr == nil || launchErr.Kind != test.wantKind {
+				t.Errorf("expected a %s launch error, got %+v", test.wantKind, launchErr)
+			}
+		})
+	}
+}
+
+func TestSchemaTooLarge(t *testing.T) {
+	withSetting(t, "MAX_SCHEMA_BYTES", "1024")
+
+	tests := []struct {
+		name      string
+		padding   int
+		wantError bool
+	}{
+		{"within the limit", 100, false},
+		{"over the limit", 2048, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := schemaServer(t, 200, `{"schema_name": "test_large", "padding": "`+strings.Repeat("x", test.padding)+`", "metadata": []}`)
+			surveyURL := server.URL + "/test_large.json"
+
+			_, err := launcherSchemaFromURL(context.Background(), surveyURL)
+			if test.wantError != errors.Is(err, clients.ErrResponseTooLarge) {
+				t.Errorf("expected ErrResponseTooLarge %v, got %v", test.wantError, err)
+			}
+
+			_, metadataErr := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test_large", URL: surveyURL}, "")
+			if test.wantError != (metadataErr != nil) {
+				t.Errorf("expected an error %v, got %v", test.wantError, metadataErr)
+			}
+
+			_, launchErr := GenerateLaunchFromDefaults(context.Background(), surveyURL, "", "", url.Values{}, TokenOptions{DryRun: true})
+			if test.wantError && (launchErr == nil || launchErr.Kind != LaunchErrorSchema || !strings.Contains(launchErr.Desc, "1024 bytes")) {
+				t.Errorf("expected a schema error giving the limit, got %+v", launchErr)
+			}
+		})
+	}
+}
+
+func TestStripSurveyURLCacheBust(t *testing.T) {
+	var fetched []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = append(fetched, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(roundTripSchema))
+	}))
+	t.Cleanup(server.Close)
+	schemaURL := server.URL + "/test_roundtrip.json"
+	withClock(t, time.Date(2017, 5, 1, 9, 30, 15, 0, time.UTC))
+
+	tests := []struct {
+		name      string
+		enabled   string
+		wantBust  bool
+		wantClaim string
+	}{
+		{"stripped", "true", false, schemaURL},
+		{"kept by default", "false", true, schemaURL + "?bust=20170501093015"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "STRIP_SURVEY_URL_CACHE_BUST", test.enabled)
+			fetched = nil
+
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), schemaURL, "", "", url.Values{}, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+
+			surveyURL, _ := launch.Claims["survey_url"].(string)
+			if hasBust := strings.Contains(surveyURL, "bust="); hasBust != test.wantBust {
+				t.Errorf("expected the cache bust in survey_url to be %v, got %s", test.wantBust, surveyURL)
+			}
+			if surveyURL != test.wantClaim {
+				t.Errorf("expected survey_url %s, got %s", test.wantClaim, surveyURL)
+			}
+
+			busted := false
+			for _, query := range fetched {
+				busted = busted || query.Get("bust") != ""
+			}
+			if !busted {
+				t.Errorf("expected the cache bust to still be used to fetch the schema, got %v", fetched)
+			}
+		})
+	}
+}
+
+func TestSchemaFetchMethod(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			SchemaName string `json:"schema_name"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+body.SchemaName)
+
+		if (r.Method == http.MethodGet && r.URL.Path == "/schemas/test_roundtrip") ||
+			(r.Method == http.MethodPost && r.URL.Path == "/schemas" && body.SchemaName == "test_roundtrip") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(roundTripSchema))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	withSetting(t, "SURVEY_RUNNER_SCHEMA_URL", server.URL)
+
+	tests := []struct {
+		name        string
+		method      string
+		wantRequest string
+		wantErr     bool
+	}{
+		{"GET", "GET", "GET /schemas/test_roundtrip ", false},
+		{"POST", "POST", "POST /schemas test_roundtrip", false},
+		{"lowercase", "post", "POST /schemas test_roundtrip", false},
+		{"unsupported", "PUT", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SCHEMA_FETCH_METHOD", test.method)
+			requests = nil
+
+			metadata, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test_roundtrip"}, "en")
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", metadata)
+				}
+				if len(requests) != 0 {
+					t.Errorf("expected no request, got %v", requests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(metadata) == 0 {
+				t.Error("expected the schema's metadata")
+			}
+			if len(requests) != 1 || requests[0] != test.wantRequest {
+				t.Errorf("expected %q, got %q", test.wantRequest, requests)
+			}
+		})
+	}
+}
+
+func TestSchemaURLClaim(t *testing.T) {
+	server := schemaServer(t, http.StatusOK, roundTripSchema)
+	schemaURL := server.URL + "/test_roundtrip.json"
+
+	tests := []struct {
+		name      string
+		claimName string
+		absent    string
+	}{
+		{"survey_url", "survey_url", "schema_url"},
+		{"schema_url", "schema_url", "survey_url"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SCHEMA_URL_CLAIM", test.claimName)
+			withSetting(t, "STRIP_SURVEY_URL_CACHE_BUST", "true")
+
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), schemaURL, "", "", url.Values{}, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if got := launch.Claims[test.claimName]; got != schemaURL {
+				t.Errorf("expected %s %s, got %v", test.claimName, schemaURL, got)
+			}
+			if got, ok := launch.Claims[test.absent]; ok {
+				t.Errorf("expected no %s claim, got %v", test.absent, got)
+			}
+		})
+	}
+}
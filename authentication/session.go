@@ -0,0 +1,87 @@
+package authentication
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// sessionTokenPlaceholder is replaced by the token in SURVEY_RUNNER_SESSION_PATH
+const sessionTokenPlaceholder = "{token}"
+
+// SessionURL returns the runner URL which starts a session with token, made from SURVEY_RUNNER_URL and the
+// SURVEY_RUNNER_SESSION_PATH template, such as /session?token={token} or /session/{token}
+func SessionURL(token string) string {
+	return sessionURL(settings.Get("SURVEY_RUNNER_URL"), token)
+}
+
+// HandoffURL returns the session URL the launcher itself starts a session with, which is on RUNNER_HANDOFF_URL when the
+// runner is reached at a different address from the browser, such as its service name in a compose network
+func HandoffURL(token string) string {
+	runnerURL := settings.Get("RUNNER_HANDOFF_URL")
+	if runnerURL == "" {
+		return SessionURL(token)
+	}
+	return sessionURL(runnerURL, token)
+}
+
+// sessionURL joins the SURVEY_RUNNER_SESSION_PATH template to runnerURL with clients.JoinURL, so that a trailing slash
+// or a path prefix on runnerURL is kept without doubling the slash
+func sessionURL(runnerURL, token string) string {
+	sessionPath := settings.Get("SURVEY_RUNNER_SESSION_PATH")
+	pathTemplate, queryTemplate := sessionPath, ""
+	if i := strings.Index(sessionPath, "?"); i >= 0 {
+		pathTemplate, queryTemplate = sessionPath[:i], sessionPath[i+1:]
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(pathTemplate, "/") {
+		if segment != "" {
+			segments = append(segments, strings.Replace(segment, sessionTokenPlaceholder, token, -1))
+		}
+	}
+
+	joinedURL, err := clients.JoinURL(runnerURL, segments...)
+	if err != nil {
+		return runnerURL + strings.Replace(sessionPath, sessionTokenPlaceholder, token, -1)
+	}
+	if queryTemplate == "" {
+		return joinedURL
+	}
+
+	parsedURL, _ := url.Parse(joinedURL)
+	query := strings.Replace(queryTemplate, sessionTokenPlaceholder, url.QueryEscape(token), -1)
+	if parsedURL.RawQuery != "" {
+		query = parsedURL.RawQuery + "&" + query
+	}
+	parsedURL.RawQuery = query
+	return parsedURL.String()
+}
+
+// FlushURL returns the runner URL which flushes the response identified by token
+func FlushURL(token string) string {
+	flushURL, err := clients.JoinURL(settings.Get("SURVEY_RUNNER_URL"), "flush")
+	if err != nil {
+		return settings.Get("SURVEY_RUNNER_URL") + "/flush?token=" + url.QueryEscape(token)
+	}
+
+	parsedURL, _ := url.Parse(flushURL)
+	query := parsedURL.Query()
+	query.Set("token", token)
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String()
+}
+
+// checkSessionURL returns an error when the settings can't make a usable session URL, so that a token isn't generated
+// only for it to be unusable
+func checkSessionURL() *LaunchError {
+	if settings.Get("SURVEY_RUNNER_URL") == "" {
+		return &LaunchError{Kind: LaunchErrorConfiguration, Desc: "SURVEY_RUNNER_URL must be set to generate a launch"}
+	}
+	if !strings.Contains(settings.Get("SURVEY_RUNNER_SESSION_PATH"), sessionTokenPlaceholder) {
+		return &LaunchError{Kind: LaunchErrorConfiguration, Desc: "SURVEY_RUNNER_SESSION_PATH must contain " + sessionTokenPlaceholder}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package authentication
+
+import "testing"
+
+func TestSessionURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		runnerURL   string
+		sessionPath string
+		want        string
+	}{
+		{"query", "http://runner", "/session?token={token}", "http://runner/session?token=abc.def"},
+		{"trailing slash", "http://runner/", "/session?token={token}", "http://runner/session?token=abc.def"},
+		{"path segment", "http://runner/", "/session/{token}", "http://runner/session/abc.def"},
+		{"path prefix", "http://proxy/runner/", "/session/{token}", "http://proxy/runner/session/abc.def"},
+		{"base query kept", "http://runner/?region=wls", "/session?token={token}", "http://runner/session?region=wls&token=abc.def"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SURVEY_RUNNER_URL", test.runnerURL)
+			withSetting(t, "SURVEY_RUNNER_SESSION_PATH", test.sessionPath)
+
+			if got := SessionURL("abc.def"); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestHandoffURL(t *testing.T) {
+	withSetting(t, "SURVEY_RUNNER_URL", "http://localhost:5000")
+	withSetting(t, "SURVEY_RUNNER_SESSION_PATH", "/session?token={token}")
+
+	withSetting(t, "RUNNER_HANDOFF_URL", "")
+	if got := HandoffURL("abc"); got != "http://localhost:5000/session?token=abc" {
+		t.Errorf("expected the session URL without RUNNER_HANDOFF_URL, got %s", got)
+	}
+
+	withSetting(t, "RUNNER_HANDOFF_URL", "http://runner:5000/")
+	if got := HandoffURL("abc"); got != "http://runner:5000/session?token=abc" {
+		t.Errorf("expected the RUNNER_HANDOFF_URL session URL, got %s", got)
+	}
+}
+
+func TestFlushURL(t *testing.T) {
+	withSetting(t, "SURVEY_RUNNER_URL", "http://runner/")
+
+	if got := FlushURL("abc"); got != "http://runner/flush?token=abc" {
+		t.Errorf("expected http://runner/flush?token=abc, got %s", got)
+	}
+}
@@ -0,0 +1,94 @@
+package authentication
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"gopkg.in/square/go-jose.v2/json"
+)
+
+// signingKeyPaths returns the additional signing keys configured in JWT_SIGNING_KEYS, keyed by key ID
+func signingKeyPaths() (map[string]string, *KeyLoadError) {
+	keyPaths := make(map[string]string)
+	if settings.Get("JWT_SIGNING_KEYS") == "" {
+		return keyPaths, nil
+	}
+
+	if err := json.Unmarshal([]byte(settings.Get("JWT_SIGNING_KEYS")), &keyPaths); err != nil {
+		return nil, &KeyLoadError{Op: "config", Err: fmt.Sprintf("Failed to parse JWT_SIGNING_KEYS: %v", err)}
+	}
+	return keyPaths, nil
+}
+
+// loadSigningKeyByID loads the signing key with the given ID from JWT_SIGNING_KEYS, stamping it with that ID as its
+// kid, or the default signing key when id is empty
+func loadSigningKeyByID(id string) (*PrivateKeyResult, *KeyLoadError) {
+	if id == "" {
+		return loadSigningKey()
+	}
+
+	keyPaths, keyErr := signingKeyPaths()
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	keyPath, ok := keyPaths[id]
+	if !ok {
+		return nil, &KeyLoadError{Op: "config", Err: fmt.Sprintf("Signing key %s is not configured in JWT_SIGNING_KEYS", id)}
+	}
+
+	privateKeyResult, keyErr := loadSigningKeyFromPath(keyPath)
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	privateKeyResult.kid = id
+	return privateKeyResult, nil
+}
+
+// signingKeyID returns the ID of the signing key mapped in SURVEY_SIGNING_KEYS to the launch's schema name, or else
+// to its survey (the survey claim, or the start of the schema name before the first underscore), or an empty string
+// to use the default signing key
+func signingKeyID(claims map[string]interface{}, launcherSchema surveys.LauncherSchema) string {
+	if settings.Get("SURVEY_SIGNING_KEYS") == "" {
+		return ""
+	}
+
+	var surveyKeys map[string]string
+	if err := json.Unmarshal([]byte(settings.Get("SURVEY_SIGNING_KEYS")), &surveyKeys); err != nil {
+		logging.Error("failed to parse SURVEY_SIGNING_KEYS", "error", err)
+		return ""
+	}
+
+	schemaName, _ := claims["schema_name"].(string)
+	if schemaName == "" {
+		schemaName = launcherSchema.Name
+	}
+	survey, _ := claims["survey"].(string)
+
+	for _, name := range surveyLookupNames(schemaName, survey) {
+		if keyID, ok := surveyKeys[name]; ok {
+			return keyID
+		}
+	}
+	return ""
+}
+
+// surveyLookupNames returns the names settings keyed by schema name or survey are looked up by, in order: the schema
+// name, then the survey, which is the start of the schema name before the first underscore when not given
+func surveyLookupNames(schemaName string, survey string) []string {
+	if survey == "" {
+		survey = strings.SplitN(schemaName, "_", 2)[0]
+	}
+
+	var names []string
+	for _, name := range []string{schemaName, strings.ToLower(survey)} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
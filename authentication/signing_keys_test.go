@@ -0,0 +1,109 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestSigningKeyID(t *testing.T) {
+	withSetting(t, "SURVEY_SIGNING_KEYS", `{"mbs_0106": "key-schema", "mbs": "key-a", "qcas": "key-b"}`)
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		schema surveys.LauncherSchema
+		want   string
+	}{
+		{"schema name", map[string]interface{}{"schema_name": "mbs_0106"}, surveys.LauncherSchema{}, "key-schema"},
+		{"survey from the schema name", map[string]interface{}{"schema_name": "mbs_0001"}, surveys.LauncherSchema{}, "key-a"},
+		{"survey claim", map[string]interface{}{"schema_name": "test_0001", "survey": "QCAS"}, surveys.LauncherSchema{}, "key-b"},
+		{"launcher schema name", map[string]interface{}{}, surveys.LauncherSchema{Name: "qcas_0001"}, "key-b"},
+		{"no mapping", map[string]interface{}{"schema_name": "census_household"}, surveys.LauncherSchema{}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := signingKeyID(test.claims, test.schema); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+
+	t.Run("invalid mapping", func(t *testing.T) {
+		withSetting(t, "SURVEY_SIGNING_KEYS", "not json")
+		if got := signingKeyID(map[string]interface{}{"schema_name": "mbs_0106"}, surveys.LauncherSchema{}); got != "" {
+			t.Errorf("expected the default key, got %q", got)
+		}
+	})
+}
+
+func TestSurveySigningKeys(t *testing.T) {
+	keys := useTestKeys(t)
+	keyA, keyB := newTestKey(t), newTestKey(t)
+	keyPaths, err := json.Marshal(map[string]string{
+		"key-a": writeKeyFile(t, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(keyA)}),
+		"key-b": writeKeyFile(t, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(keyB)}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSetting(t, "JWT_SIGNING_KEYS", string(keyPaths))
+	withSetting(t, "SURVEY_SIGNING_KEYS", `{"mbs": "key-a", "qcas": "key-b"}`)
+
+	tests := []struct {
+		name       string
+		schemaName string
+		wantKey    *rsa.PublicKey
+		wantKID    string
+	}{
+		{"survey A", "mbs_0106", &keyA.PublicKey, "key-a"},
+		{"survey B", "qcas_0001", &keyB.PublicKey, "key-b"},
+		{"unmapped survey", "census_household", keys.VerificationKey, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := map[string]interface{}{"schema_name": test.schemaName}
+			generated, tokenErr := generateTokenFromClaims(context.Background(), claims, signingKeyID(claims, surveys.LauncherSchema{}), TokenOptions{Unencrypted: true})
+			if tokenErr != nil {
+				t.Fatalf("unexpected error: %v", tokenErr)
+			}
+
+			signature, err := jose.ParseSigned(generated.Token)
+			if err != nil {
+				t.Fatalf("failed to parse JWS: %v", err)
+			}
+			if _, err := signature.Verify(test.wantKey); err != nil {
+				t.Errorf("expected the token to be signed with the survey's key: %v", err)
+			}
+
+			kid := signature.Signatures[0].Header.KeyID
+			if kid != generated.SigningKID {
+				t.Errorf("expected the stamped kid %s to be the selected key's, %s", kid, generated.SigningKID)
+			}
+			if test.wantKID != "" && kid != test.wantKID {
+				t.Errorf("expected kid %s, got %s", test.wantKID, kid)
+			}
+		})
+	}
+}
+
+func TestSurveySigningKeyNotConfigured(t *testing.T) {
+	useTestKeys(t)
+	withSetting(t, "JWT_SIGNING_KEYS", "")
+
+	_, tokenErr := generateTokenFromClaims(context.Background(), map[string]interface{}{}, "key-a", TokenOptions{Unencrypted: true})
+	if tokenErr == nil {
+		t.Fatal("expected a signing key missing from JWT_SIGNING_KEYS to be an error")
+	}
+	if keyErr, ok := tokenErr.From.(*KeyLoadError); !ok || keyErr.Op != "config" {
+		t.Errorf("expected a config KeyLoadError, got %v", tokenErr.From)
+	}
+}
@@ -0,0 +1,33 @@
+package authentication
+
+import (
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// themeDefaults adjust the default metadata values for the theme a schema declares. Business defaults are the base
+// values from GetDefaultValues, while social and health surveys are of households rather than businesses.
+var themeDefaults = map[string]map[string]string{
+	"business": {},
+	"social": {
+		"ru_name":         "",
+		"trad_as":         "",
+		"employment_date": "",
+		"case_type":       "HH",
+	},
+	"health": {
+		"ru_name":         "",
+		"trad_as":         "",
+		"employment_date": "",
+		"case_type":       "HH",
+		"participant_id":  "ABC-12345678",
+	},
+}
+
+// defaultsTheme returns the theme whose default metadata values are used for the schema, which is DEFAULTS_THEME
+// when set and otherwise the schema's own theme
+func (schema QuestionnaireSchema) defaultsTheme() string {
+	if theme := settings.Get("DEFAULTS_THEME"); theme != "" {
+		return theme
+	}
+	return schema.Theme
+}
@@ -0,0 +1,51 @@
+package authentication
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+func TestThemeDefaults(t *testing.T) {
+	base, err := GetDefaultValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		theme        string
+		setting      string
+		wantRuName   string
+		wantCaseType string
+	}{
+		{"business", "business", "", base["ru_name"], base["case_type"]},
+		{"social", "social", "", "", "HH"},
+		{"no theme", "", "", base["ru_name"], base["case_type"]},
+		{"DEFAULTS_THEME overrides the schema", "business", "social", "", "HH"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "DEFAULTS_THEME", test.setting)
+			server := schemaServer(t, 200, `{"schema_name": "test_theme", "theme": "`+test.theme+`", "metadata": [
+				{"name": "ru_name", "type": "string"},
+				{"name": "case_type", "type": "string"}
+			]}`)
+
+			metadata, err := GetRequiredMetadata(context.Background(), surveys.LauncherSchema{Name: "test_theme", URL: server.URL + "/test_theme.json"}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defaults := map[string]string{}
+			for _, item := range metadata {
+				defaults[item.Name] = item.Default
+			}
+			if defaults["ru_name"] != test.wantRuName || defaults["case_type"] != test.wantCaseType {
+				t.Errorf("expected ru_name %q and case_type %q, got %v", test.wantRuName, test.wantCaseType, defaults)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package authentication
+
+import (
+	"context"
+	"time"
+)
+
+// Timings records how long each stage of generating a token took
+type Timings struct {
+	// Started is when the launch started, set by ContextWithTimings.
+	Started time.Time
+
+	SchemaFetch     time.Duration
+	Validation      time.Duration
+	TokenGeneration time.Duration
+}
+
+type timingsKey struct{}
+
+// ContextWithTimings returns a context which records the stage timings of any token generated with it into t
+func ContextWithTimings(ctx context.Context, t *Timings) context.Context {
+	if t.Started.IsZero() {
+		t.Started = time.Now()
+	}
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// timingsFromContext returns the Timings to record into, which is discarded if the caller didn't provide one
+func timingsFromContext(ctx context.Context) *Timings {
+	if t, ok := ctx.Value(timingsKey{}).(*Timings); ok {
+		return t
+	}
+	return &Timings{}
+}
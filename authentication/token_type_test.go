@@ -0,0 +1,108 @@
+package authentication
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestTokenTypeHeader(t *testing.T) {
+	keys := useTestKeys(t)
+
+	tests := []struct {
+		name        string
+		typ         string
+		unencrypted bool
+	}{
+		{"default signed", "JWT", true},
+		{"custom signed", "eq+jwt", true},
+		{"default encrypted", "JWT", false},
+		{"custom encrypted", "eq+jwt", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "JWT_TYP", test.typ)
+
+			generated, tokenErr := generateTokenFromClaims(context.Background(), map[string]interface{}{"tx_id": "1"}, "", TokenOptions{Unencrypted: test.unencrypted})
+			if tokenErr != nil {
+				t.Fatalf("unexpected error: %v", tokenErr)
+			}
+
+			signed := generated.Token
+			if !test.unencrypted {
+				encrypted, err := jose.ParseEncrypted(generated.Token)
+				if err != nil {
+					t.Fatalf("failed to parse JWE: %v", err)
+				}
+				if typ := encrypted.Header.ExtraHeaders[jose.HeaderType]; typ != test.typ {
+					t.Errorf("expected JWE typ %s, got %v", test.typ, typ)
+				}
+				payload, err := encrypted.Decrypt(keys.DecryptionKey)
+				if err != nil {
+					t.Fatalf("failed to decrypt JWE: %v", err)
+				}
+				signed = string(payload)
+			}
+
+			signature, err := jose.ParseSigned(signed)
+			if err != nil {
+				t.Fatalf("failed to parse JWS: %v", err)
+			}
+			if typ := signature.Signatures[0].Header.ExtraHeaders[jose.HeaderType]; typ != test.typ {
+				t.Errorf("expected JWS typ %s, got %v", test.typ, typ)
+			}
+		})
+	}
+}
+
+func TestDetachedPayload(t *testing.T) {
+	keys := useTestKeys(t)
+
+	tests := []struct {
+		name         string
+		detached     string
+		unencrypted  bool
+		wantDetached bool
+	}{
+		{"combined", "false", true, false},
+		{"detached", "true", true, true},
+		{"encrypted tokens keep their payload", "true", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "JWT_DETACHED_PAYLOAD", test.detached)
+
+			generated, tokenErr := generateTokenFromClaims(context.Background(), map[string]interface{}{"tx_id": "1"}, "", TokenOptions{Unencrypted: test.unencrypted})
+			if tokenErr != nil {
+				t.Fatalf("unexpected error: %v", tokenErr)
+			}
+			if !test.wantDetached {
+				if generated.Payload != "" || strings.Contains(generated.Token, "..") {
+					t.Errorf("expected a combined token, got %s with payload %q", generated.Token, generated.Payload)
+				}
+				return
+			}
+
+			parts := strings.Split(generated.Token, ".")
+			if len(parts) != 3 || parts[1] != "" || generated.Payload == "" {
+				t.Fatalf("expected header..signature and a payload, got %s with payload %q", generated.Token, generated.Payload)
+			}
+
+			signature, err := jose.ParseSigned(parts[0] + "." + generated.Payload + "." + parts[2])
+			if err != nil {
+				t.Fatalf("failed to parse the reattached token: %v", err)
+			}
+			claims, err := signature.Verify(keys.VerificationKey)
+			if err != nil {
+				t.Fatalf("the reattached token didn't verify: %v", err)
+			}
+			if !strings.Contains(string(claims), `"tx_id":"1"`) {
+				t.Errorf("expected the claims in the payload, got %s", claims)
+			}
+		})
+	}
+}
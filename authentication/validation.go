@@ -0,0 +1,266 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"github.com/gofrs/uuid"
+)
+
+// MetadataError describes a schema metadata claim which is missing or has a value of the wrong type
+type MetadataError struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e MetadataError) Error() string {
+	return e.Name + ": " + e.Reason
+}
+
+// ReasonMissingMetadata is the Reason of a MetadataError for required metadata which wasn't given
+const ReasonMissingMetadata = "missing required metadata"
+
+// ValidateClaims checks a claims map against the metadata required by the schema, without generating a token
+func ValidateClaims(ctx context.Context, launcherSchema surveys.LauncherSchema, claims map[string]interface{}) ([]MetadataError, string) {
+	languageCode, _ := claims["language_code"].(string)
+	requiredMetadata, err := GetRequiredMetadata(ctx, launcherSchema, languageCode)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	return validateMetadataClaims(requiredMetadata, claims), ""
+}
+
+// MetadataCondition is a required_if rule on another metadata value. The condition is met when the value equals
+// Equals, differs from NotEquals, or when neither is given, when the value is present.
+type MetadataCondition struct {
+	Name      string  `json:"name"`
+	Equals    *string `json:"equals,omitempty"`
+	NotEquals *string `json:"not_equals,omitempty"`
+}
+
+func (c MetadataCondition) met(claims map[string]interface{}) bool {
+	value := ""
+	if claim, present := claims[c.Name]; present && claim != nil {
+		value = fmt.Sprint(claim)
+	}
+
+	switch {
+	case c.Equals != nil:
+		return value == *c.Equals
+	case c.NotEquals != nil:
+		return value != *c.NotEquals
+	default:
+		return value != ""
+	}
+}
+
+// required reports whether the metadata must be given, taking any required_if rule into account
+func (metadata Metadata) required(claims map[string]interface{}) bool {
+	if metadata.RequiredIf != nil {
+		return metadata.RequiredIf.met(claims)
+	}
+	return !metadata.Optional
+}
+
+func validateMetadataClaims(requiredMetadata []Metadata, claims map[string]interface{}) []MetadataError {
+	metadataErrors := []MetadataError{}
+
+	for _, metadata := range requiredMetadata {
+		value, present := claims[metadata.Name]
+		if present && value == "" && settings.GetBool("EMPTY_REQUIRED_METADATA") {
+			continue
+		}
+		if !present || value == "" {
+			if metadata.required(claims) {
+				metadataErrors = append(metadataErrors, MetadataError{Name: metadata.Name, Reason: ReasonMissingMetadata})
+			}
+			continue
+		}
+
+		reason := checkMetadataType(metadata.Validator, value)
+		if reason == "" {
+			reason = checkMetadataFormat(metadata.Format, value)
+		}
+		if reason == "" && metadata.Name == "country" {
+			reason = checkCountry(value)
+		}
+		if reason != "" {
+			metadataErrors = append(metadataErrors, MetadataError{Name: metadata.Name, Reason: reason})
+		}
+	}
+
+	return metadataErrors
+}
+
+// unfillableMetadata returns the names of the required metadata which have neither a default nor a value in values,
+// which would be sent empty
+func unfillableMetadata(requiredMetadata []Metadata, values url.Values) []string {
+	given := make(map[string]interface{}, len(values))
+	for name := range values {
+		if value := values.Get(name); value != "" {
+			given[name] = value
+		}
+	}
+
+	var unfillable []string
+	for _, metadata := range requiredMetadata {
+		if metadata.Default == "" && given[metadata.Name] == nil && metadata.required(given) {
+			unfillable = append(unfillable, metadata.Name)
+		}
+	}
+	return unfillable
+}
+
+// validateDateClaims checks each date metadata value given is in the YYYY-MM-DD format the runner expects, so a
+// value such as 01/05/2016 is reported here rather than being rejected by the runner after launching
+func validateDateClaims(requiredMetadata []Metadata, claims map[string]interface{}) []MetadataError {
+	var metadataErrors []MetadataError
+
+	for _, metadata := range requiredMetadata {
+		if metadata.Validator != "date" {
+			continue
+		}
+
+		value, present := claims[metadata.Name]
+		if !present || value == "" {
+			continue
+		}
+
+		if reason := checkMetadataType(metadata.Validator, value); reason != "" {
+			metadataErrors = append(metadataErrors, MetadataError{Name: metadata.Name, Reason: reason})
+		}
+	}
+
+	return metadataErrors
+}
+
+// validateFormatClaims checks each metadata value given matches the format hint of its schema metadata, such as
+// "email" or "uri"
+func validateFormatClaims(requiredMetadata []Metadata, claims map[string]interface{}) []MetadataError {
+	var metadataErrors []MetadataError
+
+	for _, metadata := range requiredMetadata {
+		if metadata.Format == "" {
+			continue
+		}
+
+		value, present := claims[metadata.Name]
+		if !present || value == "" {
+			continue
+		}
+
+		if reason := checkMetadataFormat(metadata.Format, value); reason != "" {
+			metadataErrors = append(metadataErrors, MetadataError{Name: metadata.Name, Reason: reason})
+		}
+	}
+
+	return metadataErrors
+}
+
+// emailPattern is a loose check of an email address, which only rules out values which clearly aren't one
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// checkMetadataFormat returns why value doesn't match the schema metadata's format hint, or an empty string if it
+// does or the format isn't one which is checked
+func checkMetadataFormat(format string, value interface{}) string {
+	switch format {
+	case "email":
+		if v, ok := value.(string); ok && emailPattern.MatchString(v) {
+			return ""
+		}
+		return fmt.Sprintf("expected an email address, got %v", value)
+	case "uri":
+		if v, ok := value.(string); ok {
+			if parsed, err := url.Parse(v); err == nil && parsed.Scheme != "" {
+				return ""
+			}
+		}
+		return fmt.Sprintf("expected an absolute URI, got %v", value)
+	default:
+		return ""
+	}
+}
+
+// checkMetadataType returns why value isn't valid for the schema metadata type, or an empty string if it is
+func checkMetadataType(validator string, value interface{}) string {
+	switch validator {
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return ""
+		case string:
+			if _, err := strconv.ParseBool(v); err == nil {
+				return ""
+			}
+		}
+		return fmt.Sprintf("expected a boolean, got %v", value)
+	case "date":
+		if v, ok := value.(string); ok {
+			if _, err := time.Parse("2006-01-02", v); err == nil {
+				return ""
+			}
+		}
+		return fmt.Sprintf("expected a date in the format YYYY-MM-DD, got %v", value)
+	case "uuid":
+		if v, ok := value.(string); ok {
+			if _, err := uuid.FromString(v); err == nil {
+				return ""
+			}
+		}
+		return fmt.Sprintf("expected a UUID, got %v", value)
+	default:
+		if _, ok := value.(string); !ok {
+			return fmt.Sprintf("expected a string, got %v", value)
+		}
+		return ""
+	}
+}
+
+// validateUserIDClaim checks that a user_id given for the launch isn't empty, as runners can't save a response without
+// one
+func validateUserIDClaim(claims map[string]interface{}) []MetadataError {
+	if value, present := claims["user_id"]; present && value == "" {
+		return []MetadataError{{Name: "user_id", Reason: "must not be empty"}}
+	}
+	return nil
+}
+
+// ruRefPattern is a reporting unit reference, 11 digits followed by its check letter
+var ruRefPattern = regexp.MustCompile(`^[0-9]{11}[A-Za-z]$`)
+
+// validateRuRefClaim checks that a ru_ref given for the launch has its check letter, when VALIDATE_RU_REF is set
+func validateRuRefClaim(claims map[string]interface{}) []MetadataError {
+	if !settings.GetBool("VALIDATE_RU_REF") {
+		return nil
+	}
+
+	value, ok := claims["ru_ref"].(string)
+	if !ok || value == "" || ruRefPattern.MatchString(value) {
+		return nil
+	}
+	return []MetadataError{{Name: "ru_ref", Reason: fmt.Sprintf("expected 11 digits followed by a check letter, such as 12346789012A, got %s", value)}}
+}
+
+// periodIDPattern is a period_id of the form YYYYMM
+var periodIDPattern = regexp.MustCompile(`^[0-9]{4}(0[1-9]|1[0-2])$`)
+
+// validatePeriodIDClaim checks that a period_id given for the launch is a year and month, such as 201605, when
+// VALIDATE_PERIOD_ID is set
+func validatePeriodIDClaim(claims map[string]interface{}) []MetadataError {
+	if !settings.GetBool("VALIDATE_PERIOD_ID") {
+		return nil
+	}
+
+	value, ok := claims["period_id"].(string)
+	if !ok || value == "" || periodIDPattern.MatchString(value) {
+		return nil
+	}
+	return []MetadataError{{Name: "period_id", Reason: fmt.Sprintf("expected a year and month as YYYYMM, such as 201605, got %s", value)}}
+}
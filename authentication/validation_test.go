@@ -0,0 +1,318 @@
+package authentication
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+const validationSchema = `{
+	"schema_name": "test_validation",
+	"metadata": [
+		{"name": "ru_ref", "type": "string"},
+		{"name": "flag", "type": "boolean"},
+		{"name": "ref_p_start_date", "type": "date"},
+		{"name": "trad_as", "type": "string", "optional": true}
+	]
+}`
+
+func TestValidateClaims(t *testing.T) {
+	server := schemaServer(t, 200, validationSchema)
+	launcherSchema := surveys.LauncherSchema{Name: "test_validation", URL: server.URL + "/test_validation.json"}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   []string
+	}{
+		{"valid", map[string]interface{}{"ru_ref": "12346789012A", "flag": true, "ref_p_start_date": "2016-05-01"}, []string{}},
+		{"boolean as a string", map[string]interface{}{"ru_ref": "12346789012A", "flag": "false", "ref_p_start_date": "2016-05-01"}, []string{}},
+		{"missing required", map[string]interface{}{"flag": true}, []string{"ru_ref", "ref_p_start_date"}},
+		{"empty required", map[string]interface{}{"ru_ref": "", "flag": true, "ref_p_start_date": "2016-05-01"}, []string{"ru_ref"}},
+		{"wrong types", map[string]interface{}{"ru_ref": 12346789012, "flag": "maybe", "ref_p_start_date": "01/05/2016"}, []string{"ru_ref", "flag", "ref_p_start_date"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metadataErrors, err := ValidateClaims(context.Background(), launcherSchema, test.claims)
+			if err != "" {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := metadataErrorNames(metadataErrors); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected errors for %v, got %+v", test.want, metadataErrors)
+			}
+		})
+	}
+}
+
+func TestValidateClaimsSchemaError(t *testing.T) {
+	server := schemaServer(t, 404, `{}`)
+
+	if _, err := ValidateClaims(context.Background(), surveys.LauncherSchema{Name: "test", URL: server.URL + "/test.json"}, nil); err == "" {
+		t.Error("expected an error when the schema can't be loaded")
+	}
+}
+
+func TestValidateDateClaims(t *testing.T) {
+	metadata := []Metadata{{Name: "ref_p_start_date", Validator: "date"}, {Name: "ru_ref", Validator: "string"}}
+
+	tests := []struct {
+		name       string
+		value      interface{}
+		wantReason string
+	}{
+		{"valid date", "2016-05-01", ""},
+		{"wrong format", "01/05/2016", "expected a date in the format YYYY-MM-DD, got 01/05/2016"},
+		{"not a date", "last May", "expected a date in the format YYYY-MM-DD, got last May"},
+		{"impossible date", "2016-02-30", "expected a date in the format YYYY-MM-DD, got 2016-02-30"},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metadataErrors := validateDateClaims(metadata, map[string]interface{}{"ref_p_start_date": test.value, "ru_ref": "01/05/2016"})
+
+			if test.wantReason == "" {
+				if len(metadataErrors) != 0 {
+					t.Errorf("expected no errors, got %+v", metadataErrors)
+				}
+				return
+			}
+			if len(metadataErrors) != 1 || metadataErrors[0].Name != "ref_p_start_date" || metadataErrors[0].Reason != test.wantReason {
+				t.Errorf("expected %q for ref_p_start_date, got %+v", test.wantReason, metadataErrors)
+			}
+		})
+	}
+}
+
+func TestLaunchWithInvalidDate(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_validation": validationSchema})
+
+	values := url.Values{"schema_name": {"test_validation"}, "ru_ref": {"12346789012A"}, "ref_p_start_date": {"01/05/2016"}}
+	_, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+	if launchErr == nil || launchErr.Kind != LaunchErrorMetadata {
+		t.Fatalf("expected a metadata error, got %v", launchErr)
+	}
+	if len(launchErr.Fields) != 1 || launchErr.Fields[0].Name != "ref_p_start_date" || !strings.Contains(launchErr.Fields[0].Reason, "YYYY-MM-DD") {
+		t.Errorf("expected the error to name ref_p_start_date and its format, got %+v", launchErr.Fields)
+	}
+}
+
+func TestValidateRequiredIf(t *testing.T) {
+	server := schemaServer(t, 200, `{
+		"schema_name": "test_required_if",
+		"metadata": [
+			{"name": "ru_name", "type": "string", "optional": true},
+			{"name": "trad_as", "type": "string", "required_if": {"name": "ru_name", "not_equals": "ESSENTIAL ENTERPRISE LTD."}},
+			{"name": "region_code", "type": "string", "optional": true},
+			{"name": "display_address", "type": "string", "required_if": {"name": "region_code", "equals": "GB-NIR"}},
+			{"name": "case_type", "type": "string", "optional": true},
+			{"name": "case_ref", "type": "string", "required_if": {"name": "case_type"}}
+		]
+	}`)
+	launcherSchema := surveys.LauncherSchema{Name: "test_required_if", URL: server.URL + "/test_required_if.json"}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   []string
+	}{
+		{"not_equals met", map[string]interface{}{"ru_name": "OTHER LTD."}, []string{"trad_as"}},
+		{"not_equals met and given", map[string]interface{}{"ru_name": "OTHER LTD.", "trad_as": "OTHER"}, []string{}},
+		{"not_equals not met", map[string]interface{}{"ru_name": "ESSENTIAL ENTERPRISE LTD."}, []string{}},
+		{"equals met", map[string]interface{}{"ru_name": "ESSENTIAL ENTERPRISE LTD.", "region_code": "GB-NIR"}, []string{"display_address"}},
+		{"equals not met", map[string]interface{}{"ru_name": "ESSENTIAL ENTERPRISE LTD.", "region_code": "GB-ENG"}, []string{}},
+		{"present met", map[string]interface{}{"ru_name": "ESSENTIAL ENTERPRISE LTD.", "case_type": "HH"}, []string{"case_ref"}},
+		{"present not met", map[string]interface{}{"ru_name": "ESSENTIAL ENTERPRISE LTD.", "case_type": ""}, []string{}},
+		{"conditional value is still type checked", map[string]interface{}{"ru_name": "ESSENTIAL ENTERPRISE LTD.", "trad_as": 12}, []string{"trad_as"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metadataErrors, err := ValidateClaims(context.Background(), launcherSchema, test.claims)
+			if err != "" {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := metadataErrorNames(metadataErrors); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected errors for %v, got %+v", test.want, metadataErrors)
+			}
+		})
+	}
+}
+
+func TestUnfillableMetadataRequiredIf(t *testing.T) {
+	requiredMetadata := []Metadata{
+		{Name: "ru_name", Optional: true},
+		{Name: "trad_as", RequiredIf: &MetadataCondition{Name: "ru_name"}},
+	}
+
+	tests := []struct {
+		name   string
+		values url.Values
+		want   []string
+	}{
+		{"condition met", url.Values{"ru_name": {"OTHER LTD."}}, []string{"trad_as"}},
+		{"condition not met", url.Values{}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := unfillableMetadata(requiredMetadata, test.values); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateRuRef(t *testing.T) {
+	useTestKeys(t)
+	server := schemaServer(t, 200, defaultsSchema)
+
+	tests := []struct {
+		name      string
+		enabled   string
+		ruRef     []string
+		wantError bool
+	}{
+		{"default", "true", nil, false},
+		{"valid", "true", []string{"49900000001F"}, false},
+		{"lowercase check letter", "true", []string{"49900000001f"}, false},
+		{"no check letter", "true", []string{"499000000012"}, true},
+		{"too short", "true", []string{"4990001F"}, true},
+		{"malformed but not validated", "false", []string{"not a ru_ref"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "VALIDATE_RU_REF", test.enabled)
+			values := url.Values{}
+			if test.ruRef != nil {
+				values["ru_ref"] = test.ruRef
+			}
+
+			_, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_defaults.json", "", "", values, TokenOptions{DryRun: true})
+			if !test.wantError {
+				if launchErr != nil {
+					t.Errorf("unexpected error: %v", launchErr)
+				}
+				return
+			}
+			if launchErr == nil || !reflect.DeepEqual(metadataErrorNames(launchErr.Fields), []string{"ru_ref"}) {
+				t.Errorf("expected a ru_ref error, got %v", launchErr)
+			}
+		})
+	}
+}
+
+func TestValidatePeriodID(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_roundtrip": roundTripSchema})
+
+	tests := []struct {
+		name      string
+		enabled   string
+		periodID  string
+		wantError bool
+	}{
+		{"valid", "true", "201605", false},
+		{"december", "true", "201612", false},
+		{"implausible month", "true", "201813", true},
+		{"month zero", "true", "201800", true},
+		{"too short", "true", "20165", true},
+		{"not digits", "true", "May 2016", true},
+		{"malformed but not validated", "false", "201813", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "VALIDATE_PERIOD_ID", test.enabled)
+			values := url.Values{"schema_name": {"test_roundtrip"}, "ru_ref": {"12346789012A"}, "period_id": {test.periodID}}
+
+			_, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if !test.wantError {
+				if launchErr != nil {
+					t.Errorf("unexpected error: %v", launchErr)
+				}
+				return
+			}
+			if launchErr == nil || !reflect.DeepEqual(metadataErrorNames(launchErr.Fields), []string{"period_id"}) {
+				t.Errorf("expected a period_id error, got %v", launchErr)
+			}
+		})
+	}
+}
+
+func TestValidateFormatClaims(t *testing.T) {
+	runnerSchemas(t, map[string]string{"test_format": `{"schema_name": "test_format", "metadata": [
+		{"name": "ru_ref", "type": "string"},
+		{"name": "email", "type": "string", "format": "email", "optional": true},
+		{"name": "website", "type": "string", "format": "uri", "optional": true}
+	]}`})
+
+	tests := []struct {
+		name       string
+		values     url.Values
+		wantErrors []string
+	}{
+		{"valid email", url.Values{"email": {"respondent@example.com"}}, nil},
+		{"invalid email", url.Values{"email": {"respondent.example.com"}}, []string{"email"}},
+		{"valid uri", url.Values{"website": {"https://example.com/survey"}}, nil},
+		{"relative uri", url.Values{"website": {"example.com/survey"}}, []string{"website"}},
+		{"not given", url.Values{}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {"test_format"}, "ru_ref": {"12346789012A"}}
+			for name, value := range test.values {
+				values[name] = value
+			}
+
+			_, launchErr := GenerateLaunch(context.Background(), "", values, TokenOptions{DryRun: true})
+			if test.wantErrors == nil {
+				if launchErr != nil {
+					t.Errorf("unexpected error: %v", launchErr)
+				}
+				return
+			}
+			if launchErr == nil || !reflect.DeepEqual(metadataErrorNames(launchErr.Fields), test.wantErrors) {
+				t.Errorf("expected errors for %v, got %v", test.wantErrors, launchErr)
+			}
+		})
+	}
+}
+
+func TestQuickLaunchUnfillableMetadataWarning(t *testing.T) {
+	useTestKeys(t)
+	server := schemaServer(t, 200, defaultsSchema)
+
+	tests := []struct {
+		name        string
+		values      url.Values
+		wantWarning bool
+	}{
+		{"unfillable", url.Values{}, true},
+		{"fully fillable", url.Values{"no_default": {"given"}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			launch, launchErr := GenerateLaunchFromDefaults(context.Background(), server.URL+"/test_defaults.json", "", "", test.values, TokenOptions{DryRun: true})
+			if launchErr != nil {
+				t.Fatalf("unexpected error: %v", launchErr)
+			}
+			if !test.wantWarning {
+				if len(launch.Warnings) != 0 {
+					t.Errorf("expected no warnings, got %v", launch.Warnings)
+				}
+				return
+			}
+			if len(launch.Warnings) != 1 || !strings.HasSuffix(launch.Warnings[0], ": no_default") {
+				t.Errorf("expected a warning naming no_default, got %v", launch.Warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2/json"
+)
+
+// validatorServer responds to each validation with the next of statuses, repeating the last, and counts the attempts
+func validatorServer(t *testing.T, statuses ...int) *int32 {
+	t.Helper()
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := int(atomic.AddInt32(&attempts, 1))
+		if attempt > len(statuses) {
+			attempt = len(statuses)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statuses[attempt-1])
+		w.Write([]byte(`{"errors": ["metadata is required"]}`))
+	}))
+	t.Cleanup(server.Close)
+	withSetting(t, "SCHEMA_VALIDATOR_URL", server.URL)
+	return &attempts
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      string
+		statuses     []int
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{"valid", "0", []int{200}, 0, 1},
+		{"invalid", "2", []int{400}, 400, 1},
+		{"validator failure", "0", []int{500}, 500, 1},
+		{"validator failure retried", "2", []int{500, 502, 200}, 0, 3},
+		{"retries exhausted", "1", []int{500}, 500, 2},
+		{"transient unavailable", "2", []int{503, 200}, 0, 2},
+		{"unprocessable not retried", "2", []int{422}, 422, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "VALIDATOR_RETRIES", test.retries)
+			attempts := validatorServer(t, test.statuses...)
+
+			err := validateSchema(context.Background(), json.RawMessage(roundTripSchema))
+
+			var validatorErr *ValidatorError
+			switch {
+			case test.wantStatus == 0 && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.wantStatus != 0 && (!errors.As(err, &validatorErr) || validatorErr.StatusCode != test.wantStatus):
+				t.Errorf("expected a %d ValidatorError, got %v", test.wantStatus, err)
+			case test.wantStatus != 0 && !strings.Contains(validatorErr.Body, "metadata is required"):
+				t.Errorf("expected the validator's response in the error, got %q", validatorErr.Body)
+			}
+			if got := atomic.LoadInt32(attempts); got != test.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", test.wantAttempts, got)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaDisabled(t *testing.T) {
+	withSetting(t, "SCHEMA_VALIDATOR_URL", "")
+
+	if err := validateSchema(context.Background(), json.RawMessage(`not even JSON`)); err != nil {
+		t.Errorf("expected no validation without SCHEMA_VALIDATOR_URL, got %v", err)
+	}
+}
+
+func TestValidateSchemaStreamsLargeSchema(t *testing.T) {
+	payload := json.RawMessage(`{"metadata": [], "padding": "` + strings.Repeat("x", 8<<20) + `"}`)
+	want := sha256.Sum256(payload)
+
+	var received [sha256.Size]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hashed as it is read, so the validator doesn't hold a copy either
+		hash := sha256.New()
+		io.Copy(hash, r.Body)
+		copy(received[:], hash.Sum(nil))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	withSetting(t, "SCHEMA_VALIDATOR_URL", server.URL)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	err := validateSchema(context.Background(), payload)
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(received[:], want[:]) {
+		t.Error("expected the validator to receive the schema unchanged")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > uint64(len(payload)/2) {
+		t.Errorf("expected the %d byte schema to be streamed, but %d bytes were allocated", len(payload), allocated)
+	}
+}
+
+func TestValidateSchemaTimeout(t *testing.T) {
+	withSetting(t, "VALIDATOR_RETRIES", "0")
+	withSetting(t, "SCHEMA_VALIDATOR_TIMEOUT", "50ms")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+	withSetting(t, "SCHEMA_VALIDATOR_URL", server.URL)
+
+	start := time.Now()
+	err := validateSchema(context.Background(), json.RawMessage(roundTripSchema))
+	if err == nil {
+		t.Fatal("expected a hung validator to fail validation")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected validation to give up after SCHEMA_VALIDATOR_TIMEOUT, took %s", elapsed)
+	}
+
+	var validatorErr *ValidatorError
+	if errors.As(err, &validatorErr) {
+		t.Errorf("expected a timeout rather than the validator's response, got %v", err)
+	}
+}
+
+func TestValidateSchemaOversizedErrorBody(t *testing.T) {
+	withSetting(t, "VALIDATOR_RETRIES", "0")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(strings.Repeat("x", 1<<20)))
+	}))
+	t.Cleanup(server.Close)
+	withSetting(t, "SCHEMA_VALIDATOR_URL", server.URL)
+
+	err := validateSchema(context.Background(), json.RawMessage(roundTripSchema))
+
+	var validatorErr *ValidatorError
+	if !errors.As(err, &validatorErr) || validatorErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a 400 ValidatorError, got %v", err)
+	}
+	if len(validatorErr.Body) == 0 || len(validatorErr.Body) > 1024 {
+		t.Errorf("expected the start of the response in the error, got %d bytes", len(validatorErr.Body))
+	}
+}
@@ -0,0 +1,39 @@
+package authentication
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestVersionClaim(t *testing.T) {
+	runnerSchemas(t, map[string]string{
+		"test_roundtrip": roundTripSchema,
+		"test_versioned": `{"schema_name": "test_versioned", "version": "v2", "metadata": [{"name": "ru_ref", "type": "string"}]}`,
+		"test_numbered":  `{"schema_name": "test_numbered", "version": 3, "metadata": [{"name": "ru_ref", "type": "string"}]}`,
+	})
+
+	tests := []struct {
+		name       string
+		schemaName string
+		version    string
+		want       interface{}
+	}{
+		{"supplied", "test_versioned", "v1", "v1"},
+		{"from the schema", "test_versioned", "", "v2"},
+		{"numeric schema version", "test_numbered", "", "3"},
+		{"absent", "test_roundtrip", "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := url.Values{"schema_name": {test.schemaName}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}}
+			if test.version != "" {
+				values.Set("version", test.version)
+			}
+
+			if got := dryRunLaunch(t, values).Claims["version"]; got != test.want {
+				t.Errorf("expected version %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+// defaultBulkMetadata pre-fills the shared metadata on the bulk launch form
+const defaultBulkMetadata = "ru_ref=12346789012A\nlanguage_code=en\nroles=dumper"
+
+type bulkPage struct {
+	BasePath   string
+	Schemas    surveys.LauncherSchemas
+	SchemaName string
+	Count      int
+	MaxCount   int
+	Metadata   string
+	Launches   []bulkLaunch
+	CSV        template.URL
+}
+
+// bulkLaunch is one row of the bulk launch results, with the identifiers researchers need to map participants to
+// responses
+type bulkLaunch struct {
+	Number     int    `json:"number"`
+	ResponseID string `json:"response_id"`
+	CaseID     string `json:"case_id"`
+	UserID     string `json:"user_id"`
+	TxID       string `json:"tx_id"`
+	LaunchURL  string `json:"launch_url,omitempty"`
+
+	// Token and Error are only included in CSV and JSON responses, which report each launch's own failure.
+	Token string `json:"token,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func getBulkLaunchHandler(w http.ResponseWriter, r *http.Request) {
+	serveTemplate("bulk.html", bulkPage{
+		BasePath: basePath(r),
+		Schemas:  surveys.GetAvailableSchemas(r.Context()),
+		Count:    10,
+		MaxCount: settings.GetInt("MAX_BULK_LAUNCHES"),
+		Metadata: defaultBulkMetadata,
+	}, w, r)
+}
+
+// postBulkLaunchHandler generates a number of launches of one schema with the same metadata, each with its own
+// response_id, case_id and user_id, and lists their launch URLs
+func postBulkLaunchHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyFailure(w, r, err, "The bulk launch form could not be read.")
+		return
+	}
+
+	maxCount := settings.GetInt("MAX_BULK_LAUNCHES")
+	count, err := strconv.Atoi(r.PostForm.Get("count"))
+	if err != nil || count < 1 || count > maxCount {
+		writeRequestFailure(w, r, http.StatusBadRequest, fmt.Sprintf("The number of launches must be between 1 and %d.", maxCount))
+		return
+	}
+
+	schemaName := r.PostForm.Get("schema_name")
+	if schemaName == "" {
+		writeRequestFailure(w, r, http.StatusBadRequest, "Select a schema to launch.")
+		return
+	}
+
+	metadata := r.PostForm.Get("metadata")
+	shared, err := parseBulkMetadata(metadata)
+	if err != nil {
+		writeRequestFailure(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	shared.Set("schema_name", schemaName)
+	if shared.Get("collection_exercise_sid") == "" {
+		collectionExerciseSid, err := authentication.NewIdentifier()
+		if err != nil {
+			writeLaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: err.Error()}, schemaName)
+			return
+		}
+		shared.Set("collection_exercise_sid", collectionExerciseSid)
+	}
+
+	values := make([]url.Values, count)
+	for i := range values {
+		if values[i], err = bulkLaunchValues(shared); err != nil {
+			writeLaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: err.Error()}, schemaName)
+			return
+		}
+	}
+
+	if wantsBulkCSV(r) || wantsJSON(r) {
+		writeBulkLaunchResults(w, r, schemaName, values)
+		return
+	}
+
+	timings := &authentication.Timings{}
+	launches, launchErr := authentication.GenerateLaunches(authentication.ContextWithTimings(r.Context(), timings), "", values, authentication.TokenOptions{})
+	recordLaunch(r, schemaName, timings, nil, launchErr)
+	if launchErr != nil {
+		writeLaunchFailure(w, r, launchErr, schemaName)
+		return
+	}
+	for _, launch := range launches {
+		auditLaunch(r, launch, schemaName)
+	}
+
+	page := bulkPage{
+		BasePath:   basePath(r),
+		Schemas:    surveys.GetAvailableSchemas(r.Context()),
+		SchemaName: schemaName,
+		Count:      count,
+		MaxCount:   maxCount,
+		Metadata:   metadata,
+	}
+	for i, launch := range launches {
+		page.Launches = append(page.Launches, bulkLaunch{
+			Number:     i + 1,
+			ResponseID: values[i].Get("response_id"),
+			CaseID:     values[i].Get("case_id"),
+			UserID:     values[i].Get("user_id"),
+			TxID:       values[i].Get("tx_id"),
+			LaunchURL:  launch.URL,
+		})
+	}
+
+	csvURL, err := bulkLaunchesCSV(page.Launches)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to write bulk launches CSV", "error", err)
+	}
+	page.CSV = csvURL
+
+	w.Header().Set("Cache-Control", "no-store")
+	serveTemplate("bulk.html", page, w, r)
+}
+
+// wantsBulkCSV reports whether the request asks for the launches as CSV, through its Accept header or a format=csv
+// parameter
+func wantsBulkCSV(r *http.Request) bool {
+	return accepts(r, "text/csv") || r.URL.Query().Get("format") == "csv"
+}
+
+// writeBulkLaunchResults responds with each launch's token, or why it failed, as CSV or JSON for tools which load
+// samples. Only a failure to load the schema fails the whole response.
+func writeBulkLaunchResults(w http.ResponseWriter, r *http.Request, schemaName string, values []url.Values) {
+	launches, launchErr := generateBulkLaunchResults(r, "", schemaName, values, authentication.TokenOptions{})
+	if launchErr != nil {
+		writeLaunchFailure(w, r, launchErr, schemaName)
+		return
+	}
+	writeBulkLaunches(w, r, launches)
+}
+
+// generateBulkLaunchResults generates a launch for each set of values, listing each one's token or why it failed
+func generateBulkLaunchResults(r *http.Request, schemaURL string, schemaName string, values []url.Values, options authentication.TokenOptions) ([]bulkLaunch, *authentication.LaunchError) {
+	timings := &authentication.Timings{}
+	results, launchErr := authentication.GenerateLaunchResults(authentication.ContextWithTimings(r.Context(), timings), schemaURL, values, options)
+	recordLaunch(r, schemaName, timings, nil, launchErr)
+	if launchErr != nil {
+		return nil, launchErr
+	}
+
+	launches := make([]bulkLaunch, len(results))
+	for i, result := range results {
+		launches[i] = bulkLaunch{
+			Number:     i + 1,
+			ResponseID: values[i].Get("response_id"),
+			CaseID:     values[i].Get("case_id"),
+			UserID:     values[i].Get("user_id"),
+			TxID:       values[i].Get("tx_id"),
+		}
+		if result.Err != nil {
+			launches[i].Error = fmt.Sprintf("%s: %s", result.Err.Kind, result.Err.Desc)
+			continue
+		}
+		auditLaunch(r, result.Launch, schemaName)
+		launches[i].Token = result.Launch.Token
+		launches[i].LaunchURL = result.Launch.URL
+	}
+	return launches, nil
+}
+
+// writeBulkLaunches responds with the launches as CSV when wantsBulkCSV, or else as JSON
+func writeBulkLaunches(w http.ResponseWriter, r *http.Request, launches []bulkLaunch) {
+	w.Header().Set("Cache-Control", "no-store")
+	if !wantsBulkCSV(r) {
+		writeJSON(w, r, http.StatusOK, launches)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="bulk-launches.csv"`)
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"number", "response_id", "case_id", "user_id", "tx_id", "token", "launch_url", "error"})
+	for _, launch := range launches {
+		writer.Write([]string{strconv.Itoa(launch.Number), launch.ResponseID, launch.CaseID, launch.UserID, launch.TxID, launch.Token, launch.LaunchURL, launch.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write bulk launches CSV", "error", err)
+	}
+}
+
+// parseBulkMetadata reads name=value lines into launch values, with repeated names giving a list such as roles
+func parseBulkMetadata(metadata string) (url.Values, error) {
+	values := url.Values{}
+
+	for i, line := range strings.Split(metadata, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		separator := strings.Index(line, "=")
+		if separator < 1 {
+			return nil, fmt.Errorf("Line %d of the metadata should be name=value.", i+1)
+		}
+		values.Add(strings.TrimSpace(line[:separator]), strings.TrimSpace(line[separator+1:]))
+	}
+
+	return values, nil
+}
+
+// bulkLaunchValues copies the shared values, adding the identifiers which must be unique to each launch
+func bulkLaunchValues(shared url.Values) (url.Values, error) {
+	values := url.Values{}
+	for name, value := range shared {
+		values[name] = append([]string(nil), value...)
+	}
+
+	values.Set("response_id", randomNumericString(16))
+	values.Set("questionnaire_id", randomNumericString(16))
+	for _, name := range []string{"case_id", "user_id", "tx_id"} {
+		id, err := authentication.NewIdentifier()
+		if err != nil {
+			return nil, err
+		}
+		values.Set(name, id)
+	}
+
+	return values, nil
+}
+
+// bulkLaunchesCSV returns the launches as a CSV data URL, so the download matches the launches shown on the page
+func bulkLaunchesCSV(launches []bulkLaunch) (template.URL, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	writer.Write([]string{"number", "response_id", "case_id", "user_id", "tx_id", "launch_url"})
+	for _, launch := range launches {
+		writer.Write([]string{strconv.Itoa(launch.Number), launch.ResponseID, launch.CaseID, launch.UserID, launch.TxID, launch.LaunchURL})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
+
+	// The content is generated here rather than taken from the request, so is safe to use as a URL
+	return template.URL("data:text/csv;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes())), nil
+}
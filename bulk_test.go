@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBulkLaunchValues(t *testing.T) {
+	shared := url.Values{"ru_ref": {"12346789012A"}, "roles": {"dumper", "flusher"}}
+
+	first, err := bulkLaunchValues(shared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := bulkLaunchValues(shared)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"response_id", "questionnaire_id", "case_id", "user_id", "tx_id"} {
+		if first.Get(name) == "" || first.Get(name) == second.Get(name) {
+			t.Errorf("expected each launch to have its own %s, got %q and %q", name, first.Get(name), second.Get(name))
+		}
+	}
+	if len(first["roles"]) != 2 || first.Get("ru_ref") != "12346789012A" {
+		t.Errorf("expected the shared values to be copied, got %v", first)
+	}
+
+	first.Add("roles", "extra")
+	if len(shared["roles"]) != 2 {
+		t.Error("expected the shared values not to be changed by a launch's values")
+	}
+}
+
+func TestParseBulkMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  string
+		want      url.Values
+		wantError bool
+	}{
+		{"name=value lines", "ru_ref=12346789012A\nlanguage_code=en", url.Values{"ru_ref": {"12346789012A"}, "language_code": {"en"}}, false},
+		{"repeated names", "roles=dumper\nroles=flusher", url.Values{"roles": {"dumper", "flusher"}}, false},
+		{"blank lines and spaces", "\n  ru_ref = 1 \n\n", url.Values{"ru_ref": {"1"}}, false},
+		{"missing separator", "ru_ref", nil, true},
+		{"missing name", "=1", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := parseBulkMetadata(test.metadata)
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+			if test.wantError {
+				return
+			}
+			if values.Encode() != test.want.Encode() {
+				t.Errorf("expected %v, got %v", test.want, values)
+			}
+		})
+	}
+}
+
+func TestBulkLaunchResults(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		accept    string
+		startDate string
+		wantError string
+	}{
+		{"CSV by format", "?format=csv", "", "2016-05-01", ""},
+		{"CSV by Accept", "", "text/csv", "2016-05-01", ""},
+		{"error with a comma and quotes", "?format=csv", "", `not, a "date"`, `ref_p_start_date: expected a date in the format YYYY-MM-DD, got not, a "date"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			form := url.Values{
+				"count":       {"2"},
+				"schema_name": {"test_launch"},
+				"metadata":    {"ru_ref=12346789012A\nperiod_id=201605\nref_p_start_date=" + test.startDate},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/bulk"+test.query, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+
+			recorder := route(t, req)
+			if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/csv") {
+				t.Fatalf("expected CSV, got %d %s: %s", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body)
+			}
+
+			records, err := csv.NewReader(recorder.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("failed to read the CSV: %v", err)
+			}
+			if len(records) != 3 {
+				t.Fatalf("expected a header and 2 launches, got %v", records)
+			}
+			for _, record := range records[1:] {
+				token, errorMessage := record[5], record[7]
+				if test.wantError == "" && (token == "" || errorMessage != "") {
+					t.Errorf("expected a token and no error, got %v", record)
+				}
+				if test.wantError != "" && (token != "" || !strings.HasSuffix(errorMessage, test.wantError)) {
+					t.Errorf("expected the error %q, got %v", test.wantError, record)
+				}
+			}
+		})
+	}
+}
+
+// postBulkForm posts values to the bulk launch form
+func postBulkForm(t *testing.T, values url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/bulk", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return route(t, req)
+}
+
+func TestPostBulkLaunch(t *testing.T) {
+	runner := useRunner(t)
+
+	recorder := postBulkForm(t, url.Values{
+		"count":       {"3"},
+		"schema_name": {"test_launch"},
+		"metadata":    {"ru_ref=12346789012A\nperiod_id=201605\nroles=dumper\nroles=flusher"},
+	})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	launchURLs := regexp.MustCompile(`href="([^"]*/session\?token=[^"]*)"`).FindAllStringSubmatch(recorder.Body.String(), -1)
+	if len(launchURLs) != 3 {
+		t.Fatalf("expected 3 launch URLs, got %d", len(launchURLs))
+	}
+	responseIDs := make(map[interface{}]bool)
+	for _, match := range launchURLs {
+		claims := sessionClaims(t, runner, html.UnescapeString(match[1]))
+		if claims["ru_ref"] != "12346789012A" || len(claims["roles"].([]interface{})) != 2 {
+			t.Errorf("expected the shared metadata in each launch, got %v", claims)
+		}
+		responseIDs[claims["response_id"]] = true
+	}
+	if len(responseIDs) != 3 {
+		t.Errorf("expected each launch to have its own response_id, got %v", responseIDs)
+	}
+}
+
+func TestPostBulkLaunchInvalid(t *testing.T) {
+	useRunner(t)
+	withSetting(t, "MAX_BULK_LAUNCHES", "5")
+
+	tests := []struct {
+		name   string
+		values url.Values
+	}{
+		{"no launches", url.Values{"count": {"0"}, "schema_name": {"test_launch"}}},
+		{"over the maximum", url.Values{"count": {"6"}, "schema_name": {"test_launch"}}},
+		{"no schema", url.Values{"count": {"1"}}},
+		{"metadata without a value", url.Values{"count": {"1"}, "schema_name": {"test_launch"}, "metadata": {"ru_ref"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := postBulkForm(t, test.values); recorder.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", recorder.Code)
+			}
+		})
+	}
+}
+
+func TestBatchTokenAPI(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		accept    string
+		startDate string
+		wantError string
+	}{
+		{"JSON", "", "", "2016-05-01", ""},
+		{"CSV by format", "?format=csv", "", "2016-05-01", ""},
+		{"CSV by Accept", "", "text/csv", "2016-05-01", ""},
+		{"error with a comma and quotes", "?format=csv", "", `not, a "date"`, `ref_p_start_date: expected a date in the format YYYY-MM-DD, got not, a "date"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"schema_name": "test_launch", "count": 2, "claims": {"ru_ref": "12346789012A", "period_id": "201605", "ref_p_start_date": %q}}`, test.startDate)
+			req := httptest.NewRequest(http.MethodPost, "/api/token/batch"+test.query, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			recorder := route(t, req)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+			}
+
+			var records [][]string
+			if test.query == "" && test.accept == "" {
+				var launches []bulkLaunch
+				decodeResponse(t, recorder, &launches)
+				for _, launch := range launches {
+					records = append(records, []string{"", launch.ResponseID, "", "", "", launch.Token, launch.LaunchURL, launch.Error})
+				}
+			} else {
+				if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/csv") {
+					t.Fatalf("expected CSV, got %s: %s", recorder.Header().Get("Content-Type"), recorder.Body)
+				}
+				all, err := csv.NewReader(recorder.Body).ReadAll()
+				if err != nil {
+					t.Fatalf("failed to read the CSV: %v", err)
+				}
+				records = all[1:]
+			}
+
+			if len(records) != 2 || records[0][1] == records[1][1] {
+				t.Fatalf("expected 2 launches with their own response_id, got %v", records)
+			}
+			for _, record := range records {
+				token, errorMessage := record[5], record[7]
+				if test.wantError == "" && (token == "" || errorMessage != "") {
+					t.Errorf("expected a token and no error, got %v", record)
+				}
+				if test.wantError != "" && (token != "" || !strings.HasSuffix(errorMessage, test.wantError)) {
+					t.Errorf("expected the error %q, got %v", test.wantError, record)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchTokenAPIErrors(t *testing.T) {
+	useRunner(t)
+	withSetting(t, "MAX_BULK_LAUNCHES", "5")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid JSON", `{"schema_name": `, http.StatusBadRequest, errorInvalidRequest},
+		{"no launches", `{"schema_name": "test_launch", "count": 0}`, http.StatusBadRequest, errorInvalidRequest},
+		{"over the maximum", `{"schema_name": "test_launch", "count": 6}`, http.StatusBadRequest, errorInvalidRequest},
+		{"no schema", `{"count": 1}`, http.StatusBadRequest, errorInvalidRequest},
+		{"invalid exp", `{"schema_name": "test_launch", "count": 1, "options": {"exp": "soon"}}`, http.StatusBadRequest, errorInvalidRequest},
+		{"unknown schema", `{"schema_name": "test_missing", "count": 1}`, http.StatusNotFound, "schema_not_found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/token/batch?format=csv", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "text/html")
+			recorder := route(t, req)
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			var response apiErrorResponse
+			decodeResponse(t, recorder, &response)
+			if response.Error.Code != test.wantCode || response.Error.Message == "" {
+				t.Errorf("expected a %s error, got %+v", test.wantCode, response.Error)
+			}
+		})
+	}
+}
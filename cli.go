@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// claimFlags collects repeated --claim name=value flags
+type claimFlags url.Values
+
+func (c claimFlags) String() string {
+	return url.Values(c).Encode()
+}
+
+func (c claimFlags) Set(claim string) error {
+	separator := strings.Index(claim, "=")
+	if separator < 1 {
+		return fmt.Errorf("expected name=value, got %q", claim)
+	}
+	url.Values(c).Add(claim[:separator], claim[separator+1:])
+	return nil
+}
+
+// runTokenCommand generates a single token through the same pipeline as the launch form, printing it (or its claims
+// with --dry-run) to stdout. It returns the exit code for the process.
+func runTokenCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	schemaName := flags.String("schema-name", "", "name of the schema to launch")
+	schemaURL := flags.String("schema-url", "", "URL of the schema to launch, instead of --schema-name")
+	claimsJSON := flags.String("claims-json", "", "JSON object of claim values")
+	lifetime := flags.Duration("exp", 0, "how long the token is valid for, e.g. 1h")
+	dryRun := flags.Bool("dry-run", false, "print the claims instead of the token")
+	claims := claimFlags{}
+	flags.Var(claims, "claim", "claim value as name=value, repeated for each claim or list item")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if (*schemaName == "") == (*schemaURL == "") {
+		fmt.Fprintln(stderr, "exactly one of --schema-name or --schema-url is required")
+		return 2
+	}
+
+	values := url.Values{}
+	if *claimsJSON != "" {
+		var jsonClaims map[string]interface{}
+		decoder := json.NewDecoder(strings.NewReader(*claimsJSON))
+		decoder.UseNumber()
+		if err := decoder.Decode(&jsonClaims); err != nil {
+			fmt.Fprintf(stderr, "invalid --claims-json: %v\n", err)
+			return 2
+		}
+
+		var err error
+		if values, err = claimValues(jsonClaims); err != nil {
+			fmt.Fprintf(stderr, "invalid --claims-json: %v\n", err)
+			return 2
+		}
+	}
+
+	// Individual --claim flags replace any value for the same claim from --claims-json
+	for name, claimList := range claims {
+		values[name] = claimList
+	}
+
+	if *schemaName != "" {
+		values.Set("schema_name", *schemaName)
+	}
+
+	options := authentication.TokenOptions{Lifetime: *lifetime, DryRun: *dryRun}
+	launch, launchErr := authentication.GenerateLaunch(context.Background(), *schemaURL, values, options)
+	if launchErr != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", launchErr.Kind, launchErr.Desc)
+		return 1
+	}
+
+	if *dryRun {
+		output, err := json.MarshalIndent(launch.Claims, "", "  ")
+		if err != nil {
+			fmt.Fprintf(stderr, "failed to encode claims: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(stdout, string(output))
+		return 0
+	}
+
+	fmt.Fprintln(stdout, launch.Token)
+	return 0
+}
+
+// runKeygenCommand generates signing and encryption key pairs for local development, writing the launcher's keys to
+// JWT_SIGNING_KEY_PATH and JWT_ENCRYPTION_KEY_PATH and printing their kids. It only runs with ENABLE_KEYGEN set, so
+// keys can't be replaced in a deployed environment. It returns the exit code for the process.
+func runKeygenCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	signingKeyPath := settings.Get("JWT_SIGNING_KEY_PATH")
+	encryptionKeyPath := settings.Get("JWT_ENCRYPTION_KEY_PATH")
+	decryptionKeyPath := settings.Get("MOCK_RUNNER_DECRYPTION_KEY_PATH")
+	if decryptionKeyPath == "" {
+		decryptionKeyPath = strings.TrimSuffix(encryptionKeyPath, ".pem") + "-private.pem"
+	}
+
+	bits := flags.Int("bits", 2048, "size of the RSA keys")
+	overwrite := flags.Bool("overwrite", false, "replace keys which already exist")
+	signingPublicKeyPath := flags.String("signing-public-out", strings.TrimSuffix(signingKeyPath, ".pem")+"-public.pem", "where to write the runner's signature verification key")
+	encryptionPrivateKeyPath := flags.String("encryption-private-out", decryptionKeyPath, "where to write the runner's decryption key")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if !settings.GetBool("ENABLE_KEYGEN") {
+		fmt.Fprintln(stderr, "keygen is only available with ENABLE_KEYGEN set, for local development")
+		return 2
+	}
+
+	paths := authentication.KeyPairPaths{
+		SigningKey:           signingKeyPath,
+		SigningPublicKey:     *signingPublicKeyPath,
+		EncryptionKey:        encryptionKeyPath,
+		EncryptionPrivateKey: *encryptionPrivateKeyPath,
+	}
+	keys, err := authentication.GenerateKeyPairs(paths, *bits, *overwrite)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to generate keys: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "signing key:            %s (kid %s)\n", paths.SigningKey, keys.SigningKID)
+	fmt.Fprintf(stdout, "signing public key:     %s\n", paths.SigningPublicKey)
+	fmt.Fprintf(stdout, "encryption key:         %s (kid %s)\n", paths.EncryptionKey, keys.EncryptionKID)
+	fmt.Fprintf(stdout, "encryption private key: %s\n", paths.EncryptionPrivateKey)
+	return 0
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// volatileClaims differ for every token, so are left out of comparisons
+var volatileClaims = []string{"tx_id", "jti", "iat", "exp"}
+
+// runToken runs the token command with args, returning its exit code, stdout and stderr
+func runToken(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := runTokenCommand(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunTokenCommandDryRun(t *testing.T) {
+	useRunner(t)
+
+	code, stdout, stderr := runToken("--schema-name=test_launch", "--claim", "ru_ref=12346789012A", "--claim", "roles=dumper", "--claim", "roles=flusher",
+		"--claims-json", `{"period_id": "201605", "trad_as": "ESSENTIAL", "ru_ref": "replaced"}`, "--dry-run")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &claims); err != nil {
+		t.Fatalf("expected the claims as JSON, got %q", stdout)
+	}
+	for _, name := range volatileClaims {
+		if _, ok := claims[name]; !ok {
+			t.Errorf("expected a %s claim", name)
+		}
+		delete(claims, name)
+	}
+
+	golden := map[string]interface{}{
+		"period_id":   "201605",
+		"preview":     false,
+		"roles":       []interface{}{"dumper", "flusher"},
+		"ru_ref":      "12346789012A",
+		"schema_name": "test_launch",
+		"trad_as":     "ESSENTIAL",
+	}
+	if !reflect.DeepEqual(claims, golden) {
+		got, _ := json.MarshalIndent(claims, "", "  ")
+		t.Errorf("expected the golden claims, got %s", got)
+	}
+}
+
+func TestRunTokenCommandToken(t *testing.T) {
+	runner := useRunner(t)
+
+	code, stdout, stderr := runToken("--schema-name", "test_launch", "--claim", "ru_ref=12346789012A", "--claim", "period_id=201605", "--exp", "1h")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+
+	claims, err := runner.Claims(strings.TrimSpace(stdout))
+	if err != nil {
+		t.Fatalf("the runner couldn't read the token: %v", err)
+	}
+	if lifetime := claims["exp"].(float64) - claims["iat"].(float64); lifetime != 3600 {
+		t.Errorf("expected the token to last an hour, got %vs", lifetime)
+	}
+	if claims["ru_ref"] != "12346789012A" {
+		t.Errorf("expected the --claim values, got %v", claims)
+	}
+}
+
+func TestRunTokenCommandErrors(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+	}{
+		{"no schema", []string{"--claim", "ru_ref=1"}, 2, "exactly one of --schema-name or --schema-url is required"},
+		{"both schemas", []string{"--schema-name", "test_launch", "--schema-url", "http://localhost/test.json"}, 2, "exactly one of --schema-name or --schema-url is required"},
+		{"invalid claim flag", []string{"--schema-name", "test_launch", "--claim", "ru_ref"}, 2, `expected name=value, got "ru_ref"`},
+		{"invalid claims JSON", []string{"--schema-name", "test_launch", "--claims-json", "[1]"}, 2, "invalid --claims-json"},
+		{"unknown flag", []string{"--schema", "test_launch"}, 2, "flag provided but not defined"},
+		{"schema not found", []string{"--schema-name", "test_missing"}, 1, "schema_not_found: "},
+		{"invalid metadata", []string{"--schema-name", "test_launch", "--claim", "ref_p_start_date=01/05/2016"}, 1, "metadata_error: "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, stdout, stderr := runToken(test.args...)
+			if code != test.wantCode {
+				t.Errorf("expected exit code %d, got %d", test.wantCode, code)
+			}
+			if stdout != "" {
+				t.Errorf("expected nothing on stdout, got %q", stdout)
+			}
+			if !strings.Contains(stderr, test.wantStderr) {
+				t.Errorf("expected %q on stderr, got %q", test.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestRunKeygenCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  string
+		wantCode int
+	}{
+		{"enabled", "true", 0},
+		{"disabled", "false", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			withSetting(t, "ENABLE_KEYGEN", test.enabled)
+			withSetting(t, "JWT_SIGNING_KEY_PATH", filepath.Join(dir, "signing.pem"))
+			withSetting(t, "JWT_ENCRYPTION_KEY_PATH", filepath.Join(dir, "encryption.pem"))
+			withSetting(t, "MOCK_RUNNER_DECRYPTION_KEY_PATH", "")
+
+			var stdout, stderr bytes.Buffer
+			if code := runKeygenCommand([]string{"--bits=1024"}, &stdout, &stderr); code != test.wantCode {
+				t.Fatalf("expected exit code %d, got %d: %s", test.wantCode, code, stderr.String())
+			}
+
+			_, err := os.Stat(filepath.Join(dir, "signing.pem"))
+			if written := err == nil; written != (test.wantCode == 0) {
+				t.Errorf("expected the signing key written %v, got %v", test.wantCode == 0, written)
+			}
+			if test.wantCode == 0 && !strings.Contains(stdout.String(), "kid") {
+				t.Errorf("expected the kids to be printed, got %q", stdout.String())
+			}
+		})
+	}
+}
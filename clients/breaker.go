@@ -0,0 +1,140 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when requests to a host are being failed fast because the host is considered down
+var ErrCircuitOpen = errors.New("service unavailable (circuit open)")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker tracks consecutive failures for a single host
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a request may be made, moving an open circuit to half-open once the cool-down has passed
+func (b *circuitBreaker) allow(cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < cooldown {
+			return false
+		}
+		// Let a single probe through, further requests fail fast until it completes
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(success bool, threshold int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= threshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) currentState() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerTransport is a http.RoundTripper which keeps a circuit breaker per host
+type breakerTransport struct {
+	next      http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerTransport(next http.RoundTripper, threshold int, cooldown time.Duration) *breakerTransport {
+	return &breakerTransport{
+		next:      next,
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*circuitBreaker),
+	}
+}
+
+func (t *breakerTransport) breaker(host string) *circuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.breakers[host]
+	if !ok {
+		b = &circuitBreaker{}
+		t.breakers[host] = b
+	}
+	return b
+}
+
+// RoundTrip fails fast with ErrCircuitOpen when the circuit for the request host is open
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.threshold <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	b := t.breaker(req.URL.Host)
+	if !b.allow(t.cooldown) {
+		return nil, ErrCircuitOpen
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	b.record(err == nil && resp.StatusCode < 500, t.threshold)
+
+	return resp, err
+}
+
+func (t *breakerTransport) states() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	states := make(map[string]string, len(t.breakers))
+	for host, b := range t.breakers {
+		states[host] = b.currentState().String()
+	}
+	return states
+}
@@ -0,0 +1,105 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBreakerTransportTransitions(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+
+	tests := []struct {
+		name     string
+		statuses []int
+		wait     time.Duration
+		wantErr  error
+		want     string
+	}{
+		{"first failure stays closed", []int{0}, 0, nil, "closed"},
+		{"threshold failures open the circuit", []int{0}, 0, nil, "open"},
+		{"open circuit fails fast", nil, 0, ErrCircuitOpen, "open"},
+		{"probe after the cool-down closes the circuit", []int{200}, cooldown, nil, "closed"},
+		{"client errors don't count as failures", []int{404, 404}, 0, nil, "closed"},
+		{"server errors open it again", []int{503, 503}, 0, nil, "open"},
+		{"failed probe reopens the circuit", []int{0}, cooldown, nil, "open"},
+	}
+
+	stub := &stubTransport{}
+	transport := newBreakerTransport(stub, 2, cooldown)
+	req := httptest.NewRequest(http.MethodGet, "http://runner/schemas", nil)
+
+	for _, test := range tests {
+		stub.statuses = append(stub.statuses[:stub.calls], test.statuses...)
+		time.Sleep(test.wait)
+
+		var err error
+		for range test.statuses {
+			_, err = transport.RoundTrip(req)
+		}
+		if test.statuses == nil {
+			_, err = transport.RoundTrip(req)
+		}
+
+		if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.wantErr, err)
+		}
+		if state := transport.states()["runner"]; state != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, state)
+		}
+	}
+}
+
+func TestBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	breaker := &circuitBreaker{}
+	breaker.record(false, 1)
+	if breaker.currentState() != circuitOpen {
+		t.Fatalf("expected open, got %s", breaker.currentState())
+	}
+
+	if !breaker.allow(0) {
+		t.Fatal("expected a probe once the cool-down has passed")
+	}
+	if breaker.currentState() != circuitHalfOpen {
+		t.Errorf("expected half-open, got %s", breaker.currentState())
+	}
+	if breaker.allow(0) {
+		t.Error("expected further requests to fail fast while the probe is in flight")
+	}
+
+	breaker.record(true, 1)
+	if breaker.currentState() != circuitClosed {
+		t.Errorf("expected closed after a successful probe, got %s", breaker.currentState())
+	}
+}
+
+func TestBreakerTransportServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	transport := newBreakerTransport(http.DefaultTransport, 1, time.Minute)
+	client := &http.Client{Transport: transport}
+
+	if response, err := client.Get(server.URL); err == nil {
+		response.Body.Close()
+	}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected a 500 to open the circuit, got %v", err)
+	}
+}
+
+func TestBreakerTransportDisabled(t *testing.T) {
+	stub := &stubTransport{statuses: []int{0, 0, 0}}
+	transport := newBreakerTransport(stub, 0, time.Minute)
+	req := httptest.NewRequest(http.MethodGet, "http://runner/schemas", nil)
+
+	for i := 0; i < 3; i++ {
+		if _, err := transport.RoundTrip(req); errors.Is(err, ErrCircuitOpen) {
+			t.Fatal("expected a threshold of 0 to disable the breaker")
+		}
+	}
+}
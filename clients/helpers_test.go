@@ -0,0 +1,34 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// stubTransport responds with the next status, or fails when it is 0
+type stubTransport struct {
+	statuses []int
+	calls    int
+}
+
+func (t *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	status := t.statuses[t.calls]
+	t.calls++
+	if status == 0 {
+		return nil, errors.New("connection refused")
+	}
+	recorder := httptest.NewRecorder()
+	recorder.WriteHeader(status)
+	return recorder.Result(), nil
+}
+
+func withSetting(t *testing.T, name string, value string) {
+	t.Helper()
+	previous := settings.Get(name)
+	settings.Set(name, value)
+	t.Cleanup(func() { settings.Set(name, previous) })
+}
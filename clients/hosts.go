@@ -0,0 +1,222 @@
+package clients
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
+	"github.com/ONSdigital/eq-questionnaire-launcher/version"
+)
+
+const defaultHostKey = "*"
+
+// hostConfig is the JSON representation of the client configuration for an upstream host
+type hostConfig struct {
+	Timeout            string `json:"timeout"`
+	Retries            int    `json:"retries"`
+	Authorization      string `json:"authorization"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	CACertPath         string `json:"ca_cert_path"`
+}
+
+// hostSettings is the validated form of a hostConfig
+type hostSettings struct {
+	timeout       time.Duration
+	retries       int
+	authorization string
+	transport     http.RoundTripper
+}
+
+var globalDefaults = hostSettings{
+	timeout:   time.Duration(5) * time.Second,
+	transport: http.DefaultTransport,
+}
+
+// parseHostConfig parses the HTTP_CLIENT_CONFIG JSON, keyed by host (with or without port) and "*" for the defaults
+func parseHostConfig(configJSON string) (defaults hostSettings, hosts map[string]hostSettings, err error) {
+	defaults = globalDefaults
+	hosts = make(map[string]hostSettings)
+
+	if configJSON == "" {
+		return defaults, hosts, nil
+	}
+
+	var configs map[string]hostConfig
+	if err := json.Unmarshal([]byte(configJSON), &configs); err != nil {
+		return defaults, hosts, fmt.Errorf("invalid HTTP_CLIENT_CONFIG: %v", err)
+	}
+
+	if config, ok := configs[defaultHostKey]; ok {
+		defaults, err = config.settings(globalDefaults)
+		if err != nil {
+			return defaults, hosts, fmt.Errorf("invalid HTTP_CLIENT_CONFIG for %q: %v", defaultHostKey, err)
+		}
+	}
+
+	for host, config := range configs {
+		if host == defaultHostKey {
+			continue
+		}
+		hosts[host], err = config.settings(defaults)
+		if err != nil {
+			return defaults, hosts, fmt.Errorf("invalid HTTP_CLIENT_CONFIG for %q: %v", host, err)
+		}
+	}
+
+	return defaults, hosts, nil
+}
+
+func (c hostConfig) settings(defaults hostSettings) (hostSettings, error) {
+	s := defaults
+
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil || timeout <= 0 {
+			return s, fmt.Errorf("timeout must be a positive duration, got %q", c.Timeout)
+		}
+		s.timeout = timeout
+	}
+
+	if c.Retries < 0 {
+		return s, errors.New("retries must not be negative")
+	}
+	if c.Retries > 0 {
+		s.retries = c.Retries
+	}
+
+	if c.Authorization != "" {
+		s.authorization = c.Authorization
+	}
+
+	if c.InsecureSkipVerify || c.CACertPath != "" {
+		tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+
+		if c.CACertPath != "" {
+			caData, err := ioutil.ReadFile(c.CACertPath)
+			if err != nil {
+				return s, fmt.Errorf("failed to read ca_cert_path: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caData) {
+				return s, fmt.Errorf("no certificates found in ca_cert_path %s", c.CACertPath)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		s.transport = transport
+	}
+
+	return s, nil
+}
+
+// hostTransport applies the per-host timeout, retries and authorization, falling back to the defaults
+type hostTransport struct {
+	defaults hostSettings
+	hosts    map[string]hostSettings
+	breaker  *breakerTransport
+}
+
+func (t *hostTransport) settingsFor(req *http.Request) hostSettings {
+	if s, ok := t.hosts[req.URL.Host]; ok {
+		return s
+	}
+	if s, ok := t.hosts[req.URL.Hostname()]; ok {
+		return s
+	}
+	return t.defaults
+}
+
+// hostRoundTripper selects the underlying transport (and so the TLS options) for the request host
+type hostRoundTripper struct {
+	hosts *hostTransport
+}
+
+func (t hostRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.hosts.settingsFor(req).transport.RoundTrip(req)
+}
+
+// RoundTrip retries connection errors and 5xx responses up to the configured number of times, where the request body can be replayed
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s := t.settingsFor(req)
+
+	for attempt := 0; ; attempt++ {
+		attemptReq, cancel, err := t.prepare(req, s, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.breaker.RoundTrip(attemptReq)
+
+		retryable := attempt < s.retries && (req.Body == nil || req.GetBody != nil) && !errors.Is(err, ErrCircuitOpen)
+		if err == nil && resp.StatusCode < 500 || !retryable {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+
+		// The backoff stops when the request's context is, such as when the client has gone away
+		select {
+		case <-time.After(time.Duration(attempt+1) * 100 * time.Millisecond):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func (t *hostTransport) prepare(req *http.Request, s hostSettings, attempt int) (*http.Request, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), s.timeout)
+	attemptReq := req.Clone(ctx)
+
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		attemptReq.Body = body
+	}
+
+	if id := requestid.FromContext(req.Context()); id != "" && attemptReq.Header.Get(requestid.Header) == "" {
+		attemptReq.Header.Set(requestid.Header, id)
+	}
+
+	if attemptReq.Header.Get("User-Agent") == "" {
+		attemptReq.Header.Set("User-Agent", version.UserAgent())
+	}
+
+	if s.authorization != "" && attemptReq.Header.Get("Authorization") == "" {
+		attemptReq.Header.Set("Authorization", s.authorization)
+	}
+
+	return attemptReq, cancel, nil
+}
+
+// cancelBody releases the request's timeout context once the response body has been closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
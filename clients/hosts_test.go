@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestHostTransport returns a hostTransport which sends every request to next, with the breaker disabled
+func newTestHostTransport(next http.RoundTripper, retries int) *hostTransport {
+	hosts := &hostTransport{defaults: hostSettings{timeout: time.Second, retries: retries, transport: next}}
+	hosts.breaker = newBreakerTransport(hostRoundTripper{hosts: hosts}, 0, time.Minute)
+	return hosts
+}
+
+func TestHostTransportRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retries    int
+		wantStatus int
+		wantCalls  int
+	}{
+		{"success", []int{200}, 2, 200, 1},
+		{"client error isn't retried", []int{404}, 2, 404, 1},
+		{"server error is retried", []int{500, 200}, 2, 200, 2},
+		{"connection error is retried", []int{0, 200}, 2, 200, 2},
+		{"retries run out", []int{500, 500, 500}, 2, 500, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stub := &stubTransport{statuses: test.statuses}
+			req, _ := http.NewRequest(http.MethodGet, "http://runner/schemas", nil)
+
+			resp, err := newTestHostTransport(stub, test.retries).RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, resp.StatusCode)
+			}
+			if stub.calls != test.wantCalls {
+				t.Errorf("expected %d calls, got %d", test.wantCalls, stub.calls)
+			}
+		})
+	}
+}
+
+func TestHostTransportBackoffStopsWithContext(t *testing.T) {
+	stub := &stubTransport{statuses: []int{500, 500, 500, 500, 500, 500}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://runner/schemas", nil)
+
+	start := time.Now()
+	_, err := newTestHostTransport(stub, 5).RoundTrip(req)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("expected the backoff to stop with the context, took %s", elapsed)
+	}
+	if stub.calls != 1 {
+		t.Errorf("expected 1 call, got %d", stub.calls)
+	}
+}
@@ -2,14 +2,43 @@ package clients
 
 import (
 	"net/http"
-	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
 )
 
-var httpClient = &http.Client{
-	Timeout: time.Duration(5) * time.Second,
+var transport *breakerTransport
+
+var httpClient = &http.Client{CheckRedirect: checkRedirect}
+
+func init() {
+	defaults, hosts, err := parseHostConfig(settings.Get("HTTP_CLIENT_CONFIG"))
+	if err != nil {
+		logging.Fatal("invalid HTTP client configuration", "error", err)
+	}
+	if socket := settings.Get("SCHEMA_UNIX_SOCKET"); socket != "" {
+		if err := withUnixSocket(defaults, hosts, settings.Get("SURVEY_RUNNER_SCHEMA_URL"), socket); err != nil {
+			logging.Fatal("invalid HTTP client configuration", "error", err)
+		}
+	}
+
+	selector := &hostTransport{defaults: defaults, hosts: hosts}
+	transport = newBreakerTransport(
+		hostRoundTripper{hosts: selector},
+		settings.GetInt("CIRCUIT_BREAKER_THRESHOLD"),
+		settings.GetDuration("CIRCUIT_BREAKER_COOLDOWN"),
+	)
+	selector.breaker = transport
+
+	httpClient.Transport = selector
 }
 
 // GetHTTPClient returns a single HttpClient for use across the app
-func GetHTTPClient() (*http.Client)  {
+func GetHTTPClient() *http.Client {
 	return httpClient
-}
\ No newline at end of file
+}
+
+// CircuitStates returns the circuit breaker state for each upstream host that has been contacted
+func CircuitStates() map[string]string {
+	return transport.states()
+}
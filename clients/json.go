@@ -0,0 +1,251 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"unicode/utf8"
+)
+
+// maxResponseBytes is the largest response body the JSON helpers will read
+const maxResponseBytes = 10 << 20
+
+// ErrResponseTooLarge is returned when a response body is larger than the JSON helpers will read
+var ErrResponseTooLarge = errors.New("response too large")
+
+// maxErrorSnippetBytes is how much of a non-2xx response body is kept on an HTTPError
+const maxErrorSnippetBytes = 1024
+
+// HTTPError describes a non-2xx response from an upstream service
+type HTTPError struct {
+	URL        string
+	StatusCode int
+
+	// Body is the start of the response body, truncated to a short snippet.
+	Body string
+}
+
+func (e *HTTPError) Error() string {
+	if e == nil {
+		return "<nil>"
+	}
+	err := fmt.Sprintf("%s returned %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		err += ": " + e.Body
+	}
+	return err
+}
+
+// GetJSON fetches url and decodes the JSON response into v
+func GetJSON(ctx context.Context, url string, v interface{}) error {
+	return GetJSONLimit(ctx, url, maxResponseBytes, v)
+}
+
+// GetJSONLimit fetches url and decodes the JSON response into v, failing with ErrResponseTooLarge rather than reading
+// more than maxBytes of the response
+func GetJSONLimit(ctx context.Context, url string, maxBytes int64, v interface{}) error {
+	_, err := GetJSONBody(ctx, url, maxBytes, v)
+	return err
+}
+
+// GetJSONBody is GetJSONLimit, also returning the response body v was decoded from
+func GetJSONBody(ctx context.Context, url string, maxBytes int64, v interface{}) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	return doJSON(req, maxBytes, v)
+}
+
+// PostJSON posts body encoded as JSON to url and decodes the JSON response into v, which may be nil if the response is not needed
+func PostJSON(ctx context.Context, url string, body interface{}, v interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	return PostJSONReader(ctx, url, bytes.NewReader(payload), v)
+}
+
+// PostJSONReader posts JSON which has already been encoded, streaming it from body rather than copying it, and decodes
+// the JSON response into v, which may be nil. Retries are only possible when body is a *bytes.Reader, *bytes.Buffer or
+// *strings.Reader.
+func PostJSONReader(ctx context.Context, url string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = doJSON(req, maxResponseBytes, v)
+	return err
+}
+
+// PostJSONBody posts body encoded as JSON to url and decodes the JSON response into v, failing with
+// ErrResponseTooLarge rather than reading more than maxBytes of the response, and returns the response body v was
+// decoded from
+func PostJSONBody(ctx context.Context, url string, body interface{}, maxBytes int64, v interface{}) ([]byte, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	return doJSON(req, maxBytes, v)
+}
+
+// Ping checks that url responds without a server error, discarding the response body
+func Ping(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := GetHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return &HTTPError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// Response is the status and the start of the body of a response which the caller reports rather than decodes
+type Response struct {
+	StatusCode int
+	Body       string
+
+	// Location is where the response redirects to, for Handoff.
+	Location string
+}
+
+// Post posts to url without a body, returning the status and up to maxErrorSnippetBytes of the response whatever the
+// status. Only failures to get a response are returned as errors.
+func Post(ctx context.Context, url string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := GetHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorSnippetBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %v", req.URL, err)
+	}
+
+	return &Response{StatusCode: resp.StatusCode, Body: string(body)}, nil
+}
+
+// Handoff sends a request without a body to sessionURL, returning the status, where it redirects to and up to
+// maxErrorSnippetBytes of the response. Redirects aren't followed, so the caller can report where they lead, such as
+// the runner's first page after it accepts a token.
+func Handoff(ctx context.Context, method string, sessionURL string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, sessionURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := *GetHTTPClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	// The URL carries the token, so errors only name the host
+	host := req.URL.Scheme + "://" + req.URL.Host
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = host
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorSnippetBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %v", host, err)
+	}
+
+	return &Response{StatusCode: resp.StatusCode, Body: string(body), Location: resp.Header.Get("Location")}, nil
+}
+
+func doJSON(req *http.Request, maxBytes int64, v interface{}) ([]byte, error) {
+	resp, err := GetHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		// Wrapped as a *url.Error, since losing the connection part way through the response is as much a failure to
+		// reach the service as losing it before
+		return nil, fmt.Errorf("failed to read response: %w", &url.Error{Op: req.Method, URL: req.URL.String(), Err: err})
+	}
+	if int64(len(responseBody)) > maxBytes {
+		return nil, fmt.Errorf("%w: response from %s exceeds %d bytes", ErrResponseTooLarge, req.URL, maxBytes)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet := responseBody
+		if len(snippet) > maxErrorSnippetBytes {
+			snippet = snippet[:maxErrorSnippetBytes]
+		}
+		return nil, &HTTPError{URL: req.URL.String(), StatusCode: resp.StatusCode, Body: string(snippet)}
+	}
+
+	if v == nil {
+		return responseBody, nil
+	}
+
+	if encodingError := InvalidUTF8(responseBody); encodingError != "" {
+		return nil, fmt.Errorf("response from %s is not valid JSON: %s", req.URL, encodingError)
+	}
+
+	if err := json.Unmarshal(responseBody, v); err != nil {
+		return nil, fmt.Errorf("failed to decode response from %s: %v", req.URL, err)
+	}
+
+	return responseBody, nil
+}
+
+// InvalidUTF8 returns a description of the first invalid UTF-8 sequence in the payload, or an empty string if it is valid
+func InvalidUTF8(payload []byte) string {
+	if utf8.Valid(payload) {
+		return ""
+	}
+
+	for offset := 0; offset < len(payload); {
+		r, size := utf8.DecodeRune(payload[offset:])
+		if r == utf8.RuneError && size == 1 {
+			return fmt.Sprintf("invalid UTF-8 byte 0x%02x at offset %d", payload[offset], offset)
+		}
+		offset += size
+	}
+
+	return ""
+}
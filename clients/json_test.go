@@ -0,0 +1,52 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// jsonServer responds to every request with the status and body
+func jsonServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"ascii", []byte(`{"name": "test"}`), ""},
+		{"multibyte", []byte(`{"name": "prawf ŵ"}`), ""},
+		{"invalid byte", []byte("{\"name\": \"\xff\"}"), "invalid UTF-8 byte 0xff at offset 10"},
+		{"truncated sequence", []byte("{\"a\": \"\xc3\"}"), "invalid UTF-8 byte 0xc3 at offset 7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := InvalidUTF8(test.payload); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGetJSONInvalidUTF8(t *testing.T) {
+	server := jsonServer(t, http.StatusOK, "{\"schema_name\": \"\xfe\"}")
+
+	var v map[string]interface{}
+	err := GetJSON(context.Background(), server.URL, &v)
+	if err == nil || !strings.Contains(err.Error(), "invalid UTF-8 byte 0xfe at offset 17") {
+		t.Errorf("expected an error naming the invalid byte, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// ErrRedirectNotFollowed is returned for a redirect which HTTP_CLIENT_MAX_REDIRECTS or
+// HTTP_CLIENT_CROSS_HOST_REDIRECTS doesn't allow
+var ErrRedirectNotFollowed = errors.New("redirect not followed")
+
+// checkRedirect follows up to HTTP_CLIENT_MAX_REDIRECTS redirects. Redirects to a different host are usually to a
+// login page rather than the JSON asked for, so they are logged, and refused when HTTP_CLIENT_CROSS_HOST_REDIRECTS is
+// false.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if maxRedirects := settings.GetInt("HTTP_CLIENT_MAX_REDIRECTS"); len(via) > maxRedirects {
+		return fmt.Errorf("%w: more than %d redirects", ErrRedirectNotFollowed, maxRedirects)
+	}
+
+	from := via[len(via)-1].URL
+	if req.URL.Host == from.Host {
+		return nil
+	}
+
+	logging.FromContext(req.Context()).Warn("request redirected to a different host", "from", from.Redacted(), "to", req.URL.Redacted())
+	if !settings.GetBool("HTTP_CLIENT_CROSS_HOST_REDIRECTS") {
+		return fmt.Errorf("%w: redirect from %s to %s", ErrRedirectNotFollowed, from.Host, req.URL.Host)
+	}
+	return nil
+}
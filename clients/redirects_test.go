@@ -0,0 +1,64 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckRedirect(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same-host":
+			http.Redirect(w, r, "/schema.json", http.StatusFound)
+		case "/other-host":
+			http.Redirect(w, r, other.URL+"/schema.json", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		path      string
+		crossHost string
+		wantError bool
+	}{
+		{"same host", "/same-host", "false", false},
+		{"other host allowed", "/other-host", "true", false},
+		{"other host refused", "/other-host", "false", true},
+		{"too many redirects", "/loop", "true", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "HTTP_CLIENT_MAX_REDIRECTS", "3")
+			withSetting(t, "HTTP_CLIENT_CROSS_HOST_REDIRECTS", test.crossHost)
+
+			client := &http.Client{CheckRedirect: checkRedirect}
+			resp, err := client.Get(server.URL + test.path)
+			if test.wantError {
+				if !errors.Is(err, ErrRedirectNotFollowed) {
+					t.Fatalf("expected ErrRedirectNotFollowed, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("expected 200, got %d", resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// withUnixSocket routes requests to the host of schemaURL through the Unix domain socket at path, for environments
+// where the schema service can only be reached through a socket. The request URLs are unchanged, so their paths are
+// still sent as usual.
+func withUnixSocket(defaults hostSettings, hosts map[string]hostSettings, schemaURL string, path string) error {
+	parsed, err := url.Parse(schemaURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("SCHEMA_UNIX_SOCKET needs SURVEY_RUNNER_SCHEMA_URL to be an absolute URL, got %q", schemaURL)
+	}
+
+	s, ok := hosts[parsed.Host]
+	if !ok {
+		s = defaults
+	}
+
+	transport, ok := s.transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("the transport for %s can't dial a Unix socket", parsed.Host)
+	}
+	transport = transport.Clone()
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "unix", path)
+	}
+	s.transport = transport
+
+	hosts[parsed.Host] = s
+	return nil
+}
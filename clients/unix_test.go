@@ -0,0 +1,75 @@
+package clients
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "schemas.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets aren't available: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + r.URL.Path))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	defaults, hosts, err := parseHostConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := withUnixSocket(defaults, hosts, "http://schemas.internal/schemas", socket); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	selector := &hostTransport{defaults: defaults, hosts: hosts}
+	selector.breaker = newBreakerTransport(hostRoundTripper{hosts: selector}, 0, time.Minute)
+	client := &http.Client{Transport: selector}
+
+	tests := []struct {
+		name      string
+		url       string
+		want      string
+		wantError bool
+	}{
+		{"schema host through the socket", "http://schemas.internal/schemas/test_launch", "schemas.internal/schemas/test_launch", false},
+		{"other hosts dial as usual", "http://other.invalid/schemas/test_launch", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := client.Get(test.url)
+			if test.wantError {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("expected the request not to reach the socket")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := ioutil.ReadAll(resp.Body)
+			if string(body) != test.want {
+				t.Errorf("expected %s, got %s", test.want, body)
+			}
+		})
+	}
+}
+
+func TestWithUnixSocketInvalidSchemaURL(t *testing.T) {
+	defaults, hosts, _ := parseHostConfig("")
+	if err := withUnixSocket(defaults, hosts, "/schemas", "/tmp/schemas.sock"); err == nil {
+		t.Error("expected an error for a relative SURVEY_RUNNER_SCHEMA_URL")
+	}
+}
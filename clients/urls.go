@@ -0,0 +1,26 @@
+package clients
+
+import (
+	"net/url"
+	"strings"
+)
+
+// JoinURL appends path segments to base, escaping each one. Base may end in a slash, have a path of its own, such as
+// a proxy's prefix, or have a query string, which is kept.
+func JoinURL(base string, segments ...string) (string, error) {
+	parsedURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	unescapedPath := strings.TrimSuffix(parsedURL.Path, "/")
+	escapedPath := strings.TrimSuffix(parsedURL.EscapedPath(), "/")
+	for _, segment := range segments {
+		unescapedPath += "/" + segment
+		escapedPath += "/" + url.PathEscape(segment)
+	}
+	parsedURL.Path = unescapedPath
+	parsedURL.RawPath = escapedPath
+
+	return parsedURL.String(), nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+// maxSchemaSuggestions is how many similarly named schemas are suggested when a schema isn't found
+const maxSchemaSuggestions = 3
+
+// errorPage describes a failure in terms which are safe to show to the user. Details such as file paths and upstream
+// responses are only logged.
+type errorPage struct {
+	BasePath    string
+	Status      int
+	Code        string
+	Title       string
+	Message     string
+	Fields      []authentication.MetadataError
+	Suggestions []string
+	Dependency  string
+	Hint        string
+	RequestID   string
+}
+
+// newLaunchErrorPage describes a failed launch of schemaName
+func newLaunchErrorPage(r *http.Request, err *authentication.LaunchError, schemaName string) errorPage {
+	page := errorPage{
+		BasePath:  basePath(r),
+		Status:    launchErrorStatus(err),
+		Code:      err.Kind,
+		RequestID: requestid.FromContext(r.Context()),
+	}
+
+	switch err.Kind {
+	case authentication.LaunchErrorSchemaNotFound:
+		page.Title = "Schema not found"
+		page.Message = fmt.Sprintf("No schema named %q could be found.", schemaName)
+		page.Suggestions = suggestSchemas(r, schemaName)
+	case authentication.LaunchErrorMetadata:
+		page.Title = "Invalid metadata"
+		page.Message = "Some of the launch values aren't valid for this schema."
+		page.Fields = err.Fields
+	case authentication.LaunchErrorUpstream:
+		page.Title = "Service unavailable"
+		page.Message = fmt.Sprintf("The %s could not be reached. Try again shortly.", err.Dependency)
+		page.Dependency = err.Dependency
+	case authentication.LaunchErrorSchema:
+		page.Title = "Invalid schema"
+		page.Message = "The schema can't be launched, as it isn't valid."
+		page.Hint = "The reason is in the launcher's logs for this request ID."
+	case authentication.LaunchErrorConfiguration:
+		page.Title = "Launcher misconfigured"
+		page.Message = "The launcher's settings don't allow this launch."
+		page.Hint = "The setting at fault is named in the launcher's logs for this request ID."
+	case authentication.LaunchErrorIdentifier:
+		page.Title = "Unable to generate identifiers"
+		page.Message = "The launcher could not generate the launch's tx_id, jti or collection_exercise_sid. Try again."
+	default:
+		page.Title = "Unable to generate token"
+		page.Message = "The launcher could not sign or encrypt the token."
+		page.Hint = "Check the JWT key settings and the launcher's logs for this request ID. /status/ready reports whether the keys load."
+	}
+
+	return page
+}
+
+// launchErrorStatus returns the HTTP status for each category of launch error
+func launchErrorStatus(err *authentication.LaunchError) int {
+	switch err.Kind {
+	case authentication.LaunchErrorSchemaNotFound:
+		return http.StatusNotFound
+	case authentication.LaunchErrorMetadata:
+		return http.StatusBadRequest
+	case authentication.LaunchErrorUpstream:
+		return errorStatus(err, http.StatusBadGateway)
+	case authentication.LaunchErrorSchema:
+		return errorStatus(err, http.StatusUnprocessableEntity)
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeLaunchFailure logs a failed launch and responds with an error page, or the JSON equivalent when the request
+// asks for JSON
+func writeLaunchFailure(w http.ResponseWriter, r *http.Request, err *authentication.LaunchError, schemaName string) {
+	logging.FromContext(r.Context()).Warn("launch failed", "kind", err.Kind, "schema_name", schemaName, "error", err.Desc)
+
+	page := newLaunchErrorPage(r, err, schemaName)
+	if wantsJSON(r) {
+		writeErrorPageJSON(w, r, page)
+		return
+	}
+	serveErrorPage(w, r, page)
+}
+
+// writeAPILaunchFailure logs a failed launch and responds with the JSON error, whatever the request accepts, for the
+// JSON API
+func writeAPILaunchFailure(w http.ResponseWriter, r *http.Request, err *authentication.LaunchError, schemaName string) {
+	logging.FromContext(r.Context()).Warn("launch failed", "kind", err.Kind, "schema_name", schemaName, "error", err.Desc)
+	writeErrorPageJSON(w, r, newLaunchErrorPage(r, err, schemaName))
+}
+
+// writeRequestFailure responds with an error page for a request which can't be used, or the JSON equivalent
+func writeRequestFailure(w http.ResponseWriter, r *http.Request, status int, message string) {
+	page := errorPage{
+		BasePath:  basePath(r),
+		Status:    status,
+		Code:      errorInvalidRequest,
+		Title:     http.StatusText(status),
+		Message:   message,
+		RequestID: requestid.FromContext(r.Context()),
+	}
+
+	if wantsJSON(r) {
+		writeErrorPageJSON(w, r, page)
+		return
+	}
+	serveErrorPage(w, r, page)
+}
+
+// writeBodyFailure responds to a request body which couldn't be read, with a 413 when it was over the size limit
+func writeBodyFailure(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if errors.Is(err, errRequestBodyTooLarge) {
+		writeRequestFailure(w, r, http.StatusRequestEntityTooLarge, requestTooLargeMessage())
+		return
+	}
+	writeRequestFailure(w, r, http.StatusBadRequest, message)
+}
+
+func serveErrorPage(w http.ResponseWriter, r *http.Request, page errorPage) {
+	w.Header().Set("Cache-Control", "no-store")
+	serveTemplateStatus(page.Status, "error.html", page, w, r)
+}
+
+func writeErrorPageJSON(w http.ResponseWriter, r *http.Request, page errorPage) {
+	writeJSON(w, r, page.Status, apiErrorResponse{Error: apiError{
+		Code:        page.Code,
+		Message:     page.Message,
+		Fields:      page.Fields,
+		Suggestions: page.Suggestions,
+		Dependency:  page.Dependency,
+	}})
+}
+
+// suggestSchemas returns the available schemas with names closest to name, for "did you mean" suggestions
+func suggestSchemas(r *http.Request, name string) []string {
+	if name == "" {
+		return nil
+	}
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+
+	schemas := surveys.GetAvailableSchemas(r.Context())
+	for _, group := range [][]surveys.LauncherSchema{schemas.Business, schemas.CCS, schemas.Census, schemas.Social, schemas.Test, schemas.Other} {
+		for _, schema := range group {
+			distance := authentication.EditDistance(strings.ToLower(name), strings.ToLower(schema.Name))
+			if strings.Contains(schema.Name, name) || distance <= len(name)/3+1 {
+				candidates = append(candidates, candidate{name: schema.Name, distance: distance})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+
+	var suggestions []string
+	for _, candidate := range candidates {
+		if len(suggestions) == maxSchemaSuggestions {
+			break
+		}
+		suggestions = append(suggestions, candidate.name)
+	}
+	return suggestions
+}
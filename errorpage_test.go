@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+)
+
+// internalDetail stands in for the details of a failure which are only logged, never shown
+const internalDetail = "/etc/launcher/secrets/sdc-user-authentication-signing-launcher-key.pem goroutine 1 [running]"
+
+func TestWriteLaunchFailure(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name            string
+		err             *authentication.LaunchError
+		schemaName      string
+		wantStatus      int
+		wantSuggestions []string
+		wantDependency  string
+		wantPage        string
+	}{
+		{
+			name:            "schema not found",
+			err:             &authentication.LaunchError{Kind: authentication.LaunchErrorSchemaNotFound, Desc: internalDetail},
+			schemaName:      "test_lanch",
+			wantStatus:      http.StatusNotFound,
+			wantSuggestions: []string{"test_launch"},
+			wantPage:        "test_launch",
+		},
+		{
+			name:       "invalid metadata",
+			err:        &authentication.LaunchError{Kind: authentication.LaunchErrorMetadata, Desc: internalDetail, Fields: []authentication.MetadataError{{Name: "ref_p_start_date", Reason: "must be a date"}}},
+			schemaName: "test_launch",
+			wantStatus: http.StatusBadRequest,
+			wantPage:   "ref_p_start_date",
+		},
+		{
+			name:           "upstream unavailable",
+			err:            &authentication.LaunchError{Kind: authentication.LaunchErrorUpstream, Desc: internalDetail, Dependency: "schema service"},
+			schemaName:     "test_launch",
+			wantStatus:     http.StatusBadGateway,
+			wantDependency: "schema service",
+			wantPage:       "schema service",
+		},
+		{
+			name:           "upstream circuit open",
+			err:            &authentication.LaunchError{Kind: authentication.LaunchErrorUpstream, Desc: internalDetail, Dependency: "schema service", Err: &url.Error{Op: "Get", URL: "http://schemas", Err: clients.ErrCircuitOpen}},
+			schemaName:     "test_launch",
+			wantStatus:     http.StatusServiceUnavailable,
+			wantDependency: "schema service",
+			wantPage:       "schema service",
+		},
+		{
+			name:           "upstream only describing an open circuit",
+			err:            &authentication.LaunchError{Kind: authentication.LaunchErrorUpstream, Desc: clients.ErrCircuitOpen.Error(), Dependency: "schema service"},
+			schemaName:     "test_launch",
+			wantStatus:     http.StatusBadGateway,
+			wantDependency: "schema service",
+			wantPage:       "schema service",
+		},
+		{
+			name:       "invalid schema",
+			err:        &authentication.LaunchError{Kind: authentication.LaunchErrorSchema, Desc: internalDetail},
+			schemaName: "test_launch",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantPage:   "Invalid schema",
+		},
+		{
+			name:       "configuration",
+			err:        &authentication.LaunchError{Kind: authentication.LaunchErrorConfiguration, Desc: internalDetail},
+			schemaName: "test_launch",
+			wantStatus: http.StatusInternalServerError,
+			wantPage:   "Launcher misconfigured",
+		},
+		{
+			name:       "key problem",
+			err:        &authentication.LaunchError{Kind: authentication.LaunchErrorKey, Desc: internalDetail},
+			schemaName: "test_launch",
+			wantStatus: http.StatusInternalServerError,
+			wantPage:   "/status/ready",
+		},
+		{
+			name:       "identifiers",
+			err:        &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: internalDetail},
+			schemaName: "test_launch",
+			wantStatus: http.StatusInternalServerError,
+			wantPage:   "tx_id",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Run("HTML", func(t *testing.T) {
+				recorder := httptest.NewRecorder()
+				writeLaunchFailure(recorder, httptest.NewRequest(http.MethodPost, "/", nil), test.err, test.schemaName)
+
+				if recorder.Code != test.wantStatus {
+					t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+				}
+				body := recorder.Body.String()
+				if !strings.Contains(body, test.wantPage) {
+					t.Errorf("expected the page to mention %q, got %s", test.wantPage, body)
+				}
+				if strings.Contains(body, "/etc/launcher") || strings.Contains(body, "goroutine") {
+					t.Errorf("expected internal details not to be shown, got %s", body)
+				}
+			})
+
+			t.Run("JSON", func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/", nil)
+				req.Header.Set("Accept", "application/json")
+				recorder := httptest.NewRecorder()
+				writeLaunchFailure(recorder, req, test.err, test.schemaName)
+
+				if recorder.Code != test.wantStatus {
+					t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+				}
+				if strings.Contains(recorder.Body.String(), "/etc/launcher") {
+					t.Errorf("expected internal details not to be returned, got %s", recorder.Body)
+				}
+
+				var response apiErrorResponse
+				decodeResponse(t, recorder, &response)
+				if response.Error.Code != test.err.Kind {
+					t.Errorf("expected code %s, got %s", test.err.Kind, response.Error.Code)
+				}
+				if !reflect.DeepEqual(response.Error.Fields, test.err.Fields) {
+					t.Errorf("expected fields %v, got %v", test.err.Fields, response.Error.Fields)
+				}
+				if !reflect.DeepEqual(response.Error.Suggestions, test.wantSuggestions) {
+					t.Errorf("expected suggestions %v, got %v", test.wantSuggestions, response.Error.Suggestions)
+				}
+				if response.Error.Dependency != test.wantDependency {
+					t.Errorf("expected dependency %q, got %q", test.wantDependency, response.Error.Dependency)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+// defaultFlushMetadata pre-fills the identifying metadata on the flush form
+const defaultFlushMetadata = "ru_ref=12346789012A\ncollection_exercise_sid=\nresponse_id=\ncase_id=\nuser_id="
+
+// flushMetadataNames are the metadata identifying a response, carried over to the flush form from the launch form
+var flushMetadataNames = []string{"ru_ref", "collection_exercise_sid", "response_id", "case_id", "user_id"}
+
+type flushPage struct {
+	BasePath   string
+	Schemas    surveys.LauncherSchemas
+	SchemaName string
+	Metadata   string
+	Confirm    bool
+	Values     []flushValue
+	Result     *flushResult
+}
+
+// flushValue is one of the values a flush will be made with, listed for confirmation
+type flushValue struct {
+	Name  string
+	Value string
+}
+
+// flushResult is the runner's response to a flush
+type flushResult struct {
+	StatusCode int
+	Status     string
+	Body       string
+	Succeeded  bool
+}
+
+// getFlushHandler shows the flush form, pre-filled from the query string so the values from a previous launch can be
+// linked to it
+func getFlushHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	schemaName := values.Get("schema_name")
+	values.Del("schema_name")
+
+	metadata := defaultFlushMetadata
+	if len(values) > 0 {
+		metadata = formatFlushMetadata(values)
+	}
+
+	serveTemplate("flush.html", flushPage{
+		BasePath:   basePath(r),
+		Schemas:    surveys.GetAvailableSchemas(r.Context()),
+		SchemaName: schemaName,
+		Metadata:   metadata,
+	}, w, r)
+}
+
+// postFlushHandler asks for confirmation of the values to flush with, then once confirmed generates a flusher token
+// and posts it to the runner's /flush endpoint, reporting the runner's response
+func postFlushHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeBodyFailure(w, r, err, "The flush form could not be read.")
+		return
+	}
+
+	schemaName := r.PostForm.Get("schema_name")
+	if schemaName == "" {
+		writeRequestFailure(w, r, http.StatusBadRequest, "Select the schema of the response to flush.")
+		return
+	}
+
+	metadata := r.PostForm.Get("metadata")
+	values, err := parseBulkMetadata(metadata)
+	if err != nil {
+		writeRequestFailure(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	values.Set("schema_name", schemaName)
+
+	page := flushPage{
+		BasePath:   basePath(r),
+		Schemas:    surveys.GetAvailableSchemas(r.Context()),
+		SchemaName: schemaName,
+		Metadata:   metadata,
+	}
+
+	// Flushing submits the response and removes it from the runner, so nothing is sent until the values are confirmed
+	if r.PostForm.Get("confirm") != "true" {
+		page.Confirm = true
+		page.Values = flushValues(values)
+		serveTemplate("flush.html", page, w, r)
+		return
+	}
+
+	timings := &authentication.Timings{}
+	launch, launchErr := authentication.GenerateFlushLaunch(authentication.ContextWithTimings(r.Context(), timings), values)
+	recordLaunch(r, schemaName, timings, launch, launchErr)
+	if launchErr != nil {
+		writeLaunchFailure(w, r, launchErr, schemaName)
+		return
+	}
+	auditLaunch(r, launch, schemaName)
+
+	response, err := clients.Post(r.Context(), authentication.FlushURL(launch.Token))
+	if err != nil {
+		writeFlushFailure(w, r, err)
+		return
+	}
+
+	page.Result = &flushResult{
+		StatusCode: response.StatusCode,
+		Status:     http.StatusText(response.StatusCode),
+		Body:       response.Body,
+		Succeeded:  response.StatusCode >= 200 && response.StatusCode <= 299,
+	}
+	logging.FromContext(r.Context()).Info("flushed response", "schema_name", schemaName, "response_id", values.Get("response_id"), "status", response.StatusCode)
+
+	status := http.StatusOK
+	if !page.Result.Succeeded {
+		status = http.StatusBadGateway
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	serveTemplateStatus(status, "flush.html", page, w, r)
+}
+
+// writeFlushFailure responds with an error page when the runner couldn't be reached, distinguishing a timeout
+func writeFlushFailure(w http.ResponseWriter, r *http.Request, err error) {
+	logging.FromContext(r.Context()).Warn("flush failed", "error", err)
+
+	page := errorPage{
+		BasePath:   basePath(r),
+		Status:     http.StatusBadGateway,
+		Code:       authentication.LaunchErrorUpstream,
+		Title:      "Service unavailable",
+		Message:    "The survey runner could not be reached, so the response has not been flushed.",
+		Dependency: "survey runner",
+		RequestID:  requestid.FromContext(r.Context()),
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		page.Status = http.StatusGatewayTimeout
+		page.Title = "Runner timed out"
+		page.Message = "The survey runner didn't respond in time. The response may or may not have been flushed."
+	} else if errors.Is(err, clients.ErrCircuitOpen) {
+		page.Message = "Requests to the survey runner are paused after repeated failures, so the response has not been flushed. Try again shortly."
+	}
+
+	if wantsJSON(r) {
+		writeErrorPageJSON(w, r, page)
+		return
+	}
+	serveErrorPage(w, r, page)
+}
+
+// flushFormURL returns the flush form pre-filled with the schema and identifying metadata of the launch form's values
+func flushFormURL(r *http.Request, values url.Values) string {
+	query := url.Values{"schema_name": {authentication.TransformSchemaParamsToName(values)}}
+	for _, name := range flushMetadataNames {
+		query.Set(name, values.Get(name))
+	}
+	return basePath(r) + "/flush?" + query.Encode()
+}
+
+// flushValues returns the values sorted by name for the confirmation step
+func flushValues(values url.Values) []flushValue {
+	var listed []flushValue
+	for name, value := range values {
+		for _, v := range value {
+			listed = append(listed, flushValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+	return listed
+}
+
+// formatFlushMetadata writes values as the name=value lines read by parseBulkMetadata
+func formatFlushMetadata(values url.Values) string {
+	var lines []string
+	for _, value := range flushValues(values) {
+		lines = append(lines, value.Name+"="+value.Value)
+	}
+	return strings.Join(lines, "\n")
+}
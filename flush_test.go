@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postFlush posts values to the flush form
+func postFlush(t *testing.T, ctx context.Context, values url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/flush", strings.NewReader(values.Encode())).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return route(t, req)
+}
+
+// useFlushRunner points SURVEY_RUNNER_URL at handler in place of the mock runner
+func useFlushRunner(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	withSetting(t, "SURVEY_RUNNER_URL", server.URL)
+}
+
+func TestPostFlushConfirmation(t *testing.T) {
+	runner := useRunner(t)
+	values := url.Values{"schema_name": {"test_launch"}, "metadata": {"ru_ref=12346789012A\nresponse_id=1234"}}
+
+	recorder := postFlush(t, context.Background(), values)
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "Confirm flush") {
+		t.Fatalf("expected the values to be confirmed, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if received := runner.Received(); len(received) != 0 {
+		t.Fatalf("expected nothing sent to the runner before confirming, got %v", received)
+	}
+
+	values.Set("confirm", "true")
+	recorder = postFlush(t, context.Background(), values)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	received := runner.Received()
+	if len(received) != 1 {
+		t.Fatalf("expected one flush, got %v", received)
+	}
+	if !reflect.DeepEqual(received[0]["roles"], []interface{}{"flusher"}) || received[0]["response_id"] != "1234" {
+		t.Errorf("expected a flusher token for response 1234, got %v", received[0])
+	}
+}
+
+func TestPostFlushRunnerFailures(t *testing.T) {
+	useRunner(t)
+	values := url.Values{"schema_name": {"test_launch"}, "metadata": {"ru_ref=12346789012A"}, "confirm": {"true"}}
+
+	t.Run("non-2xx", func(t *testing.T) {
+		useFlushRunner(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/flush" {
+				t.Errorf("expected a flush, got %s", r.URL.Path)
+			}
+			http.Error(w, "no such response", http.StatusNotFound)
+		})
+
+		recorder := postFlush(t, context.Background(), values)
+		if recorder.Code != http.StatusBadGateway {
+			t.Fatalf("expected 502, got %d: %s", recorder.Code, recorder.Body)
+		}
+		if !strings.Contains(recorder.Body.String(), "no such response") {
+			t.Errorf("expected the runner's response to be shown, got %s", recorder.Body)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		useFlushRunner(t, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		recorder := postFlush(t, ctx, values)
+		if recorder.Code != http.StatusGatewayTimeout {
+			t.Fatalf("expected 504, got %d: %s", recorder.Code, recorder.Body)
+		}
+		if !strings.Contains(recorder.Body.String(), "may or may not have been flushed") {
+			t.Errorf("expected the timeout to be explained, got %s", recorder.Body)
+		}
+	})
+}
+
+func TestLaunchFormFlush(t *testing.T) {
+	runner := useRunner(t)
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "response_id": {"1234"}, "action_flush": {"true"}}
+
+	recorder := postForm(t, values, "")
+	if recorder.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect to the flush form, got %d: %s", recorder.Code, recorder.Body)
+	}
+	location, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Path != "/flush" || location.Query().Get("schema_name") != "test_launch" || location.Query().Get("response_id") != "1234" {
+		t.Errorf("expected the flush form with the schema and response, got %s", location)
+	}
+	if location.Query().Get("period_id") != "" {
+		t.Errorf("expected only identifying metadata, got %s", location)
+	}
+	if received := runner.Received(); len(received) != 0 {
+		t.Errorf("expected nothing sent to the runner, got %v", received)
+	}
+}
@@ -4,9 +4,12 @@ go 1.16
 
 require (
 	github.com/AreaHQ/jsonhal v0.0.0-20160928112100-715ffaec982b
+	github.com/boombuler/barcode v1.0.1
 	github.com/gofrs/uuid v3.2.0+incompatible
 	github.com/gorilla/context v0.0.0-20160226214623-1ea25387ff6f // indirect
 	github.com/gorilla/mux v1.4.0
 	github.com/stretchr/testify v1.7.0 // indirect
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	gopkg.in/square/go-jose.v2 v2.1.2
+	gopkg.in/yaml.v3 v3.0.0-20200506231410-2ff61e1afc86
 )
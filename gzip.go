@@ -0,0 +1,156 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// uncompressibleTypes are content type prefixes which are already compressed, or too small to be worth compressing
+var uncompressibleTypes = []string{"image/", "video/", "audio/", "application/gzip", "application/zip", "application/jwt"}
+
+// gzipMiddleware compresses responses of at least GZIP_MIN_BYTES for clients which accept gzip. Responses are only
+// buffered up to that size, so streamed responses are compressed as they are written.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(r) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, minBytes: settings.GetInt("GZIP_MIN_BYTES")}
+		defer gw.close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(encoding), ";", 2)
+		if strings.EqualFold(parts[0], "gzip") {
+			return len(parts) == 1 || strings.TrimSpace(parts[1]) != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the start of a response until it knows whether it is large enough to compress
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minBytes int
+
+	status  int
+	buffer  []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	if !w.decided {
+		if len(w.buffer)+len(data) < w.minBytes {
+			w.buffer = append(w.buffer, data...)
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends whatever has been written so far, compressing it if the response can be compressed
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buffer) >= w.minBytes)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// decide writes the response headers and any buffered data, compressing the response when large is true and the
+// response is of a type which is worth compressing
+func (w *gzipResponseWriter) decide(large bool) error {
+	w.decided = true
+
+	header := w.Header()
+	if large && w.compressible() {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buffered := w.buffer
+	w.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buffered)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffered)
+	return err
+}
+
+func (w *gzipResponseWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || w.status < 200 || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buffer)
+		header.Set("Content-Type", contentType)
+	}
+	for _, uncompressible := range uncompressibleTypes {
+		if strings.HasPrefix(contentType, uncompressible) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		if w.status == 0 {
+			// Nothing was written, so leave the response to net/http
+			return
+		}
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
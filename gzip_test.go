@@ -0,0 +1,120 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	withSetting(t, "GZIP_MIN_BYTES", "1024")
+	large := strings.Repeat("<li>survey</li>", 200)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		etag           string
+		body           string
+		wantGzip       bool
+		wantETag       string
+	}{
+		{"large response", "gzip, deflate", "text/html; charset=utf-8", "", large, true, ""},
+		{"small response", "gzip", "text/html; charset=utf-8", "", "<p>small</p>", false, ""},
+		{"gzip not accepted", "deflate", "text/html; charset=utf-8", "", large, false, ""},
+		{"gzip refused", "gzip;q=0", "text/html; charset=utf-8", "", large, false, ""},
+		{"token result", "gzip", "application/jwt", "", large, false, ""},
+		{"already compressed", "gzip", "image/png", "", large, false, ""},
+		{"strong etag is weakened", "gzip", "application/json", `"abc"`, large, true, `W/"abc"`},
+		{"uncompressed etag is kept", "gzip", "application/json", `"abc"`, "{}", false, `"abc"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				if test.etag != "" {
+					w.Header().Set("ETag", test.etag)
+				}
+				w.Write([]byte(test.body[:len(test.body)/2]))
+				w.Write([]byte(test.body[len(test.body)/2:]))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if vary := recorder.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("expected Vary Accept-Encoding, got %q", vary)
+			}
+			if test.wantETag != "" && recorder.Header().Get("ETag") != test.wantETag {
+				t.Errorf("expected ETag %s, got %s", test.wantETag, recorder.Header().Get("ETag"))
+			}
+
+			body := recorder.Body.String()
+			if encoding := recorder.Header().Get("Content-Encoding"); (encoding == "gzip") != test.wantGzip {
+				t.Fatalf("expected gzip %v, got Content-Encoding %q", test.wantGzip, encoding)
+			}
+			if test.wantGzip {
+				body = gunzip(t, recorder.Body.String())
+			}
+			if body != test.body {
+				t.Errorf("expected the uncompressed response, got %q", body)
+			}
+		})
+	}
+}
+
+func TestGzipMiddlewareStreaming(t *testing.T) {
+	withSetting(t, "GZIP_MIN_BYTES", "1024")
+
+	flushed := make(chan string)
+	handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		for i := 0; i < 3; i++ {
+			w.Write([]byte(strings.Repeat("line\n", 300)))
+			w.(http.Flusher).Flush()
+			flushed <- w.Header().Get("Content-Encoding")
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(recorder, req)
+		close(done)
+	}()
+
+	for i := 0; i < 3; i++ {
+		if encoding := <-flushed; encoding != "gzip" {
+			t.Errorf("expected the stream to be compressed as it is written, got Content-Encoding %q", encoding)
+		}
+	}
+	<-done
+
+	if !recorder.Flushed {
+		t.Error("expected flushes to reach the client")
+	}
+	if body := gunzip(t, recorder.Body.String()); body != strings.Repeat("line\n", 900) {
+		t.Errorf("expected the streamed response, got %d bytes", len(body))
+	}
+}
+
+func gunzip(t *testing.T, compressed string) string {
+	t.Helper()
+	reader, err := gzip.NewReader(strings.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("failed to read gzip: %v", err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	return string(body)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// wantsCookieHandoff reports whether a launch asked, with redirect=cookie, to hand the token to the runner in a cookie
+// rather than in the URL. It needs LAUNCH_COOKIE_NAME.
+func wantsCookieHandoff(r *http.Request) bool {
+	return settings.Get("LAUNCH_COOKIE_NAME") != "" && r.URL.Query().Get("redirect") == "cookie"
+}
+
+// writeCookieHandoff sets the token as a cookie which lasts as long as the token, then redirects to the runner's
+// LAUNCH_COOKIE_REDIRECT_PATH. The runner must share LAUNCH_COOKIE_DOMAIN with the launcher to be sent the cookie.
+func writeCookieHandoff(w http.ResponseWriter, r *http.Request, launch *authentication.Launch) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     settings.Get("LAUNCH_COOKIE_NAME"),
+		Value:    launch.Token,
+		Path:     "/",
+		Domain:   settings.Get("LAUNCH_COOKIE_DOMAIN"),
+		Expires:  launch.ExpiresAt,
+		MaxAge:   int(time.Until(launch.ExpiresAt) / time.Second),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, cookieRedirectURL(), http.StatusFound)
+}
+
+// cookieRedirectURL joins LAUNCH_COOKIE_REDIRECT_PATH to SURVEY_RUNNER_URL, which may end in a slash
+func cookieRedirectURL() string {
+	redirectPath := settings.Get("LAUNCH_COOKIE_REDIRECT_PATH")
+	redirectURL, err := clients.JoinURL(settings.Get("SURVEY_RUNNER_URL"), strings.Split(strings.Trim(redirectPath, "/"), "/")...)
+	if err != nil || strings.Trim(redirectPath, "/") == "" {
+		return settings.Get("SURVEY_RUNNER_URL") + redirectPath
+	}
+	return redirectURL
+}
+
+// runnerHandoffResponse is the runner's response when the launcher started a session with a token itself
+type runnerHandoffResponse struct {
+	TxID     string `json:"tx_id"`
+	Status   int    `json:"status"`
+	Location string `json:"location,omitempty"`
+	Body     string `json:"body,omitempty"`
+}
+
+// postRunnerHandoffAPIHandler generates a token as the token API does, then starts a runner session with it, for
+// end-to-end tests which don't drive a browser. The runner's status and where it redirects to are returned.
+func postRunnerHandoffAPIHandler(w http.ResponseWriter, r *http.Request) {
+	method := strings.ToUpper(settings.Get("RUNNER_HANDOFF_METHOD"))
+	if method != http.MethodGet && method != http.MethodPost {
+		writeAPIError(w, r, http.StatusInternalServerError, authentication.LaunchErrorConfiguration, fmt.Sprintf("RUNNER_HANDOFF_METHOD %q is not GET or POST", settings.Get("RUNNER_HANDOFF_METHOD")))
+		return
+	}
+
+	launch, schemaName, ok := generateTokenRequestLaunch(w, r, false)
+	if !ok {
+		return
+	}
+
+	response, err := clients.Handoff(r.Context(), method, authentication.HandoffURL(launch.Token))
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("runner handoff failed", "error", err)
+		writeAPIError(w, r, http.StatusBadGateway, authentication.LaunchErrorUpstream, fmt.Sprintf("The survey runner could not be reached: %v", err))
+		return
+	}
+	logging.FromContext(r.Context()).Info("handed off launch to runner", "schema_name", schemaName, "status", response.StatusCode)
+
+	writeJSON(w, r, http.StatusOK, runnerHandoffResponse{
+		TxID:     claimString(launch.Claims, "tx_id"),
+		Status:   response.StatusCode,
+		Location: response.Location,
+		Body:     response.Body,
+	})
+}
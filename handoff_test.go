@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+)
+
+func TestWriteCookieHandoff(t *testing.T) {
+	tests := []struct {
+		name         string
+		runnerURL    string
+		redirectPath string
+		want         string
+	}{
+		{"default", "http://runner", "/session", "http://runner/session"},
+		{"trailing slash", "http://runner/", "/session", "http://runner/session"},
+		{"path prefix", "http://proxy/runner/", "/session/start", "http://proxy/runner/session/start"},
+		{"root", "http://runner", "/", "http://runner/"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SURVEY_RUNNER_URL", test.runnerURL)
+			withSetting(t, "LAUNCH_COOKIE_REDIRECT_PATH", test.redirectPath)
+			withSetting(t, "LAUNCH_COOKIE_NAME", "runner_token")
+
+			recorder := httptest.NewRecorder()
+			launch := &authentication.Launch{Token: "abc", ExpiresAt: time.Now().Add(time.Hour)}
+			writeCookieHandoff(recorder, httptest.NewRequest(http.MethodGet, "/quick-launch", nil), launch)
+
+			if recorder.Code != http.StatusFound {
+				t.Errorf("expected 302, got %d", recorder.Code)
+			}
+			if location := recorder.Header().Get("Location"); location != test.want {
+				t.Errorf("expected a redirect to %s, got %s", test.want, location)
+			}
+			cookies := recorder.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != "runner_token" || cookies[0].Value != "abc" || !cookies[0].HttpOnly {
+				t.Errorf("expected an HttpOnly runner_token cookie, got %v", cookies)
+			}
+		})
+	}
+}
+
+func TestPostRunnerHandoffAPI(t *testing.T) {
+	runner := useRunner(t)
+
+	var method, token string
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, token = r.Method, r.URL.Query().Get("token")
+		if r.URL.Path != "/session" || token == "" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/questionnaire/test_launch/", http.StatusFound)
+	}))
+	t.Cleanup(stub.Close)
+	withSetting(t, "RUNNER_HANDOFF_URL", stub.URL)
+
+	body := `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605", "ref_p_start_date": "2016-05-01"}}`
+
+	tests := []struct {
+		name   string
+		method string
+	}{
+		{"GET", "GET"},
+		{"POST", "POST"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "RUNNER_HANDOFF_METHOD", test.method)
+			method, token = "", ""
+
+			recorder := postAPI(t, "/api/handoff", body)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+			}
+
+			var response runnerHandoffResponse
+			decodeResponse(t, recorder, &response)
+			if method != test.method {
+				t.Errorf("expected the runner to be sent a %s, got %q", test.method, method)
+			}
+			claims, err := runner.Claims(token)
+			if err != nil {
+				t.Fatalf("the runner couldn't read the token it was handed: %v", err)
+			}
+			if response.TxID == "" || response.TxID != claims["tx_id"] {
+				t.Errorf("expected the handed off token's tx_id %v, got %q", claims["tx_id"], response.TxID)
+			}
+			if response.Status != http.StatusFound || response.Location != "/questionnaire/test_launch/" {
+				t.Errorf("expected the runner's redirect to be relayed, got %+v", response)
+			}
+		})
+	}
+}
+
+func TestPostRunnerHandoffAPIErrors(t *testing.T) {
+	useRunner(t)
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		runnerURL  string
+		wantStatus int
+	}{
+		{"unreachable runner", "GET", unreachable.URL, http.StatusBadGateway},
+		{"invalid method", "PUT", unreachable.URL, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "RUNNER_HANDOFF_METHOD", test.method)
+			withSetting(t, "RUNNER_HANDOFF_URL", test.runnerURL)
+
+			recorder := postAPI(t, "/api/handoff", `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605", "ref_p_start_date": "2016-05-01"}}`)
+			if recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			if strings.Contains(recorder.Body.String(), "token=") {
+				t.Errorf("expected the error not to include the token, got %s", recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/mockrunner"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// postAPI posts body to the launcher's API at path
+func postAPI(t *testing.T, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return route(t, req)
+}
+
+// decodeResponse decodes the JSON body of recorder into v
+func decodeResponse(t *testing.T, recorder *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("expected a JSON response, got %s: %s", contentType, recorder.Body)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+}
+
+// withSetting sets the setting for the test, restoring its previous value afterwards
+func withSetting(t *testing.T, name string, value string) {
+	t.Helper()
+	previous := settings.Get(name)
+	settings.Set(name, value)
+	t.Cleanup(func() { settings.Set(name, previous) })
+}
+
+// launchSchema requires ru_ref, period_id and ref_p_start_date, with an optional trad_as
+const launchSchema = `{
+	"schema_name": "test_launch",
+	"metadata": [
+		{"name": "ru_ref", "type": "string"},
+		{"name": "period_id", "type": "string"},
+		{"name": "ref_p_start_date", "type": "date"},
+		{"name": "trad_as", "type": "string", "optional": true}
+	]
+}`
+
+// useRunner points the launcher at new test keys, a mock runner holding the other half of them, and a runner
+// schema server with test_launch
+func useRunner(t *testing.T) *mockrunner.Runner {
+	t.Helper()
+	for _, name := range []string{"JWT_SIGNING_KEY_PATH", "JWT_ENCRYPTION_KEY_PATH"} {
+		withSetting(t, name, settings.Get(name))
+	}
+
+	keys, err := mockrunner.UseTestKeys(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to generate test keys: %v", err)
+	}
+	runnerServer, runner := mockrunner.NewServer(keys.DecryptionKey, keys.VerificationKey)
+	t.Cleanup(runnerServer.Close)
+	withSetting(t, "SURVEY_RUNNER_URL", runnerServer.URL)
+
+	schemaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/schemas":
+			w.Write([]byte(`["test_launch"]`))
+		case "/schemas/test_launch":
+			w.Write([]byte(launchSchema))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(schemaServer.Close)
+	withSetting(t, "SURVEY_RUNNER_SCHEMA_URL", schemaServer.URL)
+
+	return runner
+}
+
+// route sends req to the launcher's router, returning the response
+func route(t *testing.T, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	newRouter().ServeHTTP(recorder, req)
+	return recorder
+}
+
+// sessionClaims returns the claims of the token in a runner session URL, as the runner would read them
+func sessionClaims(t *testing.T, runner *mockrunner.Runner, sessionURL string) map[string]interface{} {
+	t.Helper()
+	if !strings.HasPrefix(sessionURL, settings.Get("SURVEY_RUNNER_URL")+"/session?") {
+		t.Fatalf("expected a runner session URL, got %q", sessionURL)
+	}
+	parsedURL, err := url.Parse(sessionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := runner.Claims(parsedURL.Query().Get("token"))
+	if err != nil {
+		t.Fatalf("the runner couldn't read the token: %v", err)
+	}
+	return claims
+}
+
+// postForm posts values to the launch form, with the Accept header when it isn't empty
+func postForm(t *testing.T, values url.Values, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return route(t, req)
+}
+
+// withPersonas loads personasJSON as the personas for the rest of the test, or none when it is empty
+func withPersonas(t *testing.T, personasJSON string) {
+	t.Helper()
+	path := ""
+	if personasJSON != "" {
+		path = filepath.Join(t.TempDir(), "personas.json")
+		if err := ioutil.WriteFile(path, []byte(personasJSON), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withSetting(t, "PERSONAS_PATH", path)
+
+	reset := func() { personasOnce, personas, personasErr = sync.Once{}, nil, nil }
+	reset()
+	t.Cleanup(reset)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/metrics"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+)
+
+// maxSchemaLabels caps the number of distinct schema names used as a metric label
+const maxSchemaLabels = 200
+
+var (
+	launchesTotal = metrics.NewCounterVec(
+		"launcher_launches_total", "Launch attempts by outcome and schema name.", "outcome", "schema")
+	schemaFetchDuration = metrics.NewHistogram(
+		"launcher_schema_fetch_duration_seconds", "Time spent fetching schemas for a launch.", metrics.DefaultBuckets)
+	schemaValidationDuration = metrics.NewHistogram(
+		"launcher_schema_validation_duration_seconds", "Time spent validating quick-launch schemas.", metrics.DefaultBuckets)
+	tokenGenerationDuration = metrics.NewHistogram(
+		"launcher_token_generation_duration_seconds", "Time spent signing and encrypting tokens.", metrics.DefaultBuckets)
+	availableSchemas = metrics.NewGauge(
+		"launcher_available_schemas", "Number of schemas in the most recently loaded schema list.")
+	_ = metrics.NewGaugeFunc(
+		"launcher_key_age_seconds", "Time since each JWT key file was modified.", "key", keyAges)
+
+	schemaLabels = metrics.NewLabelLimiter(maxSchemaLabels)
+)
+
+func keyAges() map[string]float64 {
+	ages := make(map[string]float64)
+	for name, age := range authentication.KeyAges() {
+		ages[name] = age.Seconds()
+	}
+	return ages
+}
+
+// recordLaunch records the outcome and stage timings of a launch attempt, and adds it to the recent launches. launch
+// is nil when the launch failed, or when more than one token was generated.
+func recordLaunch(r *http.Request, schemaName string, timings *authentication.Timings, launch *authentication.Launch, err *authentication.LaunchError) {
+	outcome := "success"
+	if err != nil {
+		outcome = err.Kind
+	}
+	launchesTotal.Inc(outcome, schemaLabels.Value(schemaName))
+
+	if timings.SchemaFetch > 0 {
+		schemaFetchDuration.Observe(timings.SchemaFetch)
+	}
+	if timings.Validation > 0 {
+		schemaValidationDuration.Observe(timings.Validation)
+	}
+	if timings.TokenGeneration > 0 {
+		tokenGenerationDuration.Observe(timings.TokenGeneration)
+	}
+
+	recordRecentLaunch(r, schemaName, timings, launch, err)
+}
+
+func recordSchemaCount(schemas surveys.LauncherSchemas) {
+	availableSchemas.Set(float64(len(schemas.Business) + len(schemas.CCS) + len(schemas.Census) +
+		len(schemas.Social) + len(schemas.Test) + len(schemas.Other)))
+}
+
+// schemaNameFromURL returns the file name of a quick-launch schema URL without its extension, for use as a label
+func schemaNameFromURL(schemaURL string) string {
+	name := path.Base(strings.SplitN(schemaURL, "?", 2)[0])
+	return strings.TrimSuffix(name, path.Ext(name))
+}
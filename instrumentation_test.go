@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestSchemaNameFromURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		schemaURL string
+		want      string
+	}{
+		{"json file", "https://schemas.example.com/schemas/test_checkbox.json", "test_checkbox"},
+		{"query string", "https://schemas.example.com/test_checkbox.json?bust=20170501", "test_checkbox"},
+		{"no extension", "https://schemas.example.com/census", "census"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := schemaNameFromURL(test.schemaURL); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// lastValuesCookie holds the last values submitted on the launch form, used to pre-populate it on the next visit
+const lastValuesCookie = "launcher_last_values"
+
+// maxLastValuesCookieBytes keeps the cookie well inside the 4KB browsers allow for a cookie. Values which don't fit
+// aren't remembered.
+const maxLastValuesCookieBytes = 3072
+
+// lastValuesMaxAge is how long, in seconds, values are remembered for after the last launch
+const lastValuesMaxAge = 30 * 24 * 60 * 60
+
+// unrememberedValues are form values which identify a single launch, or are derived from the request, so are never
+// stored in the cookie
+var unrememberedValues = map[string]bool{
+	"jti":                         true,
+	"tx_id":                       true,
+	"collection_exercise_sid":     true,
+	"response_id":                 true,
+	"case_id":                     true,
+	"questionnaire_id":            true,
+	"user_id":                     true,
+	"account_service_url":         true,
+	"account_service_log_out_url": true,
+	"action_launch":               true,
+	"action_flush":                true,
+	"action_reset":                true,
+}
+
+var errLastValuesTooLarge = errors.New("last values are too large for a cookie")
+var errLastValuesInvalid = errors.New("last values cookie is invalid or has been tampered with")
+
+var (
+	lastValuesKeyOnce sync.Once
+	lastValuesKey     []byte
+)
+
+// lastValuesSigningKey returns LAST_VALUES_COOKIE_KEY, or a random key for the life of the process when it isn't set,
+// in which case remembered values are lost on restart
+func lastValuesSigningKey() []byte {
+	lastValuesKeyOnce.Do(func() {
+		if key := settings.Get("LAST_VALUES_COOKIE_KEY"); key != "" {
+			lastValuesKey = []byte(key)
+			return
+		}
+
+		lastValuesKey = make([]byte, 32)
+		if _, err := rand.Read(lastValuesKey); err != nil {
+			logging.Fatal("failed to generate last values cookie key", "error", err)
+		}
+	})
+	return lastValuesKey
+}
+
+// encodeLastValues serialises the rememberable form values as base64 query string, followed by a dot and the base64
+// HMAC-SHA256 of it
+func encodeLastValues(values url.Values, key []byte) (string, error) {
+	remembered := url.Values{}
+	for name, value := range values {
+		if !unrememberedValues[name] {
+			remembered[name] = value
+		}
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(remembered.Encode()))
+	encoded := payload + "." + base64.RawURLEncoding.EncodeToString(lastValuesMAC(payload, key))
+	if len(encoded) > maxLastValuesCookieBytes {
+		return "", errLastValuesTooLarge
+	}
+	return encoded, nil
+}
+
+// decodeLastValues returns the values in a cookie written by encodeLastValues, after checking its signature
+func decodeLastValues(encoded string, key []byte) (url.Values, error) {
+	separator := strings.LastIndex(encoded, ".")
+	if separator < 0 || len(encoded) > maxLastValuesCookieBytes {
+		return nil, errLastValuesInvalid
+	}
+
+	payload := encoded[:separator]
+	signature, err := base64.RawURLEncoding.DecodeString(encoded[separator+1:])
+	if err != nil || !hmac.Equal(signature, lastValuesMAC(payload, key)) {
+		return nil, errLastValuesInvalid
+	}
+
+	query, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errLastValuesInvalid
+	}
+	values, err := url.ParseQuery(string(query))
+	if err != nil {
+		return nil, errLastValuesInvalid
+	}
+
+	// Never hand back values which shouldn't have been stored, whatever the cookie holds
+	for name := range unrememberedValues {
+		values.Del(name)
+	}
+	return values, nil
+}
+
+func lastValuesMAC(payload string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// readLastValues returns the values remembered for the browser, or nil when there are none or the cookie is invalid
+func readLastValues(r *http.Request) url.Values {
+	cookie, err := r.Cookie(lastValuesCookie)
+	if err != nil {
+		return nil
+	}
+
+	values, err := decodeLastValues(cookie.Value, lastValuesSigningKey())
+	if err != nil {
+		logging.FromContext(r.Context()).Info("ignoring last values cookie", "error", err)
+		return nil
+	}
+	return values
+}
+
+// rememberLastValues stores the submitted form values in a cookie, or clears it when they are too large
+func rememberLastValues(w http.ResponseWriter, r *http.Request, values url.Values) {
+	encoded, err := encodeLastValues(values, lastValuesSigningKey())
+	if err != nil {
+		logging.FromContext(r.Context()).Info("not remembering launch values", "error", err)
+		forgetLastValues(w, r)
+		return
+	}
+
+	http.SetCookie(w, newLastValuesCookie(r, encoded, lastValuesMaxAge))
+}
+
+// forgetLastValues clears the cookie, so the launch form shows its defaults again
+func forgetLastValues(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, newLastValuesCookie(r, "", -1))
+}
+
+func newLastValuesCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     lastValuesCookie,
+		Value:    value,
+		Path:     basePath(r) + "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
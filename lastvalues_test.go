@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeLastValues(t *testing.T) {
+	key := []byte("test-key")
+	values := url.Values{
+		"schema_name":             {"test_launch"},
+		"ru_ref":                  {"12346789012A"},
+		"roles":                   {"dumper", "flusher"},
+		"tx_id":                   {"2f4c5b1d-6a3e-4b8f-9c7d-0e1f2a3b4c5d"},
+		"jti":                     {"3a4b5c6d"},
+		"collection_exercise_sid": {"789"},
+		"response_id":             {"123"},
+		"action_launch":           {"true"},
+	}
+
+	encoded, err := encodeLastValues(values, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	decoded, err := decodeLastValues(encoded, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "roles": {"dumper", "flusher"}}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("expected %v, got %v", want, decoded)
+	}
+}
+
+func TestDecodeLastValuesTampering(t *testing.T) {
+	key := []byte("test-key")
+	encoded, err := encodeLastValues(url.Values{"ru_ref": {"12346789012A"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	separator := strings.LastIndex(encoded, ".")
+	payload, signature := encoded[:separator], encoded[separator+1:]
+	forged := base64.RawURLEncoding.EncodeToString([]byte("ru_ref=99999999999Z"))
+
+	tests := []struct {
+		name    string
+		encoded string
+		key     []byte
+	}{
+		{"changed values", forged + "." + signature, key},
+		{"changed signature", payload + "." + base64.RawURLEncoding.EncodeToString([]byte("signature")), key},
+		{"different key", encoded, []byte("other-key")},
+		{"no signature", payload, key},
+		{"invalid base64", "!!!." + signature, key},
+		{"too large", strings.Repeat("a", maxLastValuesCookieBytes) + "." + signature, key},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if values, err := decodeLastValues(test.encoded, test.key); err != errLastValuesInvalid {
+				t.Errorf("expected the cookie to be rejected, got %v, %v", values, err)
+			}
+		})
+	}
+}
+
+func TestDecodeLastValuesDropsUnrememberedValues(t *testing.T) {
+	key := []byte("test-key")
+	payload := base64.RawURLEncoding.EncodeToString([]byte("ru_ref=12346789012A&tx_id=abc&response_id=123"))
+	encoded := payload + "." + base64.RawURLEncoding.EncodeToString(lastValuesMAC(payload, key))
+
+	values, err := decodeLastValues(encoded, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (url.Values{"ru_ref": {"12346789012A"}}); !reflect.DeepEqual(values, want) {
+		t.Errorf("expected %v, got %v", want, values)
+	}
+}
+
+func TestEncodeLastValuesSizeCap(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{"fits", 1000, nil},
+		{"too large", maxLastValuesCookieBytes, errLastValuesTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := encodeLastValues(url.Values{"trad_as": {strings.Repeat("x", test.size)}}, []byte("test-key"))
+			if err != test.wantErr {
+				t.Fatalf("expected %v, got %v", test.wantErr, err)
+			}
+			if len(encoded) > maxLastValuesCookieBytes {
+				t.Errorf("expected at most %d bytes, got %d", maxLastValuesCookieBytes, len(encoded))
+			}
+		})
+	}
+}
+
+func TestLastValuesCookie(t *testing.T) {
+	useRunner(t)
+	withSetting(t, "URL_PREFIX", "/launcher")
+
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "tx_id": {"2f4c5b1d"}, "action_launch": {"true"}}
+	req := httptest.NewRequest(http.MethodPost, "/launcher/", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	cookie := lastValuesResponseCookie(t, route(t, req))
+
+	if cookie.Path != "/launcher/" || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Errorf("expected an HttpOnly, SameSite cookie for /launcher/, got %+v", cookie)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/launcher/", nil)
+	req.AddCookie(cookie)
+	body := route(t, req).Body.String()
+	if !strings.Contains(body, "12346789012A") {
+		t.Error("expected the form to be filled in with the last ru_ref")
+	}
+	if strings.Contains(body, "2f4c5b1d") {
+		t.Error("expected tx_id not to be remembered")
+	}
+
+	reset := url.Values{"action_reset": {"true"}}
+	req = httptest.NewRequest(http.MethodPost, "/launcher/", strings.NewReader(reset.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	if cleared := lastValuesResponseCookie(t, route(t, req)); cleared.Value != "" || cleared.MaxAge >= 0 {
+		t.Errorf("expected resetting to clear the cookie, got %+v", cleared)
+	}
+}
+
+func lastValuesResponseCookie(t *testing.T, recorder *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == lastValuesCookie {
+			return cookie
+		}
+	}
+	t.Fatalf("expected a %s cookie, got %v", lastValuesCookie, recorder.Header()["Set-Cookie"])
+	return nil
+}
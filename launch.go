@@ -1,21 +1,25 @@
 package main // import "github.com/ONSdigital/eq-questionnaire-launcher"
 
 import (
-	"fmt"
+	"bytes"
+	"errors"
 
 	"html/template"
-	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 
 	"html"
 
 	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/metrics"
+	"github.com/ONSdigital/eq-questionnaire-launcher/mockrunner"
 	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
 	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
-	"github.com/gofrs/uuid"
+	"github.com/ONSdigital/eq-questionnaire-launcher/version"
 	"github.com/gorilla/mux"
 	"gopkg.in/square/go-jose.v2/json"
 )
@@ -30,69 +34,174 @@ func randomNumericString(n int) string {
 	return string(output)
 }
 
+var templateFuncs = template.FuncMap{
+	"launcherVersion": func() string { return version.Get().Version },
+}
+
 func serveTemplate(templateName string, data interface{}, w http.ResponseWriter, r *http.Request) {
-	lp := filepath.Join("templates", "layout.html")
-	fp := filepath.Join("templates", filepath.Clean(templateName))
+	serveTemplateStatus(http.StatusOK, templateName, data, w, r)
+}
+
+// serveTemplateStatus renders a template with the given status. The page is rendered before anything is written, so
+// a template which fails to render gives a 500 rather than a partial page.
+func serveTemplateStatus(status int, templateName string, data interface{}, w http.ResponseWriter, r *http.Request) {
+	templates, err := pageTemplates()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to parse templates", "error", err)
+		http.Error(w, http.StatusText(500), 500)
+		return
+	}
 
-	// Return a 404 if the template doesn't exist or is directory
-	info, err := os.Stat(fp)
-	if err != nil && (os.IsNotExist(err) || info.IsDir()) {
-		log.Println("Cannot find: " + fp)
+	// Return a 404 if the template doesn't exist
+	tmpl, ok := templates[templateName]
+	if !ok {
+		logging.FromContext(r.Context()).Warn("cannot find template", "template", templateName)
 		http.NotFound(w, r)
 		return
 	}
 
-	tmpl, err := template.ParseFiles(lp, fp)
-	if err != nil {
-		log.Println(err.Error())
+	var rendered bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&rendered, "layout", data); err != nil {
+		logging.FromContext(r.Context()).Error("failed to render template", "template", templateName, "error", err)
 		http.Error(w, http.StatusText(500), 500)
 		return
 	}
 
-	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
-		log.Println(err.Error())
-		http.Error(w, http.StatusText(500), 500)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := rendered.WriteTo(w); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write template", "template", templateName, "error", err)
 	}
 }
 
 type page struct {
+	BasePath                string
 	Schemas                 surveys.LauncherSchemas
 	AccountServiceURL       string
 	AccountServiceLogOutURL string
+	LastValues              map[string][]string
+	Personas                []persona
+	FieldErrors             map[string]string
+
+	// ContentEncryptions are offered for the enc field, only when ENABLE_ENC_OVERRIDE is set.
+	ContentEncryptions []string
 }
 
-func getStatusPage(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("OK"))
+// errorStatus returns 503 for errors caused by an open circuit so they can be told apart from other failures
+func errorStatus(err error, defaultStatus int) int {
+	if errors.Is(err, clients.ErrCircuitOpen) {
+		return http.StatusServiceUnavailable
+	}
+	return defaultStatus
 }
 
 func getLaunchHandler(w http.ResponseWriter, r *http.Request) {
+	p := newLaunchPage(r, readLastValues(r))
+	recordSchemaCount(p.Schemas)
+	serveTemplate("launch.html", p, w, r)
+}
+
+// newLaunchPage returns the launch form, filled in with values
+func newLaunchPage(r *http.Request, values map[string][]string) page {
 	p := page{
-		Schemas:                 surveys.GetAvailableSchemas(),
+		BasePath:                basePath(r),
+		Schemas:                 surveys.GetAvailableSchemas(r.Context()),
 		AccountServiceURL:       getAccountServiceURL(r),
 		AccountServiceLogOutURL: getAccountServiceURL(r),
+		LastValues:              values,
 	}
-	serveTemplate("launch.html", p, w, r)
+	if settings.GetBool("ENABLE_ENC_OVERRIDE") {
+		p.ContentEncryptions = authentication.ContentEncryptions
+	}
+	if personas, err := getPersonas(); err != nil {
+		logging.FromContext(r.Context()).Error("failed to load personas", "error", err)
+	} else {
+		p.Personas = personas
+	}
+	return p
+}
+
+// writeLaunchFormFailure shows the launch form again with a 400, keeping the submitted values and marking each field
+// with the reason it is invalid
+func writeLaunchFormFailure(w http.ResponseWriter, r *http.Request, values url.Values, err *authentication.LaunchError) {
+	logging.FromContext(r.Context()).Warn("launch failed", "kind", err.Kind, "schema_name", authentication.TransformSchemaParamsToName(values), "error", err.Desc)
+
+	p := newLaunchPage(r, values)
+	p.FieldErrors = launchFieldErrors(err.Fields)
+
+	w.Header().Set("Cache-Control", "no-store")
+	serveTemplateStatus(http.StatusBadRequest, "launch.html", p, w, r)
+}
+
+// launchFieldErrors returns the reasons for each invalid field, joining them when a field has more than one
+func launchFieldErrors(fields []authentication.MetadataError) map[string]string {
+	fieldErrors := make(map[string]string)
+	for _, field := range fields {
+		if reason, ok := fieldErrors[field.Name]; ok {
+			fieldErrors[field.Name] = reason + "; " + field.Reason
+			continue
+		}
+		fieldErrors[field.Name] = field.Reason
+	}
+	return fieldErrors
 }
 
 func postLaunchHandler(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		http.Error(w, fmt.Sprintf("POST. r.ParseForm() err: %v", err), 500)
+		writeBodyFailure(w, r, err, "The launch form could not be read.")
+		return
+	}
+
+	if r.PostForm.Get("action_reset") != "" {
+		forgetLastValues(w, r)
+		http.Redirect(w, r, basePath(r)+"/", http.StatusSeeOther)
+		return
+	}
+
+	rememberLastValues(w, r, r.PostForm)
+
+	// Flushing is confirmed on the flush form before anything is sent to the runner
+	if r.PostForm.Get("action_flush") != "" {
+		http.Redirect(w, r, flushFormURL(r, r.PostForm), http.StatusSeeOther)
+		return
+	}
+	redirectURL(w, r, r.PostForm)
+}
+
+// getQueryLaunchHandler launches from the query string, so a launch can be bookmarked or shared as a link. Repeated
+// keys, such as roles, are kept as lists just as they are for a posted form. Flushing submits the response, so it isn't
+// left to a link which could be followed again, or prefetched, without anyone meaning to.
+func getQueryLaunchHandler(w http.ResponseWriter, r *http.Request) {
+	values := queryLaunchValues(r)
+	if _, ok := values["action_flush"]; ok {
+		writeRequestFailure(w, r, http.StatusBadRequest, "Responses can't be flushed from a launch link. Use the flush form at "+basePath(r)+"/flush instead.")
 		return
 	}
-	redirectURL(w, r)
+	values.Set("action_launch", "true")
+	redirectURL(w, r, values)
 }
 
 func getMetadataHandler(w http.ResponseWriter, r *http.Request) {
 	schema := r.URL.Query().Get("schema")
-	log.Println("Searching for schema: " + schema)
+	logging.FromContext(r.Context()).Info("searching for schema", "schema_name", schema)
+
+	if schema == "" {
+		writeRequestFailure(w, r, http.StatusBadRequest, "A schema parameter with the name of the schema is required.")
+		return
+	}
 
-	launcherSchema := surveys.FindSurveyByName(schema)
+	launcherSchema, err := surveys.FindSurveyByName(r.Context(), schema)
+	if err != nil {
+		writeLaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorSchemaNotFound, Desc: err.Error(), Err: err}, schema)
+		return
+	}
 
-	metadata, err := authentication.GetRequiredMetadata(launcherSchema)
+	ctx := authentication.ContextWithSchemaScheme(r.Context(), r.URL.Query().Get("schema_scheme"))
+	metadata, metadataErr := authentication.GetRequiredMetadata(ctx, launcherSchema, r.URL.Query().Get("language_code"))
 
-	if err != "" {
-		http.Error(w, fmt.Sprintf("GetRequiredMetadata err: %v", err), 500)
+	if metadataErr != nil {
+		writeLaunchFailure(w, r, metadataErr, launcherSchema.Name)
 		return
 	}
 
@@ -104,93 +213,308 @@ func getMetadataHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func getAccountServiceURL(r *http.Request) string {
-	forwardedProtocol := r.Header.Get("X-Forwarded-Proto")
+	return html.EscapeString(externalURL(r))
+}
 
-	requestProtocol := "http"
+func redirectURL(w http.ResponseWriter, r *http.Request, values url.Values) {
+	values, err := applyPersona(values)
+	if err != nil {
+		writeRequestFailure(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if forwardedProtocol != "" {
-		requestProtocol = forwardedProtocol
+	timings := &authentication.Timings{}
+	launch, launchErr := authentication.GenerateLaunch(authentication.ContextWithTimings(r.Context(), timings), "", values, authentication.TokenOptions{SignedCopy: wantsDebugClaims(r)})
+	recordLaunch(r, authentication.TransformSchemaParamsToName(values), timings, launch, launchErr)
+	if launchErr != nil {
+		// Invalid metadata posted from the form is shown against its fields, so it can be corrected and launched again
+		if r.Method == http.MethodPost && launchErr.Kind == authentication.LaunchErrorMetadata && !wantsJSON(r) {
+			writeLaunchFormFailure(w, r, values, launchErr)
+			return
+		}
+		writeLaunchFailure(w, r, launchErr, authentication.TransformSchemaParamsToName(values))
+		return
 	}
+	auditLaunch(r, launch, authentication.TransformSchemaParamsToName(values))
+	setLaunchHeaders(w, launch)
+	token := launch.Token
 
-	return fmt.Sprintf("%s://%s",
-		requestProtocol,
-		html.EscapeString(r.Host))
-}
+	launchAction := values.Get("action_launch")
+	logging.FromContext(r.Context()).Debug("launch request", "form", values.Encode())
 
-func redirectURL(w http.ResponseWriter, r *http.Request) {
-	hostURL := settings.Get("SURVEY_RUNNER_URL")
+	if launchAction != "" && wantsDirectRedirect(r) {
+		http.Redirect(w, r, launch.URL, http.StatusFound)
+		return
+	}
 
-	token, err := authentication.GenerateTokenFromPost(r.PostForm)
-	if err != "" {
-		http.Error(w, err, 500)
+	if launchAction != "" && wantsCookieHandoff(r) {
+		writeCookieHandoff(w, r, launch)
 		return
 	}
 
-	launchAction := r.PostForm.Get("action_launch")
-	flushAction := r.PostForm.Get("action_flush")
-	log.Println("Request: " + r.PostForm.Encode())
+	if wantsJWT(r) {
+		writeJWT(w, r, token)
+		return
+	}
 
-	if flushAction != "" {
-		http.Redirect(w, r, hostURL+"/flush?token="+token, 307)
+	if r.URL.Query().Get("format") == "qr" {
+		writeQRCode(w, r, launch.URL)
+		return
+	}
+
+	if wantsJSON(r) {
+		if launchAction == "" {
+			writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, "Invalid Action")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, newLaunchResponse(r, launch, launch.URL))
+		return
+	}
+
+	if launchAction != "" && settings.Get("LAUNCH_TEMPLATE_PATH") != "" {
+		serveLaunchedPage(w, r, launch, authentication.TransformSchemaParamsToName(values))
 	} else if launchAction != "" {
-		http.Redirect(w, r, hostURL+"/session?token="+token, 301)
+		http.Redirect(w, r, launch.URL, 301)
 	} else {
-		http.Error(w, fmt.Sprintf("Invalid Action"), 500)
+		writeRequestFailure(w, r, http.StatusBadRequest, "Invalid Action: choose to open or flush the survey.")
 	}
 }
 
+// launchJTIHeader carries the jti of a generated token, so callers can dedupe launches without decoding the token
+const launchJTIHeader = "X-Launch-Jti"
+
+// launchWarningHeader carries each of a launch's warnings, which are otherwise lost when it redirects to the runner
+const launchWarningHeader = "X-Launch-Warning"
+
+func setLaunchHeaders(w http.ResponseWriter, launch *authentication.Launch) {
+	if jti := claimString(launch.Claims, "jti"); jti != "" {
+		w.Header().Set(launchJTIHeader, jti)
+	}
+	for _, warning := range launch.Warnings {
+		w.Header().Add(launchWarningHeader, warning)
+	}
+}
+
+// wantsDirectRedirect reports whether a GET launch asked, with redirect=true, to go straight to the runner whatever
+// format would otherwise be returned. The redirect is a 302 so that a bookmarked launch link isn't cached by the
+// browser along with its token, which soon expires.
+func wantsDirectRedirect(r *http.Request) bool {
+	return r.Method == http.MethodGet && r.URL.Query().Get("redirect") == "true"
+}
+
+// queryLaunchValues returns the launch values in the query string, without the parameters which only choose how the
+// launch is responded to
+func queryLaunchValues(r *http.Request) url.Values {
+	values := r.URL.Query()
+	authentication.StripResponseParameters(values)
+	return values
+}
+
 func quickLauncherHandler(w http.ResponseWriter, r *http.Request) {
-	hostURL := settings.Get("SURVEY_RUNNER_URL")
 	accountServiceURL := getAccountServiceURL(r)
 	AccountServiceLogOutURL := getAccountServiceURL(r)
-	urlValues := r.URL.Query()
+	urlValues := queryLaunchValues(r)
 	surveyURL := urlValues.Get("url")
-	defaultValues := authentication.GetDefaultValues()
-	log.Println("Quick launch request received", surveyURL)
+	logging.FromContext(r.Context()).Info("quick launch request received", "survey_url", surveyURL)
+	defaultValues, defaultsErr := authentication.GetDefaultValues()
+	if defaultsErr != nil {
+		writeLaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: defaultsErr.Error()}, schemaNameFromURL(surveyURL))
+		return
+	}
 
 	urlValues.Add("ru_ref", defaultValues["ru_ref"])
-	collectionExerciseSid, _ := uuid.NewV4()
-	caseID, _ := uuid.NewV4()
-	urlValues.Add("collection_exercise_sid", collectionExerciseSid.String())
-	urlValues.Add("case_id", caseID.String())
+	collectionExerciseSid, err := authentication.NewIdentifier()
+	if err != nil {
+		writeLaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: err.Error()}, schemaNameFromURL(surveyURL))
+		return
+	}
+	caseID, err := authentication.NewIdentifier()
+	if err != nil {
+		writeLaunchFailure(w, r, &authentication.LaunchError{Kind: authentication.LaunchErrorIdentifier, Desc: err.Error()}, schemaNameFromURL(surveyURL))
+		return
+	}
+	urlValues.Add("collection_exercise_sid", collectionExerciseSid)
+	urlValues.Add("case_id", caseID)
 	urlValues.Add("questionnaire_id", randomNumericString(16))
 	urlValues.Add("response_id", randomNumericString(16))
 	urlValues.Add("language_code", defaultValues["language_code"])
 
-	token, err := authentication.GenerateTokenFromDefaults(surveyURL, accountServiceURL, AccountServiceLogOutURL, urlValues)
-	if err != "" {
-		http.Error(w, err, 400)
+	timings := &authentication.Timings{}
+	launch, launchErr := authentication.GenerateLaunchFromDefaults(authentication.ContextWithTimings(r.Context(), timings), surveyURL, accountServiceURL, AccountServiceLogOutURL, urlValues, authentication.TokenOptions{SignedCopy: wantsDebugClaims(r)})
+	recordLaunch(r, schemaNameFromURL(surveyURL), timings, launch, launchErr)
+	if launchErr != nil {
+		writeLaunchFailure(w, r, launchErr, schemaNameFromURL(surveyURL))
+		return
+	}
+	auditLaunch(r, launch, schemaNameFromURL(surveyURL))
+	setLaunchHeaders(w, launch)
+	token := launch.Token
+
+	if wantsDirectRedirect(r) {
+		http.Redirect(w, r, launch.URL, http.StatusFound)
+		return
+	}
+
+	if wantsJWT(r) {
+		writeJWT(w, r, token)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, r, http.StatusOK, newLaunchResponse(r, launch, launch.URL))
 		return
 	}
 
 	if surveyURL != "" {
-		http.Redirect(w, r, hostURL+"/session?token="+token, 302)
+		http.Redirect(w, r, launch.URL, 302)
 	} else {
-		http.Error(w, fmt.Sprintf("Not Found"), 404)
+		writeRequestFailure(w, r, http.StatusBadRequest, "A url parameter with the URL of the schema to launch is required.")
 	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		os.Exit(runTokenCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		os.Exit(runKeygenCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	runServer()
+}
+
+// newRouter returns the launcher's handlers
+func newRouter() http.Handler {
 	r := mux.NewRouter()
 
 	// Launch handlers
 	r.HandleFunc("/", getLaunchHandler).Methods("GET")
 	r.HandleFunc("/", postLaunchHandler).Methods("POST")
-	r.HandleFunc("/metadata", getMetadataHandler).Methods("GET")
+	r.HandleFunc("/launch", getQueryLaunchHandler).Methods("GET")
+	r.Handle("/metadata", corsMiddleware(http.HandlerFunc(getMetadataHandler))).Methods("GET", "OPTIONS")
+	r.Handle("/personas", corsMiddleware(http.HandlerFunc(getPersonasHandler))).Methods("GET", "OPTIONS")
+
+	// Many launches of one schema at once, for handing out to research participants
+	r.HandleFunc("/bulk", getBulkLaunchHandler).Methods("GET")
+	r.HandleFunc("/bulk", postBulkLaunchHandler).Methods("POST")
+
+	// Flushing a response through the runner's /flush endpoint, after confirming the values
+	r.HandleFunc("/flush", getFlushHandler).Methods("GET")
+	r.HandleFunc("/flush", postFlushHandler).Methods("POST")
+
+	// QR code of a launch URL, for launching on mobile devices
+	r.HandleFunc("/qr", getQRCodeHandler).Methods("GET")
 
 	//Author Launcher with passed parameters in Url
 	r.HandleFunc("/quick-launch", quickLauncherHandler).Methods("GET")
 
-	// Status Page
-	r.HandleFunc("/status", getStatusPage).Methods("GET")
+	// JSON API, which can be called cross-origin
+	api := mux.NewRouter()
+	api.HandleFunc("/api/token", postTokenAPIHandler).Methods("POST")
+	api.HandleFunc("/api/token/bundle", postTokenBundleAPIHandler).Methods("POST")
+	api.HandleFunc("/api/token/batch", postBatchTokenAPIHandler).Methods("POST")
+	api.HandleFunc("/api/preflight", postPreflightAPIHandler).Methods("POST")
+	api.HandleFunc("/api/schema-launch", postSchemaLaunchAPIHandler).Methods("POST")
+	api.HandleFunc("/api/handoff", postRunnerHandoffAPIHandler).Methods("POST")
+	r.PathPrefix("/api/").Handler(corsMiddleware(api))
+
+	// Prometheus metrics
+	r.Handle("/metrics", corsMiddleware(metrics.Handler())).Methods("GET", "OPTIONS")
+
+	// Status Pages
+	r.Handle("/status", corsMiddleware(http.HandlerFunc(getReadyStatusHandler))).Methods("GET", "OPTIONS")
+	r.Handle("/status/ready", corsMiddleware(http.HandlerFunc(getReadyStatusHandler))).Methods("GET", "OPTIONS")
+	r.Handle("/status/live", corsMiddleware(http.HandlerFunc(getLiveStatusHandler))).Methods("GET", "OPTIONS")
+	r.Handle("/status/version", corsMiddleware(http.HandlerFunc(getVersionStatusHandler))).Methods("GET", "OPTIONS")
+	r.Handle("/status/algorithms", corsMiddleware(http.HandlerFunc(getAlgorithmsStatusHandler))).Methods("GET", "OPTIONS")
+	r.Handle("/.well-known/jwks.json", corsMiddleware(http.HandlerFunc(getJWKSHandler))).Methods("GET", "OPTIONS")
+
+	// Stand-in runner for checking tokens round trip without a real runner
+	if keyPath := settings.Get("MOCK_RUNNER_DECRYPTION_KEY_PATH"); keyPath != "" {
+		r.PathPrefix("/mock-runner/").Handler(newMockRunner(keyPath))
+	}
+
+	// Latest audit log entries, when AUDIT_LOG_PATH is set
+	r.HandleFunc("/admin/audit", getAuditHandler).Methods("GET")
+
+	// Recent launch attempts, for triaging launches which didn't work
+	r.HandleFunc("/admin/launches", getRecentLaunchesHandler).Methods("GET")
+
+	// Profiling, when ENABLE_PPROF is set
+	addPprofRoutes(r)
 
 	// Serve static assets
-	staticFs := http.FileServer(http.Dir("static"))
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", staticFs))
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", staticHandler()))
+
+	return requestIDMiddleware(gzipMiddleware(prefixMiddleware(maxBodyMiddleware(authMiddleware(r)))))
+}
+
+// newMockRunner returns a mock runner which decrypts tokens with the key at keyPath and verifies them with the
+// launcher's own signing key
+func newMockRunner(keyPath string) http.Handler {
+	decryptionKey, err := mockrunner.LoadDecryptionKey(keyPath)
+	if err != nil {
+		logging.Fatal("failed to load mock runner decryption key", "error", err)
+	}
+
+	verificationKey, err := authentication.SigningPublicKey()
+	if err != nil {
+		logging.Fatal("failed to load signing key for mock runner", "error", err)
+	}
+
+	return http.StripPrefix("/mock-runner", mockrunner.New(decryptionKey, verificationKey))
+}
 
+// runServer serves the launcher until it is shut down
+func runServer() {
 	// Bind to a port and pass our router in
-	hostname := settings.Get("GO_LAUNCH_A_SURVEY_LISTEN_HOST") + ":" + settings.Get("GO_LAUNCH_A_SURVEY_LISTEN_PORT")
+	hostname := settings.Get("LISTEN_ADDRESS")
+	if hostname == "" {
+		hostname = settings.Get("GO_LAUNCH_A_SURVEY_LISTEN_HOST") + ":" + settings.Get("GO_LAUNCH_A_SURVEY_LISTEN_PORT")
+	}
+
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		logging.Fatal("invalid TLS configuration", "error", err)
+	}
+
+	server := &http.Server{
+		Addr:      hostname,
+		Handler:   newRouter(),
+		TLSConfig: tlsConfig,
+	}
+	setServerLimits(server)
+
+	var redirectServer *http.Server
+	if tlsConfig != nil {
+		redirectServer = newRedirectServer(hostname)
+	}
 
-	log.Println("Listening on " + hostname)
-	log.Fatal(http.ListenAndServe(hostname, r))
+	buildInfo := version.Get()
+	logging.Info("starting", "version", buildInfo.Version, "commit", buildInfo.Commit, "build_time", buildInfo.BuildTime, "go_version", buildInfo.GoVersion)
+	logging.Info("listening", "address", hostname, "tls", tlsConfig != nil)
+	if _, err := pageTemplates(); err != nil {
+		logging.Fatal("invalid templates", "error", err)
+	}
+	if _, err := getPersonas(); err != nil {
+		logging.Fatal("invalid personas", "error", err)
+	}
+	if err := checkPprofSettings(); err != nil {
+		logging.Fatal("invalid profiler settings", "error", err)
+	}
+	if missing := authentication.MissingSettings(); len(missing) > 0 {
+		if settings.GetBool("STRICT_SETTINGS") {
+			logging.Fatal("required settings are not set", "settings", missing)
+		}
+		logging.Warn("required settings are not set, so launches will fail", "settings", missing)
+	}
+	openAuditLog()
+
+	if err := serve(server, redirectServer); err != nil {
+		logging.Fatal("server stopped", "error", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		logging.Error("failed to close audit log", "error", err)
+	}
+	logging.Info("server stopped")
 }
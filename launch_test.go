@@ -0,0 +1,472 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+func TestGetQueryLaunch(t *testing.T) {
+	runner := useRunner(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantRoles []interface{}
+	}{
+		{"repeated roles", "roles=dumper&roles=flusher", []interface{}{"dumper", "flusher"}},
+		{"single role", "roles=flusher", []interface{}{"flusher"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := "schema_name=test_launch&ru_ref=12346789012A&period_id=201605&trad_as=ESSENTIAL&" + test.query
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/launch?"+query, nil))
+
+			if recorder.Code != http.StatusMovedPermanently {
+				t.Fatalf("expected a redirect to the runner, got %d: %s", recorder.Code, recorder.Body)
+			}
+			claims := sessionClaims(t, runner, recorder.Header().Get("Location"))
+			if !reflect.DeepEqual(claims["roles"], test.wantRoles) {
+				t.Errorf("expected roles %v, got %v", test.wantRoles, claims["roles"])
+			}
+			if claims["ru_ref"] != "12346789012A" || claims["trad_as"] != "ESSENTIAL" || claims["schema_name"] != "test_launch" {
+				t.Errorf("expected the query values as claims, got %v", claims)
+			}
+		})
+	}
+}
+
+func TestGetQueryLaunchRejectsFlush(t *testing.T) {
+	useRunner(t)
+
+	for _, query := range []string{"action_flush=true", "action_flush=", "action_launch=true&action_flush=true"} {
+		t.Run(query, func(t *testing.T) {
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/launch?schema_name=test_launch&ru_ref=12346789012A&"+query, nil))
+
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", recorder.Code, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), "/flush") {
+				t.Errorf("expected the error to point to /flush, got %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestGetQueryLaunchMatchesPost(t *testing.T) {
+	runner := useRunner(t)
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "roles": {"dumper", "flusher"}}
+
+	getRecorder := route(t, httptest.NewRequest(http.MethodGet, "/launch?"+values.Encode(), nil))
+
+	values.Set("action_launch", "true")
+	postReq := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	postReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	postRecorder := route(t, postReq)
+
+	getClaims := sessionClaims(t, runner, getRecorder.Header().Get("Location"))
+	postClaims := sessionClaims(t, runner, postRecorder.Header().Get("Location"))
+	for _, name := range []string{"tx_id", "jti", "iat", "exp", "collection_exercise_sid", "case_id", "response_id", "questionnaire_id", "user_id"} {
+		delete(getClaims, name)
+		delete(postClaims, name)
+	}
+	if !reflect.DeepEqual(getClaims, postClaims) {
+		t.Errorf("expected the same claims from GET and POST, got %v and %v", getClaims, postClaims)
+	}
+}
+
+func TestLaunchContentNegotiation(t *testing.T) {
+	runner := useRunner(t)
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "action_launch": {"true"}}
+
+	htmlRecorder := postForm(t, values, "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	if htmlRecorder.Code != http.StatusMovedPermanently {
+		t.Errorf("expected the browser to be redirected to the runner, got %d", htmlRecorder.Code)
+	}
+	sessionClaims(t, runner, htmlRecorder.Header().Get("Location"))
+
+	jsonRecorder := postForm(t, values, "application/json")
+	if jsonRecorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", jsonRecorder.Code, jsonRecorder.Body)
+	}
+	var response launchResponse
+	decodeResponse(t, jsonRecorder, &response)
+	claims := sessionClaims(t, runner, response.LaunchURL)
+	if tokenClaims, err := runner.Claims(response.Token); err != nil || tokenClaims["tx_id"] != claims["tx_id"] {
+		t.Errorf("expected the token to be the launch_url's, got %v", err)
+	}
+	if response.ClaimsSummary["ru_ref"] != "12346789012A" {
+		t.Errorf("expected ru_ref in the claims summary, got %v", response.ClaimsSummary)
+	}
+}
+
+func TestLaunchContentNegotiationErrors(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name       string
+		values     url.Values
+		accept     string
+		wantStatus int
+		wantCode   string
+	}{
+		{"schema not found", url.Values{"schema_name": {"test_missing"}, "action_launch": {"true"}}, "application/json", http.StatusNotFound, "schema_not_found"},
+		{"invalid metadata", url.Values{"schema_name": {"test_launch"}, "ref_p_start_date": {"01/05/2016"}, "action_launch": {"true"}}, "application/json", http.StatusBadRequest, "metadata_error"},
+		{"no action", url.Values{"schema_name": {"test_launch"}}, "application/json", http.StatusBadRequest, "invalid_request"},
+		{"schema not found as HTML", url.Values{"schema_name": {"test_missing"}, "action_launch": {"true"}}, "", http.StatusNotFound, ""},
+		{"invalid metadata as HTML", url.Values{"schema_name": {"test_launch"}, "ref_p_start_date": {"01/05/2016"}, "action_launch": {"true"}}, "", http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := postForm(t, test.values, test.accept)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+			if test.wantCode == "" {
+				if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/html") {
+					t.Errorf("expected an HTML page, got %s", recorder.Header().Get("Content-Type"))
+				}
+				return
+			}
+			var response apiErrorResponse
+			decodeResponse(t, recorder, &response)
+			if response.Error.Code != test.wantCode {
+				t.Errorf("expected %s, got %+v", test.wantCode, response.Error)
+			}
+		})
+	}
+}
+
+func TestLaunchJWTResponse(t *testing.T) {
+	runner := useRunner(t)
+	query := "schema_name=test_launch&ru_ref=12346789012A&period_id=201605"
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+	}{
+		{"Accept header", "/launch?" + query, "application/jwt"},
+		{"format parameter", "/launch?format=jwt&" + query, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			recorder := route(t, req)
+
+			if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/jwt" {
+				t.Fatalf("expected a 200 application/jwt response, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+			}
+			claims, err := runner.Claims(recorder.Body.String())
+			if err != nil {
+				t.Fatalf("expected the bare token as the body, got %q: %v", recorder.Body.String(), err)
+			}
+			if claims["ru_ref"] != "12346789012A" {
+				t.Errorf("expected the launch's claims, got %v", claims)
+			}
+		})
+	}
+}
+
+func TestLaunchUnderURLPrefix(t *testing.T) {
+	runner := useRunner(t)
+	withSetting(t, "URL_PREFIX", "/launcher")
+
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "action_launch": {"true"}}
+	req := httptest.NewRequest(http.MethodPost, "/launcher/", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := route(t, req)
+	if recorder.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected a redirect to the runner, got %d", recorder.Code)
+	}
+	sessionClaims(t, runner, recorder.Header().Get("Location"))
+
+	reset := url.Values{"action_reset": {"true"}}
+	req = httptest.NewRequest(http.MethodPost, "/launcher/", strings.NewReader(reset.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if location := route(t, req).Header().Get("Location"); location != "/launcher/" {
+		t.Errorf("expected a redirect to /launcher/, got %s", location)
+	}
+
+	tests := []struct {
+		name            string
+		forwardedPrefix string
+		want            string
+	}{
+		{"URL_PREFIX", "", "http://launcher.example.com/launcher"},
+		{"X-Forwarded-Prefix", "/proxy/launcher", "http://launcher.example.com/proxy/launcher"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schemaURL := settings.Get("SURVEY_RUNNER_SCHEMA_URL") + "/schemas/test_launch"
+			req := httptest.NewRequest(http.MethodGet, "http://launcher.example.com/launcher/quick-launch?url="+url.QueryEscape(schemaURL), nil)
+			if test.forwardedPrefix != "" {
+				req.Header.Set("X-Forwarded-Prefix", test.forwardedPrefix)
+			}
+			recorder := route(t, req)
+			if recorder.Code != http.StatusFound {
+				t.Fatalf("expected a redirect to the runner, got %d: %s", recorder.Code, recorder.Body)
+			}
+
+			claims := sessionClaims(t, runner, recorder.Header().Get("Location"))
+			if claims["account_service_url"] != test.want {
+				t.Errorf("expected account_service_url %s, got %v", test.want, claims["account_service_url"])
+			}
+		})
+	}
+}
+
+func TestLaunchDirectRedirect(t *testing.T) {
+	runner := useRunner(t)
+	withPersonas(t, `{"welsh_trader": {"language_code": "cy", "trad_as": "MASNACHWR"}}`)
+	query := "schema_name=test_launch&ru_ref=12346789012A&period_id=201605&redirect=true"
+
+	tests := []struct {
+		name       string
+		path       string
+		accept     string
+		wantClaims map[string]interface{}
+	}{
+		{"launch", "/launch?" + query, "", map[string]interface{}{"ru_ref": "12346789012A"}},
+		{"instead of JSON", "/launch?" + query, "application/json", map[string]interface{}{"ru_ref": "12346789012A"}},
+		{"instead of the JWT", "/launch?format=jwt&" + query, "", map[string]interface{}{"ru_ref": "12346789012A"}},
+		{"with a persona", "/launch?persona=welsh_trader&" + query, "", map[string]interface{}{"language_code": "cy", "trad_as": "MASNACHWR"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			recorder := route(t, req)
+
+			if recorder.Code != http.StatusFound {
+				t.Fatalf("expected a 302 to the runner, got %d: %s", recorder.Code, recorder.Body)
+			}
+			claims := sessionClaims(t, runner, recorder.Header().Get("Location"))
+			for name, want := range test.wantClaims {
+				if claims[name] != want {
+					t.Errorf("expected %s %v, got %v", name, want, claims[name])
+				}
+			}
+			if _, ok := claims["redirect"]; ok {
+				t.Error("expected redirect not to be sent as a claim")
+			}
+		})
+	}
+}
+
+func TestLaunchDirectRedirectFailure(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{"invalid metadata", "schema_name=test_launch&ref_p_start_date=01/05/2016&redirect=true", http.StatusBadRequest},
+		{"unknown schema", "schema_name=test_missing&redirect=true", http.StatusNotFound},
+		{"unknown persona", "schema_name=test_launch&persona=nobody&redirect=true", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/launch?"+test.query, nil))
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+			if location := recorder.Header().Get("Location"); location != "" {
+				t.Errorf("expected an error page rather than a redirect, got a redirect to %s", location)
+			}
+			if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("expected an HTML error page, got %s", recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestQuickLaunchSchemaErrors(t *testing.T) {
+	useRunner(t)
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refused.Close()
+	invalidJSON := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>not a schema</html>`))
+	}))
+	t.Cleanup(invalidJSON.Close)
+
+	tests := []struct {
+		name       string
+		schemaURL  string
+		wantStatus int
+	}{
+		{"connection refused", refused.URL + "/test_launch.json", http.StatusBadGateway},
+		{"invalid JSON", invalidJSON.URL + "/test_launch.json", http.StatusUnprocessableEntity},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/quick-launch?url="+url.QueryEscape(test.schemaURL), nil))
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+			if strings.Contains(recorder.Body.String(), "goroutine") {
+				t.Errorf("expected an error page without a stack trace, got %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestGetMetadataErrors(t *testing.T) {
+	useRunner(t)
+	schemas := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schemas":
+			w.Write([]byte(`["test_launch", "test_broken"]`))
+		case "/schemas/test_launch":
+			w.Write([]byte(launchSchema))
+		default:
+			http.Error(w, "/etc/launcher/schemas/test_broken.json: permission denied", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(schemas.Close)
+	withSetting(t, "SURVEY_RUNNER_SCHEMA_URL", schemas.URL)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantCode   string
+	}{
+		{"no schema", "", http.StatusBadRequest, errorInvalidRequest},
+		{"unknown schema", "schema=test_missing", http.StatusNotFound, authentication.LaunchErrorSchemaNotFound},
+		{"schema service failing", "schema=test_broken", http.StatusBadGateway, authentication.LaunchErrorUpstream},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metadata?"+test.query, nil)
+			req.Header.Set("Accept", "application/json")
+			recorder := route(t, req)
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			var response apiErrorResponse
+			decodeResponse(t, recorder, &response)
+			if response.Error.Code != test.wantCode {
+				t.Errorf("expected code %s, got %+v", test.wantCode, response.Error)
+			}
+			if strings.Contains(recorder.Body.String(), "/etc/launcher") {
+				t.Errorf("expected the schema service's response only to be logged, got %s", recorder.Body)
+			}
+		})
+	}
+}
+
+func TestLaunchJTIHeader(t *testing.T) {
+	runner := useRunner(t)
+	query := "schema_name=test_launch&ru_ref=12346789012A&period_id=201605"
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+	}{
+		{"redirect", "/launch?" + query, ""},
+		{"JSON", "/launch?" + query, "application/json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			recorder := route(t, req)
+
+			var sessionURL string
+			if test.accept == "" {
+				sessionURL = recorder.Header().Get("Location")
+			} else {
+				var response launchResponse
+				decodeResponse(t, recorder, &response)
+				sessionURL = response.LaunchURL
+			}
+
+			jti := recorder.Header().Get(launchJTIHeader)
+			if jti == "" {
+				t.Fatalf("expected a %s header", launchJTIHeader)
+			}
+			if claims := sessionClaims(t, runner, sessionURL); claims["jti"] != jti {
+				t.Errorf("expected the token's jti %v, got %s", claims["jti"], jti)
+			}
+		})
+	}
+
+	failed := route(t, httptest.NewRequest(http.MethodGet, "/launch?schema_name=test_missing", nil))
+	if jti := failed.Header().Get(launchJTIHeader); jti != "" {
+		t.Errorf("expected no %s header for a failed launch, got %s", launchJTIHeader, jti)
+	}
+}
+
+func TestLaunchFormFieldErrors(t *testing.T) {
+	useRunner(t)
+
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "ref_p_start_date": {"not a date"}, "action_launch": {"true"}}
+	recorder := postForm(t, values, "text/html")
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	body := recorder.Body.String()
+	if !strings.Contains(body, "qa-error-fields") || !strings.Contains(body, "<strong>ref_p_start_date</strong>") {
+		t.Errorf("expected ref_p_start_date to be marked as invalid, got %s", body)
+	}
+	if strings.Contains(body, "<strong>ru_ref</strong>") {
+		t.Error("expected ru_ref not to be marked as invalid")
+	}
+	if !strings.Contains(body, "12346789012A") {
+		t.Error("expected the form to keep the ru_ref which was entered")
+	}
+}
+
+func TestLaunchFieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []authentication.MetadataError
+		want   map[string]string
+	}{
+		{"none", nil, map[string]string{}},
+		{"one field", []authentication.MetadataError{{Name: "period_id", Reason: "is required"}}, map[string]string{"period_id": "is required"}},
+		{
+			"several reasons for a field",
+			[]authentication.MetadataError{{Name: "ref_p_start_date", Reason: "is required"}, {Name: "ref_p_start_date", Reason: "must be a date"}, {Name: "ru_ref", Reason: "is too long"}},
+			map[string]string{"ref_p_start_date": "is required; must be a date", "ru_ref": "is too long"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := launchFieldErrors(test.fields); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// launchedPage is what the page shown after a launch from the form is rendered with
+type launchedPage struct {
+	BasePath   string
+	SchemaName string
+	Token      string
+	LaunchURL  template.URL
+	Claims     map[string]interface{}
+	ExpiresAt  time.Time
+}
+
+// serveLaunchedPage shows the page for a successful launch, rendered from the LAUNCH_TEMPLATE_PATH template so teams
+// can brand it or add their own links. The built-in page is shown if that template can't be read or rendered.
+func serveLaunchedPage(w http.ResponseWriter, r *http.Request, launch *authentication.Launch, schemaName string) {
+	page := launchedPage{
+		BasePath:   basePath(r),
+		SchemaName: schemaName,
+		Token:      launch.Token,
+		// The URL is built by the launcher from SURVEY_RUNNER_URL, so is safe to use as a link
+		LaunchURL: template.URL(launch.URL),
+		Claims:    launch.Claims,
+		ExpiresAt: launch.ExpiresAt,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	rendered, err := renderLaunchTemplate(settings.Get("LAUNCH_TEMPLATE_PATH"), page)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to render LAUNCH_TEMPLATE_PATH, using the built-in page", "error", err)
+		serveTemplate("launched.html", page, w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := rendered.WriteTo(w); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write launch page", "error", err)
+	}
+}
+
+// renderLaunchTemplate renders the standalone template at templatePath, which is read on every launch so changes to
+// it show up without a restart
+func renderLaunchTemplate(templatePath string, page launchedPage) (*bytes.Buffer, error) {
+	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(templateFuncs).ParseFiles(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, page); err != nil {
+		return nil, err
+	}
+	return &rendered, nil
+}
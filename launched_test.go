@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+func TestLaunchTemplate(t *testing.T) {
+	useRunner(t)
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "action_launch": {"true"}}
+
+	tests := []struct {
+		name       string
+		template   string
+		wantStatus int
+		want       string
+	}{
+		{"custom template", `<p class="custom">{{.SchemaName}} {{index .Claims "ru_ref"}} <a href="{{.LaunchURL}}">go</a></p>`, http.StatusOK, `<p class="custom">test_launch 12346789012A <a href="` + settings.Get("SURVEY_RUNNER_URL")},
+		{"invalid template", `{{.SchemaName`, http.StatusOK, "qa-launched-schema"},
+		{"template which fails to render", `{{.Missing}}`, http.StatusOK, "qa-launched-schema"},
+		{"no template", "", http.StatusMovedPermanently, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			templatePath := ""
+			if test.template != "" {
+				templatePath = filepath.Join(t.TempDir(), "launched.html")
+				if err := ioutil.WriteFile(templatePath, []byte(test.template), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			withSetting(t, "LAUNCH_TEMPLATE_PATH", templatePath)
+
+			recorder := postForm(t, values, "text/html")
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			if !strings.Contains(recorder.Body.String(), test.want) {
+				t.Errorf("expected %q in the page, got %s", test.want, recorder.Body)
+			}
+		})
+	}
+}
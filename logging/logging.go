@@ -0,0 +1,215 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+// Log levels, in increasing order of severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "INFO"
+	}
+}
+
+func parseLevel(level string) Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return LevelDebug
+	case "warn", "warning":
+		return LevelWarn
+	case "error":
+		return LevelError
+	default:
+		return LevelInfo
+	}
+}
+
+// redactedKeys are field names whose values are never written, so tokens and credentials can't leak into the logs
+var redactedKeys = []string{"token", "authorization", "password", "passphrase", "secret", "key", "cookie"}
+
+const redacted = "[REDACTED]"
+
+var (
+	outputMutex sync.Mutex
+	output      io.Writer = os.Stderr
+	minLevel              = parseLevel(settings.Get("LOG_LEVEL"))
+	textFormat            = strings.ToLower(settings.Get("LOG_FORMAT")) == "text"
+)
+
+// SetOutput sets where log entries are written
+func SetOutput(w io.Writer) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	output = w
+}
+
+// Logger writes structured log entries carrying a fixed set of fields
+type Logger struct {
+	fields []interface{}
+}
+
+var defaultLogger = &Logger{}
+
+// With returns a Logger which adds the key/value pairs to every entry
+func With(args ...interface{}) *Logger {
+	return defaultLogger.With(args...)
+}
+
+// With returns a Logger which adds the key/value pairs to every entry as well as the existing fields
+func (l *Logger) With(args ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(args))
+	fields = append(fields, l.fields...)
+	fields = append(fields, args...)
+	return &Logger{fields: fields}
+}
+
+// Debug logs msg with the key/value pairs at debug level
+func (l *Logger) Debug(msg string, args ...interface{}) { l.log(LevelDebug, msg, args) }
+
+// Info logs msg with the key/value pairs at info level
+func (l *Logger) Info(msg string, args ...interface{}) { l.log(LevelInfo, msg, args) }
+
+// Warn logs msg with the key/value pairs at warn level
+func (l *Logger) Warn(msg string, args ...interface{}) { l.log(LevelWarn, msg, args) }
+
+// Error logs msg with the key/value pairs at error level
+func (l *Logger) Error(msg string, args ...interface{}) { l.log(LevelError, msg, args) }
+
+// Fatal logs msg with the key/value pairs at error level and exits
+func (l *Logger) Fatal(msg string, args ...interface{}) {
+	l.log(LevelError, msg, args)
+	os.Exit(1)
+}
+
+// Debug logs msg with the key/value pairs at debug level
+func Debug(msg string, args ...interface{}) { defaultLogger.log(LevelDebug, msg, args) }
+
+// Info logs msg with the key/value pairs at info level
+func Info(msg string, args ...interface{}) { defaultLogger.log(LevelInfo, msg, args) }
+
+// Warn logs msg with the key/value pairs at warn level
+func Warn(msg string, args ...interface{}) { defaultLogger.log(LevelWarn, msg, args) }
+
+// Error logs msg with the key/value pairs at error level
+func Error(msg string, args ...interface{}) { defaultLogger.log(LevelError, msg, args) }
+
+// Fatal logs msg with the key/value pairs at error level and exits
+func Fatal(msg string, args ...interface{}) { defaultLogger.Fatal(msg, args...) }
+
+func (l *Logger) log(level Level, msg string, args []interface{}) {
+	if level < minLevel {
+		return
+	}
+
+	entry := map[string]interface{}{}
+	addFields(entry, l.fields)
+	addFields(entry, args)
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	var line []byte
+	if textFormat {
+		line = formatText(entry)
+	} else {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			line, _ = json.Marshal(map[string]interface{}{"time": entry["time"], "level": entry["level"], "msg": msg, "log_error": err.Error()})
+		}
+	}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	output.Write(append(line, '\n'))
+}
+
+func addFields(entry map[string]interface{}, args []interface{}) {
+	for i := 0; i < len(args); i += 2 {
+		key := fmt.Sprint(args[i])
+		if i+1 >= len(args) {
+			entry["!BADKEY"] = key
+			break
+		}
+		entry[key] = fieldValue(key, args[i+1])
+	}
+}
+
+func fieldValue(key string, value interface{}) interface{} {
+	lowerKey := strings.ToLower(key)
+	for _, redactedKey := range redactedKeys {
+		if strings.Contains(lowerKey, redactedKey) {
+			return redacted
+		}
+	}
+
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.Seconds()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+func formatText(entry map[string]interface{}) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "time=%s level=%s msg=%q", entry["time"], entry["level"], entry["msg"])
+
+	keys := make([]string, 0, len(entry))
+	for key := range entry {
+		if key != "time" && key != "level" && key != "msg" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%v", key, entry[key])
+	}
+	return []byte(b.String())
+}
+
+type loggerKey struct{}
+
+// NewContext returns a context carrying the logger, so that every entry logged for a request shares its fields
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by the context, or the default logger if there isn't one
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return defaultLogger
+}
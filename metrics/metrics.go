@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram bucket upper bounds in seconds, suited to upstream HTTP calls and signing
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []metric
+)
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, m)
+}
+
+// CounterVec is a counter partitioned by a fixed set of labels
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a counter with the given label names
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the label values, which must be given in the same order as the label names
+func (c *CounterVec) Inc(labelValues ...string) {
+	key := formatLabels(c.labels, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key]++
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %v\n", c.name, key, c.values[key])
+	}
+}
+
+// Histogram tracks the distribution of durations
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates and registers a histogram of durations in seconds
+func NewHistogram(name string, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	register(h)
+	return h
+}
+
+// Observe records a duration
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%v\"} %d\n", h.name, bound, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %v\n", h.name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// Gauge is a value which can go up and down
+type Gauge struct {
+	name string
+	help string
+
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates and registers a gauge
+func NewGauge(name string, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+// Set sets the gauge to value
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %v\n", g.name, g.value)
+}
+
+// GaugeFunc is a gauge partitioned by a single label whose values are computed when scraped
+type GaugeFunc struct {
+	name   string
+	help   string
+	label  string
+	values func() map[string]float64
+}
+
+// NewGaugeFunc creates and registers a gauge whose values are returned by fn, keyed by the label value
+func NewGaugeFunc(name string, help string, label string, fn func() map[string]float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, label: label, values: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	values := g.values()
+
+	writeHeader(w, g.name, g.help, "gauge")
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %v\n", g.name, formatLabels([]string{g.label}, []string{key}), values[key])
+	}
+}
+
+// LabelLimiter bounds the number of distinct values used for a label, mapping any beyond the cap to "other"
+type LabelLimiter struct {
+	max int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// NewLabelLimiter creates a LabelLimiter allowing up to max distinct values
+func NewLabelLimiter(max int) *LabelLimiter {
+	return &LabelLimiter{max: max, seen: make(map[string]bool)}
+}
+
+// Value returns value if it has been seen before or there is room for it, otherwise "other"
+func (l *LabelLimiter) Value(value string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seen[value] {
+		return value
+	}
+	if len(l.seen) >= l.max {
+		return "other"
+	}
+	l.seen[value] = true
+	return value
+}
+
+// Handler serves the registered metrics and the Go runtime metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		registryMutex.Lock()
+		metrics := append([]metric(nil), registry...)
+		registryMutex.Unlock()
+
+		for _, m := range metrics {
+			m.write(w)
+		}
+		writeRuntimeMetrics(w)
+	})
+}
+
+func writeRuntimeMetrics(w io.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	writeHeader(w, "go_info", "Information about the Go environment.", "gauge")
+	fmt.Fprintf(w, "go_info{version=\"%s\"} 1\n", runtime.Version())
+	writeHeader(w, "go_goroutines", "Number of goroutines that currently exist.", "gauge")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+	writeHeader(w, "go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", "gauge")
+	fmt.Fprintf(w, "go_memstats_alloc_bytes %d\n", stats.Alloc)
+	writeHeader(w, "go_memstats_sys_bytes", "Number of bytes obtained from system.", "gauge")
+	fmt.Fprintf(w, "go_memstats_sys_bytes %d\n", stats.Sys)
+	writeHeader(w, "go_memstats_heap_objects", "Number of allocated objects.", "gauge")
+	fmt.Fprintf(w, "go_memstats_heap_objects %d\n", stats.HeapObjects)
+	writeHeader(w, "go_gc_cycles_total", "Number of completed GC cycles.", "counter")
+	fmt.Fprintf(w, "go_gc_cycles_total %d\n", stats.NumGC)
+	writeHeader(w, "go_gc_pause_seconds_total", "Total time spent in GC stop-the-world pauses.", "counter")
+	fmt.Fprintf(w, "go_gc_pause_seconds_total %v\n", time.Duration(stats.PauseTotalNs).Seconds())
+}
+
+func writeHeader(w io.Writer, name string, help string, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, labelValueEscaper.Replace(value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
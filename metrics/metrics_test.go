@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics page
+func scrape(t *testing.T) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("expected the Prometheus text format, got %s", contentType)
+	}
+	return recorder.Body.String()
+}
+
+// assertLines fails the test for each of lines missing from page
+func assertLines(t *testing.T, page string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(page, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, page)
+		}
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	counter := NewCounterVec("test_launches_total", "Launches by outcome.", "outcome", "schema")
+	counter.Inc("success", "census")
+	counter.Inc("success", "census")
+	counter.Inc("schema", `quoted "name"`)
+
+	assertLines(t, scrape(t),
+		"# HELP test_launches_total Launches by outcome.",
+		"# TYPE test_launches_total counter",
+		`test_launches_total{outcome="success",schema="census"} 2`,
+		`test_launches_total{outcome="schema",schema="quoted \"name\""} 1`,
+	)
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1})
+	for _, d := range []time.Duration{50 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second} {
+		histogram.Observe(d)
+	}
+
+	assertLines(t, scrape(t),
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{le="0.1"} 1`,
+		`test_duration_seconds_bucket{le="1"} 2`,
+		`test_duration_seconds_bucket{le="+Inf"} 3`,
+		"test_duration_seconds_count 3",
+	)
+}
+
+func TestGauges(t *testing.T) {
+	gauge := NewGauge("test_schemas", "Schemas.")
+	gauge.Set(3)
+	NewGaugeFunc("test_key_age_seconds", "Key ages.", "key", func() map[string]float64 {
+		return map[string]float64{"signing": 60, "encryption": 120}
+	})
+
+	assertLines(t, scrape(t),
+		"# TYPE test_schemas gauge",
+		"test_schemas 3",
+		`test_key_age_seconds{key="encryption"} 120`,
+		`test_key_age_seconds{key="signing"} 60`,
+	)
+}
+
+func TestRuntimeMetrics(t *testing.T) {
+	page := scrape(t)
+
+	for _, name := range []string{"go_info", "go_goroutines", "go_memstats_alloc_bytes", "go_gc_cycles_total"} {
+		if !strings.Contains(page, "\n"+name) {
+			t.Errorf("expected the %s runtime metric", name)
+		}
+	}
+}
+
+func TestLabelLimiter(t *testing.T) {
+	limiter := NewLabelLimiter(2)
+
+	for _, test := range []struct{ value, want string }{
+		{"census", "census"},
+		{"mbs", "mbs"},
+		{"lms", "other"},
+		{"census", "census"},
+	} {
+		if got := limiter.Value(test.value); got != test.want {
+			t.Errorf("expected %s for %s, got %s", test.want, test.value, got)
+		}
+	}
+}
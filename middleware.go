@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// requestIDMiddleware tags each request with an ID, taken from X-Request-Id when supplied, which is returned in the
+// response, added to every log entry for the request and used as the tx_id of any token generated
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestid.FromHeader(r.Header.Get(requestid.Header))
+
+		ctx := requestid.NewContext(r.Context(), id)
+		ctx = logging.NewContext(ctx, logging.With("request_id", id))
+
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// errRequestBodyTooLarge is returned when reading more than MAX_REQUEST_BODY_BYTES of a request body
+var errRequestBodyTooLarge = errors.New("request body too large")
+
+// defaultMaxRequestBodyBytes is the body limit used when MAX_REQUEST_BODY_BYTES isn't a positive number of bytes
+const defaultMaxRequestBodyBytes = 1048576
+
+// maxRequestBodyBytes returns MAX_REQUEST_BODY_BYTES, or defaultMaxRequestBodyBytes when it's 0, negative or invalid,
+// which would otherwise refuse every request with a body
+func maxRequestBodyBytes() int64 {
+	limit := settings.GetInt("MAX_REQUEST_BODY_BYTES")
+	if limit <= 0 {
+		return defaultMaxRequestBodyBytes
+	}
+	return int64(limit)
+}
+
+// maxBodyMiddleware limits request bodies to MAX_REQUEST_BODY_BYTES. Requests declaring a larger body are refused
+// with a 413 straight away, and reading past the limit of any other body fails with errRequestBodyTooLarge.
+func maxBodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := maxRequestBodyBytes()
+		if r.ContentLength > limit {
+			writeRequestFailure(w, r, http.StatusRequestEntityTooLarge, requestTooLargeMessage())
+			return
+		}
+
+		// http.MaxBytesReader also closes the connection once the response is written, rather than reading the rest
+		r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), limit: limit}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func requestTooLargeMessage() string {
+	return fmt.Sprintf("The request body is larger than the limit of %d bytes.", maxRequestBodyBytes())
+}
+
+// limitedBody replaces the untyped error http.MaxBytesReader returns at the limit with errRequestBodyTooLarge
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		return n, errRequestBodyTooLarge
+	}
+	return n, err
+}
+
+// corsMiddleware lets the origins in CORS_ALLOWED_ORIGINS call the wrapped JSON endpoints from a browser. Entries
+// match an origin exactly, or any subdomain when written as https://*.example.com. No cross-origin access is allowed
+// when the setting is empty.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && corsOriginAllowed(origin, settings.GetList("CORS_ALLOWED_ORIGINS"))
+
+		w.Header().Add("Vary", "Origin")
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", requestid.Header+", "+launchJTIHeader)
+		}
+
+		if r.Method != http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Preflight requests are answered here rather than by the wrapped handler
+		if !allowed || r.Header.Get("Access-Control-Request-Method") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+requestid.Header)
+		w.Header().Set("Access-Control-Max-Age", "600")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func corsOriginAllowed(origin string, allowedOrigins []string) bool {
+	origin = strings.ToLower(origin)
+
+	for _, allowedOrigin := range allowedOrigins {
+		allowedOrigin = strings.ToLower(strings.TrimSuffix(allowedOrigin, "/"))
+
+		wildcard := strings.Index(allowedOrigin, "://*.")
+		if wildcard == -1 {
+			if origin == allowedOrigin {
+				return true
+			}
+			continue
+		}
+
+		// https://*.example.com matches https://a.example.com and https://a.b.example.com, but not https://example.com
+		scheme := allowedOrigin[:wildcard+len("://")]
+		domain := allowedOrigin[wildcard+len("://*"):]
+		if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, domain) && len(origin) > len(scheme)+len(domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authMiddleware requires every request, apart from liveness probes and CORS preflights, to carry the basic auth
+// credentials in LAUNCHER_BASIC_AUTH. Requests to the JSON API under /api/ may carry the bearer token in
+// LAUNCHER_API_TOKEN instead, which is required of them when only the token is set. Nothing is required when neither
+// is set.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		basicAuth := settings.Get("LAUNCHER_BASIC_AUTH")
+		apiToken := settings.Get("LAUNCHER_API_TOKEN")
+		if !isAPIRequest(r) {
+			apiToken = ""
+		}
+
+		if (basicAuth == "" && apiToken == "") || r.URL.Path == "/status/live" || isPreflight(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if authorised(r, basicAuth, apiToken) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logging.FromContext(r.Context()).Warn("unauthorised request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+
+		if basicAuth != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="launcher", charset="UTF-8"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="launcher"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// isAPIRequest reports whether r is for the JSON API, the only routes which accept LAUNCHER_API_TOKEN
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func authorised(r *http.Request, basicAuth string, apiToken string) bool {
+	authorization := r.Header.Get("Authorization")
+
+	if apiToken != "" && len(authorization) > len("Bearer ") && strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		token := authorization[len("Bearer "):]
+		return subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1
+	}
+
+	if basicAuth == "" {
+		return false
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	separator := strings.Index(basicAuth, ":")
+	if separator == -1 {
+		logging.FromContext(r.Context()).Error("LAUNCHER_BASIC_AUTH must be user:bcrypt-hash")
+		return false
+	}
+
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(basicAuth[:separator])) == 1
+	passwordMatches := bcrypt.CompareHashAndPassword([]byte(basicAuth[separator+1:]), []byte(password)) == nil
+
+	return usernameMatches && passwordMatches
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// validPrefix matches a URL path prefix which is safe to include in links
+var validPrefix = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// prefixMiddleware strips URL_PREFIX from request paths, so the launcher can be served below a path on a shared host.
+// Requests without the prefix are routed unchanged, so probes can still reach the status pages directly.
+func prefixMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := urlPrefix()
+		if prefix == "" || (r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			next.ServeHTTP(w, r)
+		})).ServeHTTP(w, r)
+	})
+}
+
+// urlPrefix returns URL_PREFIX with a leading slash and without a trailing one, or an empty string when it isn't set
+func urlPrefix() string {
+	prefix := strings.Trim(settings.Get("URL_PREFIX"), "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// basePath returns the path the launcher is served below for building links, taken from the X-Forwarded-Prefix
+// header set by a proxy when present, otherwise URL_PREFIX
+func basePath(r *http.Request) string {
+	if forwardedPrefix := strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/"); validPrefix.MatchString(forwardedPrefix) {
+		return forwardedPrefix
+	}
+	return urlPrefix()
+}
+
+// validHost matches a host, with an optional port, which is safe to include in links
+var validHost = regexp.MustCompile(`^([A-Za-z0-9.-]+|\[[0-9A-Fa-f:.]+\])(:[0-9]+)?$`)
+
+// externalURL returns the launcher's URL as seen by users, for links outside the launcher's own pages. It is
+// EXTERNAL_BASE_URL when set, otherwise built from the X-Forwarded-Proto and X-Forwarded-Host headers set by a proxy,
+// falling back to the request's own scheme and host, followed by basePath.
+func externalURL(r *http.Request) string {
+	if baseURL := strings.TrimSuffix(settings.Get("EXTERNAL_BASE_URL"), "/"); baseURL != "" {
+		return baseURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwardedProto := strings.ToLower(firstHeaderValue(r, "X-Forwarded-Proto")); forwardedProto == "http" || forwardedProto == "https" {
+		scheme = forwardedProto
+	}
+
+	host := r.Host
+	if forwardedHost := firstHeaderValue(r, "X-Forwarded-Host"); validHost.MatchString(forwardedHost) {
+		host = forwardedHost
+	}
+
+	return scheme + "://" + host + basePath(r)
+}
+
+// firstHeaderValue returns the first of a comma-separated header's values, which proxies append to
+func firstHeaderValue(r *http.Request, name string) string {
+	value := r.Header.Get(name)
+	if comma := strings.Index(value, ","); comma >= 0 {
+		value = value[:comma]
+	}
+	return strings.TrimSpace(value)
+}
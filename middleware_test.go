@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMaxBodyMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      string
+		body       string
+		wantStatus int
+	}{
+		{"within the limit", "10", "0123456789", http.StatusOK},
+		{"declared over the limit", "10", "0123456789a", http.StatusRequestEntityTooLarge},
+		{"zero uses the default", "0", "0123456789a", http.StatusOK},
+		{"negative uses the default", "-1", "0123456789a", http.StatusOK},
+		{"invalid uses the default", "1MB", "0123456789a", http.StatusOK},
+		{"default is still enforced", "0", strings.Repeat("a", defaultMaxRequestBodyBytes+1), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "MAX_REQUEST_BODY_BYTES", test.limit)
+
+			handler := maxBodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := ioutil.ReadAll(r.Body); err != nil {
+					t.Errorf("unexpected error reading the body: %v", err)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/api/token", strings.NewReader(test.body))
+			req.Header.Set("Accept", "application/json")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestMaxBodyMiddlewareUndeclaredLength(t *testing.T) {
+	withSetting(t, "MAX_REQUEST_BODY_BYTES", "10")
+
+	var readErr error
+	handler := maxBodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = ioutil.ReadAll(r.Body)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/token", strings.NewReader("0123456789a"))
+	req.ContentLength = -1
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !errors.Is(readErr, errRequestBodyTooLarge) {
+		t.Errorf("expected errRequestBodyTooLarge, got %v", readErr)
+	}
+}
+
+func TestCorsOriginAllowed(t *testing.T) {
+	allowed := []string{"https://ui.example.com/", "https://*.internal.example.com"}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://ui.example.com", true},
+		{"HTTPS://UI.EXAMPLE.COM", true},
+		{"http://ui.example.com", false},
+		{"https://ui.example.com.evil.com", false},
+		{"https://a.internal.example.com", true},
+		{"https://a.b.internal.example.com", true},
+		{"https://internal.example.com", false},
+		{"http://a.internal.example.com", false},
+		{"https://evilinternal.example.com", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.origin, func(t *testing.T) {
+			if got := corsOriginAllowed(test.origin, allowed); got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+
+	if corsOriginAllowed("https://ui.example.com", nil) {
+		t.Error("expected no origin to be allowed when none are configured")
+	}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		allowed       string
+		method        string
+		origin        string
+		requestMethod string
+		wantStatus    int
+		wantAllowed   bool
+	}{
+		{"preflight from an allowed origin", "https://ui.example.com", http.MethodOptions, "https://ui.example.com", "POST", http.StatusNoContent, true},
+		{"preflight from a disallowed origin", "https://ui.example.com", http.MethodOptions, "https://evil.example.com", "POST", http.StatusForbidden, false},
+		{"preflight when unconfigured", "", http.MethodOptions, "https://ui.example.com", "POST", http.StatusForbidden, false},
+		{"options without a request method", "https://ui.example.com", http.MethodOptions, "https://ui.example.com", "", http.StatusForbidden, true},
+		{"request from an allowed origin", "https://ui.example.com", http.MethodPost, "https://ui.example.com", "", http.StatusOK, true},
+		{"request from a disallowed origin", "https://ui.example.com", http.MethodPost, "https://evil.example.com", "", http.StatusOK, false},
+		{"same-origin request", "https://ui.example.com", http.MethodPost, "", "", http.StatusOK, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "CORS_ALLOWED_ORIGINS", test.allowed)
+
+			handler := corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(test.method, "/api/token", nil)
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			if test.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", test.requestMethod)
+				req.Header.Set("Access-Control-Request-Headers", "content-type")
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+			if got := recorder.Header().Get("Access-Control-Allow-Origin"); (got == test.origin && got != "") != test.wantAllowed {
+				t.Errorf("expected the origin to be allowed %v, got %q", test.wantAllowed, got)
+			}
+			if test.wantStatus == http.StatusNoContent && !strings.Contains(recorder.Header().Get("Access-Control-Allow-Headers"), "Content-Type") {
+				t.Errorf("expected Content-Type to be allowed for JSON posts, got %q", recorder.Header().Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
+
+func TestCorsRoutes(t *testing.T) {
+	withSetting(t, "CORS_ALLOWED_ORIGINS", "https://ui.example.com")
+	router := newRouter()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		wantAllowed bool
+	}{
+		{"token API preflight", http.MethodOptions, "/api/token", true},
+		{"status", http.MethodGet, "/status/live", true},
+		{"HTML launch page", http.MethodOptions, "/", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			req.Header.Set("Origin", "https://ui.example.com")
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if got := recorder.Header().Get("Access-Control-Allow-Origin") != ""; got != test.wantAllowed {
+				t.Errorf("expected CORS headers %v, got %v", test.wantAllowed, recorder.Header())
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("launch-pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	basicAuth := "tester:" + string(hash)
+
+	tests := []struct {
+		name          string
+		basicAuth     string
+		apiToken      string
+		path          string
+		setAuth       func(r *http.Request)
+		wantStatus    int
+		wantChallenge string
+	}{
+		{"unprotected", "", "", "/", nil, http.StatusOK, ""},
+		{"correct basic auth", basicAuth, "", "/", func(r *http.Request) { r.SetBasicAuth("tester", "launch-pass") }, http.StatusOK, ""},
+		{"wrong password", basicAuth, "", "/", func(r *http.Request) { r.SetBasicAuth("tester", "wrong") }, http.StatusUnauthorized, "Basic"},
+		{"wrong user", basicAuth, "", "/", func(r *http.Request) { r.SetBasicAuth("other", "launch-pass") }, http.StatusUnauthorized, "Basic"},
+		{"no credentials", basicAuth, "", "/", nil, http.StatusUnauthorized, "Basic"},
+		{"malformed LAUNCHER_BASIC_AUTH", "tester", "", "/", func(r *http.Request) { r.SetBasicAuth("tester", "launch-pass") }, http.StatusUnauthorized, "Basic"},
+		{"correct bearer token", "", "api-secret", "/api/token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-secret") }, http.StatusOK, ""},
+		{"bearer is case insensitive", "", "api-secret", "/api/token", func(r *http.Request) { r.Header.Set("Authorization", "bearer api-secret") }, http.StatusOK, ""},
+		{"wrong bearer token", "", "api-secret", "/api/token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-secre") }, http.StatusUnauthorized, "Bearer"},
+		{"bearer token with basic auth set too", basicAuth, "api-secret", "/api/token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-secret") }, http.StatusOK, ""},
+		{"basic auth with a bearer token set too", basicAuth, "api-secret", "/", func(r *http.Request) { r.SetBasicAuth("tester", "launch-pass") }, http.StatusOK, ""},
+		{"basic auth on the API", basicAuth, "api-secret", "/api/token", func(r *http.Request) { r.SetBasicAuth("tester", "launch-pass") }, http.StatusOK, ""},
+		{"bearer token outside the API", basicAuth, "api-secret", "/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-secret") }, http.StatusUnauthorized, "Basic"},
+		{"bearer token for the profiler", basicAuth, "api-secret", "/debug/pprof/", func(r *http.Request) { r.Header.Set("Authorization", "Bearer api-secret") }, http.StatusUnauthorized, "Basic"},
+		{"only the API protected by a bearer token", "", "api-secret", "/", nil, http.StatusOK, ""},
+		{"API prefix must be a path segment", "", "api-secret", "/apikeys", nil, http.StatusOK, ""},
+		{"liveness probe is exempt", basicAuth, "api-secret", "/status/live", nil, http.StatusOK, ""},
+		{"readiness probe isn't exempt", basicAuth, "api-secret", "/status/ready", nil, http.StatusUnauthorized, "Basic"},
+		{"preflight is exempt", "", "api-secret", "/api/token", func(r *http.Request) {
+			r.Method = http.MethodOptions
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "LAUNCHER_BASIC_AUTH", test.basicAuth)
+			withSetting(t, "LAUNCHER_API_TOKEN", test.apiToken)
+
+			var logs bytes.Buffer
+			logging.SetOutput(&logs)
+			t.Cleanup(func() { logging.SetOutput(os.Stderr) })
+
+			handler := authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.setAuth != nil {
+				test.setAuth(req)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+			if challenge := recorder.Header().Get("WWW-Authenticate"); !strings.HasPrefix(challenge, test.wantChallenge) || (test.wantChallenge == "") != (challenge == "") {
+				t.Errorf("expected a %q challenge, got %q", test.wantChallenge, challenge)
+			}
+			if strings.Contains(logs.String(), "launch-pass") || strings.Contains(logs.String(), "api-secre") {
+				t.Errorf("expected no credentials in the logs, got %s", logs.String())
+			}
+		})
+	}
+}
+
+func TestPrefixMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		path     string
+		wantPath string
+	}{
+		{"no prefix", "", "/launcher/status", "/launcher/status"},
+		{"prefixed path", "/launcher/", "/launcher/status", "/status"},
+		{"prefix without slashes", "launcher", "/launcher/api/token", "/api/token"},
+		{"prefix itself", "/launcher", "/launcher", "/"},
+		{"unprefixed path is unchanged", "/launcher", "/status/live", "/status/live"},
+		{"similar path isn't stripped", "/launcher", "/launchers/status", "/launchers/status"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "URL_PREFIX", test.prefix)
+
+			var gotPath string
+			handler := prefixMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { gotPath = r.URL.Path }))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+
+			if gotPath != test.wantPath {
+				t.Errorf("expected %s, got %s", test.wantPath, gotPath)
+			}
+		})
+	}
+}
+
+func TestExternalURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		baseURL string
+		headers map[string]string
+		want    string
+	}{
+		{"request host", "", "", nil, "http://launcher.example.com"},
+		{"URL_PREFIX", "/launcher", "", nil, "http://launcher.example.com/launcher"},
+		{"forwarded prefix wins", "/launcher", "", map[string]string{"X-Forwarded-Prefix": "/proxy/"}, "http://launcher.example.com/proxy"},
+		{"invalid forwarded prefix is ignored", "/launcher", "", map[string]string{"X-Forwarded-Prefix": `/"><script>`}, "http://launcher.example.com/launcher"},
+		{"forwarded proto and host", "", "", map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "public.example.com"}, "https://public.example.com"},
+		{"invalid forwarded host is ignored", "", "", map[string]string{"X-Forwarded-Host": "evil.com/path"}, "http://launcher.example.com"},
+		{"EXTERNAL_BASE_URL", "/launcher", "https://eq.example.com/launcher/", map[string]string{"X-Forwarded-Host": "public.example.com"}, "https://eq.example.com/launcher"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "URL_PREFIX", test.prefix)
+			withSetting(t, "EXTERNAL_BASE_URL", test.baseURL)
+
+			req := httptest.NewRequest(http.MethodGet, "http://launcher.example.com/quick-launch", nil)
+			for name, value := range test.headers {
+				req.Header.Set(name, value)
+			}
+
+			if got := externalURL(req); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		supplied string
+		want     string
+	}{
+		{"supplied", "6f0d8b8a-4a7e-4b8e-9c1e-2a5c1b0d7e3f", "6f0d8b8a-4a7e-4b8e-9c1e-2a5c1b0d7e3f"},
+		{"generated", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var seen string
+			handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestid.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.supplied != "" {
+				req.Header.Set(requestid.Header, test.supplied)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			returned := recorder.Header().Get(requestid.Header)
+			if returned == "" || returned != seen {
+				t.Errorf("expected the handler's request ID %q in the response, got %q", seen, returned)
+			}
+			if test.want != "" && returned != test.want {
+				t.Errorf("expected %s, got %s", test.want, returned)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package mockrunner mimics the survey runner's /session endpoint, so that launcher tokens can be checked end to end
+// without a runner. It decrypts and verifies each token it receives and reports the claims it carried.
+package mockrunner
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Runner is an http.Handler for the runner's /session and /flush endpoints
+type Runner struct {
+	decryptionKey   *rsa.PrivateKey
+	verificationKey *rsa.PublicKey
+
+	mutex    sync.Mutex
+	received []map[string]interface{}
+}
+
+// New returns a Runner which decrypts tokens with decryptionKey and verifies their signatures with verificationKey
+func New(decryptionKey *rsa.PrivateKey, verificationKey *rsa.PublicKey) *Runner {
+	return &Runner{decryptionKey: decryptionKey, verificationKey: verificationKey}
+}
+
+// NewServer starts an httptest.Server running a Runner. Point SURVEY_RUNNER_URL at its URL to launch against it.
+func NewServer(decryptionKey *rsa.PrivateKey, verificationKey *rsa.PublicKey) (*httptest.Server, *Runner) {
+	runner := New(decryptionKey, verificationKey)
+	return httptest.NewServer(runner), runner
+}
+
+// ServeHTTP accepts a token from the token query parameter, responding with its claims as JSON, or 401 when the
+// token can't be decrypted or verified
+func (runner *Runner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	claims, err := runner.Claims(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	runner.mutex.Lock()
+	runner.received = append(runner.received, claims)
+	runner.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(claims)
+}
+
+// Claims decrypts and verifies token, returning its claims. Tokens which are signed but not encrypted are accepted too.
+func (runner *Runner) Claims(token string) (map[string]interface{}, error) {
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+
+	var signed *jwt.JSONWebToken
+	if strings.Count(token, ".") == 4 {
+		nested, err := jwt.ParseSignedAndEncrypted(token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token: %v", err)
+		}
+		if signed, err = nested.Decrypt(runner.decryptionKey); err != nil {
+			return nil, fmt.Errorf("failed to decrypt token: %v", err)
+		}
+	} else {
+		var err error
+		if signed, err = jwt.ParseSigned(token); err != nil {
+			return nil, fmt.Errorf("failed to parse token: %v", err)
+		}
+	}
+
+	claims := make(map[string]interface{})
+	if err := signed.Claims(runner.verificationKey, &claims); err != nil {
+		return nil, fmt.Errorf("failed to verify token: %v", err)
+	}
+
+	return claims, nil
+}
+
+// Received returns the claims of every token the runner has accepted, oldest first
+func (runner *Runner) Received() []map[string]interface{} {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	return append([]map[string]interface{}(nil), runner.received...)
+}
+
+// Keys are a matching set of launcher and runner keys
+type Keys struct {
+	// DecryptionKey is the runner's private key, whose public key the launcher encrypts with.
+	DecryptionKey *rsa.PrivateKey
+
+	// VerificationKey is the public key of the launcher's signing key.
+	VerificationKey *rsa.PublicKey
+}
+
+// UseTestKeys generates a new set of keys, writes the launcher's keys to dir and points JWT_SIGNING_KEY_PATH and
+// JWT_ENCRYPTION_KEY_PATH at them, returning the keys the runner needs
+func UseTestKeys(dir string) (*Keys, error) {
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionKey, err := x509.MarshalPKIXPublicKey(&decryptionKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeyPath := filepath.Join(dir, "signing-key.pem")
+	signingKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(signingKey)})
+	if err := ioutil.WriteFile(signingKeyPath, signingKeyPEM, 0600); err != nil {
+		return nil, err
+	}
+
+	encryptionKeyPath := filepath.Join(dir, "encryption-key.pem")
+	encryptionKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: encryptionKey})
+	if err := ioutil.WriteFile(encryptionKeyPath, encryptionKeyPEM, 0600); err != nil {
+		return nil, err
+	}
+
+	settings.Set("JWT_SIGNING_KEY_PATH", signingKeyPath)
+	settings.Set("JWT_ENCRYPTION_KEY_PATH", encryptionKeyPath)
+
+	return &Keys{DecryptionKey: decryptionKey, VerificationKey: &signingKey.PublicKey}, nil
+}
+
+// LoadDecryptionKey reads the runner's PEM encoded RSA private key from path
+func LoadDecryptionKey(path string) (*rsa.PrivateKey, error) {
+	keyData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key from %s: %v", path, err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an RSA private key", path)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// persona is a named set of launch values, such as those used for accessibility testing, loaded from PERSONAS_PATH
+type persona struct {
+	Name   string              `json:"name"`
+	Values map[string][]string `json:"values"`
+}
+
+// personaValue is a value in the personas file, which may be a string or a list of strings
+type personaValue []string
+
+func (v *personaValue) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = personaValue{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("persona values must be a string or a list of strings")
+	}
+	*v = list
+	return nil
+}
+
+var (
+	personasOnce sync.Once
+	personas     []persona
+	personasErr  error
+)
+
+// getPersonas returns the personas from PERSONAS_PATH, sorted by name, or none when it isn't set. The file is only
+// read once.
+func getPersonas() ([]persona, error) {
+	personasOnce.Do(func() {
+		if path := settings.Get("PERSONAS_PATH"); path != "" {
+			personas, personasErr = loadPersonas(path)
+		}
+	})
+	return personas, personasErr
+}
+
+// loadPersonas reads a JSON object of persona names to their values, such as
+// {"screen_reader": {"language_code": "cy", "roles": ["dumper"]}}
+func loadPersonas(path string) ([]persona, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read personas from %s: %v", path, err)
+	}
+
+	var file map[string]map[string]personaValue
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid personas in %s: %v", path, err)
+	}
+
+	var loaded []persona
+	for name, values := range file {
+		p := persona{Name: name, Values: make(map[string][]string)}
+		for key, value := range values {
+			p.Values[key] = value
+		}
+		loaded = append(loaded, p)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+
+	return loaded, nil
+}
+
+// applyPersona returns the values of the persona named by the persona value, overridden by any other non-empty values
+// given. values is returned unchanged when it doesn't name a persona.
+func applyPersona(values url.Values) (url.Values, error) {
+	name := values.Get("persona")
+	if name == "" {
+		return values, nil
+	}
+
+	all, err := getPersonas()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range all {
+		if p.Name != name {
+			continue
+		}
+
+		merged := url.Values{}
+		for key, value := range p.Values {
+			merged[key] = append([]string(nil), value...)
+		}
+		for key, value := range values {
+			if key != "persona" && len(value) > 0 && value[0] != "" {
+				merged[key] = value
+			}
+		}
+		return merged, nil
+	}
+
+	return nil, fmt.Errorf("unknown persona %q", name)
+}
+
+// getPersonasHandler lists the personas and their values as JSON
+func getPersonasHandler(w http.ResponseWriter, r *http.Request) {
+	all, err := getPersonas()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load personas", "error", err)
+		writeAPIError(w, r, http.StatusInternalServerError, "personas_error", "The personas could not be loaded.")
+		return
+	}
+	if all == nil {
+		all = []persona{}
+	}
+
+	writeJSON(w, r, http.StatusOK, all)
+}
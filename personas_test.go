@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testPersonas = `{
+	"screen_reader": {"language_code": "cy", "roles": ["dumper", "flusher"], "trad_as": "DARLLENYDD"},
+	"keyboard_only": {"trad_as": "KEYBOARD"}
+}`
+
+func TestLoadPersonas(t *testing.T) {
+	tests := []struct {
+		name      string
+		json      string
+		want      []persona
+		wantError bool
+	}{
+		{"strings and lists, sorted by name", testPersonas, []persona{
+			{Name: "keyboard_only", Values: map[string][]string{"trad_as": {"KEYBOARD"}}},
+			{Name: "screen_reader", Values: map[string][]string{"language_code": {"cy"}, "roles": {"dumper", "flusher"}, "trad_as": {"DARLLENYDD"}}},
+		}, false},
+		{"invalid value", `{"screen_reader": {"roles": 1}}`, nil, true},
+		{"invalid JSON", `{"screen_reader":`, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "personas.json")
+			if err := ioutil.WriteFile(path, []byte(test.json), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := loadPersonas(path)
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+			if !reflect.DeepEqual(loaded, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, loaded)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := loadPersonas(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("expected an error for a missing file")
+		}
+	})
+}
+
+func TestApplyPersona(t *testing.T) {
+	withPersonas(t, testPersonas)
+
+	tests := []struct {
+		name      string
+		values    url.Values
+		want      url.Values
+		wantError bool
+	}{
+		{"no persona", url.Values{"ru_ref": {"1"}}, url.Values{"ru_ref": {"1"}}, false},
+		{"persona values", url.Values{"persona": {"screen_reader"}, "ru_ref": {"1"}},
+			url.Values{"language_code": {"cy"}, "roles": {"dumper", "flusher"}, "trad_as": {"DARLLENYDD"}, "ru_ref": {"1"}}, false},
+		{"overrides win", url.Values{"persona": {"screen_reader"}, "trad_as": {"OVERRIDE"}, "roles": {"flusher"}},
+			url.Values{"language_code": {"cy"}, "roles": {"flusher"}, "trad_as": {"OVERRIDE"}}, false},
+		{"empty values don't override", url.Values{"persona": {"keyboard_only"}, "trad_as": {""}},
+			url.Values{"trad_as": {"KEYBOARD"}}, false},
+		{"unknown persona", url.Values{"persona": {"nobody"}}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := applyPersona(test.values)
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPersonasHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		json       string
+		wantStatus int
+		wantNames  []string
+	}{
+		{"personas", testPersonas, http.StatusOK, []string{"keyboard_only", "screen_reader"}},
+		{"none configured", "", http.StatusOK, []string{}},
+		{"invalid file", `{"screen_reader":`, http.StatusInternalServerError, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withPersonas(t, test.json)
+
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/personas", nil))
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+			if test.wantNames == nil {
+				return
+			}
+
+			var listed []persona
+			decodeResponse(t, recorder, &listed)
+			names := []string{}
+			for _, p := range listed {
+				names = append(names, p.Name)
+			}
+			if !reflect.DeepEqual(names, test.wantNames) {
+				t.Errorf("expected %v, got %v", test.wantNames, names)
+			}
+		})
+	}
+}
+
+func TestLaunchWithPersona(t *testing.T) {
+	runner := useRunner(t)
+	withPersonas(t, testPersonas)
+
+	values := url.Values{"schema_name": {"test_launch"}, "ru_ref": {"12346789012A"}, "period_id": {"201605"}, "persona": {"screen_reader"}, "trad_as": {"OVERRIDE"}, "action_launch": {"true"}}
+	recorder := postForm(t, values, "")
+	if recorder.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected a redirect to the runner, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	claims := sessionClaims(t, runner, recorder.Header().Get("Location"))
+	if claims["language_code"] != "cy" || claims["trad_as"] != "OVERRIDE" {
+		t.Errorf("expected the persona's language_code and the overridden trad_as, got %v", claims)
+	}
+	if _, ok := claims["persona"]; ok {
+		t.Error("expected persona not to be sent as a claim")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/gorilla/mux"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// errPprofUnprotected is returned by checkPprofSettings, as profiles expose the command line, memory and goroutine
+// stacks to anyone who can reach the launcher. LAUNCHER_API_TOKEN only protects /api/, so it isn't enough.
+var errPprofUnprotected = errors.New("ENABLE_PPROF requires LAUNCHER_BASIC_AUTH to be set")
+
+// checkPprofSettings fails when the profiler is enabled without credentials to put it behind
+func checkPprofSettings() error {
+	if settings.GetBool("ENABLE_PPROF") && settings.Get("LAUNCHER_BASIC_AUTH") == "" {
+		return errPprofUnprotected
+	}
+	return nil
+}
+
+// addPprofRoutes mounts the net/http/pprof handlers under /debug/pprof/ when ENABLE_PPROF is set, sampling block and
+// mutex contention at PPROF_BLOCK_PROFILE_RATE and PPROF_MUTEX_PROFILE_FRACTION. Like every other route they sit
+// behind authMiddleware, and they aren't mounted at all when it has no credentials to check.
+func addPprofRoutes(r *mux.Router) {
+	if !settings.GetBool("ENABLE_PPROF") {
+		return
+	}
+	if err := checkPprofSettings(); err != nil {
+		logging.Error("not serving the profiler", "error", err)
+		return
+	}
+
+	runtime.SetBlockProfileRate(settings.GetInt("PPROF_BLOCK_PROFILE_RATE"))
+	runtime.SetMutexProfileFraction(settings.GetInt("PPROF_MUTEX_PROFILE_FRACTION"))
+
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// Index also serves the named profiles, such as /debug/pprof/heap and /debug/pprof/mutex
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
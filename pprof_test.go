@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPprofRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+	})
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("launch-pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		enabled    string
+		basicAuth  string
+		path       string
+		login      bool
+		wantStatus int
+	}{
+		{"disabled index", "false", "tester:" + string(hash), "/debug/pprof/", true, http.StatusNotFound},
+		{"disabled profile", "false", "tester:" + string(hash), "/debug/pprof/heap", true, http.StatusNotFound},
+		{"enabled index", "true", "tester:" + string(hash), "/debug/pprof/", true, http.StatusOK},
+		{"enabled profile", "true", "tester:" + string(hash), "/debug/pprof/heap?debug=1", true, http.StatusOK},
+		{"enabled cmdline", "true", "tester:" + string(hash), "/debug/pprof/cmdline", true, http.StatusOK},
+		{"enabled without credentials", "true", "tester:" + string(hash), "/debug/pprof/", false, http.StatusUnauthorized},
+		{"enabled without auth configured", "true", "", "/debug/pprof/", false, http.StatusNotFound},
+		{"enabled without auth configured profile", "true", "", "/debug/pprof/heap", false, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ENABLE_PPROF", test.enabled)
+			withSetting(t, "LAUNCHER_BASIC_AUTH", test.basicAuth)
+
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.login {
+				req.SetBasicAuth("tester", "launch-pass")
+			}
+			if recorder := route(t, req); recorder.Code != test.wantStatus {
+				t.Errorf("expected %d, got %d", test.wantStatus, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestPprofProfileRates(t *testing.T) {
+	t.Cleanup(func() {
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+	})
+	withSetting(t, "ENABLE_PPROF", "true")
+	withSetting(t, "LAUNCHER_BASIC_AUTH", "tester:hash")
+	withSetting(t, "PPROF_MUTEX_PROFILE_FRACTION", "5")
+
+	newRouter()
+
+	if fraction := runtime.SetMutexProfileFraction(-1); fraction != 5 {
+		t.Errorf("expected a mutex profile fraction of 5, got %d", fraction)
+	}
+}
+
+func TestCheckPprofSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   string
+		basicAuth string
+		apiToken  string
+		wantError bool
+	}{
+		{"disabled", "false", "", "", false},
+		{"enabled without credentials", "true", "", "", true},
+		{"enabled with basic auth", "true", "tester:hash", "", false},
+		{"enabled with only an API token", "true", "", "secret", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "ENABLE_PPROF", test.enabled)
+			withSetting(t, "LAUNCHER_BASIC_AUTH", test.basicAuth)
+			withSetting(t, "LAUNCHER_API_TOKEN", test.apiToken)
+
+			if err := checkPprofSettings(); (err != nil) != test.wantError {
+				t.Errorf("expected an error %v, got %v", test.wantError, err)
+			}
+		})
+	}
+}
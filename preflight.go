@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+)
+
+// postPreflightAPIHandler reports whether the launch in a token API request would succeed, without generating a token
+func postPreflightAPIHandler(w http.ResponseWriter, r *http.Request) {
+	var request tokenRequest
+
+	if err := decodeTokenRequest(r, &request); errors.Is(err, errRequestBodyTooLarge) {
+		writeAPIError(w, r, http.StatusRequestEntityTooLarge, errorInvalidRequest, requestTooLargeMessage())
+		return
+	} else if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return
+	}
+
+	if (request.SchemaName == "") == (request.SchemaURL == "") {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, "exactly one of schema_name or schema_url is required")
+		return
+	}
+
+	values, err := request.launchValues()
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, authentication.Preflight(r.Context(), request.SchemaURL, values))
+}
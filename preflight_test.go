@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+)
+
+func TestPostPreflightAPI(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantReady   bool
+		wantSchema  bool
+		wantMissing []string
+	}{
+		{
+			"ready",
+			`{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605", "ref_p_start_date": "2016-05-01"}}`,
+			true, true, []string{},
+		},
+		{
+			"missing metadata",
+			`{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A"}}`,
+			false, true, []string{"period_id", "ref_p_start_date"},
+		},
+		{
+			"unknown schema",
+			`{"schema_name": "test_unknown", "claims": {}}`,
+			false, false, []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := postAPI(t, "/api/preflight", test.body)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+			}
+
+			var report authentication.PreflightReport
+			decodeResponse(t, recorder, &report)
+			if report.Ready != test.wantReady {
+				t.Errorf("expected ready %v, got %+v", test.wantReady, report)
+			}
+			if !report.KeysOK {
+				t.Errorf("expected the keys to load, got %+v", report)
+			}
+			if report.SchemaValid != test.wantSchema {
+				t.Errorf("expected schema_valid %v, got %+v", test.wantSchema, report)
+			}
+			if !reflect.DeepEqual(report.MissingMetadata, test.wantMissing) {
+				t.Errorf("expected missing metadata %v, got %v", test.wantMissing, report.MissingMetadata)
+			}
+		})
+	}
+}
+
+func TestPostPreflightAPIInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"no schema", `{"claims": {}}`},
+		{"schema_name and schema_url", `{"schema_name": "test_launch", "schema_url": "http://schemas/test_launch.json"}`},
+		{"invalid JSON", `{"schema_name": `},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := postAPI(t, "/api/preflight", test.body); recorder.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
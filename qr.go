@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+)
+
+// qrModulePixels is the width in pixels of each module (square) of a QR code, so codes stay readable however long the
+// launch URL is
+const qrModulePixels = 4
+
+// getQRCodeHandler returns a PNG QR code of a launch URL, so testers can launch on a mobile device. The URL is given
+// as url, or built from the runner's session URL when only token is given.
+func getQRCodeHandler(w http.ResponseWriter, r *http.Request) {
+	launchURL := r.URL.Query().Get("url")
+	if launchURL == "" {
+		if token := r.URL.Query().Get("token"); token != "" {
+			launchURL = authentication.SessionURL(token)
+		}
+	}
+	if launchURL == "" {
+		http.Error(w, "url or token is required", http.StatusBadRequest)
+		return
+	}
+
+	writeQRCode(w, r, launchURL)
+}
+
+// writeQRCode writes a PNG QR code of launchURL
+func writeQRCode(w http.ResponseWriter, r *http.Request, launchURL string) {
+	encoded, err := qrCodePNG(launchURL)
+	if err != nil {
+		logging.FromContext(r.Context()).Info("unable to encode QR code", "error", err, "length", len(launchURL))
+		http.Error(w, "launch URL is too long to encode as a QR code", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(encoded); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write QR code", "error", err)
+	}
+}
+
+// qrCodePNG encodes content as a QR code PNG. The lowest error correction level is used so that encrypted tokens,
+// which can run to a couple of kilobytes, still fit.
+func qrCodePNG(content string) ([]byte, error) {
+	code, err := qr.Encode(content, qr.L, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+
+	size := code.Bounds().Dx() * qrModulePixels
+	if code, err = barcode.Scale(code, size, size); err != nil {
+		return nil, err
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, code); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
+}
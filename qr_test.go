@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/boombuler/barcode/qr"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+)
+
+// qrModules reads the modules of a PNG QR code scaled by qrModulePixels, as true for dark
+func qrModules(t *testing.T, encoded []byte) [][]bool {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("expected a valid PNG: %v", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() != bounds.Dy() || bounds.Dx()%qrModulePixels != 0 {
+		t.Fatalf("expected a square of whole modules, got %v", bounds)
+	}
+
+	size := bounds.Dx() / qrModulePixels
+	modules := make([][]bool, size)
+	for y := range modules {
+		modules[y] = make([]bool, size)
+		for x := range modules[y] {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x*qrModulePixels+qrModulePixels/2, bounds.Min.Y+y*qrModulePixels+qrModulePixels/2)).(color.Gray)
+			modules[y][x] = gray.Y < 128
+		}
+	}
+	return modules
+}
+
+// assertQRCodeOf checks a PNG QR code has exactly the modules of a QR code of content, so decodes back to it
+func assertQRCodeOf(t *testing.T, encoded []byte, content string) {
+	t.Helper()
+	want, err := qr.Encode(content, qr.L, qr.Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := qrModules(t, encoded)
+	if len(got) != want.Bounds().Dx() {
+		t.Fatalf("expected %d modules across, got %d", want.Bounds().Dx(), len(got))
+	}
+	for y := range got {
+		for x := range got[y] {
+			if dark := want.At(x, y) == color.Black; got[y][x] != dark {
+				t.Fatalf("module %d,%d doesn't match a QR code of %s", x, y, content)
+			}
+		}
+	}
+}
+
+func TestQRCodeHandler(t *testing.T) {
+	withSetting(t, "SURVEY_RUNNER_URL", "http://runner.example.com")
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		wantURL    string
+	}{
+		{"url", url.Values{"url": {"http://runner.example.com/session?token=abc"}}, http.StatusOK, "http://runner.example.com/session?token=abc"},
+		{"token", url.Values{"token": {"abc.def.ghi"}}, http.StatusOK, authentication.SessionURL("abc.def.ghi")},
+		{"url wins over token", url.Values{"url": {"http://example.com/"}, "token": {"abc"}}, http.StatusOK, "http://example.com/"},
+		{"neither", url.Values{}, http.StatusBadRequest, ""},
+		{"too long", url.Values{"url": {"http://example.com/" + strings.Repeat("x", 3000)}}, http.StatusBadRequest, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			getQRCodeHandler(recorder, httptest.NewRequest(http.MethodGet, "/qr?"+test.query.Encode(), nil))
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			if test.wantURL == "" {
+				return
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "image/png" {
+				t.Errorf("expected image/png, got %s", contentType)
+			}
+			assertQRCodeOf(t, recorder.Body.Bytes(), test.wantURL)
+		})
+	}
+}
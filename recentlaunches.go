@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/requestid"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// recentLaunch is a launch attempt listed on /admin/launches. Only identifiers and the outcome are kept, never the
+// token or claim values.
+type recentLaunch struct {
+	Time       time.Time `json:"time"`
+	SchemaName string    `json:"schema_name"`
+	Outcome    string    `json:"outcome"`
+	ErrorKind  string    `json:"error_kind,omitempty"`
+	TxID       string    `json:"tx_id,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// recentLaunches keeps the last RECENT_LAUNCHES_SIZE launch attempts in memory, so they're lost on restart
+type recentLaunches struct {
+	mutex   sync.Mutex
+	entries []recentLaunch
+}
+
+var launchHistory = &recentLaunches{}
+
+// add records a launch attempt, dropping the oldest once there are size of them
+func (l *recentLaunches) add(entry recentLaunch, size int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if size >= 0 && len(l.entries) > size {
+		l.entries = append([]recentLaunch(nil), l.entries[len(l.entries)-size:]...)
+	}
+}
+
+// list returns the recorded launch attempts, newest first
+func (l *recentLaunches) list() []recentLaunch {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	listed := make([]recentLaunch, len(l.entries))
+	for i, entry := range l.entries {
+		listed[len(l.entries)-1-i] = entry
+	}
+	return listed
+}
+
+// recordRecentLaunch adds a launch attempt to the recent launches. launch is nil when the launch failed, or when more
+// than one token was generated.
+func recordRecentLaunch(r *http.Request, schemaName string, timings *authentication.Timings, launch *authentication.Launch, err *authentication.LaunchError) {
+	entry := recentLaunch{
+		Time:       time.Now().UTC(),
+		SchemaName: schemaName,
+		Outcome:    "success",
+		RequestID:  requestid.FromContext(r.Context()),
+	}
+	if !timings.Started.IsZero() {
+		entry.DurationMS = time.Since(timings.Started).Milliseconds()
+	}
+	if err != nil {
+		entry.Outcome = "failure"
+		entry.ErrorKind = err.Kind
+	}
+	if launch != nil {
+		entry.TxID = claimString(launch.Claims, "tx_id")
+	}
+
+	launchHistory.add(entry, settings.GetInt("RECENT_LAUNCHES_SIZE"))
+}
+
+type recentLaunchesPage struct {
+	BasePath string
+	Launches []recentLaunch
+}
+
+// getRecentLaunchesHandler lists the recent launch attempts, as JSON when the request asks for it
+func getRecentLaunchesHandler(w http.ResponseWriter, r *http.Request) {
+	launches := launchHistory.list()
+
+	w.Header().Set("Cache-Control", "no-store")
+	if wantsJSON(r) || r.URL.Query().Get("format") == "json" {
+		writeJSON(w, r, http.StatusOK, launches)
+		return
+	}
+	serveTemplate("launches.html", recentLaunchesPage{BasePath: basePath(r), Launches: launches}, w, r)
+}
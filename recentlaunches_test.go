@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useLaunchHistory records launch attempts in a new, empty history for the rest of the test
+func useLaunchHistory(t *testing.T) {
+	t.Helper()
+	previous := launchHistory
+	launchHistory = &recentLaunches{}
+	t.Cleanup(func() { launchHistory = previous })
+}
+
+func TestRecentLaunchesSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		wantTxIDs []string
+	}{
+		{"under the size", 10, []string{"5", "4", "3", "2", "1"}},
+		{"over the size", 3, []string{"5", "4", "3"}},
+		{"disabled", 0, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := &recentLaunches{}
+			for _, txID := range []string{"1", "2", "3", "4", "5"} {
+				history.add(recentLaunch{TxID: txID}, test.size)
+			}
+
+			txIDs := []string{}
+			for _, entry := range history.list() {
+				txIDs = append(txIDs, entry.TxID)
+			}
+			if !reflect.DeepEqual(txIDs, test.wantTxIDs) {
+				t.Errorf("expected %v newest first, got %v", test.wantTxIDs, txIDs)
+			}
+		})
+	}
+}
+
+func TestRecentLaunchesConcurrent(t *testing.T) {
+	history := &recentLaunches{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				history.add(recentLaunch{Outcome: "success"}, 50)
+				history.list()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(history.list()); got != 50 {
+		t.Errorf("expected 50 launches, got %d", got)
+	}
+}
+
+func TestGetRecentLaunches(t *testing.T) {
+	runner := useRunner(t)
+	useLaunchHistory(t)
+
+	recorder := postAPI(t, "/api/token", `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "period_id": "201605"}}`)
+	var response launchResponse
+	decodeResponse(t, recorder, &response)
+	claims, err := runner.Claims(response.Token)
+	if err != nil {
+		t.Fatalf("the runner couldn't read the token: %v", err)
+	}
+	postAPI(t, "/api/token", `{"schema_name": "test_launch", "claims": {"ru_ref": "12346789012A", "ref_p_start_date": "01/05/2016"}}`)
+
+	recorder = route(t, httptest.NewRequest(http.MethodGet, "/admin/launches?format=json", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if strings.Contains(recorder.Body.String(), response.Token) || strings.Contains(recorder.Body.String(), "12346789012A") {
+		t.Errorf("expected no tokens or claim values, got %s", recorder.Body)
+	}
+
+	var launches []recentLaunch
+	decodeResponse(t, recorder, &launches)
+	if len(launches) != 2 {
+		t.Fatalf("expected 2 launches, got %+v", launches)
+	}
+	if launches[0].Outcome != "failure" || launches[0].ErrorKind != "metadata_error" || launches[0].SchemaName != "test_launch" {
+		t.Errorf("expected the failed launch first, got %+v", launches[0])
+	}
+	if launches[1].Outcome != "success" || launches[1].TxID != claims["tx_id"] || launches[1].RequestID == "" {
+		t.Errorf("expected the successful launch with its identifiers, got %+v", launches[1])
+	}
+
+	recorder = route(t, httptest.NewRequest(http.MethodGet, "/admin/launches", nil))
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/html") || !strings.Contains(recorder.Body.String(), "metadata_error") {
+		t.Errorf("expected the launches as an HTML page, got %s: %s", recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+}
@@ -0,0 +1,37 @@
+package requestid
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/gofrs/uuid"
+)
+
+// Header is the HTTP header the request ID is read from and returned in
+const Header = "X-Request-Id"
+
+// validID limits accepted request IDs to a safe length and character set so they can't be used to inject into logs
+var validID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// NewContext returns a context carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// FromContext returns the request ID carried by the context, or an empty string if there isn't one
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromHeader returns the supplied request ID if it is acceptable, otherwise a newly generated UUID
+func FromHeader(supplied string) string {
+	if validID.MatchString(supplied) {
+		return supplied
+	}
+
+	id, _ := uuid.NewV4()
+	return id.String()
+}
@@ -0,0 +1,46 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestFromHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		supplied string
+		keep     bool
+	}{
+		{"uuid", "6f0d8b8a-4a7e-4b8e-9c1e-2a5c1b0d7e3f", true},
+		{"other safe id", "trace.abc_123-x", true},
+		{"missing", "", false},
+		{"unsafe characters", "abc\ninjected=1", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := FromHeader(test.supplied)
+			if test.keep && got != test.supplied {
+				t.Errorf("expected %q, got %q", test.supplied, got)
+			}
+			if !test.keep {
+				if _, err := uuid.FromString(got); err != nil {
+					t.Errorf("expected a generated UUID, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != "" {
+		t.Errorf("expected no request ID, got %q", got)
+	}
+	if got := FromContext(NewContext(context.Background(), "abc")); got != "abc" {
+		t.Errorf("expected abc, got %q", got)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+)
+
+// postSchemaLaunchAPIHandler launches the schema JSON in the request body, with the launch values in the query
+// string, for schema authors trying out a schema they haven't hosted
+func postSchemaLaunchAPIHandler(w http.ResponseWriter, r *http.Request) {
+	schemaJSON, err := ioutil.ReadAll(r.Body)
+	if errors.Is(err, errRequestBodyTooLarge) {
+		writeAPIError(w, r, http.StatusRequestEntityTooLarge, errorInvalidRequest, requestTooLargeMessage())
+		return
+	} else if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, "The schema could not be read.")
+		return
+	}
+	if len(schemaJSON) == 0 {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, "the request body must be the schema JSON")
+		return
+	}
+
+	values, err := applyPersona(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, errorInvalidRequest, err.Error())
+		return
+	}
+
+	timings := &authentication.Timings{}
+	launch, launchErr := authentication.GenerateLaunchFromSchema(authentication.ContextWithTimings(r.Context(), timings), schemaJSON, values, authentication.TokenOptions{SignedCopy: wantsDebugClaims(r)})
+	schemaName := values.Get("schema_name")
+	if launch != nil && schemaName == "" {
+		schemaName = claimString(launch.Claims, "schema_name")
+	}
+	recordLaunch(r, schemaName, timings, launch, launchErr)
+	if launchErr != nil {
+		writeAPILaunchFailure(w, r, launchErr, schemaName)
+		return
+	}
+	auditLaunch(r, launch, schemaName)
+	setLaunchHeaders(w, launch)
+
+	writeJSON(w, r, http.StatusOK, newLaunchResponse(r, launch, launch.URL))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPostSchemaLaunchAPI(t *testing.T) {
+	runner := useRunner(t)
+
+	recorder := postAPI(t, "/api/schema-launch?ru_ref=12346789012A&period_id=201605&ref_p_start_date=2016-05-01", launchSchema)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var response launchResponse
+	decodeResponse(t, recorder, &response)
+	claims, err := runner.Claims(response.Token)
+	if err != nil {
+		t.Fatalf("the runner couldn't read the token: %v", err)
+	}
+	if claims["schema_name"] != "test_launch" || claims["ru_ref"] != "12346789012A" {
+		t.Errorf("expected the inline schema's claims, got %v", claims)
+	}
+	if _, ok := claims["survey_url"]; ok {
+		t.Errorf("expected no survey_url for a schema without a URL, got %v", claims["survey_url"])
+	}
+}
+
+func TestPostSchemaLaunchAPIInvalidSchema(t *testing.T) {
+	useRunner(t)
+	validator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors": ["sections is required"]}`))
+	}))
+	t.Cleanup(validator.Close)
+
+	tests := []struct {
+		name         string
+		validatorURL string
+		body         string
+		wantStatus   int
+		wantMessage  string
+	}{
+		{"not JSON", "", `{"schema_name": "test_launch", `, http.StatusUnprocessableEntity, "isn't valid"},
+		{"rejected by the validator", validator.URL, launchSchema, http.StatusUnprocessableEntity, "isn't valid"},
+		{"empty body", "", "", http.StatusBadRequest, "must be the schema JSON"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "SCHEMA_VALIDATOR_URL", test.validatorURL)
+
+			// The API responds with JSON even to a request which would rather have HTML
+			req := httptest.NewRequest(http.MethodPost, "/api/schema-launch?ru_ref=12346789012A", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "text/html")
+			recorder := route(t, req)
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			var response apiErrorResponse
+			decodeResponse(t, recorder, &response)
+			if !strings.Contains(response.Error.Message, test.wantMessage) {
+				t.Errorf("expected the error to mention %q, got %q", test.wantMessage, response.Error.Message)
+			}
+			if strings.Contains(recorder.Body.String(), "sections is required") {
+				t.Errorf("expected the validator's response only to be logged, got %s", recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+// serve runs the server, and the HTTP to HTTPS redirect server when it isn't nil, until it receives SIGTERM or SIGINT.
+// It then stops accepting new connections and waits up to SHUTDOWN_GRACE_PERIOD for in-flight launches to finish.
+// An error is returned if they are still running after that.
+func serve(server *http.Server, redirectServer *http.Server) error {
+	// Every request context, and so every upstream call made for it, is derived from baseCtx so that anything still
+	// running once the grace period has passed is abandoned rather than left behind
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	server.BaseContext = func(net.Listener) context.Context { return baseCtx }
+
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	serveErr := make(chan error, 2)
+	go func() {
+		if server.TLSConfig != nil {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+	if redirectServer != nil {
+		go func() {
+			serveErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-signalCtx.Done():
+	}
+
+	// A second signal falls back to the default behaviour of exiting immediately
+	stopSignals()
+
+	gracePeriod := settings.GetDuration("SHUTDOWN_GRACE_PERIOD")
+	logging.Info("shutting down", "grace_period", gracePeriod)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancelShutdown()
+
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		cancelBase()
+		return fmt.Errorf("in-flight requests did not finish within %s: %v", gracePeriod, err)
+	}
+
+	return nil
+}
+
+// setServerLimits applies the SERVER_* timeouts and header size limit to server, so slow or abandoned connections are
+// closed rather than accumulating. The write timeout runs from the end of reading the request headers to the end of
+// the response, so it has to allow for the slowest schema fetch and bulk launch.
+func setServerLimits(server *http.Server) {
+	server.ReadHeaderTimeout = settings.GetDuration("SERVER_READ_HEADER_TIMEOUT")
+	server.ReadTimeout = settings.GetDuration("SERVER_READ_TIMEOUT")
+	server.WriteTimeout = settings.GetDuration("SERVER_WRITE_TIMEOUT")
+	server.IdleTimeout = settings.GetDuration("SERVER_IDLE_TIMEOUT")
+	server.MaxHeaderBytes = settings.GetInt("SERVER_MAX_HEADER_BYTES")
+}
+
+// serverTLSConfig returns the TLS configuration for the server when TLS_CERT_PATH and TLS_KEY_PATH are set, or nil to
+// serve plain HTTP when neither is
+func serverTLSConfig() (*tls.Config, error) {
+	certPath := settings.Get("TLS_CERT_PATH")
+	keyPath := settings.Get("TLS_KEY_PATH")
+
+	if certPath == "" && keyPath == "" {
+		return nil, nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, errors.New("TLS_CERT_PATH and TLS_KEY_PATH must both be set to serve TLS")
+	}
+
+	loader := &certificateLoader{certPath: certPath, keyPath: keyPath}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+		CurvePreferences:         []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		GetCertificate: loader.getCertificate,
+	}, nil
+}
+
+// certificateLoader serves the TLS certificate, reloading it when either file changes so that short-lived
+// certificates can be rotated without a restart
+type certificateLoader struct {
+	certPath string
+	keyPath  string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func (l *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if modTime := l.filesModTime(); modTime.After(l.modTime) {
+		if err := l.loadLocked(); err != nil {
+			// Keep serving the previous certificate until the new files are complete
+			logging.Error("failed to reload TLS certificate", "error", err)
+		} else {
+			logging.Info("reloaded TLS certificate", "path", l.certPath)
+		}
+	}
+
+	return l.certificate, nil
+}
+
+func (l *certificateLoader) load() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.loadLocked()
+}
+
+func (l *certificateLoader) loadLocked() error {
+	modTime := l.filesModTime()
+
+	certificate, err := tls.LoadX509KeyPair(l.certPath, l.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate from %s and %s: %v", l.certPath, l.keyPath, err)
+	}
+
+	l.certificate = &certificate
+	l.modTime = modTime
+	return nil
+}
+
+// filesModTime returns the later of the certificate and key files' modification times
+func (l *certificateLoader) filesModTime() time.Time {
+	var modTime time.Time
+	for _, path := range []string{l.certPath, l.keyPath} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime
+}
+
+// newRedirectServer returns a server on TLS_REDIRECT_HTTP_PORT which redirects every request to HTTPS on the port of
+// tlsAddress, or nil when the port isn't set
+func newRedirectServer(tlsAddress string) *http.Server {
+	port := settings.Get("TLS_REDIRECT_HTTP_PORT")
+	if port == "" {
+		return nil
+	}
+
+	server := &http.Server{
+		Addr: settings.Get("GO_LAUNCH_A_SURVEY_LISTEN_HOST") + ":" + port,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				host = hostname
+			}
+			if _, tlsPort, err := net.SplitHostPort(tlsAddress); err == nil && tlsPort != "443" {
+				host = net.JoinHostPort(host, tlsPort)
+			}
+
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+	}
+	setServerLimits(server)
+
+	return server
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSetServerLimits(t *testing.T) {
+	withSetting(t, "SERVER_READ_HEADER_TIMEOUT", "5s")
+	withSetting(t, "SERVER_READ_TIMEOUT", "15s")
+	withSetting(t, "SERVER_WRITE_TIMEOUT", "1m")
+	withSetting(t, "SERVER_IDLE_TIMEOUT", "2m")
+	withSetting(t, "SERVER_MAX_HEADER_BYTES", "4096")
+
+	server := &http.Server{}
+	setServerLimits(server)
+
+	if server.ReadHeaderTimeout != 5*time.Second {
+		t.Errorf("expected a read header timeout of 5s, got %s", server.ReadHeaderTimeout)
+	}
+	if server.ReadTimeout != 15*time.Second {
+		t.Errorf("expected a read timeout of 15s, got %s", server.ReadTimeout)
+	}
+	if server.WriteTimeout != time.Minute {
+		t.Errorf("expected a write timeout of 1m, got %s", server.WriteTimeout)
+	}
+	if server.IdleTimeout != 2*time.Minute {
+		t.Errorf("expected an idle timeout of 2m, got %s", server.IdleTimeout)
+	}
+	if server.MaxHeaderBytes != 4096 {
+		t.Errorf("expected max header bytes of 4096, got %d", server.MaxHeaderBytes)
+	}
+}
+
+func TestSetServerLimitsDefaults(t *testing.T) {
+	server := &http.Server{}
+	setServerLimits(server)
+
+	if server.ReadHeaderTimeout == 0 || server.ReadTimeout == 0 || server.WriteTimeout == 0 || server.IdleTimeout == 0 {
+		t.Errorf("expected every timeout to be set by default, got %+v", server)
+	}
+}
+
+// startServe runs serve with handler on a free local port, returning the server's URL and serve's result
+func startServe(t *testing.T, handler http.Handler) (string, chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	served := make(chan error, 1)
+	go func() { served <- serve(&http.Server{Addr: addr, Handler: handler}, nil) }()
+	return "http://" + addr, served
+}
+
+// getWhenListening retries the GET until the server has started listening
+func getWhenListening(t *testing.T, url string) (*http.Response, error) {
+	t.Helper()
+	for attempt := 0; ; attempt++ {
+		resp, err := http.Get(url)
+		if err == nil || attempt == 50 {
+			return resp, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeFinishesInFlightRequestsOnSIGTERM(t *testing.T) {
+	withSetting(t, "SHUTDOWN_GRACE_PERIOD", "5s")
+
+	started := make(chan struct{})
+	serverURL, served := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("launched"))
+	}))
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := getWhenListening(t, serverURL)
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	response := <-responses
+	if response.err != nil || response.body != "launched" {
+		t.Errorf("expected the in-flight request to complete, got %q, %v", response.body, response.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestServeReportsRequestsOutlastingTheGracePeriod(t *testing.T) {
+	withSetting(t, "SHUTDOWN_GRACE_PERIOD", "50ms")
+
+	started := make(chan struct{})
+	abandoned := make(chan struct{})
+	serverURL, served := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-r.Context().Done():
+			close(abandoned)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+
+	go func() {
+		if resp, err := getWhenListening(t, serverURL); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-served; err == nil {
+		t.Error("expected an error when requests outlast the grace period")
+	}
+	select {
+	case <-abandoned:
+	case <-time.After(time.Second):
+		t.Error("expected the request's context to be cancelled once the grace period passed")
+	}
+}
+
+func TestServerTLSConfigRequiresBothPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		certPath  string
+		keyPath   string
+		wantError bool
+	}{
+		{"neither serves plain HTTP", "", "", false},
+		{"only the certificate", "/etc/launcher/tls.crt", "", true},
+		{"only the key", "", "/etc/launcher/tls.key", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "TLS_CERT_PATH", test.certPath)
+			withSetting(t, "TLS_KEY_PATH", test.keyPath)
+
+			tlsConfig, err := serverTLSConfig()
+			if test.wantError {
+				if err == nil || !strings.Contains(err.Error(), "must both be set") {
+					t.Errorf("expected startup to fail with both paths required, got %v", err)
+				}
+				return
+			}
+			if err != nil || tlsConfig != nil {
+				t.Errorf("expected plain HTTP, got %v, %v", tlsConfig, err)
+			}
+		})
+	}
+}
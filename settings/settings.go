@@ -1,6 +1,11 @@
 package settings
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 var _settings map[string]string
 
@@ -16,15 +21,161 @@ func init() {
 	_settings = make(map[string]string)
 	setSetting("GO_LAUNCH_A_SURVEY_LISTEN_HOST", "0.0.0.0")
 	setSetting("GO_LAUNCH_A_SURVEY_LISTEN_PORT", "8000")
+	setSetting("LISTEN_ADDRESS", "")
+	setSetting("URL_PREFIX", "")
+	setSetting("EXTERNAL_BASE_URL", "")
+	setSetting("LAUNCH_LINK_TIMEZONE", "Europe/London")
 	setSetting("SURVEY_RUNNER_URL", "http://localhost:5000")
 	setSetting("SURVEY_RUNNER_SCHEMA_URL", Get("SURVEY_RUNNER_URL"))
+	setSetting("SURVEY_RUNNER_SESSION_PATH", "/session?token={token}")
+	setSetting("LAUNCH_COOKIE_NAME", "")
+	setSetting("LAUNCH_COOKIE_DOMAIN", "")
+	setSetting("LAUNCH_COOKIE_REDIRECT_PATH", "/session")
+	setSetting("RUNNER_HANDOFF_URL", "")
+	setSetting("RUNNER_HANDOFF_METHOD", "GET")
 	setSetting("SCHEMA_VALIDATOR_URL", "")
+	setSetting("SCHEMA_VALIDATOR_TIMEOUT", "10s")
+	setSetting("VALIDATOR_RETRIES", "0")
 	setSetting("SURVEY_REGISTER_URL", "")
 	setSetting("JWT_ENCRYPTION_KEY_PATH", "jwt-test-keys/sdc-user-authentication-encryption-sr-public-key.pem")
 	setSetting("JWT_SIGNING_KEY_PATH", "jwt-test-keys/sdc-user-authentication-signing-launcher-private-key.pem")
+	setSetting("JWT_ENCRYPTION_KEY_DIR", "")
+	setSetting("JWT_SIGNING_KEY_DIR", "")
+	setSetting("JWT_SIGNING_KEY_PASSPHRASE", "")
+	setSetting("SIGNED_ONLY_FALLBACK", "false")
+	setSetting("DETERMINISTIC_TX_ID", "false")
+	setSetting("JWT_TYP", "JWT")
+	setSetting("JWT_DETACHED_PAYLOAD", "false")
+	setSetting("JWT_CONTENT_ENCRYPTION", "A256GCM")
+	setSetting("JWT_CLOCK_SKEW", "0s")
+	setSetting("JWT_MAX_LIFETIME", "24h")
+	setSetting("JWT_MAX_LIFETIME_MODE", "reject")
+	setSetting("JWT_SIGNING_KEYS", "")
+	setSetting("SURVEY_SIGNING_KEYS", "")
+	setSetting("SURVEY_REQUIRED_ROLES", "")
+	setSetting("FORBIDDEN_ROLES", "")
+	setSetting("ALLOWED_ROLE_COMBINATIONS", "")
+	setSetting("MAX_ROLES", "10")
+	setSetting("MAX_CLAIMS", "0")
+	setSetting("CIRCUIT_BREAKER_THRESHOLD", "5")
+	setSetting("CIRCUIT_BREAKER_COOLDOWN", "30s")
+	setSetting("FORM_TYPE_MAP", "")
+	setSetting("HTTP_CLIENT_CONFIG", "")
+	setSetting("HTTP_CLIENT_MAX_REDIRECTS", "10")
+	setSetting("HTTP_CLIENT_CROSS_HOST_REDIRECTS", "true")
+	setSetting("SCHEMA_UNIX_SOCKET", "")
+	setSetting("SCHEMA_FETCH_METHOD", "GET")
+	setSetting("SCHEMA_HOST_ALLOWLIST", "")
+	setSetting("SCHEMA_QUERY_PARAMS", "")
+	setSetting("MAX_SCHEMA_BYTES", "5242880")
+	setSetting("SCHEMA_HASH_CLAIM", "false")
+	setSetting("LAUNCHER_VERSION_CLAIM", "false")
+	setSetting("SCHEMA_NAME_CASE", "preserve")
+	setSetting("DEFAULT_SCHEMA_NAME", "")
+	setSetting("HEALTH_CHECK_CACHE_DURATION", "5s")
+	setSetting("HEALTH_CHECK_TIMEOUT", "5s")
+	setSetting("CHANNEL_ACCOUNT_SERVICE_URLS", "")
+	setSetting("ACCOUNT_SERVICE_URL_TRAILING_SLASH", "")
+	setSetting("CLAIMS_VERSION", "v1")
+	setSetting("EXCLUDED_CLAIMS", "")
+	setSetting("CLAIM_RENAME_MAP", "")
+	setSetting("METADATA_CLAIM_PREFIX", "")
+	setSetting("NULL_OPTIONAL_METADATA", "false")
+	setSetting("EMPTY_REQUIRED_METADATA", "false")
+	setSetting("LAUNCHER_STRICT", "false")
+	setSetting("STRICT_CLAIMS", "false")
+	setSetting("TRIM_CLAIM_VALUES", "true")
+	setSetting("TRIM_CLAIM_VALUES_EXCLUDED", "")
+	setSetting("QUICKLAUNCH_RUNNER_FALLBACK", "false")
+	setSetting("QUICKLAUNCH_FALLBACK_SCHEMA_NAME", "")
+	setSetting("STRIP_SURVEY_URL_CACHE_BUST", "false")
+	setSetting("SCHEMA_URL_CLAIM", "survey_url")
+	setSetting("SHUTDOWN_GRACE_PERIOD", "25s")
+	setSetting("SERVER_READ_HEADER_TIMEOUT", "10s")
+	setSetting("SERVER_READ_TIMEOUT", "30s")
+	setSetting("SERVER_WRITE_TIMEOUT", "120s")
+	setSetting("SERVER_IDLE_TIMEOUT", "120s")
+	setSetting("SERVER_MAX_HEADER_BYTES", "65536")
+	setSetting("MAX_REQUEST_BODY_BYTES", "1048576")
+	setSetting("CORS_ALLOWED_ORIGINS", "")
+	setSetting("DEFAULT_COUNTRY", "E")
+	setSetting("DEFAULT_USER_ID", "UNKNOWN")
+	setSetting("GENERATE_USER_ID", "false")
+	setSetting("CASE_REF_FORMAT", "numeric")
+	setSetting("CASE_REF_LENGTH", "16")
+	setSetting("GENERATE_CASE_REF", "false")
+	setSetting("TRAD_AS_FROM_RU_NAME", "false")
+	setSetting("LANGUAGE_DEFAULTS_PATH", "")
+	setSetting("COLLECTION_EXERCISE_PERIODS_PATH", "")
+	setSetting("LAUNCH_LANGUAGE_CLAIM", "false")
+	setSetting("DEFAULTS_THEME", "")
+	setSetting("COUNTRY_CODES", "")
+	setSetting("VALIDATE_RU_REF", "false")
+	setSetting("VALIDATE_PERIOD_ID", "false")
+	setSetting("LAUNCHER_BASIC_AUTH", "")
+	setSetting("LAUNCHER_API_TOKEN", "")
+	setSetting("STRICT_SCHEMA_METADATA", "false")
+	setSetting("ALLOW_RESERVED_METADATA", "false")
+	setSetting("RESOLVE_SCHEMA_REFS", "false")
+	setSetting("TLS_CERT_PATH", "")
+	setSetting("TLS_KEY_PATH", "")
+	setSetting("TLS_REDIRECT_HTTP_PORT", "")
+	setSetting("MOCK_RUNNER_DECRYPTION_KEY_PATH", "")
+	setSetting("GZIP_MIN_BYTES", "1400")
+	setSetting("LAST_VALUES_COOKIE_KEY", "")
+	setSetting("PERSONAS_PATH", "")
+	setSetting("LAUNCH_TEMPLATE_PATH", "")
+	setSetting("MAX_BULK_LAUNCHES", "100")
+	setSetting("AUDIT_LOG_PATH", "")
+	setSetting("RECENT_LAUNCHES_SIZE", "100")
+	setSetting("STRICT_SETTINGS", "false")
+	setSetting("ASSETS_FROM_DISK", "false")
+	setSetting("ENABLE_DEBUG_CLAIMS", "false")
+	setSetting("ENABLE_ENC_OVERRIDE", "false")
+	setSetting("ENABLE_SCHEMA_SCHEME_OVERRIDE", "false")
+	setSetting("ENABLE_KEYGEN", "false")
+	setSetting("ENABLE_PPROF", "false")
+	setSetting("PPROF_BLOCK_PROFILE_RATE", "0")
+	setSetting("PPROF_MUTEX_PROFILE_FRACTION", "0")
+	setSetting("LOG_LEVEL", "info")
+	setSetting("LOG_FORMAT", "json")
 }
 
 // Get returns the value for the specified named setting
 func Get(name string) string {
 	return _settings[name]
 }
+
+// Set overrides the value of the specified named setting, for harnesses which configure the launcher in-process
+func Set(name string, value string) {
+	_settings[name] = value
+}
+
+// GetInt returns the value for the specified named setting as an int, or 0 if it is not a valid integer
+func GetInt(name string) int {
+	value, _ := strconv.Atoi(strings.TrimSpace(_settings[name]))
+	return value
+}
+
+// GetBool returns the value for the specified named setting as a bool, or false if it is not a valid boolean
+func GetBool(name string) bool {
+	value, _ := strconv.ParseBool(strings.TrimSpace(_settings[name]))
+	return value
+}
+
+// GetDuration returns the value for the specified named setting as a time.Duration, or 0 if it is not a valid duration
+func GetDuration(name string) time.Duration {
+	value, _ := time.ParseDuration(strings.TrimSpace(_settings[name]))
+	return value
+}
+
+// GetList returns the value for the specified named setting split on commas, with whitespace and empty entries removed
+func GetList(name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(_settings[name], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+	"github.com/ONSdigital/eq-questionnaire-launcher/surveys"
+	"github.com/ONSdigital/eq-questionnaire-launcher/version"
+)
+
+const (
+	statusOK       = "OK"
+	statusFailed   = "FAILED"
+	statusReady    = "READY"
+	statusNotReady = "NOT_READY"
+)
+
+type dependencyCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type statusReport struct {
+	Status   string                     `json:"status"`
+	Failing  []string                   `json:"failing,omitempty"`
+	Checks   map[string]dependencyCheck `json:"checks"`
+	Circuits map[string]string          `json:"circuits"`
+	Checked  time.Time                  `json:"checked_at"`
+}
+
+var (
+	statusMutex  sync.Mutex
+	cachedStatus *statusReport
+
+	// statusChecking is closed when the checks in flight finish, and is nil when none are running
+	statusChecking chan struct{}
+)
+
+func newDependencyCheck(err error) dependencyCheck {
+	if err != nil {
+		return dependencyCheck{Status: statusFailed, Error: err.Error()}
+	}
+	return dependencyCheck{Status: statusOK}
+}
+
+// pingRunnerSchemas checks that the runner's schema list can be fetched
+func pingRunnerSchemas(ctx context.Context) error {
+	schemasURL, err := clients.JoinURL(settings.Get("SURVEY_RUNNER_SCHEMA_URL"), "schemas")
+	if err != nil {
+		return err
+	}
+	return clients.Ping(ctx, schemasURL)
+}
+
+// checkDependencies runs each readiness check, only calling out to the upstream services which are configured
+func checkDependencies(ctx context.Context) *statusReport {
+	checks := map[string]dependencyCheck{
+		"keys":           newDependencyCheck(authentication.CheckKeys()),
+		"schema_runner":  newDependencyCheck(pingRunnerSchemas(ctx)),
+		"schema_sources": newDependencyCheck(surveys.CheckSources(ctx)),
+	}
+
+	if validatorURL := settings.Get("SCHEMA_VALIDATOR_URL"); validatorURL != "" {
+		checks["schema_validator"] = newDependencyCheck(clients.Ping(ctx, validatorURL))
+	}
+
+	if registerURL := settings.Get("SURVEY_REGISTER_URL"); registerURL != "" {
+		checks["survey_register"] = newDependencyCheck(clients.Ping(ctx, registerURL))
+	}
+
+	report := &statusReport{Status: statusReady, Checks: checks, Checked: time.Now()}
+	for name, check := range checks {
+		if check.Status != statusOK {
+			report.Status = statusNotReady
+			report.Failing = append(report.Failing, name)
+		}
+	}
+
+	return report
+}
+
+// getStatusReport returns the last readiness report if it is recent enough, so probes don't hammer the dependencies.
+// Otherwise the first request runs the checks, and any others arriving meanwhile wait for its result rather than
+// running their own.
+func getStatusReport(ctx context.Context) statusReport {
+	statusMutex.Lock()
+	if cachedStatus == nil || time.Since(cachedStatus.Checked) > settings.GetDuration("HEALTH_CHECK_CACHE_DURATION") {
+		checking := statusChecking
+		if checking == nil {
+			checking = make(chan struct{})
+			statusChecking = checking
+			go refreshStatus(ctx, checking)
+		}
+		statusMutex.Unlock()
+		<-checking
+		statusMutex.Lock()
+	}
+
+	report := *cachedStatus
+	statusMutex.Unlock()
+
+	report.Circuits = clients.CircuitStates()
+	return report
+}
+
+// refreshStatus runs the readiness checks and caches the report, closing checking once it is cached. The checks get
+// their own HEALTH_CHECK_TIMEOUT rather than the request's context, so a probe which gives up doesn't fail them for
+// the requests waiting on the same result.
+func refreshStatus(ctx context.Context, checking chan struct{}) {
+	checkCtx, cancel := context.WithTimeout(context.Background(), settings.GetDuration("HEALTH_CHECK_TIMEOUT"))
+	defer cancel()
+
+	report := checkDependencies(checkCtx)
+	if report.Status != statusReady {
+		logging.FromContext(ctx).Warn("readiness checks failing", "failing", report.Failing)
+	}
+
+	statusMutex.Lock()
+	cachedStatus = report
+	statusChecking = nil
+	statusMutex.Unlock()
+	close(checking)
+}
+
+func writeStatus(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.Error("failed to write status response", "error", err)
+	}
+}
+
+func getLiveStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, map[string]string{"status": statusOK})
+}
+
+func getReadyStatusHandler(w http.ResponseWriter, r *http.Request) {
+	report := getStatusReport(r.Context())
+
+	status := http.StatusOK
+	if report.Status != statusReady {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeStatus(w, status, report)
+}
+
+func getVersionStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, version.Get())
+}
+
+func getAlgorithmsStatusHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, http.StatusOK, authentication.GetTokenAlgorithms())
+}
+
+func getJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keySet, err := authentication.SigningJWKS()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("failed to load signing keys for JWKS", "error", err)
+		writeStatus(w, http.StatusServiceUnavailable, dependencyCheck{Status: statusFailed, Error: err.Error()})
+		return
+	}
+	writeStatus(w, http.StatusOK, keySet)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/authentication"
+)
+
+func TestVersionStatus(t *testing.T) {
+	recorder := route(t, httptest.NewRequest(http.MethodGet, "/status/version", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	for _, field := range []string{"version", "commit", "build_time", "go_version"} {
+		value, ok := body[field].(string)
+		if !ok || value == "" {
+			t.Errorf("expected a non-empty %s, got %v", field, body[field])
+		}
+	}
+	if len(body) != 4 {
+		t.Errorf("expected only the version fields, got %v", body)
+	}
+}
+
+func TestAlgorithmsStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		want     authentication.TokenAlgorithms
+	}{
+		{
+			"defaults",
+			map[string]string{"JWT_CONTENT_ENCRYPTION": "A256GCM", "JWT_DETACHED_PAYLOAD": "false", "JWT_TYP": "JWT", "ENABLE_ENC_OVERRIDE": "false"},
+			authentication.TokenAlgorithms{SigningAlgorithm: "RS256", KeyEncryptionAlgorithm: "RSA-OAEP", ContentEncryptionAlgorithm: "A256GCM", KIDHash: "SHA-1", Serialization: "compact", Typ: "JWT"},
+		},
+		{
+			"configured",
+			map[string]string{"JWT_CONTENT_ENCRYPTION": "A128CBC-HS256", "JWT_DETACHED_PAYLOAD": "true", "JWT_TYP": "eq+jwt", "ENABLE_ENC_OVERRIDE": "true"},
+			authentication.TokenAlgorithms{SigningAlgorithm: "RS256", KeyEncryptionAlgorithm: "RSA-OAEP", ContentEncryptionAlgorithm: "A128CBC-HS256", EncOverride: true, KIDHash: "SHA-1", Serialization: "detached", Typ: "eq+jwt"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.settings {
+				withSetting(t, name, value)
+			}
+
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/status/algorithms", nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", recorder.Code)
+			}
+
+			var got authentication.TokenAlgorithms
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			test.want.SupportedContentEncryptions = authentication.ContentEncryptions
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+// useStatusSchemas points SURVEY_RUNNER_SCHEMA_URL at a server listing schemas, which first waits for release when it
+// isn't nil, and clears the cached readiness report. It returns the number of requests the server has had.
+func useStatusSchemas(t *testing.T, schemas string, release chan struct{}) *int32 {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if release != nil {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(schemas))
+	}))
+	t.Cleanup(server.Close)
+	withSetting(t, "SURVEY_RUNNER_SCHEMA_URL", server.URL)
+
+	reset := func() { cachedStatus = nil }
+	reset()
+	t.Cleanup(reset)
+	return &requests
+}
+
+func TestLiveStatus(t *testing.T) {
+	useRunner(t)
+	requests := useStatusSchemas(t, `["test_launch"]`, nil)
+
+	recorder := route(t, httptest.NewRequest(http.MethodGet, "/status/live", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	var body map[string]string
+	decodeResponse(t, recorder, &body)
+	if body["status"] != statusOK {
+		t.Errorf("expected %s, got %v", statusOK, body)
+	}
+	if got := atomic.LoadInt32(requests); got != 0 {
+		t.Errorf("expected no upstream requests, got %d", got)
+	}
+}
+
+func TestReadyStatus(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name        string
+		schemas     string
+		wantStatus  int
+		wantFailing []string
+	}{
+		{"ready", `["test_launch"]`, http.StatusOK, nil},
+		{"no schemas", `[]`, http.StatusServiceUnavailable, []string{"schema_sources"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useStatusSchemas(t, test.schemas, nil)
+
+			recorder := route(t, httptest.NewRequest(http.MethodGet, "/status/ready", nil))
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", test.wantStatus, recorder.Code, recorder.Body)
+			}
+			var report statusReport
+			decodeResponse(t, recorder, &report)
+			if !reflect.DeepEqual(report.Failing, test.wantFailing) {
+				t.Errorf("expected failing %v, got %v", test.wantFailing, report.Failing)
+			}
+			if check := report.Checks["schema_runner"]; check.Status != statusOK {
+				t.Errorf("expected the runner to be reachable, got %+v", check)
+			}
+		})
+	}
+}
+
+func TestReadyStatusCached(t *testing.T) {
+	useRunner(t)
+
+	tests := []struct {
+		name         string
+		duration     string
+		wantRequests int32
+	}{
+		{"cached", "1m", 2},
+		{"not cached", "0s", 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			withSetting(t, "HEALTH_CHECK_CACHE_DURATION", test.duration)
+			requests := useStatusSchemas(t, `["test_launch"]`, nil)
+
+			for i := 0; i < 2; i++ {
+				if report := getStatusReport(context.Background()); report.Status != statusReady {
+					t.Fatalf("expected %s, got %+v", statusReady, report)
+				}
+			}
+			if got := atomic.LoadInt32(requests); got != test.wantRequests {
+				t.Errorf("expected %d upstream requests, got %d", test.wantRequests, got)
+			}
+		})
+	}
+}
+
+func TestReadyStatusSharesChecks(t *testing.T) {
+	useRunner(t)
+	release := make(chan struct{})
+	requests := useStatusSchemas(t, `["test_launch"]`, release)
+
+	// The checks don't use the probes' contexts, so probes which have given up don't fail them
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var wg sync.WaitGroup
+	reports := make([]statusReport, 5)
+	for i := range reports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = getStatusReport(ctx)
+		}(i)
+	}
+	for atomic.LoadInt32(requests) == 0 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	for _, report := range reports {
+		if report.Status != statusReady {
+			t.Errorf("expected %s, got %+v", statusReady, report)
+		}
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("expected one run of the checks, got %d upstream requests", got)
+	}
+}
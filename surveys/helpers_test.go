@@ -0,0 +1,14 @@
+package surveys
+
+import (
+	"testing"
+
+	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
+)
+
+func withSetting(t *testing.T, name string, value string) {
+	t.Helper()
+	previous := settings.Get(name)
+	settings.Set(name, value)
+	t.Cleanup(func() { settings.Set(name, previous) })
+}
@@ -1,17 +1,18 @@
 package surveys
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"regexp"
 
-	"fmt"
-	"io/ioutil"
 	"sort"
 	"strings"
 
 	"github.com/AreaHQ/jsonhal"
 	"github.com/ONSdigital/eq-questionnaire-launcher/clients"
+	"github.com/ONSdigital/eq-questionnaire-launcher/logging"
 	"github.com/ONSdigital/eq-questionnaire-launcher/settings"
 )
 
@@ -19,6 +20,14 @@ import (
 type LauncherSchema struct {
 	Name string
 	URL  string
+
+	// AccountServiceURL and AccountServiceLogOutURL are the survey's own account service, from the survey register,
+	// used by quick launches which don't give their own.
+	AccountServiceURL       string
+	AccountServiceLogOutURL string
+
+	// CacheBust is the query the launcher added to the end of URL, so the runner fetches a quick launch schema afresh.
+	CacheBust string
 }
 
 // LauncherSchemas is a separation of Test and Live schemas
@@ -42,7 +51,9 @@ type Schemas []Schema
 // Schema is an available schema
 type Schema struct {
 	jsonhal.Hal
-	Name string `json:"name"`
+	Name                    string `json:"name"`
+	AccountServiceURL       string `json:"account_service_url"`
+	AccountServiceLogOutURL string `json:"account_service_log_out_url"`
 }
 
 var eqIDFormTypeRegex = regexp.MustCompile(`^(?P<eq_id>[a-z0-9]+)_(?P<form_type>\w+)`)
@@ -55,10 +66,10 @@ func LauncherSchemaFromFilename(filename string) LauncherSchema {
 }
 
 // GetAvailableSchemas Gets the list of static schemas an joins them with any schemas from the eq-survey-register if defined
-func GetAvailableSchemas() LauncherSchemas {
+func GetAvailableSchemas(ctx context.Context) LauncherSchemas {
 	schemaList := LauncherSchemas{}
 
-	runnerSchemas := getAvailableSchemasFromRunner()
+	runnerSchemas := getAvailableSchemasFromRunner(ctx)
 
 	for _, launcherSchema := range runnerSchemas {
 		if strings.HasPrefix(launcherSchema.Name, "test_") {
@@ -74,7 +85,11 @@ func GetAvailableSchemas() LauncherSchemas {
 		}
 	}
 
-	schemaList.Other = getAvailableSchemasFromRegister()
+	registerSchemas, err := getAvailableSchemasFromRegister(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to load schemas from register", "error", err)
+	}
+	schemaList.Other = registerSchemas
 
 	sort.Sort(ByFilename(schemaList.Business))
 	sort.Sort(ByFilename(schemaList.Census))
@@ -92,27 +107,16 @@ func (a ByFilename) Len() int           { return len(a) }
 func (a ByFilename) Less(i, j int) bool { return a[i].Name < a[j].Name }
 func (a ByFilename) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
-func getAvailableSchemasFromRegister() []LauncherSchema {
+// getAvailableSchemasFromRegister returns the schemas in the survey register, or an empty list with the error when the
+// register can't be reached, such as when the request is cancelled or the circuit is open
+func getAvailableSchemasFromRegister(ctx context.Context) ([]LauncherSchema, error) {
 
 	schemaList := []LauncherSchema{}
 
 	if settings.Get("SURVEY_REGISTER_URL") != "" {
-		resp, err := clients.GetHTTPClient().Get(settings.Get("SURVEY_REGISTER_URL"))
-		if err != nil {
-			log.Fatal("Do: ", err)
-			return []LauncherSchema{}
-		}
-
-		responseBody, err := ioutil.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return schemaList
-		}
-
 		var registerResponse RegisterResponse
-		if err := json.Unmarshal(responseBody, &registerResponse); err != nil {
-			log.Print(err)
-			return schemaList
+		if err := clients.GetJSON(ctx, settings.Get("SURVEY_REGISTER_URL"), &registerResponse); err != nil {
+			return schemaList, err
 		}
 
 		var schemas Schemas
@@ -120,93 +124,119 @@ func getAvailableSchemasFromRegister() []LauncherSchema {
 		schemasJSON, _ := json.Marshal(registerResponse.Embedded["schemas"])
 
 		if err := json.Unmarshal(schemasJSON, &schemas); err != nil {
-			log.Println(err)
+			logging.FromContext(ctx).Error("failed to parse schemas from register", "error", err)
 		}
 
 		for _, schema := range schemas {
 			url := schema.Links["self"]
 			schemaList = append(schemaList, LauncherSchema{
-				Name: schema.Name,
-				URL:  url.Href,
+				Name:                    schema.Name,
+				URL:                     url.Href,
+				AccountServiceURL:       schema.AccountServiceURL,
+				AccountServiceLogOutURL: schema.AccountServiceLogOutURL,
 			})
 		}
 	}
 
+	return schemaList, nil
+}
+
+func getAvailableSchemasFromRunner(ctx context.Context) []LauncherSchema {
+	schemaList, err := loadSchemasFromRunner(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to load schemas from runner", "error", err)
+		return []LauncherSchema{}
+	}
 	return schemaList
 }
 
-func getAvailableSchemasFromRunner() []LauncherSchema {
+// loadSchemasFromRunner returns the schemas listed by the runner at SURVEY_RUNNER_SCHEMA_URL
+func loadSchemasFromRunner(ctx context.Context) ([]LauncherSchema, error) {
 
 	schemaList := []LauncherSchema{}
 
 	hostURL := settings.Get("SURVEY_RUNNER_SCHEMA_URL")
 
-	log.Printf("Survey Runner Schema URL: %s", hostURL)
-
-	url := fmt.Sprintf("%s/schemas", hostURL)
-
-	resp, err := clients.GetHTTPClient().Get(url)
-	if err != nil {
-		return []LauncherSchema{}
-	}
-
-	if resp.StatusCode != 200 {
-		return []LauncherSchema{}
-	}
+	logging.FromContext(ctx).Debug("loading schemas from runner", "schema_url", hostURL)
 
-	responseBody, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
+	url, err := clients.JoinURL(hostURL, "schemas")
 	if err != nil {
-		return []LauncherSchema{}
+		return schemaList, fmt.Errorf("invalid SURVEY_RUNNER_SCHEMA_URL: %v", err)
 	}
 
 	var schemaListResponse []string
 
-	if err := json.Unmarshal(responseBody, &schemaListResponse); err != nil {
-		log.Print(err)
-		return []LauncherSchema{}
+	if err := clients.GetJSON(ctx, url, &schemaListResponse); err != nil {
+		return schemaList, err
 	}
 
 	for _, schema := range schemaListResponse {
 		schemaList = append(schemaList, LauncherSchemaFromFilename(schema))
 	}
 
-	return schemaList
+	return schemaList, nil
 }
 
-// FindSurveyByName Finds the schema in the list of available schemas
-func FindSurveyByName(name string) LauncherSchema {
-	availableSchemas := GetAvailableSchemas()
-
-	for _, survey := range availableSchemas.Business {
-		if survey.Name == name {
-			return survey
-		}
+// CheckSources loads the schema lists the launch form is built from, failing when the runner's list can't be loaded or
+// is empty, or the survey register is configured but can't be loaded, as launches would only see a partial list
+func CheckSources(ctx context.Context) error {
+	runnerSchemas, err := loadSchemasFromRunner(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load schemas from runner: %w", err)
 	}
-	for _, survey := range availableSchemas.CCS {
-		if survey.Name == name {
-			return survey
-		}
+	if len(runnerSchemas) == 0 {
+		return errors.New("the runner lists no schemas")
 	}
-	for _, survey := range availableSchemas.Census {
-		if survey.Name == name {
-			return survey
-		}
+
+	if _, err := getAvailableSchemasFromRegister(ctx); err != nil {
+		return fmt.Errorf("failed to load schemas from register: %w", err)
 	}
-	for _, survey := range availableSchemas.Social {
-		if survey.Name == name {
-			return survey
+	return nil
+}
+
+// UnknownSurveyError is returned by FindSurveyByName when no available schema has the name
+type UnknownSurveyError struct {
+	Name string
+}
+
+func (e *UnknownSurveyError) Error() string {
+	return "unknown survey: " + e.Name
+}
+
+// FindSurveyByName Finds the schema in the list of available schemas, returning an *UnknownSurveyError if there
+// isn't one with the name
+func FindSurveyByName(ctx context.Context, name string) (LauncherSchema, error) {
+	availableSchemas := GetAvailableSchemas(ctx)
+
+	for _, group := range [][]LauncherSchema{availableSchemas.Business, availableSchemas.CCS, availableSchemas.Census,
+		availableSchemas.Social, availableSchemas.Test, availableSchemas.Other} {
+		for _, survey := range group {
+			if survey.Name == name {
+				return survey, nil
+			}
 		}
 	}
-	for _, survey := range availableSchemas.Test {
-		if survey.Name == name {
-			return survey
-		}
+
+	return LauncherSchema{}, &UnknownSurveyError{Name: name}
+}
+
+// FindRegisteredSurveyByURL finds the schema in the survey register with the URL, for the details the register holds
+// about it. A register which can't be reached is treated as not having the survey, so quick launches still work.
+func FindRegisteredSurveyByURL(ctx context.Context, url string) (LauncherSchema, bool) {
+	if settings.Get("SURVEY_REGISTER_URL") == "" {
+		return LauncherSchema{}, false
 	}
-	for _, survey := range availableSchemas.Other {
-		if survey.Name == name {
-			return survey
+
+	registerSchemas, err := getAvailableSchemasFromRegister(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to load schemas from register, treating the survey as unregistered", "url", url, "error", err)
+		return LauncherSchema{}, false
+	}
+
+	for _, survey := range registerSchemas {
+		if survey.URL == url {
+			return survey, true
 		}
 	}
-	panic("Survey not found")
+	return LauncherSchema{}, false
 }
@@ -0,0 +1,139 @@
+package surveys
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func registerServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"_embedded": {"schemas": [{"name": "mbs_0106", "_links": {"self": {"href": "http://register/mbs_0106.json"}}}]}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetAvailableSchemasFromRegister(t *testing.T) {
+	withSetting(t, "SURVEY_REGISTER_URL", registerServer(t).URL)
+
+	schemas, err := getAvailableSchemasFromRegister(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(schemas) != 1 || schemas[0].Name != "mbs_0106" || schemas[0].URL != "http://register/mbs_0106.json" {
+		t.Errorf("unexpected schemas %+v", schemas)
+	}
+}
+
+func TestGetAvailableSchemasFromRegisterCancelled(t *testing.T) {
+	withSetting(t, "SURVEY_REGISTER_URL", registerServer(t).URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	schemas, err := getAvailableSchemasFromRegister(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(schemas) != 0 {
+		t.Errorf("expected no schemas, got %+v", schemas)
+	}
+}
+
+func TestGetAvailableSchemasFromRegisterUnreachable(t *testing.T) {
+	server := registerServer(t)
+	withSetting(t, "SURVEY_REGISTER_URL", server.URL)
+	server.Close()
+
+	if _, err := getAvailableSchemasFromRegister(context.Background()); err == nil {
+		t.Error("expected an error for an unreachable register")
+	}
+}
+
+func TestFindRegisteredSurveyByURL(t *testing.T) {
+	server := registerServer(t)
+	withSetting(t, "SURVEY_REGISTER_URL", server.URL)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		url        string
+		registered bool
+	}{
+		{"registered", context.Background(), "http://register/mbs_0106.json", true},
+		{"not registered", context.Background(), "http://register/other.json", false},
+		{"cancelled request", cancelled, "http://register/mbs_0106.json", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			survey, registered := FindRegisteredSurveyByURL(test.ctx, test.url)
+			if registered != test.registered {
+				t.Errorf("expected registered %v, got %v", test.registered, registered)
+			}
+			if registered && survey.Name != "mbs_0106" {
+				t.Errorf("unexpected survey %+v", survey)
+			}
+		})
+	}
+}
+
+func TestFindRegisteredSurveyByURLRegisterDown(t *testing.T) {
+	server := registerServer(t)
+	withSetting(t, "SURVEY_REGISTER_URL", server.URL)
+	server.Close()
+
+	if _, registered := FindRegisteredSurveyByURL(context.Background(), "http://register/mbs_0106.json"); registered {
+		t.Error("expected a register which can't be reached to give an unregistered survey")
+	}
+}
+
+func TestCheckSources(t *testing.T) {
+	closedRegister := registerServer(t)
+	closedRegister.Close()
+
+	tests := []struct {
+		name        string
+		schemas     string
+		registerURL string
+		wantError   string
+	}{
+		{"runner schemas", `["test_checkbox"]`, "", ""},
+		{"runner and register", `["test_checkbox"]`, registerServer(t).URL, ""},
+		{"no runner schemas", `[]`, "", "the runner lists no schemas"},
+		{"invalid runner list", `{}`, "", "failed to load schemas from runner"},
+		{"unreachable register", `["test_checkbox"]`, closedRegister.URL, "failed to load schemas from register"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(test.schemas))
+			}))
+			t.Cleanup(runner.Close)
+			withSetting(t, "SURVEY_RUNNER_SCHEMA_URL", runner.URL)
+			withSetting(t, "SURVEY_REGISTER_URL", test.registerURL)
+
+			err := CheckSources(context.Background())
+			if test.wantError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Errorf("expected %q, got %v", test.wantError, err)
+			}
+		})
+	}
+}
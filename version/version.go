@@ -0,0 +1,48 @@
+// Package version describes the build of the launcher. The values are set at build time with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/ONSdigital/eq-questionnaire-launcher/version.Version=v1.2.3
+//	  -X github.com/ONSdigital/eq-questionnaire-launcher/version.Commit=$(git rev-parse HEAD)
+//	  -X github.com/ONSdigital/eq-questionnaire-launcher/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"runtime"
+)
+
+// Set with -ldflags at build time
+var (
+	Version   = ""
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info is the version and build of the running launcher
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the version and build of the running launcher, with "dev" or "unknown" for values which weren't set
+// at build time
+func Get() Info {
+	return Info{
+		Version:   valueOrDefault(Version, "dev"),
+		Commit:    valueOrDefault(Commit, "unknown"),
+		BuildTime: valueOrDefault(BuildTime, "unknown"),
+		GoVersion: runtime.Version(),
+	}
+}
+
+// UserAgent is the User-Agent header sent on the launcher's requests to other services
+func UserAgent() string {
+	return "eq-questionnaire-launcher/" + Get().Version
+}
+
+func valueOrDefault(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
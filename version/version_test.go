@@ -0,0 +1,32 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name                                   string
+		version, commit, buildTime             string
+		wantVersion, wantCommit, wantBuildTime string
+	}{
+		{"without ldflags", "", "", "", "dev", "unknown", "unknown"},
+		{"with ldflags", "v1.2.3", "abc123", "2017-05-01T09:00:00Z", "v1.2.3", "abc123", "2017-05-01T09:00:00Z"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func(version, commit, buildTime string) { Version, Commit, BuildTime = version, commit, buildTime }(Version, Commit, BuildTime)
+			Version, Commit, BuildTime = test.version, test.commit, test.buildTime
+
+			want := Info{Version: test.wantVersion, Commit: test.wantCommit, BuildTime: test.wantBuildTime, GoVersion: runtime.Version()}
+			if got := Get(); got != want {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+			if userAgent := UserAgent(); userAgent != "eq-questionnaire-launcher/"+test.wantVersion {
+				t.Errorf("expected the version in the User-Agent, got %s", userAgent)
+			}
+		})
+	}
+}
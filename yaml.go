@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlContentTypes are the Content-Types of token requests written as YAML, such as test fixtures
+var yamlContentTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+}
+
+// decodeTokenRequest reads the request body as JSON, or as YAML when the Content-Type says so. YAML is converted to
+// JSON first, so its booleans and numbers reach claimValues as they would from JSON.
+func decodeTokenRequest(r *http.Request, request interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !yamlContentTypes[mediaType] {
+		if err := decodeJSON(r.Body, request); err != nil {
+			return fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return nil
+	}
+
+	// The body is read before parsing so that one over the size limit is reported as too large rather than invalid
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	body, err = yamlToJSON(body)
+	if err != nil {
+		return fmt.Errorf("invalid YAML body: %w", err)
+	}
+	if err := decodeJSON(bytes.NewReader(body), request); err != nil {
+		return fmt.Errorf("invalid YAML body: %w", err)
+	}
+	return nil
+}
+
+func decodeJSON(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// yamlToJSON reads a YAML document as JSON. Timestamps such as 2016-05-01 stay as the strings they were written as.
+func yamlToJSON(body []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(body, &node); err != nil {
+		return nil, err
+	}
+	timestampsAsStrings(&node)
+
+	var document interface{}
+	if err := node.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	// Mappings with keys which aren't all strings can't be written as JSON, and are reported by json.Marshal
+	return json.Marshal(document)
+}
+
+func timestampsAsStrings(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!timestamp" {
+		node.Tag = "!!str"
+	}
+	for _, child := range node.Content {
+		timestampsAsStrings(child)
+	}
+}
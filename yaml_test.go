@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr bool
+	}{
+		{"bool", "flag: true", `{"flag":true}`, false},
+		{"int", "count: 3", `{"count":3}`, false},
+		{"float", "ratio: 0.5", `{"ratio":0.5}`, false},
+		{"quoted number", `ru_ref: "012"`, `{"ru_ref":"012"}`, false},
+		{"timestamp", "ref_p_start_date: 2016-05-01", `{"ref_p_start_date":"2016-05-01"}`, false},
+		{"list", "roles: [dumper, flusher]", `{"roles":["dumper","flusher"]}`, false},
+		{"nested", "survey_metadata:\n  data:\n    qid: 1", `{"survey_metadata":{"data":{"qid":1}}}`, false},
+		{"invalid", "claims: [", "", true},
+		{"non-string key", "{[a]: b}", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := yamlToJSON([]byte(test.yaml))
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestPostTokenAPIYAML(t *testing.T) {
+	runner := useRunner(t)
+
+	body := `
+schema_name: test_launch
+claims:
+  ru_ref: "12346789012A"
+  period_id: "201605"
+  ref_p_start_date: 2016-05-01
+  roles: [dumper, flusher]
+  flag: true
+  count: 3
+options:
+  encrypt: true
+`
+	tests := []struct {
+		name        string
+		contentType string
+	}{
+		{"application/yaml", "application/yaml"},
+		{"application/x-yaml", "application/x-yaml"},
+		{"text/yaml with charset", "text/yaml; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/token", strings.NewReader(body))
+			req.Header.Set("Content-Type", test.contentType)
+			recorder := route(t, req)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body)
+			}
+
+			var response launchResponse
+			decodeResponse(t, recorder, &response)
+			claims, err := runner.Claims(response.Token)
+			if err != nil {
+				t.Fatalf("the runner couldn't read the token: %v", err)
+			}
+
+			// As with JSON requests, claims reach the token through the launch form's values
+			want := map[string]interface{}{
+				"ru_ref":           "12346789012A",
+				"period_id":        "201605",
+				"ref_p_start_date": "2016-05-01",
+				"roles":            []interface{}{"dumper", "flusher"},
+				"flag":             "true",
+				"count":            "3",
+			}
+			for name, value := range want {
+				if got := claims[name]; !reflect.DeepEqual(got, value) {
+					t.Errorf("expected %s to be %#v, got %#v", name, value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPostTokenAPIInvalidYAML(t *testing.T) {
+	useRunner(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/token", strings.NewReader("schema_name: [test_launch"))
+	req.Header.Set("Content-Type", "application/yaml")
+	recorder := route(t, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), "invalid YAML body") {
+		t.Errorf("expected the YAML error in the response, got %s", recorder.Body)
+	}
+}